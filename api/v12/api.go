@@ -0,0 +1,57 @@
+// This package defines the types for Flux API version 12.
+package v12
+
+import (
+	"context"
+	"time"
+
+	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/drift"
+	"github.com/weaveworks/flux/freeze"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/update"
+)
+
+// SyncPlan says what syncing the given revision of the repo would do
+// to the cluster.
+type SyncPlan struct {
+	Revision  string
+	Resources cluster.SyncPlan
+}
+
+// DriftReport says how the resources in the cluster differ from their
+// definitions at the given (last synced) revision of the repo.
+type DriftReport struct {
+	Revision  string
+	Resources drift.Report
+}
+
+// PendingRelease is an automated release of a workload with an
+// approval policy, which is waiting to be approved. Approving it runs
+// the release as the job with the given ID.
+type PendingRelease struct {
+	ID       job.ID
+	Spec     update.Spec
+	Result   update.Result
+	Approval string
+	// The branch the release has been pushed to, if the approval
+	// policy says to do so
+	Branch  string `json:",omitempty"`
+	Created time.Time
+}
+
+type Server interface {
+	v11.Server
+
+	SyncPlan(ctx context.Context) (SyncPlan, error)
+	DriftReport(ctx context.Context) (DriftReport, error)
+	ListPendingReleases(ctx context.Context) ([]PendingRelease, error)
+	ApproveRelease(ctx context.Context, id job.ID, cause update.Cause) (job.ID, error)
+	ListFreezes(ctx context.Context) ([]freeze.Freeze, error)
+	SetFreeze(ctx context.Context, f freeze.Freeze) error
+}
+
+type Upstream interface {
+	v11.Upstream
+}
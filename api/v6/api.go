@@ -56,6 +56,17 @@ type GitConfig struct {
 	Remote       GitRemoteConfig   `json:"remote"`
 	PublicSSHKey ssh.PublicKey     `json:"publicSSHKey"`
 	Status       git.GitRepoStatus `json:"status"`
+	// Additional repos that are synced to the cluster (but not
+	// otherwise written to); see `--git-source`
+	Sources []GitSourceConfig `json:"sources,omitempty"`
+}
+
+type GitSourceConfig struct {
+	Name         string            `json:"name"`
+	Remote       GitRemoteConfig   `json:"remote"`
+	Namespaces   []string          `json:"namespaces,omitempty"`
+	Status       git.GitRepoStatus `json:"status"`
+	SyncRevision string            `json:"syncRevision,omitempty"`
 }
 
 type Deprecated interface {
@@ -24,6 +24,10 @@ type Container struct {
 	// Filtered available images (matching tag filters)
 	FilteredImagesCount    int `json:",omitempty"`
 	NewFilteredImagesCount int `json:",omitempty"`
+
+	// Whether this is an init container; this is reported
+	// regardless of the fields asked for.
+	Init bool `json:",omitempty"`
 }
 
 // NewContainer creates a Container given a list of images and the current image
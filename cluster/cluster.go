@@ -28,7 +28,18 @@ type Cluster interface {
 	SomeControllers([]flux.ResourceID) ([]Controller, error)
 	Ping() error
 	Export() ([]byte, error)
-	Sync(SyncDef) error
+	// ExportSynced gives the definitions of all resources in the
+	// cluster that were marked as belonging to the source given, when
+	// last synced.
+	ExportSynced(source string) ([]byte, error)
+	// Sync applies the actions in the SyncDef, and reports what
+	// happened to each resource. Resources that couldn't be synced
+	// are returned in a SyncError, along with the result for the
+	// others.
+	Sync(SyncDef) (SyncResult, error)
+	// PlanSync works out what Sync would do with the SyncDef given,
+	// without changing anything in the cluster.
+	PlanSync(SyncDef) (SyncPlan, error)
 	PublicSSHKey(regenerate bool) (ssh.PublicKey, error)
 }
 
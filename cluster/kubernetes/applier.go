@@ -0,0 +1,357 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/restmapper"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+)
+
+// DynamicApplier is an Applier that talks to the API server directly,
+// using the dynamic client, rather than running kubectl. It follows
+// the same rules as `kubectl apply`: the definition applied is
+// recorded in an annotation, and used to calculate a three-way merge
+// with the live object the next time around.
+type DynamicApplier struct {
+	client dynamic.Interface
+	mapper *restmapper.DeferredDiscoveryRESTMapper
+}
+
+func NewDynamicApplier(discoveryClient discovery.DiscoveryInterface, client dynamic.Interface) *DynamicApplier {
+	return &DynamicApplier{
+		client: client,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(cached.NewMemCacheClient(discoveryClient)),
+	}
+}
+
+// applyOp is what it would take to apply a particular object; it is
+// calculated before doing anything, so the same calculation can be
+// used for planning.
+type applyOp struct {
+	client    dynamic.ResourceInterface
+	obj       *unstructured.Unstructured
+	exists    bool
+	patch     []byte
+	patchType types.PatchType
+}
+
+// Each object is dealt with individually, so (unlike with kubectl)
+// there's no need to treat objects that errored last time specially.
+func (c *DynamicApplier) apply(logger log.Logger, cs changeSet, _ map[flux.ResourceID]error) (result cluster.SyncResult, errs cluster.SyncError) {
+	result = cluster.SyncResult{}
+	for _, obj := range deleteOrder(cs.objs["delete"]) {
+		begin := time.Now()
+		err := c.delete(obj)
+		logger.Log("cmd", "delete", "resource", obj.ResourceID(), "took", time.Since(begin), "err", err)
+		if err != nil {
+			errs = append(errs, cluster.ResourceError{obj.Resource, err})
+			continue
+		}
+		result[obj.ResourceID()] = cluster.SyncDeleted
+	}
+
+	stages, orderErrs := applyStages(cs.objs["apply"])
+	errs = append(errs, orderErrs...)
+	for i, stage := range stages {
+		for _, obj := range stage {
+			begin := time.Now()
+			op, err := c.prepareApply(obj)
+			if err == nil {
+				err = op.do()
+			}
+			logger.Log("cmd", "apply", "resource", obj.ResourceID(), "took", time.Since(begin), "err", err)
+			if err != nil {
+				errs = append(errs, cluster.ResourceError{obj.Resource, err})
+				continue
+			}
+			result[obj.ResourceID()] = op.outcome()
+		}
+		if crds := crdsIn(stage); len(crds) > 0 && i < len(stages)-1 {
+			for _, crd := range crds {
+				err := c.waitEstablished(crd.Metadata.Name, crdEstablishedTimeout)
+				logger.Log("cmd", "wait", "resource", crd.ResourceID(), "err", err)
+			}
+		}
+	}
+	return result, errs
+}
+
+func (c *DynamicApplier) plan(logger log.Logger, cs changeSet) cluster.SyncPlan {
+	var plan cluster.SyncPlan
+
+	for _, obj := range deleteOrder(cs.objs["delete"]) {
+		plan = append(plan, cluster.ResourcePlan{
+			ID:     obj.ResourceID(),
+			Source: obj.Source(),
+			Action: cluster.PlanDelete,
+		})
+	}
+
+	stages, errs := applyStages(cs.objs["apply"])
+	for _, stage := range stages {
+		for _, obj := range stage {
+			p := cluster.ResourcePlan{
+				ID:     obj.ResourceID(),
+				Source: obj.Source(),
+			}
+			op, err := c.prepareApply(obj)
+			switch {
+			case err != nil:
+				logger.Log("resource", obj.ResourceID(), "err", err)
+				p.Error = err.Error()
+			case !op.exists:
+				p.Action = cluster.PlanCreate
+			case op.patch == nil:
+				p.Action = cluster.PlanUnchanged
+			default:
+				p.Action = cluster.PlanUpdate
+			}
+			plan = append(plan, p)
+		}
+	}
+	return append(plan, errorPlan(errs)...)
+}
+
+var crdResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1beta1",
+	Resource: "customresourcedefinitions",
+}
+
+// waitEstablished waits until the named custom resource definition
+// has the condition `Established`, meaning its custom resources are
+// being served.
+func (c *DynamicApplier) waitEstablished(name string, timeout time.Duration) error {
+	return wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		crd, err := c.client.Resource(crdResource).Get(name, meta_v1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+		for _, c := range conditions {
+			c, ok := c.(map[string]interface{})
+			if ok && c["type"] == "Established" && c["status"] == "True" {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+func (c *DynamicApplier) delete(obj *apiObject) error {
+	u, err := toUnstructured(obj.Bytes())
+	if err != nil {
+		return err
+	}
+	client, err := c.resourceClient(u)
+	if err != nil {
+		return err
+	}
+	propagation := meta_v1.DeletePropagationBackground
+	err = client.Delete(u.GetName(), &meta_v1.DeleteOptions{PropagationPolicy: &propagation})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// prepareApply works out how to apply the object: either by creating
+// it, or by patching the existing object.
+func (c *DynamicApplier) prepareApply(obj *apiObject) (*applyOp, error) {
+	u, err := toUnstructured(obj.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	client, err := c.resourceClient(u)
+	if err != nil {
+		return nil, err
+	}
+
+	// What would be recorded as the last applied configuration is
+	// the definition itself.
+	lastApplied, err := u.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	annotations := u.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[lastAppliedAnnotation] = string(lastApplied)
+	u.SetAnnotations(annotations)
+
+	op := &applyOp{client: client, obj: u}
+	current, err := client.Get(u.GetName(), meta_v1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return op, nil
+	case err != nil:
+		return nil, err
+	}
+	op.exists = true
+
+	modified, err := u.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	currentBytes, err := current.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	original := []byte(current.GetAnnotations()[lastAppliedAnnotation])
+
+	var patch []byte
+	// Types known to the client get a strategic merge patch, like
+	// with kubectl; others (e.g., custom resources) get a JSON merge
+	// patch.
+	if versioned, err := scheme.Scheme.New(u.GroupVersionKind()); err == nil {
+		lookupPatchMeta, err := strategicpatch.NewPatchMetaFromStruct(versioned)
+		if err != nil {
+			return nil, err
+		}
+		patch, err = strategicpatch.CreateThreeWayMergePatch(original, modified, currentBytes, lookupPatchMeta, true)
+		if err != nil {
+			return nil, errors.Wrap(err, "calculating patch")
+		}
+		op.patchType = types.StrategicMergePatchType
+	} else {
+		patch, err = createThreeWayJSONMergePatch(original, modified, currentBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "calculating patch")
+		}
+		op.patchType = types.MergePatchType
+	}
+	if string(patch) != "{}" {
+		op.patch = patch
+	}
+	return op, nil
+}
+
+// outcome says what doing the operation does to the object.
+func (op *applyOp) outcome() cluster.SyncOutcome {
+	switch {
+	case !op.exists:
+		return cluster.SyncCreated
+	case op.patch == nil:
+		return cluster.SyncUnchanged
+	default:
+		return cluster.SyncConfigured
+	}
+}
+
+func (op *applyOp) do() error {
+	var err error
+	switch {
+	case !op.exists:
+		_, err = op.client.Create(op.obj)
+	case op.patch != nil:
+		_, err = op.client.Patch(op.obj.GetName(), op.patchType, op.patch)
+	}
+	return err
+}
+
+// resourceClient gives a client for the resource, figuring out the
+// API endpoint using discovery.
+func (c *DynamicApplier) resourceClient(u *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	gvk := u.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) || errors.Cause(err) == cached.ErrCacheEmpty {
+		// The kind may have been defined since we last looked
+		// (e.g., by a CustomResourceDefinition applied earlier), or
+		// we may not have looked yet.
+		c.mapper.Reset()
+		mapping, err = c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "finding API resource for %s", gvk)
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return c.client.Resource(mapping.Resource), nil
+	}
+	ns := u.GetNamespace()
+	if ns == "" {
+		ns = "default"
+		u.SetNamespace(ns)
+	}
+	return c.client.Resource(mapping.Resource).Namespace(ns), nil
+}
+
+func toUnstructured(def []byte) (*unstructured.Unstructured, error) {
+	jsonBytes, err := k8syaml.YAMLToJSON(def)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing definition")
+	}
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(jsonBytes); err != nil {
+		return nil, errors.Wrap(err, "parsing definition")
+	}
+	return u, nil
+}
+
+// createThreeWayJSONMergePatch calculates a JSON merge patch (RFC
+// 7386) which will take the current object to the modified one,
+// removing any fields that were in the original definition but have
+// been removed from the modified definition.
+func createThreeWayJSONMergePatch(original, modified, current []byte) ([]byte, error) {
+	var originalMap, modifiedMap, currentMap map[string]interface{}
+	if len(original) > 0 {
+		if err := json.Unmarshal(original, &originalMap); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(modified, &modifiedMap); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(current, &currentMap); err != nil {
+		return nil, err
+	}
+	return json.Marshal(threeWayMergePatch(originalMap, modifiedMap, currentMap))
+}
+
+func threeWayMergePatch(original, modified, current map[string]interface{}) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for k, modifiedVal := range modified {
+		currentVal, inCurrent := current[k]
+		modifiedMap, modifiedIsMap := modifiedVal.(map[string]interface{})
+		currentMap, currentIsMap := currentVal.(map[string]interface{})
+		if modifiedIsMap && currentIsMap {
+			originalMap, _ := original[k].(map[string]interface{})
+			if sub := threeWayMergePatch(originalMap, modifiedMap, currentMap); len(sub) > 0 {
+				patch[k] = sub
+			}
+			continue
+		}
+		if !inCurrent || !reflect.DeepEqual(modifiedVal, currentVal) {
+			patch[k] = modifiedVal
+		}
+	}
+	for k := range original {
+		if _, ok := modified[k]; ok {
+			continue
+		}
+		if _, ok := current[k]; ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
@@ -0,0 +1,146 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	k8s_testing "k8s.io/client-go/testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+)
+
+func setupDynamicApplier() (*DynamicApplier, *fakedynamic.FakeDynamicClient) {
+	disco := &fakediscovery.FakeDiscovery{Fake: &k8s_testing.Fake{}}
+	disco.Resources = []*meta_v1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: meta_v1.Verbs{"create", "get", "list", "patch", "delete"}},
+				{Name: "namespaces", Kind: "Namespace", Namespaced: false, Verbs: meta_v1.Verbs{"create", "get", "list", "patch", "delete"}},
+			},
+		},
+	}
+	client := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	return NewDynamicApplier(disco, client), client
+}
+
+func stagedObj(t *testing.T, id, def string) *apiObject {
+	obj, err := parseObj([]byte(def))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.Resource = rsc{id, []byte(def)}
+	return obj
+}
+
+const testConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+  namespace: bar
+data:
+  key: value
+`
+
+func TestDynamicApplierCreate(t *testing.T) {
+	applier, client := setupDynamicApplier()
+	cs := makeChangeSet()
+	cs.stage("apply", stagedObj(t, "bar:configmap/foo", testConfigMap))
+
+	plan := applier.plan(log.NewNopLogger(), cs)
+	if len(plan) != 1 || plan[0].Action != cluster.PlanCreate {
+		t.Fatalf("expected plan to create the configmap, got %#v", plan)
+	}
+
+	result, errs := applier.apply(log.NewNopLogger(), cs, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	id := flux.MustParseResourceID("bar:configmap/foo")
+	if result[id] != cluster.SyncCreated {
+		t.Errorf("expected configmap to be reported as created, got %#v", result)
+	}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	obj, err := client.Resource(gvr).Namespace("bar").Get("foo", meta_v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := obj.GetAnnotations()[lastAppliedAnnotation]; !ok {
+		t.Error("expected created object to record the last applied configuration")
+	}
+
+	plan = applier.plan(log.NewNopLogger(), cs)
+	if len(plan) != 1 || plan[0].Action != cluster.PlanUnchanged {
+		t.Errorf("expected applying again to leave the configmap unchanged, got %#v", plan)
+	}
+	result, errs = applier.apply(log.NewNopLogger(), cs, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if result[id] != cluster.SyncUnchanged {
+		t.Errorf("expected configmap to be reported as unchanged, got %#v", result)
+	}
+
+	cs = makeChangeSet()
+	cs.stage("delete", stagedObj(t, "bar:configmap/foo", testConfigMap))
+	result, errs = applier.apply(log.NewNopLogger(), cs, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if result[id] != cluster.SyncDeleted {
+		t.Errorf("expected configmap to be reported as deleted, got %#v", result)
+	}
+}
+
+func TestDynamicApplierUnknownKind(t *testing.T) {
+	applier, _ := setupDynamicApplier()
+	cs := makeChangeSet()
+	cs.stage("apply", stagedObj(t, "bar:frobnicator/foo", `apiVersion: example.com/v1
+kind: Frobnicator
+metadata:
+  name: foo
+  namespace: bar
+`))
+	result, errs := applier.apply(log.NewNopLogger(), cs, nil)
+	if len(result) > 0 {
+		t.Errorf("expected no outcomes, got %#v", result)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %#v", errs)
+	}
+	if errs[0].ResourceID().String() != "bar:frobnicator/foo" {
+		t.Errorf("expected error for bar:frobnicator/foo, got %s", errs[0].ResourceID())
+	}
+}
+
+func TestThreeWayJSONMergePatch(t *testing.T) {
+	original := `{"spec":{"a":1,"b":2}}`
+	modified := `{"spec":{"a":1,"c":3}}`
+	current := `{"spec":{"a":5,"b":2,"d":4},"status":{}}`
+	patch, err := createThreeWayJSONMergePatch([]byte(original), []byte(modified), []byte(current))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(patch, &got); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"a": 1.0, // changed in the cluster, so reset
+			"b": nil, // removed from the definition
+			"c": 3.0, // added to the definition
+		},
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected %#v, got %#v", expected, got)
+	}
+}
@@ -28,7 +28,12 @@ is a new kind of resource in Kubernetes, and Flux does not support it
 yet.
 
 If you can use a Deployment instead, Flux can work with
-those. Otherwise, you may have to update the resource manually (e.g.,
+those. If the resource refers to an image in some other field, you
+can mark the field with an annotation
+
+    flux.weave.works/image.<name>: <JSONPath to the field>
+
+Otherwise, you may have to update the resource manually (e.g.,
 using kubectl).
 `,
 	}
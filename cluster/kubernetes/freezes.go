@@ -0,0 +1,71 @@
+package kubernetes
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/weaveworks/flux/freeze"
+)
+
+// The key in the config map under which the freezes are kept
+const freezesKey = "freezes"
+
+// FreezeStore keeps ad-hoc freezes in a config map, as JSON, so that
+// they stay in force if fluxd restarts. The config map is created
+// when a freeze is first saved.
+type FreezeStore struct {
+	ConfigMapAPI v1.ConfigMapInterface
+	Name         string
+}
+
+var _ freeze.Store = &FreezeStore{}
+
+func (s *FreezeStore) Load() ([]freeze.Freeze, error) {
+	cm, err := s.ConfigMapAPI.Get(s.Name, meta_v1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting config map %s", s.Name)
+	}
+	data, ok := cm.Data[freezesKey]
+	if !ok {
+		return nil, nil
+	}
+	var freezes []freeze.Freeze
+	if err := json.Unmarshal([]byte(data), &freezes); err != nil {
+		return nil, errors.Wrapf(err, "parsing freezes in config map %s", s.Name)
+	}
+	return freezes, nil
+}
+
+func (s *FreezeStore) Save(freezes []freeze.Freeze) error {
+	if freezes == nil {
+		freezes = []freeze.Freeze{}
+	}
+	data, err := json.Marshal(freezes)
+	if err != nil {
+		return err
+	}
+	cm, err := s.ConfigMapAPI.Get(s.Name, meta_v1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		cm = &apiv1.ConfigMap{
+			ObjectMeta: meta_v1.ObjectMeta{Name: s.Name},
+			Data:       map[string]string{freezesKey: string(data)},
+		}
+		_, err = s.ConfigMapAPI.Create(cm)
+	case err == nil:
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[freezesKey] = string(data)
+		_, err = s.ConfigMapAPI.Update(cm)
+	}
+	return errors.Wrapf(err, "saving freezes in config map %s", s.Name)
+}
@@ -0,0 +1,34 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/weaveworks/flux/freeze"
+)
+
+func TestFreezeStore(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	store := &FreezeStore{ConfigMapAPI: client.CoreV1().ConfigMaps("flux"), Name: "flux-freezes"}
+
+	// Nothing saved yet
+	freezes, err := store.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, freezes)
+
+	until := time.Date(2018, 12, 27, 9, 0, 0, 0, time.UTC)
+	saved := []freeze.Freeze{{Namespace: "production", Until: until, User: "Jane", Reason: "holidays"}}
+	assert.NoError(t, store.Save(saved))
+	freezes, err = store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, saved, freezes)
+
+	// Saving again updates the config map
+	assert.NoError(t, store.Save(nil))
+	freezes, err = store.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, freezes)
+}
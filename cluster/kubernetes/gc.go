@@ -0,0 +1,176 @@
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+
+	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/resource"
+)
+
+// gcMarkLabel is the label put on each resource applied during a
+// sync, so that it can be identified as having come from a
+// particular sync source. Only resources bearing the mark are ever
+// considered for garbage collection.
+const gcMarkLabel = kresource.PolicyPrefix + "sync-gc-mark"
+
+// makeGCMark gives the value of the mark label for a resource synced
+// from the source given. Label values are limited in length and
+// alphabet, so it's a hash rather than the source itself. The
+// resource ID is included, so that copying the labels from one
+// resource to another (as might happen with `kubectl get -o yaml`)
+// does not make the copy a candidate for deletion.
+func makeGCMark(source, id string) string {
+	sum := sha256.Sum224([]byte(source + "\n" + id))
+	return hex.EncodeToString(sum[:])
+}
+
+// markedResource is a resource.Resource with its definition replaced
+// by one carrying the GC mark.
+type markedResource struct {
+	resource.Resource
+	bytes []byte
+}
+
+func (r markedResource) Bytes() []byte {
+	return r.bytes
+}
+
+// markResource returns the resource with the GC mark for the source
+// given added to its labels.
+func markResource(res resource.Resource, source string) (resource.Resource, error) {
+	def := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(res.Bytes(), &def); err != nil {
+		return nil, errors.Wrapf(err, "parsing definition from %s", res.Source())
+	}
+
+	meta, ok := def["metadata"].(map[interface{}]interface{})
+	if !ok {
+		if def["metadata"] != nil {
+			return nil, errors.Errorf("unexpected metadata in definition from %s", res.Source())
+		}
+		meta = map[interface{}]interface{}{}
+		def["metadata"] = meta
+	}
+	labels, ok := meta["labels"].(map[interface{}]interface{})
+	if !ok {
+		if meta["labels"] != nil {
+			return nil, errors.Errorf("unexpected labels in definition from %s", res.Source())
+		}
+		labels = map[interface{}]interface{}{}
+		meta["labels"] = labels
+	}
+	labels[gcMarkLabel] = makeGCMark(source, res.ResourceID().String())
+
+	bytes, err := yaml.Marshal(def)
+	if err != nil {
+		return nil, errors.Wrapf(err, "serialising definition from %s", res.Source())
+	}
+	return markedResource{res, bytes}, nil
+}
+
+// ExportSynced exports all resources, of any kind, that carry the GC
+// mark for the given source. Resources outside the namespace
+// whitelist, and add-ons, are never included.
+func (c *Cluster) ExportSynced(source string) ([]byte, error) {
+	// Partial results are OK; e.g., an aggregated API may be
+	// unavailable, in which case we won't see its resources, but
+	// can't have synced them either.
+	resourceLists, err := c.client.coreClient.Discovery().ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, errors.Wrap(err, "discovering API resources")
+	}
+
+	var namespaces []string
+	if len(c.nsWhitelist) > 0 {
+		nsList, err := c.getAllowedNamespaces()
+		if err != nil {
+			return nil, errors.Wrap(err, "getting namespaces")
+		}
+		for _, ns := range nsList {
+			namespaces = append(namespaces, ns.Name)
+		}
+	} else {
+		namespaces = []string{meta_v1.NamespaceAll}
+	}
+
+	var config bytes.Buffer
+	seen := map[string]bool{}
+	for _, list := range resourceLists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, apiResource := range list.APIResources {
+			// Subresources can't be deleted independently
+			if strings.Contains(apiResource.Name, "/") || !hasVerbs(apiResource.Verbs, "list", "delete") {
+				continue
+			}
+			resourceClient := c.client.dynamicClient.Resource(gv.WithResource(apiResource.Name))
+			scope := []string{meta_v1.NamespaceAll}
+			if apiResource.Namespaced {
+				scope = namespaces
+			}
+			for _, ns := range scope {
+				objs, err := resourceClient.Namespace(ns).List(meta_v1.ListOptions{LabelSelector: gcMarkLabel})
+				if err != nil {
+					if apierrors.IsForbidden(err) || apierrors.IsNotFound(err) || apierrors.IsMethodNotSupported(err) {
+						continue
+					}
+					return nil, errors.Wrapf(err, "listing %s", apiResource.Name)
+				}
+				for i := range objs.Items {
+					obj := &objs.Items[i]
+					if isAddon(obj) {
+						continue
+					}
+					objNS := obj.GetNamespace()
+					if objNS == "" {
+						objNS = "default"
+					}
+					id := flux.MakeResourceID(objNS, obj.GetKind(), obj.GetName()).String()
+					// The same resource may be served under more than
+					// one group (e.g., extensions and apps)
+					if seen[id] || obj.GetLabels()[gcMarkLabel] != makeGCMark(source, id) {
+						continue
+					}
+					seen[id] = true
+					yamlBytes, err := k8syaml.Marshal(obj.Object)
+					if err != nil {
+						return nil, errors.Wrapf(err, "marshalling %s to YAML", id)
+					}
+					config.WriteString("---\n")
+					config.Write(yamlBytes)
+				}
+			}
+		}
+	}
+	return config.Bytes(), nil
+}
+
+func hasVerbs(verbs meta_v1.Verbs, want ...string) bool {
+	for _, w := range want {
+		found := false
+		for _, v := range verbs {
+			if v == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package kubernetes
+
+import (
+	"regexp"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestMarkResource(t *testing.T) {
+	for _, def := range []string{
+		`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+  namespace: bar
+`,
+		`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+  namespace: bar
+  labels:
+    app: foo
+`,
+	} {
+		res := rsc{"bar:configmap/foo", []byte(def)}
+		marked, err := markResource(res, "source")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if marked.ResourceID() != res.ResourceID() {
+			t.Errorf("expected marked resource to have ID %s, got %s", res.ResourceID(), marked.ResourceID())
+		}
+
+		var obj struct {
+			Metadata struct {
+				Name   string            `yaml:"name"`
+				Labels map[string]string `yaml:"labels"`
+			} `yaml:"metadata"`
+		}
+		if err := yaml.Unmarshal(marked.Bytes(), &obj); err != nil {
+			t.Fatal(err)
+		}
+		if obj.Metadata.Name != "foo" {
+			t.Errorf("expected name to be preserved, got %q", obj.Metadata.Name)
+		}
+		if got, want := obj.Metadata.Labels[gcMarkLabel], makeGCMark("source", "bar:configmap/foo"); got != want {
+			t.Errorf("expected mark %q, got %q", want, got)
+		}
+	}
+}
+
+func TestGCMarkIsLabelValue(t *testing.T) {
+	// See https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#syntax-and-character-set
+	valid := regexp.MustCompile(`^[a-z0-9A-Z]([-_.a-z0-9A-Z]{0,61}[a-z0-9A-Z])?$`)
+	mark := makeGCMark("git@github.com:weaveworks/flux-example#master:", "default:deployment/helloworld")
+	if !valid.MatchString(mark) {
+		t.Errorf("mark %q is not a valid label value", mark)
+	}
+	if mark == makeGCMark("git@github.com:weaveworks/flux-example#master:", "default:deployment/other") {
+		t.Error("expected marks for different resources to differ")
+	}
+}
@@ -0,0 +1,311 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// A directory with a config file in it (see
+// `kresource.ConfigFilename`) has its manifests generated by running
+// commands, rather than read from files. The config file looks like
+// this:
+//
+//	version: 1
+//	generators:
+//	- command: kustomize build .
+//	updaters:
+//	- containerImage:
+//	    command: ./set-image.sh
+//	  policy:
+//	    command: ./set-policy.sh
+//
+// Generators are run in the directory and are expected to print YAML
+// manifests. Since generated manifests can't be edited in place,
+// updaters are run to make changes to the files the manifests are
+// generated from. The changes are described to updaters using
+// environment variables:
+//
+//  - $FLUX_WORKLOAD is the ID of the resource being updated, e.g.,
+//    `default:deployment/helloworld`;
+//  - for containerImage updaters, $FLUX_CONTAINER is the name of the
+//    container, and $FLUX_IMG and $FLUX_TAG give the new image;
+//  - for policy updaters, $FLUX_POLICY is the name of the policy
+//    (e.g., `automated`, or `tag.helloworld`) and $FLUX_POLICY_VALUE
+//    its value, which is empty if the policy is to be removed.
+
+// How long to let a generator or updater command run, before giving
+// up on it.
+const generatorTimeout = time.Minute
+
+type configFile struct {
+	Version    int                `yaml:"version"`
+	Generators []generatorCommand `yaml:"generators"`
+	Updaters   []updater          `yaml:"updaters"`
+}
+
+type generatorCommand struct {
+	Command string `yaml:"command"`
+}
+
+type updater struct {
+	ContainerImage generatorCommand `yaml:"containerImage"`
+	Policy         generatorCommand `yaml:"policy"`
+}
+
+func readConfigFile(dir string) (*configFile, error) {
+	path := filepath.Join(dir, kresource.ConfigFilename)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config configFile
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", path)
+	}
+	if config.Version != 1 {
+		return nil, fmt.Errorf("%s: unsupported version %d; expected version: 1", path, config.Version)
+	}
+	if len(config.Generators) == 0 {
+		return nil, fmt.Errorf("%s: no generators given", path)
+	}
+	return &config, nil
+}
+
+func hasConfigFile(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, kresource.ConfigFilename))
+	return err == nil
+}
+
+// findConfigDirs looks for the directories among (and under) the
+// paths given that have their manifests generated. A path inside such
+// a directory is treated as though the directory itself were given,
+// since the manifests can only be generated as a whole.
+func findConfigDirs(base string, paths []string) ([]string, error) {
+	var dirs []string
+	seen := map[string]bool{}
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, root := range paths {
+		root = filepath.Clean(root)
+		if dir, ok := configAncestor(base, root); ok {
+			add(dir)
+			continue
+		}
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return errors.Wrapf(err, "walking %q for %s files", path, kresource.ConfigFilename)
+			}
+			if info.IsDir() && hasConfigFile(path) {
+				add(path)
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+// configAncestor finds the nearest directory above the path given,
+// and not above base, that has a config file.
+func configAncestor(base, path string) (string, bool) {
+	base = filepath.Clean(base)
+	for dir := filepath.Dir(path); dir == base || strings.HasPrefix(dir, base+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if hasConfigFile(dir) {
+			return dir, true
+		}
+		if dir == base {
+			break
+		}
+	}
+	return "", false
+}
+
+// loadWithGenerators loads the manifests under the paths given,
+// running the generators in any directory that has a config file and
+// reading files everywhere else.
+func loadWithGenerators(base string, paths []string) (map[string]resource.Resource, error) {
+	dirs, err := findConfigDirs(base, paths)
+	if err != nil {
+		return nil, err
+	}
+	var plainPaths []string
+	for _, path := range paths {
+		if _, ok := configAncestor(base, filepath.Clean(path)); !ok {
+			plainPaths = append(plainPaths, path)
+		}
+	}
+	objs, err := kresource.LoadExcluding(base, plainPaths, dirs)
+	if err != nil {
+		return objs, err
+	}
+
+	for _, dir := range dirs {
+		generated, err := generate(base, dir)
+		if err != nil {
+			return objs, err
+		}
+		for id, obj := range generated {
+			if alreadyDefined, ok := objs[id]; ok {
+				return objs, fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, alreadyDefined.Source(), obj.Source())
+			}
+			objs[id] = obj
+		}
+	}
+	return objs, nil
+}
+
+// generate runs the generators given in the config file in dir,
+// giving the resources they output. These have the config file as
+// their source.
+func generate(base, dir string) (map[string]resource.Resource, error) {
+	config, err := readConfigFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	source, err := filepath.Rel(base, filepath.Join(dir, kresource.ConfigFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	objs := map[string]resource.Resource{}
+	for _, g := range config.Generators {
+		out, err := runGeneratorCommand(dir, g.Command)
+		if err != nil {
+			return nil, errors.Wrapf(err, "running generator %q from %s", g.Command, source)
+		}
+		docs, err := kresource.ParseMultidoc(out, source)
+		if err != nil {
+			return nil, err
+		}
+		for id, obj := range docs {
+			if _, ok := objs[id]; ok {
+				return nil, fmt.Errorf(`duplicate definition of '%s' (in output of generators from %s)`, id, source)
+			}
+			objs[id] = obj
+		}
+	}
+	return objs, nil
+}
+
+func runGeneratorCommand(dir, command string, env ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), generatorTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = errOut
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("timed out after %s", generatorTimeout)
+		}
+		if errOut.Len() == 0 {
+			return nil, err
+		}
+		return nil, errors.New(strings.TrimSpace(errOut.String()))
+	}
+	return out.Bytes(), nil
+}
+
+// runUpdaters runs the updater commands picked out by `command` from
+// the config file that generated the resource given. It's an error
+// if there are no such commands, since then the update can't be
+// done.
+func runUpdaters(base string, res resource.Resource, kind string, command func(updater) string, env ...string) error {
+	dir := filepath.Dir(filepath.Join(base, res.Source()))
+	config, err := readConfigFile(dir)
+	if err != nil {
+		return err
+	}
+	env = append(env, "FLUX_WORKLOAD="+res.ResourceID().String())
+
+	var ran bool
+	for _, u := range config.Updaters {
+		c := command(u)
+		if c == "" {
+			continue
+		}
+		if _, err := runGeneratorCommand(dir, c, env...); err != nil {
+			return errors.Wrapf(err, "running %s updater %q from %s", kind, c, res.Source())
+		}
+		ran = true
+	}
+	if !ran {
+		return fmt.Errorf("no %s updaters in %s, so %s cannot be updated", kind, res.Source(), res.ResourceID())
+	}
+	return nil
+}
+
+// Generated is true of resources that came from running generators,
+// rather than from files.
+func (m *Manifests) Generated(res resource.Resource) bool {
+	return filepath.Base(res.Source()) == kresource.ConfigFilename
+}
+
+func (m *Manifests) GeneratedFrom(base, path string) bool {
+	if !m.Generate {
+		return false
+	}
+	_, ok := configAncestor(base, filepath.Clean(path))
+	return ok
+}
+
+func (m *Manifests) SetGeneratedContainerImage(base string, res resource.Resource, container string, ref image.Ref) error {
+	return runUpdaters(base, res, "containerImage", func(u updater) string { return u.ContainerImage.Command },
+		"FLUX_CONTAINER="+container,
+		"FLUX_IMG="+ref.Name.String(),
+		"FLUX_TAG="+ref.Tag)
+}
+
+func (m *Manifests) UpdateGeneratedPolicies(base string, res resource.Resource, update policy.Update) error {
+	add, del, err := resolvePolicies(update, func() ([]resource.Container, error) {
+		workload, ok := res.(resource.Workload)
+		if !ok {
+			return nil, errors.New("resource " + res.ResourceID().String() + " does not have containers")
+		}
+		return workload.Containers(), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	policyCommand := func(u updater) string { return u.Policy.Command }
+	for pol, val := range add {
+		if err := runUpdaters(base, res, "policy", policyCommand, "FLUX_POLICY="+string(pol), "FLUX_POLICY_VALUE="+val); err != nil {
+			return err
+		}
+	}
+	for pol := range del {
+		if err := runUpdaters(base, res, "policy", policyCommand, "FLUX_POLICY="+string(pol), "FLUX_POLICY_VALUE="); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+)
+
+const generatedConfig = `version: 1
+generators:
+- command: cat input.txt
+updaters:
+- containerImage:
+    command: echo "$FLUX_WORKLOAD $FLUX_CONTAINER $FLUX_IMG $FLUX_TAG" >> image-updates
+  policy:
+    command: echo "$FLUX_WORKLOAD $FLUX_POLICY=$FLUX_POLICY_VALUE" >> policy-updates
+`
+
+// The input has a .yaml extension so that it would be loaded as a
+// manifest, were the directory not generated.
+const generatedInput = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: generated
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: quay.io/weaveworks/helloworld:v1
+`
+
+func setupGenerated(t *testing.T) (string, func()) {
+	dir, cleanup := testfiles.TempDir(t)
+	if err := testfiles.WriteTestFiles(dir); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	gendir := filepath.Join(dir, "generated")
+	if err := os.Mkdir(gendir, 0777); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	for file, content := range map[string]string{
+		".flux.yaml":  generatedConfig,
+		"input.txt":   generatedInput,
+		"ignore.yaml": strings.Replace(generatedInput, "name: generated", "name: ignored", 1),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(gendir, file), []byte(content), 0666); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	return dir, cleanup
+}
+
+func TestLoadWithGenerators(t *testing.T) {
+	dir, cleanup := setupGenerated(t)
+	defer cleanup()
+
+	m := &Manifests{Generate: true}
+	resources, err := m.LoadManifests(dir, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generated, ok := resources["default:deployment/generated"]
+	if !ok {
+		t.Fatalf("expected generated resource, got %v", resources)
+	}
+	if generated.Source() != "generated/.flux.yaml" {
+		t.Errorf("expected source of generated resource to be the config file, got %q", generated.Source())
+	}
+	if !m.Generated(generated) {
+		t.Error("expected resource to be reported as generated")
+	}
+	if _, ok := resources["default:deployment/ignored"]; ok {
+		t.Error("did not expect files in generated directory to be loaded")
+	}
+	for id := range testfiles.ResourceMap {
+		res, ok := resources[id.String()]
+		if !ok {
+			t.Errorf("expected plain resource %s to be loaded", id)
+			continue
+		}
+		if m.Generated(res) {
+			t.Errorf("did not expect %s to be reported as generated", id)
+		}
+	}
+
+	// A path inside the generated directory means the whole
+	// directory gets generated.
+	resources, err = m.LoadManifests(dir, []string{filepath.Join(dir, "generated", "input.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 1 {
+		t.Errorf("expected just the generated resource, got %v", resources)
+	}
+
+	// Without generation, the config file is ignored and the
+	// directory loaded as usual.
+	resources, err = (&Manifests{}).LoadManifests(dir, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resources["default:deployment/ignored"]; !ok {
+		t.Error("expected files in directory to be loaded when generation is not enabled")
+	}
+}
+
+func TestGeneratorFailure(t *testing.T) {
+	dir, cleanup := setupGenerated(t)
+	defer cleanup()
+
+	config := strings.Replace(generatedConfig, "cat input.txt", "echo oh no >&2; exit 1", 1)
+	if err := ioutil.WriteFile(filepath.Join(dir, "generated", ".flux.yaml"), []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+	_, err := (&Manifests{Generate: true}).LoadManifests(dir, []string{dir})
+	if err == nil || !strings.Contains(err.Error(), "oh no") {
+		t.Errorf("expected error with output of generator, got %v", err)
+	}
+}
+
+func TestGeneratedUpdates(t *testing.T) {
+	dir, cleanup := setupGenerated(t)
+	defer cleanup()
+
+	m := &Manifests{Generate: true}
+	id := flux.MustParseResourceID("default:deployment/generated")
+	resources, err := m.LoadManifests(dir, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := resources[id.String()]
+
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:v2")
+	if err := m.SetGeneratedContainerImage(dir, res, "app", ref); err != nil {
+		t.Fatal(err)
+	}
+	checkFileContents(t, filepath.Join(dir, "generated", "image-updates"),
+		"default:deployment/generated app quay.io/weaveworks/helloworld v2\n")
+
+	changed, err := cluster.UpdatePolicies(m, dir, []string{dir}, id, policy.Update{
+		Remove: policy.Set{policy.Locked: "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("expected update of generated resource to be reported as a change")
+	}
+	checkFileContents(t, filepath.Join(dir, "generated", "policy-updates"),
+		"default:deployment/generated locked=\n")
+
+	// No updaters means no updates
+	config := generatedConfig[:strings.Index(generatedConfig, "updaters:")]
+	if err := ioutil.WriteFile(filepath.Join(dir, "generated", ".flux.yaml"), []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetGeneratedContainerImage(dir, res, "app", ref); err == nil {
+		t.Error("expected error updating image with no updaters")
+	}
+}
+
+func checkFileContents(t *testing.T, path, expected string) {
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("expected %s to contain %q, got %q", path, expected, string(got))
+	}
+}
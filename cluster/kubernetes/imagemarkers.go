@@ -0,0 +1,179 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+// Any resource can have fields marked as holding images, with
+// annotations (see kresource.ImageMarkerPrefix). The marked images
+// are reported as containers, alongside the real containers of
+// workloads. Resources of other kinds are found by recording which
+// of those applied in a sync have image markers.
+
+// markedImages gives the images marked in the object given, as
+// containers.
+func markedImages(obj k8sObject) ([]resource.Container, error) {
+	markers, err := kresource.ImageMarkers(obj.GetAnnotations())
+	if len(markers) == 0 {
+		return nil, err
+	}
+	var content map[string]interface{}
+	if u, ok := obj.(runtime.Unstructured); ok {
+		content = u.UnstructuredContent()
+	} else {
+		var convErr error
+		if content, convErr = runtime.DefaultUnstructuredConverter.ToUnstructured(obj); convErr != nil {
+			return nil, convErr
+		}
+	}
+
+	var containers []resource.Container
+	for _, marker := range markers {
+		value, _ := marker.Path.Get(content)
+		s, ok := value.(string)
+		if !ok {
+			err = fmt.Errorf("image marker %q does not point to a string", marker.Name)
+			continue
+		}
+		ref, parseErr := image.ParseRef(s)
+		if parseErr != nil {
+			err = parseErr
+			continue
+		}
+		containers = append(containers, resource.Container{Name: marker.Name, Image: ref})
+	}
+	return containers, err
+}
+
+// hasImageMarkers says whether any of the annotations given are
+// image markers.
+func hasImageMarkers(annotations map[string]string) bool {
+	for k := range annotations {
+		if strings.HasPrefix(k, kresource.ImageMarkerPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// setMarkedResources records the resources that were applied in a
+// sync from the source given which have image markers, but aren't of
+// a kind that's otherwise looked at, along with the API version each
+// was applied with.
+func (c *Cluster) setMarkedResources(source string, actions []cluster.SyncAction) {
+	marked := map[flux.ResourceID]string{}
+	for _, action := range actions {
+		if action.Apply == nil {
+			continue
+		}
+		obj, err := parseObj(action.Apply.Bytes())
+		if err != nil || !hasImageMarkers(obj.Metadata.Annotations) {
+			continue
+		}
+		if isWorkloadKind(obj.APIVersion, obj.Kind) {
+			continue
+		}
+		marked[action.Apply.ResourceID()] = obj.APIVersion
+	}
+
+	c.muMarked.Lock()
+	defer c.muMarked.Unlock()
+	if c.marked == nil {
+		c.marked = map[string]map[flux.ResourceID]string{}
+	}
+	c.marked[source] = marked
+}
+
+// markedResources gives the resources with image markers recorded
+// in syncs, in the namespace given, or all namespaces if it's empty.
+func (c *Cluster) markedResources(namespace string) map[flux.ResourceID]string {
+	c.muMarked.RLock()
+	defer c.muMarked.RUnlock()
+	result := map[flux.ResourceID]string{}
+	for _, marked := range c.marked {
+		for id, apiVersion := range marked {
+			if ns, _, _ := id.Components(); namespace == "" || ns == namespace {
+				result[id] = apiVersion
+			}
+		}
+	}
+	return result
+}
+
+// getMarkedController fetches a resource with image markers from the
+// cluster, as a pod controller with no pod template. If the resource
+// is not there, it returns a nil error and false.
+func (c *Cluster) getMarkedController(id flux.ResourceID, apiVersion string) (podController, bool, error) {
+	ns, kind, name := id.Components()
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return podController{}, false, err
+	}
+	resources, err := c.client.coreClient.Discovery().ServerResourcesForGroupVersion(apiVersion)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return podController{}, false, nil
+		}
+		return podController{}, false, err
+	}
+	for _, apiResource := range resources.APIResources {
+		if strings.Contains(apiResource.Name, "/") || !strings.EqualFold(apiResource.Kind, kind) {
+			continue
+		}
+		client := c.client.dynamicClient.Resource(gv.WithResource(apiResource.Name))
+		var obj interface {
+			k8sObject
+			GetName() string
+			GetKind() string
+		}
+		if apiResource.Namespaced {
+			obj, err = client.Namespace(ns).Get(name, meta_v1.GetOptions{})
+		} else {
+			obj, err = client.Get(name, meta_v1.GetOptions{})
+		}
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return podController{}, false, nil
+			}
+			return podController{}, false, err
+		}
+		return podController{
+			k8sObject:  obj,
+			apiVersion: apiVersion,
+			kind:       obj.GetKind(),
+			name:       obj.GetName(),
+			status:     cluster.StatusReady,
+		}, true, nil
+	}
+	return podController{}, false, nil
+}
+
+// markedControllers fetches the resources with image markers
+// recorded in syncs, in the namespace given. Those that can't be
+// fetched are logged and left out.
+func (c *Cluster) markedControllers(namespace string) map[flux.ResourceID]podController {
+	result := map[flux.ResourceID]podController{}
+	for id, apiVersion := range c.markedResources(namespace) {
+		pc, ok, err := c.getMarkedController(id, apiVersion)
+		if err != nil {
+			c.logger.Log("resource", id, "err", err)
+			continue
+		}
+		if ok && !isAddon(pc) {
+			result[id] = pc
+		}
+	}
+	return result
+}
@@ -0,0 +1,137 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	apiapps "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+func TestMarkedImagesInWorkload(t *testing.T) {
+	replicas := int32(1)
+	deployment := &apiapps.Deployment{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "app",
+			Namespace: "default",
+			Annotations: map[string]string{
+				kresource.ImageMarkerPrefix + "runner":  `{.spec.template.spec.containers[?(@.name=="app")].env[?(@.name=="RUNNER_IMAGE")].value}`,
+				kresource.ImageMarkerPrefix + "missing": `{.spec.template.spec.containers[1].image}`,
+			},
+		},
+		Spec: apiapps.DeploymentSpec{
+			Replicas: &replicas,
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{{
+						Name:  "app",
+						Image: "quay.io/example/app:v1",
+						Env:   []apiv1.EnvVar{{Name: "RUNNER_IMAGE", Value: "quay.io/example/runner:v1"}},
+					}},
+				},
+			},
+		},
+	}
+
+	marked, err := markedImages(deployment)
+	assert.Error(t, err, "expected error for marker not pointing at a string")
+	runnerRef, _ := image.ParseRef("quay.io/example/runner:v1")
+	assert.Equal(t, []resource.Container{{Name: "runner", Image: runnerRef}}, marked)
+
+	controller := makeDeploymentPodController(deployment).toClusterController(flux.MustParseResourceID("default:deployment/app"))
+	var names []string
+	for _, c := range controller.ContainersOrNil() {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"app", "runner"}, names)
+}
+
+func TestMarkedResources(t *testing.T) {
+	configMap := &apiv1.ConfigMap{
+		TypeMeta: meta_v1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "runners",
+			Namespace: "default",
+			Annotations: map[string]string{
+				kresource.ImageMarkerPrefix + "runner": "{.data.runner}",
+			},
+		},
+		Data: map[string]string{"runner": "quay.io/example/runner:v1"},
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(configMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientset := fake.NewSimpleClientset()
+	clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*meta_v1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []meta_v1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+			},
+		},
+	}
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), unstructuredObj(obj))
+	c := NewCluster(clientset, nil, dynamicClient, nil, nil, log.NewNopLogger(), nil)
+
+	manifests, err := kresource.ParseMultidoc([]byte(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: runners
+  annotations:
+    flux.weave.works/image.runner: '{.data.runner}'
+data:
+  runner: quay.io/example/runner:v1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unmarked
+data:
+  foo: bar
+`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []cluster.SyncAction
+	for _, res := range manifests {
+		actions = append(actions, cluster.SyncAction{Apply: res})
+	}
+
+	id := flux.MustParseResourceID("default:configmap/runners")
+	// Until it has been synced, it's not known to have images
+	controllers, err := c.SomeControllers([]flux.ResourceID{id})
+	assert.NoError(t, err)
+	assert.Len(t, controllers, 0)
+
+	c.setMarkedResources("test", actions)
+	assert.Equal(t, map[flux.ResourceID]string{id: "v1"}, c.markedResources(""))
+	assert.Len(t, c.markedResources("other"), 0)
+
+	controllers, err = c.SomeControllers([]flux.ResourceID{id, flux.MustParseResourceID("default:configmap/unmarked")})
+	assert.NoError(t, err)
+	if assert.Len(t, controllers, 1) {
+		runnerRef, _ := image.ParseRef("quay.io/example/runner:v1")
+		assert.Equal(t, id, controllers[0].ID)
+		assert.Equal(t, cluster.StatusReady, controllers[0].Status)
+		assert.Equal(t, []resource.Container{{Name: "runner", Image: runnerRef}}, controllers[0].ContainersOrNil())
+	}
+
+	// Another sync without it forgets about it
+	c.setMarkedResources("test", nil)
+	assert.Len(t, c.markedResources(""), 0)
+}
@@ -12,9 +12,10 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/registry"
+	"github.com/weaveworks/flux/resource"
 )
 
-func mergeCredentials(log func(...interface{}) error, client extendedClient, namespace string, podTemplate apiv1.PodTemplateSpec, imageCreds registry.ImageCreds, seenCreds map[string]registry.Credentials) {
+func mergeCredentials(log func(...interface{}) error, client extendedClient, namespace string, podTemplate apiv1.PodTemplateSpec, imageCreds registry.ImageCreds, seenCreds map[string]registry.Credentials, marked ...resource.Container) {
 	creds := registry.NoCredentials()
 	var imagePullSecrets []string
 	saName := podTemplate.Spec.ServiceAccountName
@@ -97,6 +98,9 @@ func mergeCredentials(log func(...interface{}) error, client extendedClient, nam
 		}
 		imageCreds[r.Name] = creds
 	}
+	for _, container := range marked {
+		imageCreds[container.Image.Name] = creds
+	}
 }
 
 // ImagesToFetch is a k8s specific method to get a list of images to update along with their credentials
@@ -125,20 +129,39 @@ func (c *Cluster) ImagesToFetch() registry.ImageCreds {
 			imageCreds := make(registry.ImageCreds)
 			for _, podController := range podControllers {
 				logger := log.With(c.logger, "resource", flux.MakeResourceID(ns.Name, kind, podController.name))
-				mergeCredentials(logger.Log, c.client, ns.Name, podController.podTemplate, imageCreds, seenCreds)
+				marked, err := markedImages(podController.k8sObject)
+				if err != nil {
+					logger.Log("err", errors.Wrap(err, "reading image markers"))
+				}
+				mergeCredentials(logger.Log, c.client, ns.Name, podController.podTemplate, imageCreds, seenCreds, marked...)
 			}
 
-			// Merge creds
-			for imageID, creds := range imageCreds {
-				existingCreds, ok := allImageCreds[imageID]
-				if ok {
-					existingCreds.Merge(creds)
-				} else {
-					allImageCreds[imageID] = creds
-				}
+			mergeImageCreds(allImageCreds, imageCreds)
+		}
+
+		// Other resources may have images, given by image markers
+		imageCreds := make(registry.ImageCreds)
+		for id, podController := range c.markedControllers(ns.Name) {
+			logger := log.With(c.logger, "resource", id)
+			marked, err := markedImages(podController.k8sObject)
+			if err != nil {
+				logger.Log("err", errors.Wrap(err, "reading image markers"))
 			}
+			mergeCredentials(logger.Log, c.client, ns.Name, podController.podTemplate, imageCreds, seenCreds, marked...)
 		}
+		mergeImageCreds(allImageCreds, imageCreds)
 	}
 
 	return allImageCreds
 }
+
+func mergeImageCreds(allImageCreds, imageCreds registry.ImageCreds) {
+	for imageID, creds := range imageCreds {
+		existingCreds, ok := allImageCreds[imageID]
+		if ok {
+			existingCreds.Merge(creds)
+		} else {
+			allImageCreds[imageID] = creds
+		}
+	}
+}
@@ -2,7 +2,6 @@ package kubernetes
 
 import (
 	"bytes"
-	"fmt"
 	"sync"
 
 	k8syaml "github.com/ghodss/yaml"
@@ -13,6 +12,7 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	k8sclient "k8s.io/client-go/kubernetes"
 
 	"github.com/weaveworks/flux"
@@ -23,23 +23,27 @@ import (
 
 type coreClient k8sclient.Interface
 type fluxHelmClient fhrclient.Interface
+type dynamicClient dynamic.Interface
 
 type extendedClient struct {
 	coreClient
 	fluxHelmClient
+	dynamicClient
 }
 
 // --- internal types for keeping track of syncing
 
 type metadata struct {
-	Name      string `yaml:"name"`
-	Namespace string `yaml:"namespace"`
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace"`
+	Annotations map[string]string `yaml:"annotations"`
 }
 
 type apiObject struct {
 	resource.Resource
-	Kind     string   `yaml:"kind"`
-	Metadata metadata `yaml:"metadata"`
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   metadata `yaml:"metadata"`
 }
 
 // A convenience for getting an minimal object from some bytes.
@@ -97,10 +101,16 @@ type Cluster struct {
 	sshKeyRing ssh.KeyRing
 
 	// syncErrors keeps a record of all per-resource errors during
-	// the sync from Git repo to the cluster.
-	syncErrors   map[flux.ResourceID]error
+	// the sync from Git repo to the cluster, for each sync source.
+	syncErrors   map[string]map[flux.ResourceID]error
 	muSyncErrors sync.RWMutex
 
+	// marked keeps a record of the resources with image markers
+	// that aren't otherwise workloads, and the API version of each,
+	// for each sync source.
+	marked   map[string]map[flux.ResourceID]string
+	muMarked sync.RWMutex
+
 	nsWhitelist       []string
 	nsWhitelistLogged map[string]bool // to keep track of whether we've logged a problem with seeing a whitelisted ns
 
@@ -110,6 +120,7 @@ type Cluster struct {
 // NewCluster returns a usable cluster.
 func NewCluster(clientset k8sclient.Interface,
 	fluxHelmClientset fhrclient.Interface,
+	dynamicClientset dynamic.Interface,
 	applier Applier,
 	sshKeyRing ssh.KeyRing,
 	logger log.Logger,
@@ -119,6 +130,7 @@ func NewCluster(clientset k8sclient.Interface,
 		client: extendedClient{
 			clientset,
 			fluxHelmClientset,
+			dynamicClientset,
 		},
 		applier:           applier,
 		logger:            logger,
@@ -142,7 +154,21 @@ func (c *Cluster) SomeControllers(ids []flux.ResourceID) (res []cluster.Controll
 
 		resourceKind, ok := resourceKinds[kind]
 		if !ok {
-			return nil, fmt.Errorf("Unsupported kind %v", kind)
+			// It may be a resource with image markers; if it isn't
+			// known to be, it's not a controller as far as we know.
+			apiVersion, ok := c.markedResources(ns)[id]
+			if !ok {
+				continue
+			}
+			podController, found, err := c.getMarkedController(id, apiVersion)
+			if err != nil {
+				return nil, err
+			}
+			if found && !isAddon(podController) {
+				podController.syncError = c.syncError(id)
+				controllers = append(controllers, podController.toClusterController(id))
+			}
+			continue
 		}
 
 		podController, err := resourceKind.getPodController(c, ns, name)
@@ -151,9 +177,7 @@ func (c *Cluster) SomeControllers(ids []flux.ResourceID) (res []cluster.Controll
 		}
 
 		if !isAddon(podController) {
-			c.muSyncErrors.RLock()
-			podController.syncError = c.syncErrors[id]
-			c.muSyncErrors.RUnlock()
+			podController.syncError = c.syncError(id)
 			controllers = append(controllers, podController.toClusterController(id))
 		}
 	}
@@ -188,23 +212,64 @@ func (c *Cluster) AllControllers(namespace string) (res []cluster.Controller, er
 			for _, podController := range podControllers {
 				if !isAddon(podController) {
 					id := flux.MakeResourceID(ns.Name, kind, podController.name)
-					c.muSyncErrors.RLock()
-					podController.syncError = c.syncErrors[id]
-					c.muSyncErrors.RUnlock()
+					podController.syncError = c.syncError(id)
 					allControllers = append(allControllers, podController.toClusterController(id))
 				}
 			}
 		}
+
+		for id, podController := range c.markedControllers(ns.Name) {
+			podController.syncError = c.syncError(id)
+			allControllers = append(allControllers, podController.toClusterController(id))
+		}
 	}
 
 	return allControllers, nil
 }
 
-// Sync performs the given actions on resources. Operations are
-// asynchronous, but serialised.
-func (c *Cluster) Sync(spec cluster.SyncDef) error {
+// Sync performs the given actions on resources, and reports the
+// outcome for each. Operations are asynchronous, but serialised.
+func (c *Cluster) Sync(spec cluster.SyncDef) (cluster.SyncResult, error) {
 	logger := log.With(c.logger, "method", "Sync")
 
+	cs, errs := c.stageActions(spec)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.muSyncErrors.RLock()
+	result, applyErrs := c.applier.apply(logger, cs, c.syncErrors[spec.Source])
+	if len(applyErrs) > 0 {
+		errs = append(errs, applyErrs...)
+	}
+	c.muSyncErrors.RUnlock()
+	c.setMarkedResources(spec.Source, spec.Actions)
+
+	// If `nil`, errs is a cluster.SyncError(nil) rather than error(nil)
+	if errs == nil {
+		return result, nil
+	}
+
+	// It is expected that Cluster.Sync is invoked with *all* resources
+	// from the source. Otherwise it will override previously recorded
+	// sync errors.
+	c.setSyncErrors(spec.Source, errs)
+	return result, errs
+}
+
+// PlanSync works out what Sync would do with the given actions,
+// without changing anything in the cluster.
+func (c *Cluster) PlanSync(spec cluster.SyncDef) (cluster.SyncPlan, error) {
+	logger := log.With(c.logger, "method", "PlanSync")
+
+	cs, errs := c.stageActions(spec)
+	return append(errorPlan(errs), c.applier.plan(logger, cs)...), nil
+}
+
+// stageActions turns the actions in a SyncDef into a changeSet for
+// the applier, marking the resources to be applied as belonging to
+// the sync source. Any resources that cannot be staged are returned
+// as errors.
+func (c *Cluster) stageActions(spec cluster.SyncDef) (changeSet, cluster.SyncError) {
 	cs := makeChangeSet()
 	var errs cluster.SyncError
 	for _, action := range spec.Actions {
@@ -219,45 +284,53 @@ func (c *Cluster) Sync(spec cluster.SyncDef) error {
 			if stage.res == nil {
 				continue
 			}
-			obj, err := parseObj(stage.res.Bytes())
+			res := stage.res
+			if stage.cmd == "apply" && spec.Source != "" {
+				marked, err := markResource(res, spec.Source)
+				if err != nil {
+					errs = append(errs, cluster.ResourceError{Resource: res, Error: err})
+					break
+				}
+				res = marked
+			}
+			obj, err := parseObj(res.Bytes())
 			if err == nil {
-				obj.Resource = stage.res
+				obj.Resource = res
 				cs.stage(stage.cmd, obj)
 			} else {
-				errs = append(errs, cluster.ResourceError{Resource: stage.res, Error: err})
+				errs = append(errs, cluster.ResourceError{Resource: res, Error: err})
 				break
 			}
 		}
 	}
-
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.muSyncErrors.RLock()
-	if applyErrs := c.applier.apply(logger, cs, c.syncErrors); len(applyErrs) > 0 {
-		errs = append(errs, applyErrs...)
-	}
-	c.muSyncErrors.RUnlock()
-
-	// If `nil`, errs is a cluster.SyncError(nil) rather than error(nil)
-	if errs == nil {
-		return nil
-	}
-
-	// It is expected that Cluster.Sync is invoked with *all* resources.
-	// Otherwise it will override previously recorded sync errors.
-	c.setSyncErrors(errs)
-	return errs
+	return cs, errs
 }
 
-func (c *Cluster) setSyncErrors(errs cluster.SyncError) {
+func (c *Cluster) setSyncErrors(source string, errs cluster.SyncError) {
 	c.muSyncErrors.Lock()
 	defer c.muSyncErrors.Unlock()
-	c.syncErrors = make(map[flux.ResourceID]error)
+	if c.syncErrors == nil {
+		c.syncErrors = make(map[string]map[flux.ResourceID]error)
+	}
+	c.syncErrors[source] = make(map[flux.ResourceID]error)
 	for _, e := range errs {
-		c.syncErrors[e.ResourceID()] = e.Error
+		c.syncErrors[source][e.ResourceID()] = e.Error
 	}
 }
 
+// syncError gives the error recorded for the resource when it was
+// last synced, from whichever source.
+func (c *Cluster) syncError(id flux.ResourceID) error {
+	c.muSyncErrors.RLock()
+	defer c.muSyncErrors.RUnlock()
+	for _, errs := range c.syncErrors {
+		if err, ok := errs[id]; ok {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *Cluster) Ping() error {
 	_, err := c.client.coreClient.Discovery().ServerVersion()
 	return err
@@ -1,45 +1,319 @@
 package kubernetes
 
 import (
-	"bytes"
-	"errors"
-	"os/exec"
+	"fmt"
+	"reflect"
 	"strings"
+
+	"github.com/pkg/errors"
+
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/image"
 )
 
-// KubeYAML is a placeholder value for calling the helper executable
-// `kubeyaml`.
+// KubeYAML edits Kubernetes resource definitions in YAML streams,
+// keeping comments and formatting intact. It replaces the helper
+// executable `kubeyaml`, and behaves the same way.
 type KubeYAML struct {
 }
 
-// Image calls the kubeyaml subcommand `image` with the arguments given.
+// Image sets the image used by the container given, in the resource
+// given.
 func (k KubeYAML) Image(in []byte, ns, kind, name, container, image string) ([]byte, error) {
-	args := []string{"image", "--namespace", ns, "--kind", kind, "--name", name}
-	args = append(args, "--container", container, "--image", image)
-	return execKubeyaml(in, args)
+	docs := parseYAMLStream(in)
+	doc, res, err := findResource(docs, ns, kind, name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(kind) {
+	case "fluxhelmrelease", "helmrelease":
+		doc.changed, err = setHelmReleaseImage(res, container, image)
+	default:
+		apiVersion, _ := res.lookup("apiVersion").stringValue()
+		doc.changed, err = setContainerImage(res, podSpecPath(apiVersion, kind), container, image)
+	}
+	if err != nil {
+		// There may be an image marker by that name instead
+		if path, ok, markerErr := imageMarkerPath(res, container); ok {
+			doc.changed, err = setMarkedImage(res, path, container, image)
+		} else if markerErr != nil {
+			err = markerErr
+		}
+	}
+	if err != nil || !doc.changed {
+		return in, err
+	}
+	return writeYAMLStream(docs), nil
+}
+
+// Annotate sets (or, if the value is empty, removes) annotations in
+// the resource given. Each annotation is given as `key=value`.
+func (k KubeYAML) Annotate(in []byte, ns, kind, name string, annotations ...string) ([]byte, error) {
+	docs := parseYAMLStream(in)
+	doc, res, err := findResource(docs, ns, kind, name)
+	if err != nil {
+		return nil, err
+	}
+	metadata := res.get("metadata")
+	if metadata == nil || metadata.value == nil || metadata.value.kind != yamlMapping {
+		return nil, errors.New("resource has no metadata")
+	}
+
+	for _, annotation := range annotations {
+		parts := strings.SplitN(annotation, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("annotation %q not in the form key=value", annotation)
+		}
+		key, value := parts[0], parts[1]
+		entry := metadata.value.get("annotations")
+		if value == "" {
+			if entry != nil && entry.value != nil && entry.value.kind == yamlMapping && entry.value.remove(key) {
+				if entry.value.size() == 0 {
+					metadata.value.remove("annotations")
+				}
+				doc.changed = true
+			}
+			continue
+		}
+
+		if entry == nil {
+			entry = metadata.value.add("annotations")
+		}
+		// An empty flow mapping (`{}`) is replaced, so the
+		// annotations are written in the same style as the metadata
+		if entry.value == nil || entry.value.kind != yamlMapping ||
+			(entry.value.size() == 0 && entry.value.flow != metadata.value.flow) {
+			if v, err := entry.value.decode(); err != nil || (v != nil && !reflect.DeepEqual(v, map[interface{}]interface{}{})) {
+				return nil, errors.New("annotations are not a mapping")
+			}
+			entry.value = newYAMLMapping(metadata.value.flow)
+			doc.changed = true
+		}
+		annotation := entry.value.get(key)
+		if annotation == nil {
+			annotation = entry.value.add(key)
+		}
+		if annotation.setString(value) {
+			doc.changed = true
+		}
+	}
+
+	if !doc.changed {
+		return in, nil
+	}
+	return writeYAMLStream(docs), nil
+}
+
+// findResource looks through the documents for the resource given,
+// which may also be an item in a List. It returns the document
+// containing it, and the resource itself.
+func findResource(docs []*yamlDoc, ns, kind, name string) (*yamlDoc, *yamlNode, error) {
+	var parseErr error
+	for _, doc := range docs {
+		if doc.err != nil {
+			parseErr = doc.err
+			continue
+		}
+		if doc.root == nil {
+			continue
+		}
+		candidates := []*yamlNode{doc.root}
+		if kind, _ := doc.root.lookup("kind").stringValue(); kind == "List" {
+			if items := doc.root.lookup("items"); items != nil && items.kind == yamlSequence {
+				candidates = nil
+				for _, item := range items.entries {
+					candidates = append(candidates, item.value)
+				}
+			}
+		}
+		for _, res := range candidates {
+			if isResource(res, ns, kind, name) {
+				return doc, res, nil
+			}
+		}
+	}
+	if parseErr != nil {
+		return nil, nil, errors.Wrap(parseErr, "parsing YAML")
+	}
+	return nil, nil, fmt.Errorf("resource %s:%s/%s not found", ns, strings.ToLower(kind), name)
+}
+
+func isResource(res *yamlNode, ns, kind, name string) bool {
+	resKind, _ := res.lookup("kind").stringValue()
+	resName, _ := res.lookup("metadata", "name").stringValue()
+	resNamespace, _ := res.lookup("metadata", "namespace").stringValue()
+	if resNamespace == "" {
+		resNamespace = "default"
+	}
+	return strings.EqualFold(resKind, kind) && resName == name && resNamespace == ns
 }
 
-// Annotate calls the kubeyaml subcommand `annotate` with the arguments as given.
-func (k KubeYAML) Annotate(in []byte, ns, kind, name string, policies ...string) ([]byte, error) {
-	args := []string{"annotate", "--namespace", ns, "--kind", kind, "--name", name}
-	args = append(args, policies...)
-	return execKubeyaml(in, args)
+func podSpecPath(apiVersion, kind string) []string {
+	if strings.ToLower(kind) == "cronjob" {
+		return []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	}
+	if wk, ok := kresource.LookupWorkloadKind(apiVersion, kind); ok {
+		if path, err := wk.TemplatePath(); err == nil {
+			return append(path, "spec")
+		}
+	}
+	return []string{"spec", "template", "spec"}
 }
 
-func execKubeyaml(in []byte, args []string) ([]byte, error) {
-	cmd := exec.Command("kubeyaml", args...)
-	out := &bytes.Buffer{}
-	errOut := &bytes.Buffer{}
-	cmd.Stdin = bytes.NewBuffer(in)
-	cmd.Stdout = out
-	cmd.Stderr = errOut
+// setContainerImage sets the image of the container named, which
+// may be either a container or an init container, in the pod spec
+// at the path given.
+func setContainerImage(res *yamlNode, path []string, container, image string) (bool, error) {
+	podSpec := res.lookup(path...)
+	for _, field := range []string{"containers", "initContainers"} {
+		containers := podSpec.lookup(field)
+		if containers == nil || containers.kind != yamlSequence {
+			continue
+		}
+		for _, item := range containers.entries {
+			if containerName, _ := item.value.lookup("name").stringValue(); containerName == container {
+				entry := item.value.get("image")
+				if entry == nil {
+					return false, fmt.Errorf("container %q has no image", container)
+				}
+				return entry.setString(image), nil
+			}
+		}
+	}
+	return false, fmt.Errorf("container %q not found", container)
+}
 
-	err := cmd.Run()
+// imageMarkerPath gives the path in the image marker with the name
+// given, if there is one.
+func imageMarkerPath(res *yamlNode, name string) (kresource.FieldPath, bool, error) {
+	marker, ok := res.lookup("metadata", "annotations", kresource.ImageMarkerPrefix+name).stringValue()
+	if !ok {
+		return nil, false, nil
+	}
+	path, err := kresource.ParseFieldPath(marker)
 	if err != nil {
-		if errOut.Len() == 0 {
-			return nil, err
+		return nil, false, errors.Wrapf(err, "image marker %q", name)
+	}
+	return path, true, nil
+}
+
+// setMarkedImage sets the image in the field at the path given, as
+// from an image marker.
+func setMarkedImage(res *yamlNode, path kresource.FieldPath, name, image string) (bool, error) {
+	node := res
+	var entry *yamlEntry
+	for _, step := range path {
+		entry = nil
+		switch {
+		case node == nil:
+		case step.Field != "":
+			entry = node.get(step.Field)
+		case node.kind != yamlSequence:
+		case step.Key != "":
+			for _, item := range node.entries {
+				if value, _ := item.value.lookup(step.Key).stringValue(); value == step.Value {
+					entry = item
+					break
+				}
+			}
+		case step.Index < len(node.entries):
+			entry = node.entries[step.Index]
+		}
+		if entry == nil {
+			return false, fmt.Errorf("image marker %q does not point to a field in the resource", name)
+		}
+		node = entry.value
+	}
+	if _, ok := entry.value.stringValue(); !ok {
+		return false, fmt.Errorf("image marker %q does not point to a string", name)
+	}
+	return entry.setString(image), nil
+}
+
+// setHelmReleaseImage sets the image in the values of a
+// HelmRelease (or FluxHelmRelease). The values are interpreted in
+// the same way as when listing the images, then any fields changed
+// as a result of setting the image are changed in the document.
+func setHelmReleaseImage(res *yamlNode, container, imageName string) (bool, error) {
+	ref, err := image.ParseRef(imageName)
+	if err != nil {
+		return false, err
+	}
+	values := res.lookup("spec", "values")
+	if values == nil || values.kind != yamlMapping {
+		return false, fmt.Errorf("container %q not found", container)
+	}
+	decoded, err := values.decode()
+	if err != nil {
+		return false, errors.Wrap(err, "decoding values")
+	}
+	updated := map[string]interface{}{}
+	for k, v := range decoded.(map[interface{}]interface{}) {
+		updated[fmt.Sprint(k)] = copyValue(v)
+	}
+
+	var found bool
+	kresource.FindFluxHelmReleaseContainers(updated, func(name string, _ image.Ref, set kresource.ImageSetter) error {
+		if name == container {
+			set(ref)
+			found = true
+		}
+		return nil
+	})
+	if !found {
+		return false, fmt.Errorf("container %q not found", container)
+	}
+	return applyChangedStrings(values, decoded.(map[interface{}]interface{}), updated), nil
+}
+
+// copyValue makes a deep copy of a decoded YAML value, so that it
+// can be changed and compared with the original.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[interface{}]interface{}{}
+		for k, item := range v {
+			m[k] = copyValue(item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, item := range v {
+			s[i] = copyValue(item)
+		}
+		return s
+	}
+	return value
+}
+
+// applyChangedStrings sets the string fields of a mapping that are
+// different in `updated` than in `original`, recursing into nested
+// mappings. It says whether anything was changed.
+func applyChangedStrings(node *yamlNode, original map[interface{}]interface{}, updated map[string]interface{}) bool {
+	var changed bool
+	for key, value := range updated {
+		was := original[key]
+		switch v := value.(type) {
+		case string:
+			if v == was {
+				continue
+			}
+			entry := node.get(key)
+			if entry == nil {
+				entry = node.add(key)
+			}
+			changed = entry.setString(v) || changed
+		case map[interface{}]interface{}:
+			wasMap, _ := was.(map[interface{}]interface{})
+			nested := map[string]interface{}{}
+			for k, item := range v {
+				nested[fmt.Sprint(k)] = item
+			}
+			if child := node.lookup(key); child != nil && child.kind == yamlMapping {
+				changed = applyChangedStrings(child, wasMap, nested) || changed
+			}
 		}
-		return nil, errors.New(strings.TrimSpace(errOut.String()))
 	}
-	return out.Bytes(), nil
+	return changed
 }
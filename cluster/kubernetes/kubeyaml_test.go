@@ -0,0 +1,458 @@
+package kubernetes
+
+import (
+	"testing"
+)
+
+func TestKubeYAMLImage(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		in, out   string
+		kind, res string
+		container string
+	}{
+		{
+			name: "formatting kept",
+			in: `# A file with odd formatting
+apiVersion: v1
+kind: Service
+metadata:
+    name: web
+spec:
+    ports:
+        - port: 80
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: web:v1   # keep this
+          args: [ "--verbose",
+                  "--port=80" ]
+`,
+			out: `# A file with odd formatting
+apiVersion: v1
+kind: Service
+metadata:
+    name: web
+spec:
+    ports:
+        - port: 80
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: web:v2   # keep this
+          args: [ "--verbose",
+                  "--port=80" ]
+`,
+			kind: "deployment", res: "web", container: "web",
+		},
+		{
+			name: "cronjob",
+			in: `apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: web
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: web
+            image: "web:v1"
+`,
+			out: `apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: web
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: web
+            image: "web:v2"
+`,
+			kind: "cronjob", res: "web", container: "web",
+		},
+		{
+			name: "indentation kept",
+			in: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+   name: web
+   annotations:
+      description: |
+         Serves the web.
+
+         Or tries to.
+spec:
+   template:
+      spec:
+         containers:
+         - name: web
+           image: web:v1
+`,
+			out: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+   name: web
+   annotations:
+      description: |
+         Serves the web.
+
+         Or tries to.
+spec:
+   template:
+      spec:
+         containers:
+         - name: web
+           image: web:v2
+`,
+			kind: "deployment", res: "web", container: "web",
+		},
+		{
+			name: "CRLF line endings",
+			in:   "apiVersion: apps/v1\r\nkind: Deployment\r\nmetadata:\r\n  name: web\r\nspec:\r\n  template:\r\n    spec:\r\n      containers:\r\n      - name: web\r\n        image: web:v1\r\n",
+			out:  "apiVersion: apps/v1\r\nkind: Deployment\r\nmetadata:\r\n  name: web\r\nspec:\r\n  template:\r\n    spec:\r\n      containers:\r\n      - name: web\r\n        image: web:v2\r\n",
+			kind: "deployment", res: "web", container: "web",
+		},
+		{
+			name: "flow mappings",
+			in: `apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web}
+spec:
+  template:
+    spec:
+      containers:
+      - {name: sidecar, image: "sidecar:v1"}
+      - {name: web, image: web:v1}
+`,
+			out: `apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web}
+spec:
+  template:
+    spec:
+      containers:
+      - {name: sidecar, image: "sidecar:v1"}
+      - {name: web, image: 'web:v2'}
+`,
+			kind: "deployment", res: "web", container: "web",
+		},
+		{
+			name: "JSON",
+			in: `{
+  "apiVersion": "apps/v1",
+  "kind": "Deployment",
+  "metadata": {"name": "web"},
+  "spec": {"template": {"spec": {"containers": [
+    {"name": "web", "image": "web:v1"}
+  ]}}}
+}
+`,
+			out: `{
+  "apiVersion": "apps/v1",
+  "kind": "Deployment",
+  "metadata": {"name": "web"},
+  "spec": {"template": {"spec": {"containers": [
+    {"name": "web", "image": "web:v2"}
+  ]}}}
+}
+`,
+			kind: "deployment", res: "web", container: "web",
+		},
+		{
+			name: "indented sequences",
+			in: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+    name: web
+spec:
+    template:
+        spec:
+            containers:
+                -   name: web
+                    image: web:v1
+                    ports:
+                        - containerPort: 80
+`,
+			out: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+    name: web
+spec:
+    template:
+        spec:
+            containers:
+                -   name: web
+                    image: web:v2
+                    ports:
+                        - containerPort: 80
+`,
+			kind: "deployment", res: "web", container: "web",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := (KubeYAML{}).Image([]byte(c.in), "default", c.kind, c.res, c.container, "web:v2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != c.out {
+				t.Errorf("expected:\n%s\ngot:\n%s", c.out, string(out))
+			}
+		})
+	}
+}
+
+func TestKubeYAMLImageErrors(t *testing.T) {
+	const def = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:v1
+`
+	if _, err := (KubeYAML{}).Image([]byte(def), "default", "deployment", "api", "web", "web:v2"); err == nil {
+		t.Error("expected error for missing resource")
+	}
+	if _, err := (KubeYAML{}).Image([]byte(def), "default", "deployment", "web", "api", "web:v2"); err == nil {
+		t.Error("expected error for missing container")
+	}
+}
+
+func TestKubeYAMLAnnotate(t *testing.T) {
+	const in = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  annotations: {}
+`
+	out, err := (KubeYAML{}).Annotate([]byte(in), "default", "Deployment", "web",
+		"flux.weave.works/locked=true", "flux.weave.works/locked_msg=Broken\nsee #123",
+		"flux.weave.works/tag.web=glob:v*", "flux.weave.works/locked_user=Name <name@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  annotations:
+    flux.weave.works/locked: 'true'
+    flux.weave.works/locked_msg: |-
+      Broken
+      see #123
+    flux.weave.works/tag.web: glob:v*
+    flux.weave.works/locked_user: Name <name@example.com>
+`
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+
+	out, err = (KubeYAML{}).Annotate(out, "default", "Deployment", "web",
+		"flux.weave.works/locked=", "flux.weave.works/locked_msg=", "flux.weave.works/tag.web=", "flux.weave.works/locked_user=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const removed = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`
+	if string(out) != removed {
+		t.Errorf("expected:\n%s\ngot:\n%s", removed, string(out))
+	}
+}
+
+func TestKubeYAMLAnnotateFormatting(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		in, out string
+	}{
+		{
+			name: "flow metadata",
+			in: `apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web, labels: {app: web}}
+`,
+			out: `apiVersion: apps/v1
+kind: Deployment
+metadata: {name: web, labels: {app: web}, annotations: {flux.weave.works/locked: 'true', flux.weave.works/locked_msg: "Broken\nsee #123"}}
+`,
+		},
+		{
+			name: "flow annotations",
+			in: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  annotations: { example.com/owner: web-team }
+`,
+			out: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  annotations: { example.com/owner: web-team, flux.weave.works/locked: 'true', flux.weave.works/locked_msg: "Broken\nsee #123" }
+`,
+		},
+		{
+			name: "indentation",
+			in: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+    name: web
+    annotations:
+        example.com/owner: web-team # who to ask
+spec:
+    replicas: 1
+`,
+			out: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+    name: web
+    annotations:
+        example.com/owner: web-team # who to ask
+        flux.weave.works/locked: 'true'
+        flux.weave.works/locked_msg: |-
+            Broken
+            see #123
+spec:
+    replicas: 1
+`,
+		},
+		{
+			name: "no line end",
+			in:   "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web",
+			out: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  annotations:\n    flux.weave.works/locked: 'true'\n" +
+				"    flux.weave.works/locked_msg: |-\n      Broken\n      see #123",
+		},
+		{
+			name: "new annotations",
+			in:   "apiVersion: apps/v1\r\nkind: Deployment\r\nmetadata:\r\n   name: web\r\nspec:\r\n   replicas: 1\r\n",
+			out: "apiVersion: apps/v1\r\nkind: Deployment\r\nmetadata:\r\n   name: web\r\n   annotations:\r\n      flux.weave.works/locked: 'true'\r\n" +
+				"      flux.weave.works/locked_msg: |-\r\n         Broken\r\n         see #123\r\nspec:\r\n   replicas: 1\r\n",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := (KubeYAML{}).Annotate([]byte(c.in), "default", "Deployment", "web",
+				"flux.weave.works/locked=true", "flux.weave.works/locked_msg=Broken\nsee #123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != c.out {
+				t.Errorf("expected:\n%s\ngot:\n%s", c.out, string(out))
+			}
+
+			// Removing the annotations again gets back to where we
+			// started
+			out, err = (KubeYAML{}).Annotate(out, "default", "Deployment", "web",
+				"flux.weave.works/locked=", "flux.weave.works/locked_msg=")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != c.in {
+				t.Errorf("expected:\n%s\ngot:\n%s", c.in, string(out))
+			}
+		})
+	}
+}
+
+func TestKubeYAMLImageMarker(t *testing.T) {
+	const in = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  annotations:
+    flux.weave.works/image.runner: '{.spec.template.spec.containers[?(@.name=="web")].env[?(@.name=="RUNNER_IMAGE")].value}'
+    flux.weave.works/image.bad: '{.spec.replicas}'
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:v1
+        env:
+        - name: OTHER
+          value: "web:v1"
+        - name: RUNNER_IMAGE
+          value: "runner:v1" # the job runner
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: runner
+  annotations:
+    flux.weave.works/image.runner: '{.data.images[1]}'
+data:
+  images:
+  - runner:v0
+  - runner:v1
+`
+	out, err := (KubeYAML{}).Image([]byte(in), "default", "deployment", "web", "runner", "runner:v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = (KubeYAML{}).Image(out, "default", "configmap", "runner", "runner", "runner:v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  annotations:
+    flux.weave.works/image.runner: '{.spec.template.spec.containers[?(@.name=="web")].env[?(@.name=="RUNNER_IMAGE")].value}'
+    flux.weave.works/image.bad: '{.spec.replicas}'
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:v1
+        env:
+        - name: OTHER
+          value: "web:v1"
+        - name: RUNNER_IMAGE
+          value: "runner:v2" # the job runner
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: runner
+  annotations:
+    flux.weave.works/image.runner: '{.data.images[1]}'
+data:
+  images:
+  - runner:v0
+  - runner:v2
+`
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+
+	if _, err := (KubeYAML{}).Image([]byte(in), "default", "deployment", "web", "bad", "runner:v2"); err == nil {
+		t.Error("expected error for image marker not pointing to a string")
+	}
+}
@@ -8,9 +8,17 @@ import (
 )
 
 type Manifests struct {
+	// Generate manifests for directories with a config file in
+	// them, by running the commands given there. Since this means
+	// running commands from the repo, it must be enabled
+	// explicitly.
+	Generate bool
 }
 
 func (c *Manifests) LoadManifests(base string, paths []string) (map[string]resource.Resource, error) {
+	if c.Generate {
+		return loadWithGenerators(base, paths)
+	}
 	return kresource.Load(base, paths)
 }
 
@@ -0,0 +1,302 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+)
+
+// Resources are applied in stages, such that each resource is applied
+// in a later stage than anything it depends on. A resource depends on
+//
+//  - the namespace it's in (the default namespace, if it doesn't
+//    say), if that is being applied too;
+//  - the CustomResourceDefinition for its kind, if that is being
+//    applied too;
+//  - any resources named in its `flux.weave.works/depends-on`
+//    annotation, which is a comma-separated list of resource IDs
+//    (e.g., `default:deployment/helloworld`).
+//
+// Depending on a resource that isn't being applied is fine; it's
+// assumed to be there already, or to be dealt with elsewhere.
+
+const dependsOnAnnotation = kresource.PolicyPrefix + "depends-on"
+
+// crdEstablishedTimeout is how long to wait for newly applied custom
+// resource definitions to be established -- that is, for the API
+// server to serve the custom resources -- before moving on to the
+// next stage.
+const crdEstablishedTimeout = time.Minute
+
+func isCRD(obj *apiObject) bool {
+	return obj.Kind == "CustomResourceDefinition"
+}
+
+// clusterScopedKinds are the built-in kinds of resource that don't
+// belong to a namespace.
+var clusterScopedKinds = map[string]bool{
+	"APIService":                     true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"CustomResourceDefinition":       true,
+	"MutatingWebhookConfiguration":   true,
+	"Namespace":                      true,
+	"Node":                           true,
+	"PersistentVolume":               true,
+	"PodSecurityPolicy":              true,
+	"PriorityClass":                  true,
+	"StorageClass":                   true,
+	"ValidatingWebhookConfiguration": true,
+}
+
+// namespace gives the namespace the object will be in once applied:
+// the one given, or if none is given, the default namespace. Objects
+// of cluster-scoped kinds aren't in a namespace. (Custom resources
+// without a namespace are taken to be namespaced, which at worst
+// means waiting for the default namespace to be applied.)
+func (o *apiObject) namespace() string {
+	if o.hasNamespace() || clusterScopedKinds[o.Kind] {
+		return o.Metadata.Namespace
+	}
+	return "default"
+}
+
+// group gives the API group of the object, which is the part of the
+// apiVersion before the slash (or the empty string, for the core
+// group).
+func (o *apiObject) group() string {
+	if i := strings.Index(o.APIVersion, "/"); i >= 0 {
+		return o.APIVersion[:i]
+	}
+	return ""
+}
+
+// definedKind gives the group and kind of the custom resources
+// defined by a CustomResourceDefinition.
+func definedKind(crd *apiObject) (string, string, error) {
+	var def struct {
+		Spec struct {
+			Group string `yaml:"group"`
+			Names struct {
+				Kind string `yaml:"kind"`
+			} `yaml:"names"`
+		} `yaml:"spec"`
+	}
+	if err := yaml.Unmarshal(crd.Bytes(), &def); err != nil {
+		return "", "", errors.Wrap(err, "parsing custom resource definition")
+	}
+	return def.Spec.Group, def.Spec.Names.Kind, nil
+}
+
+// dependencies gives, for each object, the indices of the objects it
+// depends on. An object whose dependencies can't be worked out gets
+// an error instead.
+func dependencies(objs []*apiObject) ([][]int, cluster.SyncError) {
+	byID := map[flux.ResourceID]int{}
+	namespaces := map[string]int{}
+	crds := map[string]int{}
+	var errs cluster.SyncError
+	for i, obj := range objs {
+		byID[obj.ResourceID()] = i
+		switch {
+		case obj.Kind == "Namespace":
+			namespaces[obj.Metadata.Name] = i
+		case isCRD(obj):
+			group, kind, err := definedKind(obj)
+			if err != nil {
+				errs = append(errs, cluster.ResourceError{obj.Resource, err})
+				continue
+			}
+			crds[group+"/"+kind] = i
+		}
+	}
+
+	deps := make([][]int, len(objs))
+	for i, obj := range objs {
+		seen := map[int]bool{}
+		add := func(j int) {
+			if !seen[j] {
+				seen[j] = true
+				deps[i] = append(deps[i], j)
+			}
+		}
+		if j, ok := namespaces[obj.namespace()]; ok {
+			add(j)
+		}
+		if j, ok := crds[obj.group()+"/"+obj.Kind]; ok {
+			add(j)
+		}
+		dependsOn, ok := obj.Metadata.Annotations[dependsOnAnnotation]
+		if !ok {
+			continue
+		}
+		for _, s := range strings.Split(dependsOn, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			id, err := flux.ParseResourceID(s)
+			if err != nil {
+				errs = append(errs, cluster.ResourceError{obj.Resource, errors.Wrapf(err, "parsing %s annotation", dependsOnAnnotation)})
+				break
+			}
+			if j, ok := byID[id]; ok {
+				add(j)
+			}
+		}
+	}
+	return deps, errs
+}
+
+// applyStages arranges the objects into stages for applying, as
+// described above. Objects that cannot be placed, because they are
+// part of a dependency cycle (or depend on something that is), are
+// left out and returned as errors instead.
+func applyStages(objs []*apiObject) ([][]*apiObject, cluster.SyncError) {
+	deps, errs := dependencies(objs)
+	bad := map[flux.ResourceID]bool{}
+	for _, e := range errs {
+		bad[e.ResourceID()] = true
+	}
+
+	placed := make([]bool, len(objs))
+	remaining := map[int]bool{}
+	for i, obj := range objs {
+		if !bad[obj.ResourceID()] {
+			remaining[i] = true
+		}
+	}
+
+	var stages [][]*apiObject
+	for len(remaining) > 0 {
+		var ready []int
+		for i := range objs {
+			if !remaining[i] {
+				continue
+			}
+			ok := true
+			for _, j := range deps[i] {
+				if !placed[j] {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				ready = append(ready, i)
+			}
+		}
+		if len(ready) == 0 {
+			break
+		}
+		stage := make([]*apiObject, len(ready))
+		for k, i := range ready {
+			placed[i] = true
+			delete(remaining, i)
+			stage[k] = objs[i]
+		}
+		sort.Slice(stage, func(a, b int) bool {
+			return stage[a].ResourceID().String() < stage[b].ResourceID().String()
+		})
+		stages = append(stages, stage)
+	}
+
+	for i, obj := range objs {
+		if !remaining[i] {
+			continue
+		}
+		var err error
+		if cycle := findCycle(i, deps, remaining); cycle != nil {
+			ids := make([]string, len(cycle))
+			for k, j := range cycle {
+				ids[k] = objs[j].ResourceID().String()
+			}
+			err = fmt.Errorf("dependency cycle: %s", strings.Join(ids, " -> "))
+		} else {
+			for _, j := range deps[i] {
+				if !placed[j] {
+					err = fmt.Errorf("depends on %s, which cannot be applied", objs[j].ResourceID())
+					break
+				}
+			}
+		}
+		errs = append(errs, cluster.ResourceError{obj.Resource, err})
+	}
+	return stages, errs
+}
+
+// findCycle looks for a path of dependencies, amongst the candidates
+// given, leading from the object at `start` back to itself. It
+// returns the path, starting and ending with `start`, or nil if there
+// is no such path.
+func findCycle(start int, deps [][]int, candidates map[int]bool) []int {
+	parent := map[int]int{}
+	queue := []int{start}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, d := range deps[n] {
+			if !candidates[d] {
+				continue
+			}
+			if d == start {
+				var path []int
+				for m := n; m != start; m = parent[m] {
+					path = append(path, m)
+				}
+				cycle := []int{start}
+				for k := len(path) - 1; k >= 0; k-- {
+					cycle = append(cycle, path[k])
+				}
+				return append(cycle, start)
+			}
+			if _, seen := parent[d]; seen {
+				continue
+			}
+			parent[d] = n
+			queue = append(queue, d)
+		}
+	}
+	return nil
+}
+
+// deleteOrder gives the order in which to delete objects, which is
+// the reverse of the order in which they would be applied. Objects
+// that could not be placed in an order for applying come first, since
+// nothing is known to depend on them.
+func deleteOrder(objs []*apiObject) []*apiObject {
+	stages, errs := applyStages(objs)
+	unplaced := map[flux.ResourceID]bool{}
+	for _, e := range errs {
+		unplaced[e.ResourceID()] = true
+	}
+	var ordered []*apiObject
+	for _, obj := range objs {
+		if unplaced[obj.ResourceID()] {
+			ordered = append(ordered, obj)
+		}
+	}
+	for i := len(stages) - 1; i >= 0; i-- {
+		ordered = append(ordered, stages[i]...)
+	}
+	return ordered
+}
+
+// crdsIn picks out the custom resource definitions in a stage, so
+// they can be waited for.
+func crdsIn(stage []*apiObject) []*apiObject {
+	var crds []*apiObject
+	for _, obj := range stage {
+		if isCRD(obj) {
+			crds = append(crds, obj)
+		}
+	}
+	return crds
+}
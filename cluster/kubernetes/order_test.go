@@ -0,0 +1,213 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+)
+
+func stagedObjs(t *testing.T, defs map[string]string) []*apiObject {
+	var objs []*apiObject
+	for id, def := range defs {
+		objs = append(objs, stagedObj(t, id, def))
+	}
+	return objs
+}
+
+func stageIDs(stages [][]*apiObject) [][]string {
+	var ids [][]string
+	for _, stage := range stages {
+		var s []string
+		for _, obj := range stage {
+			s = append(s, obj.ResourceID().String())
+		}
+		ids = append(ids, s)
+	}
+	return ids
+}
+
+func TestApplyStages(t *testing.T) {
+	objs := stagedObjs(t, map[string]string{
+		"bar:deployment/deploy": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: deploy
+  namespace: bar
+  annotations:
+    flux.weave.works/depends-on: bar:secret/secret
+`,
+		"bar:secret/secret": `apiVersion: v1
+kind: Secret
+metadata:
+  name: secret
+  namespace: bar
+`,
+		"default:namespace/bar": `apiVersion: v1
+kind: Namespace
+metadata:
+  name: bar
+`,
+		"default:customresourcedefinition/foos.example.com": `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: foos.example.com
+spec:
+  group: example.com
+  names:
+    kind: Foo
+    plural: foos
+`,
+		"bar:foo/foo": `apiVersion: example.com/v1
+kind: Foo
+metadata:
+  name: foo
+  namespace: bar
+`,
+		"bar:configmap/config": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: bar
+  annotations:
+    flux.weave.works/depends-on: default:deployment/elsewhere
+`,
+	})
+
+	stages, errs := applyStages(objs)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	expected := [][]string{
+		{"default:customresourcedefinition/foos.example.com", "default:namespace/bar"},
+		{"bar:configmap/config", "bar:foo/foo", "bar:secret/secret"},
+		{"bar:deployment/deploy"},
+	}
+	got := stageIDs(stages)
+	if len(got) != len(expected) {
+		t.Fatalf("expected stages %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if strings.Join(got[i], " ") != strings.Join(expected[i], " ") {
+			t.Errorf("expected stage %d to be %v, got %v", i, expected[i], got[i])
+		}
+	}
+
+	deletes := deleteOrder(objs)
+	if first := deletes[0].ResourceID().String(); first != "bar:deployment/deploy" {
+		t.Errorf("expected deployment to be deleted first, got %s", first)
+	}
+}
+
+func TestApplyStagesDefaultNamespace(t *testing.T) {
+	objs := stagedObjs(t, map[string]string{
+		"default:namespace/default": `apiVersion: v1
+kind: Namespace
+metadata:
+  name: default
+`,
+		"default:configmap/config": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`,
+		"default:clusterrole/role": `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: role
+`,
+	})
+
+	stages, errs := applyStages(objs)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	// The config map is in the default namespace, though it doesn't
+	// say so; the cluster role isn't in a namespace
+	expected := [][]string{
+		{"default:clusterrole/role", "default:namespace/default"},
+		{"default:configmap/config"},
+	}
+	got := stageIDs(stages)
+	if len(got) != len(expected) {
+		t.Fatalf("expected stages %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if strings.Join(got[i], " ") != strings.Join(expected[i], " ") {
+			t.Errorf("expected stage %d to be %v, got %v", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestApplyStagesCycle(t *testing.T) {
+	objs := stagedObjs(t, map[string]string{
+		"bar:configmap/a": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  namespace: bar
+  annotations:
+    flux.weave.works/depends-on: bar:configmap/b
+`,
+		"bar:configmap/b": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+  namespace: bar
+  annotations:
+    flux.weave.works/depends-on: bar:configmap/a
+`,
+		"bar:configmap/c": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: c
+  namespace: bar
+  annotations:
+    flux.weave.works/depends-on: bar:configmap/a, bar:configmap/d
+`,
+		"bar:configmap/d": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: d
+  namespace: bar
+`,
+	})
+
+	stages, errs := applyStages(objs)
+	got := stageIDs(stages)
+	if len(got) != 1 || strings.Join(got[0], " ") != "bar:configmap/d" {
+		t.Errorf("expected only bar:configmap/d to be applied, got %v", got)
+	}
+
+	messages := map[string]string{}
+	for _, e := range errs {
+		messages[e.ResourceID().String()] = e.Error.Error()
+	}
+	for id, msg := range map[string]string{
+		"bar:configmap/a": "dependency cycle: bar:configmap/a -> bar:configmap/b -> bar:configmap/a",
+		"bar:configmap/b": "dependency cycle: bar:configmap/b -> bar:configmap/a -> bar:configmap/b",
+		"bar:configmap/c": "depends on bar:configmap/a, which cannot be applied",
+	} {
+		if messages[id] != msg {
+			t.Errorf("expected error %q for %s, got %q", msg, id, messages[id])
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("expected three errors, got %v", errs)
+	}
+}
+
+func TestApplyStagesMalformedDependency(t *testing.T) {
+	objs := stagedObjs(t, map[string]string{
+		"bar:configmap/a": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  namespace: bar
+  annotations:
+    flux.weave.works/depends-on: not an ID
+`,
+	})
+	stages, errs := applyStages(objs)
+	if len(stages) != 0 || len(errs) != 1 {
+		t.Errorf("expected a single error and nothing applied, got %v and %v", stageIDs(stages), errs)
+	}
+}
@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
@@ -14,19 +15,43 @@ import (
 
 func (m *Manifests) UpdatePolicies(def []byte, id flux.ResourceID, update policy.Update) ([]byte, error) {
 	ns, kind, name := id.Components()
-	add, del := update.Add, update.Remove
+	add, del, err := resolvePolicies(update, func() ([]resource.Container, error) {
+		return extractContainers(def, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Annotations are appended in the order given, so sort them to
+	// get the same result each time.
+	var args []string
+	for pol, val := range add {
+		args = append(args, fmt.Sprintf("%s%s=%s", kresource.PolicyPrefix, pol, val))
+	}
+	sort.Strings(args)
+	for pol, _ := range del {
+		args = append(args, fmt.Sprintf("%s%s=", kresource.PolicyPrefix, pol))
+	}
+
+	return (KubeYAML{}).Annotate(def, ns, kind, name, args...)
+}
+
+// resolvePolicies works out the policies to add and remove for the
+// update given, checking that any tag patterns are valid.
+func resolvePolicies(update policy.Update, containers func() ([]resource.Container, error)) (add, del policy.Set, err error) {
+	add, del = update.Add, update.Remove
 
 	// We may be sent the pseudo-policy `policy.TagAll`, which means
 	// apply this filter to all containers. To do so, we need to know
 	// what all the containers are.
 	if tagAll, ok := update.Add.Get(policy.TagAll); ok {
 		add = add.Without(policy.TagAll)
-		containers, err := extractContainers(def, id)
+		cs, err := containers()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
-		for _, container := range containers {
+		for _, container := range cs {
 			if tagAll == policy.PatternAll.String() {
 				del = del.Add(policy.TagPrefix(container.Name))
 			} else {
@@ -35,18 +60,22 @@ func (m *Manifests) UpdatePolicies(def []byte, id flux.ResourceID, update policy
 		}
 	}
 
-	var args []string
 	for pol, val := range add {
-		if policy.Tag(pol) && !policy.NewPattern(val).Valid() {
-			return nil, fmt.Errorf("invalid tag pattern: %q", val)
+		if policy.Tag(pol) {
+			if err := policy.ValidatePattern(val); err != nil {
+				return nil, nil, err
+			}
+		}
+		if pol == policy.Sort {
+			if _, err := policy.SortOrder(val); err != nil {
+				return nil, nil, err
+			}
+		}
+		if pol == policy.Approval && val != policy.ApprovalManual && val != policy.ApprovalBranch {
+			return nil, nil, fmt.Errorf("invalid approval %q; expected %q or %q", val, policy.ApprovalManual, policy.ApprovalBranch)
 		}
-		args = append(args, fmt.Sprintf("%s%s=%s", kresource.PolicyPrefix, pol, val))
-	}
-	for pol, _ := range del {
-		args = append(args, fmt.Sprintf("%s%s=", kresource.PolicyPrefix, pol))
 	}
-
-	return (KubeYAML{}).Annotate(def, ns, kind, name, args...)
+	return add, del, nil
 }
 
 type manifest struct {
@@ -166,6 +166,22 @@ func TestUpdatePolicies(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "add approval policy",
+			in:   nil,
+			out:  []string{"flux.weave.works/approval", "branch"},
+			update: policy.Update{
+				Add: policy.Set{policy.Approval: "branch"},
+			},
+		},
+		{
+			name: "add invalid approval policy",
+			in:   nil,
+			update: policy.Update{
+				Add: policy.Set{policy.Approval: "yes"},
+			},
+			wantErr: true,
+		},
 	} {
 		t.Run(c.name, func(t *testing.T) {
 			caseIn := templToString(t, annotationsTemplate, c.in)
@@ -3,6 +3,7 @@ package resource
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/resource"
@@ -126,13 +127,13 @@ func interpretAsContainer(m mapper) (image.Ref, ImageSetter, bool) {
 				//     tag: v1
 				if tagStr, ok := tag.(string); ok {
 					taggy = true
-					imageRef.Tag = tagStr
+					imageRef.Tag, imageRef.Digest = splitTagDigest(tagStr)
 				}
 			}
 			return imageRef, func(ref image.Ref) {
 				if taggy {
 					m.set("image", ref.Name.String())
-					m.set("tag", ref.Tag)
+					m.set("tag", joinTagDigest(ref))
 					return
 				}
 				m.set("image", ref.String())
@@ -169,7 +170,7 @@ func interpretAsImage(m mapper) (image.Ref, ImageSetter, bool) {
 			if err == nil {
 				return imgRef, func(ref image.Ref) {
 					m.set("repository", ref.Name.String())
-					m.set("tag", ref.Tag)
+					m.set("tag", joinTagDigest(ref))
 				}, true
 			}
 		}
@@ -177,6 +178,24 @@ func interpretAsImage(m mapper) (image.Ref, ImageSetter, bool) {
 	return image.Ref{}, nil, false
 }
 
+// splitTagDigest splits a tag value which may have a digest appended,
+// as in `v1@sha256:<hex>`.
+func splitTagDigest(tag string) (string, string) {
+	if at := strings.Index(tag, "@"); at > -1 {
+		return tag[:at], tag[at+1:]
+	}
+	return tag, ""
+}
+
+// joinTagDigest gives the tag of the ref, with the digest appended
+// if there is one, for use as a tag value.
+func joinTagDigest(ref image.Ref) string {
+	if ref.Digest != "" {
+		return ref.Tag + "@" + ref.Digest
+	}
+	return ref.Tag
+}
+
 // Containers returns the containers that are defined in the
 // FluxHelmRelease.
 func (fhr FluxHelmRelease) Containers() []resource.Container {
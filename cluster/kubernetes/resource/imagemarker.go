@@ -0,0 +1,283 @@
+package resource
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+// ImageMarkerPrefix is the prefix for annotations marking a field of
+// a resource as holding an image, for example
+//
+//	flux.weave.works/image.runner: '{.spec.template.spec.containers[?(@.name=="app")].env[?(@.name=="RUNNER_IMAGE")].value}'
+//
+// The image is then treated as though it were used by a container
+// with the name given ("runner" here): it is listed, fetched by the
+// registry warmer, updated by releases and automation, and can have
+// a tag filter.
+const ImageMarkerPrefix = PolicyPrefix + "image."
+
+// ImageMarker is a name for an image, and where to find it in a
+// resource.
+type ImageMarker struct {
+	Name string
+	Path FieldPath
+}
+
+// ImageMarkers gives the image markers among the annotations given,
+// sorted by name. Any markers that can't be parsed are left out, and
+// reported in the error returned.
+func ImageMarkers(annotations map[string]string) ([]ImageMarker, error) {
+	var markers []ImageMarker
+	var bad []string
+	for k, v := range annotations {
+		if !strings.HasPrefix(k, ImageMarkerPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(k, ImageMarkerPrefix)
+		path, err := ParseFieldPath(v)
+		if name == "" || err != nil {
+			bad = append(bad, k)
+			continue
+		}
+		markers = append(markers, ImageMarker{Name: name, Path: path})
+	}
+	sort.Slice(markers, func(i, j int) bool { return markers[i].Name < markers[j].Name })
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		return markers, fmt.Errorf("invalid image markers: %s", strings.Join(bad, ", "))
+	}
+	return markers, nil
+}
+
+// FieldPathStep is one step in a FieldPath: either a field of an
+// object, an index into a list, or the item of a list which has a
+// field with a particular value.
+type FieldPathStep struct {
+	Field string
+	Index int
+	// When Key is not empty, the step selects the first list item
+	// with the field Key equal to Value.
+	Key, Value string
+}
+
+// FieldPath is the path to a field in a resource. It's written as a
+// JSONPath expression limited to fields, indexes and filters
+// comparing a field with a string, e.g.,
+// `{.spec.tasks[?(@.name=="build")].steps[0].image}`, so that each
+// step leads to exactly one place.
+type FieldPath []FieldPathStep
+
+// ParseFieldPath parses a FieldPath from the JSONPath expression
+// given.
+func ParseFieldPath(expr string) (FieldPath, error) {
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
+	}
+	bad := func(reason string) (FieldPath, error) {
+		return nil, fmt.Errorf("path %q: %s", expr, reason)
+	}
+
+	var path FieldPath
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			end := strings.IndexAny(s[1:], ".[")
+			if end < 0 {
+				end = len(s) - 1
+			}
+			field := s[1 : end+1]
+			if field == "" || strings.ContainsAny(field, "]*@?()$ ") {
+				return bad("expected a field name after '.'")
+			}
+			path = append(path, FieldPathStep{Field: field})
+			s = s[end+1:]
+		case '[':
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return bad("unclosed '['")
+			}
+			inner := s[1:end]
+			if strings.HasPrefix(inner, "?(@.") && strings.HasSuffix(inner, ")") {
+				parts := strings.SplitN(inner[4:len(inner)-1], "==", 2)
+				if len(parts) != 2 {
+					return bad("expected a filter like [?(@.name==\"value\")]")
+				}
+				key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+				if len(value) < 2 || (value[0] != '"' && value[0] != '\'') || value[len(value)-1] != value[0] {
+					return bad("filters must compare with a quoted string")
+				}
+				if key == "" || strings.ContainsAny(key, ".[]") {
+					return bad("filters must compare a single field")
+				}
+				path = append(path, FieldPathStep{Key: key, Value: value[1 : len(value)-1]})
+			} else {
+				i, err := strconv.Atoi(inner)
+				if err != nil || i < 0 {
+					return bad("expected an index or a filter in '[...]'")
+				}
+				path = append(path, FieldPathStep{Index: i})
+			}
+			s = s[end+1:]
+		default:
+			return bad("expected '.' or '['")
+		}
+	}
+	if len(path) == 0 {
+		return bad("empty path")
+	}
+	return path, nil
+}
+
+// Get gives the value at the path in the object given, which may be
+// as decoded from YAML or from JSON.
+func (p FieldPath) Get(obj interface{}) (interface{}, bool) {
+	for _, step := range p {
+		var ok bool
+		if obj, ok = step.get(obj); !ok {
+			return nil, false
+		}
+	}
+	return obj, true
+}
+
+// Set sets the value at the path in the object given, if there is
+// already a value there. It says whether it could.
+func (p FieldPath) Set(obj interface{}, value interface{}) bool {
+	if len(p) == 0 {
+		return false
+	}
+	parent, ok := p[:len(p)-1].Get(obj)
+	if !ok {
+		return false
+	}
+	last := p[len(p)-1]
+	if _, ok := last.get(parent); !ok {
+		return false
+	}
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[last.Field] = value
+	case map[interface{}]interface{}:
+		c[last.Field] = value
+	case []interface{}:
+		i, ok := last.index(c)
+		if !ok {
+			return false
+		}
+		c[i] = value
+	default:
+		return false
+	}
+	return true
+}
+
+func (step FieldPathStep) get(obj interface{}) (interface{}, bool) {
+	if step.Field != "" {
+		switch m := obj.(type) {
+		case map[string]interface{}:
+			v, ok := m[step.Field]
+			return v, ok
+		case map[interface{}]interface{}:
+			v, ok := m[step.Field]
+			return v, ok
+		}
+		return nil, false
+	}
+	list, ok := obj.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	i, ok := step.index(list)
+	if !ok {
+		return nil, false
+	}
+	return list[i], true
+}
+
+func (step FieldPathStep) index(list []interface{}) (int, bool) {
+	if step.Field != "" {
+		return 0, false
+	}
+	if step.Key == "" {
+		return step.Index, step.Index < len(list)
+	}
+	for i, item := range list {
+		if v, ok := (FieldPathStep{Field: step.Key}).get(item); ok && v == step.Value {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// markedResource is a resource with image markers. It's a workload
+// whether or not the resource it wraps is.
+type markedResource struct {
+	resource.Resource
+	markers []ImageMarker
+	// the resource, as decoded from YAML, to get and set images in
+	doc interface{}
+}
+
+func (r *markedResource) Containers() []resource.Container {
+	var result []resource.Container
+	if wl, ok := r.Resource.(resource.Workload); ok {
+		result = wl.Containers()
+	}
+	for _, marker := range r.markers {
+		value, _ := marker.Path.Get(r.doc)
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		// FIXME(https://github.com/weaveworks/flux/issues/1269): account for possible errors
+		ref, _ := image.ParseRef(s)
+		result = append(result, resource.Container{Name: marker.Name, Image: ref})
+	}
+	return result
+}
+
+// SetContainerImage sets the image of the container named if there
+// is one, or otherwise that of the image marker.
+func (r *markedResource) SetContainerImage(container string, ref image.Ref) error {
+	if wl, ok := r.Resource.(resource.Workload); ok {
+		if err := wl.SetContainerImage(container, ref); err == nil {
+			return nil
+		}
+	}
+	for _, marker := range r.markers {
+		if marker.Name != container {
+			continue
+		}
+		if !marker.Path.Set(r.doc, ref.String()) {
+			return fmt.Errorf("image marker %q does not point to a field in the resource", container)
+		}
+		return nil
+	}
+	return fmt.Errorf("container %q not found in workload", container)
+}
+
+var _ resource.Workload = &markedResource{}
+
+// withImageMarkers wraps the resource given if it has image markers;
+// otherwise, it returns the resource as it is. Markers that can't be
+// parsed are ignored here; they are reported when the resource is
+// examined in the cluster.
+func withImageMarkers(base baseObject, res resource.Resource) (resource.Resource, error) {
+	markers, _ := ImageMarkers(base.Meta.Annotations)
+	if len(markers) == 0 {
+		return res, nil
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal(base.bytes, &doc); err != nil {
+		return nil, err
+	}
+	return &markedResource{Resource: res, markers: markers, doc: doc}, nil
+}
@@ -0,0 +1,105 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	for expr, expected := range map[string]FieldPath{
+		"{.data.image}":    {{Field: "data"}, {Field: "image"}},
+		".spec.steps[1]":   {{Field: "spec"}, {Field: "steps"}, {Index: 1}},
+		"{.items[0].name}": {{Field: "items"}, {Index: 0}, {Field: "name"}},
+		`{.spec.containers[?(@.name=="app")].env[?(@.name=='IMG')].value}`: {
+			{Field: "spec"}, {Field: "containers"}, {Key: "name", Value: "app"},
+			{Field: "env"}, {Key: "name", Value: "IMG"}, {Field: "value"},
+		},
+	} {
+		path, err := ParseFieldPath(expr)
+		if err != nil {
+			t.Errorf("%q: %s", expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(expected, path) {
+			t.Errorf("%q: expected %#v, got %#v", expr, expected, path)
+		}
+	}
+
+	for _, expr := range []string{
+		"", "{}", "{.}", "data.image", "{.data..image}", "{.items[*].image}",
+		"{.items[-1]}", "{.items[?(@.name==app)]}", "{.items[?(@.a.b=='x')]}", "{.items[0}",
+	} {
+		if _, err := ParseFieldPath(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestImageMarkers(t *testing.T) {
+	const doc = `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: runners
+  annotations:
+    flux.weave.works/image.runner: '{.data.runnerImage}'
+    flux.weave.works/image.missing: '{.data.nothingHere}'
+    flux.weave.works/tag.runner: semver:~1
+data:
+  runnerImage: quay.io/example/runner:1.0.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    flux.weave.works/image.runner: '{.spec.template.spec.containers[?(@.name=="app")].env[?(@.name=="RUNNER_IMAGE")].value}'
+    flux.weave.works/image.broken: 'not a path'
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: quay.io/example/app:v1
+        env:
+        - name: RUNNER_IMAGE
+          value: quay.io/example/runner:1.0.0
+`
+	objs, err := ParseMultidoc([]byte(doc), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runnerRef, _ := image.ParseRef("quay.io/example/runner:1.0.0")
+	newRef, _ := image.ParseRef("quay.io/example/runner:1.1.0")
+
+	cm, ok := objs["default:configmap/runners"].(resource.Workload)
+	if !assert.True(t, ok, "configmap with image markers is a workload") {
+		t.FailNow()
+	}
+	assert.Equal(t, []resource.Container{{Name: "runner", Image: runnerRef}}, cm.Containers())
+	assert.Equal(t, policy.Set{"tag.runner": "semver:~1"}, cm.Policy())
+	assert.NoError(t, cm.SetContainerImage("runner", newRef))
+	assert.Equal(t, []resource.Container{{Name: "runner", Image: newRef}}, cm.Containers())
+	assert.Error(t, cm.SetContainerImage("missing", newRef))
+	assert.Error(t, cm.SetContainerImage("other", newRef))
+
+	dep, ok := objs["default:deployment/app"].(resource.Workload)
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+	var names []string
+	for _, c := range dep.Containers() {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"app", "runner"}, names)
+	assert.NoError(t, dep.SetContainerImage("runner", newRef))
+	assert.Equal(t, newRef, dep.Containers()[1].Image)
+	assert.Equal(t, "quay.io/example/app:v1", dep.Containers()[0].Image.String())
+}
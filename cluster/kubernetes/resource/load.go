@@ -16,6 +16,14 @@ import (
 // based on the file(s) therein. Resources are named according to the
 // file content, rather than the file name of directory structure.
 func Load(base string, paths []string) (map[string]resource.Resource, error) {
+	return LoadExcluding(base, paths, nil)
+}
+
+// LoadExcluding is like Load, but ignores the directories given in
+// `excluded` (and anything under them). This is for when the files in
+// those directories are used some other way, e.g., to generate
+// manifests.
+func LoadExcluding(base string, paths []string, excluded []string) (map[string]resource.Resource, error) {
 	if _, err := os.Stat(base); os.IsNotExist(err) {
 		return nil, fmt.Errorf("git path %q not found", base)
 	}
@@ -24,6 +32,10 @@ func Load(base string, paths []string) (map[string]resource.Resource, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "walking %q for chartdirs", base)
 	}
+	// Excluded directories are skipped in just the same way as charts
+	for _, dir := range excluded {
+		charts[dir] = true
+	}
 	for _, root := range paths {
 		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
@@ -38,6 +50,10 @@ func Load(base string, paths []string) (map[string]resource.Resource, error) {
 				return nil
 			}
 
+			if filepath.Base(path) == ConfigFilename {
+				return nil
+			}
+
 			if !info.IsDir() && filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml" {
 				bytes, err := ioutil.ReadFile(path)
 				if err != nil {
@@ -68,6 +84,12 @@ func Load(base string, paths []string) (map[string]resource.Resource, error) {
 	return objs, nil
 }
 
+// ConfigFilename is the name of the file which, if present in a
+// directory, says how to generate the manifests for that directory
+// rather than reading them from files. It is never itself treated as
+// a manifest.
+const ConfigFilename = ".flux.yaml"
+
 type chartTracker map[string]bool
 
 func newChartTracker(root string) (chartTracker, error) {
@@ -19,10 +19,11 @@ const (
 
 // struct to embed in objects, to provide default implementation
 type baseObject struct {
-	source string
-	bytes  []byte
-	Kind   string `yaml:"kind"`
-	Meta   struct {
+	source     string
+	bytes      []byte
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Meta       struct {
 		Namespace   string            `yaml:"namespace"`
 		Name        string            `yaml:"name"`
 		Annotations map[string]string `yaml:"annotations,omitempty"`
@@ -46,6 +47,9 @@ func (o *baseObject) debyte() {
 func (o baseObject) Policy() policy.Set {
 	set := policy.Set{}
 	for k, v := range o.Meta.Annotations {
+		if strings.HasPrefix(k, ImageMarkerPrefix) {
+			continue
+		}
 		if strings.HasPrefix(k, PolicyPrefix) {
 			p := strings.TrimPrefix(k, PolicyPrefix)
 			if v == "true" {
@@ -75,6 +79,12 @@ func unmarshalObject(source string, bytes []byte) (resource.Resource, error) {
 	if err != nil {
 		return nil, makeUnmarshalObjectErr(source, err)
 	}
+	if r == nil || base.Kind == "List" {
+		return r, nil
+	}
+	if r, err = withImageMarkers(base, r); err != nil {
+		return nil, makeUnmarshalObjectErr(source, err)
+	}
 	return r, nil
 }
 
@@ -132,8 +142,15 @@ func unmarshalKind(base baseObject, bytes []byte) (resource.Resource, error) {
 		// assumption it is unlikely to happen.
 		return nil, nil
 	// The remainder are things we have to care about, but not
-	// treat specially
+	// treat specially, unless they are registered as workloads
 	default:
+		if kind, ok := LookupWorkloadKind(base.APIVersion, base.Kind); ok {
+			w, err := unmarshalWorkload(base, kind, bytes)
+			if err != nil {
+				return nil, err
+			}
+			return w, nil
+		}
 		return &base, nil
 	}
 }
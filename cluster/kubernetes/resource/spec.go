@@ -29,7 +29,7 @@ func (t PodTemplate) Containers() []resource.Container {
 	}
 	for _, c := range t.Spec.InitContainers {
 		im, _ := image.ParseRef(c.Image)
-		result = append(result, resource.Container{Name: c.Name, Image: im})
+		result = append(result, resource.Container{Name: c.Name, Image: im, Init: true})
 	}
 	return result
 }
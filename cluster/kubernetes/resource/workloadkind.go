@@ -0,0 +1,272 @@
+package resource
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+// WorkloadKind describes a kind of resource that runs pods from a
+// pod template, so that resources of that kind can be treated as
+// workloads -- have their images listed and updated, and their
+// rollouts reported -- without code specific to the kind. Kinds
+// are usually given in a config file, with entries like
+//
+//	apiVersion: argoproj.io/v1alpha1
+//	kind: Rollout
+//	podTemplate: '{.spec.template}'
+//	status:
+//	  observedGeneration: '{.status.observedGeneration}'
+//	  desired: '{.spec.replicas}'
+//	  updated: '{.status.updatedReplicas}'
+//	  ready: '{.status.readyReplicas}'
+//	  available: '{.status.availableReplicas}'
+type WorkloadKind struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	// The name of the resource in the API; if not given, it's the
+	// kind in lower case, with an "s" on the end.
+	Resource string `yaml:"resource,omitempty"`
+	// The field holding the pod template, as a JSONPath
+	// expression. This must be a plain path to a field (so that
+	// images can be updated in manifests); `{.}` means the resource
+	// is itself a pod.
+	PodTemplate string `yaml:"podTemplate"`
+	// Where to find the progress of a rollout; any of these can be
+	// left out.
+	Status WorkloadStatus `yaml:"status,omitempty"`
+	// If true, the pod template can't be changed once a resource is
+	// created (as with Jobs), so resources of the kind have their
+	// images listed, but aren't automated or released to.
+	Immutable bool `yaml:"immutable,omitempty"`
+}
+
+// WorkloadStatus gives JSONPath expressions for the fields reporting
+// the progress of a workload's rollout.
+type WorkloadStatus struct {
+	ObservedGeneration string `yaml:"observedGeneration,omitempty"`
+	Desired            string `yaml:"desired,omitempty"`
+	Updated            string `yaml:"updated,omitempty"`
+	Ready              string `yaml:"ready,omitempty"`
+	Available          string `yaml:"available,omitempty"`
+}
+
+// TemplatePath gives the fields leading to the pod template.
+func (k WorkloadKind) TemplatePath() ([]string, error) {
+	expr := strings.TrimSpace(k.PodTemplate)
+	if strings.HasPrefix(expr, "{") && strings.HasSuffix(expr, "}") {
+		expr = expr[1 : len(expr)-1]
+	}
+	if expr == "." {
+		return nil, nil
+	}
+	if !strings.HasPrefix(expr, ".") {
+		return nil, fmt.Errorf("pod template path %q is not a path to a field", k.PodTemplate)
+	}
+	fields := strings.Split(expr[1:], ".")
+	for _, field := range fields {
+		if field == "" || strings.ContainsAny(field, "[]*@?()$ ") {
+			return nil, fmt.Errorf("pod template path %q is not a path to a field", k.PodTemplate)
+		}
+	}
+	return fields, nil
+}
+
+// Group gives the API group of the kind, which is the part of the
+// apiVersion before the slash (or the empty string, for the core
+// group).
+func (k WorkloadKind) Group() string {
+	return apiGroup(k.APIVersion)
+}
+
+func apiGroup(apiVersion string) string {
+	if i := strings.Index(apiVersion, "/"); i >= 0 {
+		return apiVersion[:i]
+	}
+	return ""
+}
+
+// workloadKindKey gives the key under which a kind is registered,
+// which is its group and kind, with the kind in lower case.
+func workloadKindKey(group, kind string) string {
+	return group + "/" + strings.ToLower(kind)
+}
+
+// These kinds have their own representation, so can't be
+// registered. Resource IDs don't include the API group, so these
+// can't be registered in other groups either.
+var specialKinds = map[string]bool{
+	"cronjob":         true,
+	"daemonset":       true,
+	"deployment":      true,
+	"statefulset":     true,
+	"namespace":       true,
+	"list":            true,
+	"fluxhelmrelease": true,
+	"helmrelease":     true,
+}
+
+// The workload kinds that are supported out of the box, besides
+// those with their own representation.
+var builtinWorkloadKinds = []WorkloadKind{
+	{
+		APIVersion:  "v1",
+		Kind:        "Pod",
+		PodTemplate: "{.}",
+	},
+	{
+		APIVersion:  "v1",
+		Kind:        "ReplicationController",
+		PodTemplate: "{.spec.template}",
+		Status: WorkloadStatus{
+			ObservedGeneration: "{.status.observedGeneration}",
+			Desired:            "{.spec.replicas}",
+			Ready:              "{.status.readyReplicas}",
+			Available:          "{.status.availableReplicas}",
+		},
+	},
+	{
+		APIVersion:  "apps/v1",
+		Kind:        "ReplicaSet",
+		PodTemplate: "{.spec.template}",
+		Status: WorkloadStatus{
+			ObservedGeneration: "{.status.observedGeneration}",
+			Desired:            "{.spec.replicas}",
+			Ready:              "{.status.readyReplicas}",
+			Available:          "{.status.availableReplicas}",
+		},
+	},
+	{
+		APIVersion:  "batch/v1",
+		Kind:        "Job",
+		PodTemplate: "{.spec.template}",
+		Immutable:   true,
+	},
+}
+
+var (
+	workloadKindsMu sync.RWMutex
+	workloadKinds   = map[string]WorkloadKind{}
+)
+
+func init() {
+	for _, kind := range builtinWorkloadKinds {
+		if err := RegisterWorkloadKind(kind); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterWorkloadKind makes resources of the kind described be
+// parsed as workloads. Kinds are told apart by their API group as
+// well as their kind, so that resources of the same kind in another
+// group are not taken to be workloads.
+func RegisterWorkloadKind(kind WorkloadKind) error {
+	if kind.APIVersion == "" || kind.Kind == "" {
+		return fmt.Errorf("workload kind must have apiVersion and kind")
+	}
+	if specialKinds[strings.ToLower(kind.Kind)] {
+		return fmt.Errorf("workload kind %s is already supported", kind.Kind)
+	}
+	if _, err := kind.TemplatePath(); err != nil {
+		return err
+	}
+
+	key := workloadKindKey(kind.Group(), kind.Kind)
+	workloadKindsMu.Lock()
+	defer workloadKindsMu.Unlock()
+	if _, ok := workloadKinds[key]; ok {
+		return fmt.Errorf("workload kind %s in API version %s is already registered", kind.Kind, kind.APIVersion)
+	}
+	workloadKinds[key] = kind
+	return nil
+}
+
+// LookupWorkloadKind gives the registered workload kind for
+// resources with the API version and kind given (the kind compared
+// without regard to case), if there is one. Any version of the kind's
+// API group will do.
+func LookupWorkloadKind(apiVersion, kind string) (WorkloadKind, bool) {
+	workloadKindsMu.RLock()
+	defer workloadKindsMu.RUnlock()
+	k, ok := workloadKinds[workloadKindKey(apiGroup(apiVersion), kind)]
+	return k, ok
+}
+
+// WorkloadKinds gives all the registered workload kinds, sorted by
+// kind.
+func WorkloadKinds() []WorkloadKind {
+	workloadKindsMu.RLock()
+	defer workloadKindsMu.RUnlock()
+	var kinds []WorkloadKind
+	for _, kind := range workloadKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if kinds[i].Kind != kinds[j].Kind {
+			return kinds[i].Kind < kinds[j].Kind
+		}
+		return kinds[i].Group() < kinds[j].Group()
+	})
+	return kinds
+}
+
+// GenericWorkload is a resource of a registered workload kind.
+type GenericWorkload struct {
+	baseObject
+	Template  PodTemplate
+	immutable bool
+}
+
+func (w GenericWorkload) Containers() []resource.Container {
+	return w.Template.Containers()
+}
+
+func (w GenericWorkload) SetContainerImage(container string, ref image.Ref) error {
+	return w.Template.SetContainerImage(container, ref)
+}
+
+func (w GenericWorkload) Immutable() bool {
+	return w.immutable
+}
+
+var _ resource.Workload = GenericWorkload{}
+var _ resource.Immutable = GenericWorkload{}
+
+func unmarshalWorkload(base baseObject, kind WorkloadKind, bytes []byte) (*GenericWorkload, error) {
+	path, err := kind.TemplatePath()
+	if err != nil {
+		return nil, err
+	}
+	var template interface{}
+	if err := yaml.Unmarshal(bytes, &template); err != nil {
+		return nil, err
+	}
+	for _, field := range path {
+		m, ok := template.(map[interface{}]interface{})
+		if !ok {
+			template = nil
+			break
+		}
+		template = m[field]
+	}
+
+	workload := &GenericWorkload{baseObject: base, immutable: kind.Immutable}
+	if template == nil {
+		return workload, nil
+	}
+	templateBytes, err := yaml.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(templateBytes, &workload.Template); err != nil {
+		return nil, err
+	}
+	return workload, nil
+}
@@ -0,0 +1,163 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/resource"
+)
+
+func TestTemplatePath(t *testing.T) {
+	for expr, expected := range map[string][]string{
+		"{.spec.template}":                  {"spec", "template"},
+		".spec.template":                    {"spec", "template"},
+		"{.spec.jobTemplate.spec.template}": {"spec", "jobTemplate", "spec", "template"},
+		"{.}":                               nil,
+	} {
+		path, err := WorkloadKind{PodTemplate: expr}.TemplatePath()
+		if err != nil {
+			t.Errorf("%q: %s", expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(expected, path) {
+			t.Errorf("%q: expected %#v, got %#v", expr, expected, path)
+		}
+	}
+
+	for _, expr := range []string{"", "{}", "spec.template", "{.spec.containers[0]}", "{.spec..template}"} {
+		if _, err := (WorkloadKind{PodTemplate: expr}).TemplatePath(); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestRegisterWorkloadKindErrors(t *testing.T) {
+	for _, kind := range []WorkloadKind{
+		{Kind: "Rollout", PodTemplate: "{.spec.template}"},
+		{APIVersion: "apps/v1", Kind: "Deployment", PodTemplate: "{.spec.template}"},
+		{APIVersion: "apps/v1", Kind: "ReplicaSet", PodTemplate: "{.spec.template}"},
+		{APIVersion: "argoproj.io/v1alpha1", Kind: "Rollout", PodTemplate: "{.spec.containers[*]}"},
+	} {
+		if err := RegisterWorkloadKind(kind); err == nil {
+			t.Errorf("expected error registering %#v", kind)
+		}
+	}
+}
+
+func TestParseWorkloadKinds(t *testing.T) {
+	doc := `---
+apiVersion: apps/v1
+kind: ReplicaSet
+metadata:
+  name: frontend
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: php-redis
+        image: gcr.io/google_samples/gb-frontend:v3
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: static
+  namespace: web
+spec:
+  initContainers:
+  - name: migrate
+    image: quay.io/example/app:v1
+  containers:
+  - name: app
+    image: quay.io/example/app:v1
+`
+	objs, err := ParseMultidoc([]byte(doc), "test")
+	assert.NoError(t, err)
+
+	obj, ok := objs["default:replicaset/frontend"]
+	assert.True(t, ok)
+	rs, ok := obj.(*GenericWorkload)
+	if assert.True(t, ok) {
+		containers := rs.Containers()
+		if assert.Len(t, containers, 1) {
+			assert.Equal(t, "php-redis", containers[0].Name)
+			assert.Equal(t, "gcr.io/google_samples/gb-frontend:v3", containers[0].Image.String())
+		}
+	}
+
+	obj, ok = objs["web:pod/static"]
+	assert.True(t, ok)
+	pod, ok := obj.(resource.Workload)
+	if assert.True(t, ok) {
+		var names []string
+		for _, c := range pod.Containers() {
+			names = append(names, c.Name)
+		}
+		assert.Equal(t, []string{"app", "migrate"}, names)
+	}
+}
+
+func TestWorkloadKindGroups(t *testing.T) {
+	assert.NoError(t, RegisterWorkloadKind(WorkloadKind{APIVersion: "example.com/v1", Kind: "Widget", PodTemplate: "{.spec.template}"}))
+	// The same kind can be registered in another group
+	assert.NoError(t, RegisterWorkloadKind(WorkloadKind{APIVersion: "other.io/v1", Kind: "Widget", PodTemplate: "{.spec.pod}"}))
+	assert.Error(t, RegisterWorkloadKind(WorkloadKind{APIVersion: "example.com/v2", Kind: "Widget", PodTemplate: "{.spec.template}"}))
+
+	kind, ok := LookupWorkloadKind("example.com/v2", "widget")
+	assert.True(t, ok)
+	assert.Equal(t, "{.spec.template}", kind.PodTemplate)
+	_, ok = LookupWorkloadKind("unrelated.org/v1", "Widget")
+	assert.False(t, ok)
+
+	objs, err := ParseMultidoc([]byte(`---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: registered
+---
+apiVersion: unrelated.org/v1
+kind: Widget
+metadata:
+  name: unregistered
+`), "test")
+	assert.NoError(t, err)
+	_, ok = objs["default:widget/registered"].(resource.Workload)
+	assert.True(t, ok)
+	_, ok = objs["default:widget/unregistered"].(resource.Workload)
+	assert.False(t, ok)
+}
+
+func TestJobIsImmutable(t *testing.T) {
+	objs, err := ParseMultidoc([]byte(`---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: quay.io/example/app:v1
+---
+apiVersion: apps/v1
+kind: ReplicaSet
+metadata:
+  name: frontend
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: quay.io/example/app:v1
+`), "test")
+	assert.NoError(t, err)
+	job, ok := objs["default:job/migrate"].(resource.Workload)
+	if assert.True(t, ok) {
+		assert.Len(t, job.Containers(), 1)
+		assert.True(t, resource.IsImmutable(job))
+	}
+	assert.False(t, resource.IsImmutable(objs["default:replicaset/frontend"]))
+}
@@ -1,10 +1,20 @@
 package kubernetes
 
 import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 	apiapps "k8s.io/api/apps/v1"
 	apibatch "k8s.io/api/batch/v1beta1"
 	apiv1 "k8s.io/api/core/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
@@ -68,13 +78,22 @@ func (pc podController) toClusterController(resourceID flux.ResourceID) cluster.
 		clusterContainers = append(clusterContainers, resource.Container{Name: container.Name, Image: ref})
 	}
 	for _, container := range pc.podTemplate.Spec.InitContainers {
+		if excuse != "" {
+			break
+		}
 		ref, err := image.ParseRef(container.Image)
 		if err != nil {
 			clusterContainers = nil
 			excuse = err.Error()
 			break
 		}
-		clusterContainers = append(clusterContainers, resource.Container{Name: container.Name, Image: ref})
+		clusterContainers = append(clusterContainers, resource.Container{Name: container.Name, Image: ref, Init: true})
+	}
+	if excuse == "" {
+		// Problems with image markers are reported when fetching
+		// images; here, we just use the markers that work.
+		marked, _ := markedImages(pc.k8sObject)
+		clusterContainers = append(clusterContainers, marked...)
 	}
 
 	var antecedent flux.ResourceID
@@ -476,3 +495,254 @@ func makeHelmReleasePodController(helmRelease *fhr_v1beta1.HelmRelease) podContr
 		k8sObject:   helmRelease,
 	}
 }
+
+/////////////////////////////////////////////////////////////////////////////
+// Workload kinds registered with RegisterWorkloadKind
+
+func init() {
+	for _, wk := range kresource.WorkloadKinds() {
+		kind, err := makeWorkloadKind(wk)
+		if err != nil {
+			panic(err)
+		}
+		resourceKinds[strings.ToLower(wk.Kind)] = kind
+	}
+}
+
+// RegisterWorkloadKind makes resources of the kind described
+// available as workloads, both in manifests and in the cluster; so,
+// for example, their images can be listed and automated. It must be
+// called before any manifests are loaded or controllers listed.
+// Resource IDs don't include the API group, so only one group's kind
+// of a given name can be registered.
+func RegisterWorkloadKind(wk kresource.WorkloadKind) error {
+	kind, err := makeWorkloadKind(wk)
+	if err != nil {
+		return err
+	}
+	if existing, ok := resourceKinds[strings.ToLower(wk.Kind)].(*workloadKind); ok {
+		return errors.Errorf("workload kind %s is already registered with API version %s", wk.Kind, existing.apiVersion)
+	}
+	if err := kresource.RegisterWorkloadKind(wk); err != nil {
+		return err
+	}
+	resourceKinds[strings.ToLower(wk.Kind)] = kind
+	return nil
+}
+
+// LoadWorkloadKinds registers each of the workload kinds listed in
+// the YAML file given.
+func LoadWorkloadKinds(path string) error {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var kinds []kresource.WorkloadKind
+	if err := yaml.UnmarshalStrict(bytes, &kinds); err != nil {
+		return errors.Wrapf(err, "parsing workload kinds in %s", path)
+	}
+	for _, wk := range kinds {
+		if err := RegisterWorkloadKind(wk); err != nil {
+			return errors.Wrapf(err, "registering workload kind from %s", path)
+		}
+	}
+	return nil
+}
+
+// isWorkloadKind says whether resources of the API version and kind
+// given are workloads. Registered workload kinds belong to a
+// particular API group; the others are taken to be workloads in any
+// group.
+func isWorkloadKind(apiVersion, kind string) bool {
+	rk, ok := resourceKinds[strings.ToLower(kind)]
+	if !ok {
+		return false
+	}
+	if _, registered := rk.(*workloadKind); registered {
+		_, ok = kresource.LookupWorkloadKind(apiVersion, kind)
+	}
+	return ok
+}
+
+type workloadKind struct {
+	apiVersion   string
+	kind         string
+	resource     schema.GroupVersionResource
+	templatePath []string
+	status       workloadStatusPaths
+}
+
+type workloadStatusPaths struct {
+	observedGeneration, desired, updated, ready, available *jsonpath.JSONPath
+}
+
+func makeWorkloadKind(wk kresource.WorkloadKind) (*workloadKind, error) {
+	gv, err := schema.ParseGroupVersion(wk.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	resource := wk.Resource
+	if resource == "" {
+		resource = strings.ToLower(wk.Kind) + "s"
+	}
+	templatePath, err := wk.TemplatePath()
+	if err != nil {
+		return nil, err
+	}
+
+	kind := &workloadKind{
+		apiVersion:   wk.APIVersion,
+		kind:         wk.Kind,
+		resource:     gv.WithResource(resource),
+		templatePath: templatePath,
+	}
+	for _, path := range []struct {
+		expr string
+		into **jsonpath.JSONPath
+	}{
+		{wk.Status.ObservedGeneration, &kind.status.observedGeneration},
+		{wk.Status.Desired, &kind.status.desired},
+		{wk.Status.Updated, &kind.status.updated},
+		{wk.Status.Ready, &kind.status.ready},
+		{wk.Status.Available, &kind.status.available},
+	} {
+		if path.expr == "" {
+			continue
+		}
+		jp := jsonpath.New(wk.Kind)
+		jp.AllowMissingKeys(true)
+		if err := jp.Parse(path.expr); err != nil {
+			return nil, errors.Wrapf(err, "parsing status path %q for %s", path.expr, wk.Kind)
+		}
+		*path.into = jp
+	}
+	return kind, nil
+}
+
+func (wk *workloadKind) getPodController(c *Cluster, namespace, name string) (podController, error) {
+	obj, err := c.client.dynamicClient.Resource(wk.resource).Namespace(namespace).Get(name, meta_v1.GetOptions{})
+	if err != nil {
+		return podController{}, err
+	}
+	return wk.makePodController(obj)
+}
+
+func (wk *workloadKind) getPodControllers(c *Cluster, namespace string) ([]podController, error) {
+	list, err := c.client.dynamicClient.Resource(wk.resource).Namespace(namespace).List(meta_v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var podControllers []podController
+	for i := range list.Items {
+		obj := &list.Items[i]
+		// Pods, ReplicaSets and Jobs are usually created by another
+		// workload; it's that one which should be reported.
+		if meta_v1.GetControllerOf(obj) != nil {
+			continue
+		}
+		pc, err := wk.makePodController(obj)
+		if err != nil {
+			return nil, err
+		}
+		podControllers = append(podControllers, pc)
+	}
+	return podControllers, nil
+}
+
+func (wk *workloadKind) makePodController(obj *unstructured.Unstructured) (podController, error) {
+	var podTemplate apiv1.PodTemplateSpec
+	template, found, err := unstructured.NestedMap(obj.Object, wk.templatePath...)
+	if err != nil {
+		return podController{}, errors.Wrapf(err, "finding pod template in %s %s", wk.kind, obj.GetName())
+	}
+	if found {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(template, &podTemplate); err != nil {
+			return podController{}, errors.Wrapf(err, "reading pod template in %s %s", wk.kind, obj.GetName())
+		}
+	}
+
+	apiVersion := obj.GetAPIVersion()
+	if apiVersion == "" {
+		apiVersion = wk.apiVersion
+	}
+	// When exported, the apiVersion and kind are written
+	// separately, so leave them out of the object
+	exported := obj.DeepCopy()
+	delete(exported.Object, "apiVersion")
+	delete(exported.Object, "kind")
+
+	status, rollout := wk.rolloutStatus(obj)
+	return podController{
+		apiVersion:  apiVersion,
+		kind:        wk.kind,
+		name:        obj.GetName(),
+		status:      status,
+		rollout:     rollout,
+		podTemplate: podTemplate,
+		k8sObject:   exported,
+	}, nil
+}
+
+// rolloutStatus works out the progress of a rollout from whichever
+// of the status fields were given for the kind.
+func (wk *workloadKind) rolloutStatus(obj *unstructured.Unstructured) (string, cluster.RolloutStatus) {
+	paths := wk.status
+	if paths == (workloadStatusPaths{}) {
+		// Nothing to go on, so treat it like a CronJob
+		return cluster.StatusReady, cluster.RolloutStatus{}
+	}
+
+	var rollout cluster.RolloutStatus
+	rollout.Desired = int32(evalCount(paths.desired, obj))
+	rollout.Updated = int32(evalCount(paths.updated, obj))
+	rollout.Ready = int32(evalCount(paths.ready, obj))
+	rollout.Available = int32(evalCount(paths.available, obj))
+
+	complete := true
+	if paths.desired != nil {
+		if paths.updated != nil {
+			rollout.Outdated = rollout.Desired - rollout.Updated
+			complete = rollout.Updated == rollout.Desired
+		}
+		if paths.available != nil {
+			complete = complete && rollout.Available == rollout.Desired
+		} else if paths.ready != nil {
+			complete = complete && rollout.Ready == rollout.Desired
+		}
+	}
+
+	status := cluster.StatusStarted
+	if paths.observedGeneration == nil || evalCount(paths.observedGeneration, obj) >= obj.GetGeneration() {
+		// the definition has been updated; now let's see about the replicas
+		status = cluster.StatusUpdating
+		if complete {
+			status = cluster.StatusReady
+		}
+	}
+	return status, rollout
+}
+
+// evalCount gives the number at the JSONPath given in the object, or
+// zero if there's no such field or it's not a number.
+func evalCount(path *jsonpath.JSONPath, obj *unstructured.Unstructured) int64 {
+	if path == nil {
+		return 0
+	}
+	results, err := path.FindResults(obj.Object)
+	if err != nil || len(results) == 0 || len(results[0]) == 0 {
+		return 0
+	}
+	switch v := results[0][0].Interface().(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
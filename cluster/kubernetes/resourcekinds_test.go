@@ -0,0 +1,181 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	apiapps "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+)
+
+func unstructuredObj(obj map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func TestWorkloadKindPodController(t *testing.T) {
+	template := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": "quay.io/example/app:v1"},
+			},
+		},
+	}
+	replicaSet := unstructuredObj(map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "ReplicaSet",
+		"metadata": map[string]interface{}{
+			"name":       "standalone",
+			"namespace":  "default",
+			"generation": int64(2),
+		},
+		"spec": map[string]interface{}{"replicas": int64(3), "template": template},
+		"status": map[string]interface{}{
+			"observedGeneration": int64(2),
+			"readyReplicas":      int64(3),
+			"availableReplicas":  int64(2),
+		},
+	})
+
+	client := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), replicaSet)
+	c := NewCluster(nil, nil, client, nil, nil, log.NewNopLogger(), nil)
+
+	kind := resourceKinds["replicaset"]
+	pc, err := kind.getPodController(c, "default", "standalone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	controller := pc.toClusterController(flux.MustParseResourceID("default:replicaset/standalone"))
+	if controller.Status != cluster.StatusUpdating {
+		t.Errorf("expected status %q while not all replicas are available, got %q", cluster.StatusUpdating, controller.Status)
+	}
+	expected := cluster.RolloutStatus{Desired: 3, Ready: 3, Available: 2}
+	if !reflect.DeepEqual(controller.Rollout, expected) {
+		t.Errorf("expected rollout %#v, got %#v", expected, controller.Rollout)
+	}
+	if len(controller.Containers.Containers) != 1 || controller.Containers.Containers[0].Image.String() != "quay.io/example/app:v1" {
+		t.Errorf("expected container from the pod template, got %#v", controller.Containers)
+	}
+}
+
+func TestRegisteredWorkloadKind(t *testing.T) {
+	wk := kresource.WorkloadKind{
+		APIVersion:  "example.com/v1",
+		Kind:        "Frobnicator",
+		PodTemplate: "{.spec.pod}",
+		Status: kresource.WorkloadStatus{
+			ObservedGeneration: "{.status.observedGeneration}",
+			Desired:            "{.spec.replicas}",
+			Updated:            "{.status.replicas[?(@.updated==true)].count}",
+		},
+	}
+	kind, err := makeWorkloadKind(wk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind.resource.Resource != "frobnicators" || kind.resource.Group != "example.com" {
+		t.Errorf("expected resource to be guessed from kind, got %#v", kind.resource)
+	}
+
+	obj := unstructuredObj(map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Frobnicator",
+		"metadata":   map[string]interface{}{"name": "frob", "generation": int64(1)},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"pod": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "frob", "image": "frob:v1"},
+					},
+				},
+			},
+		},
+		"status": map[string]interface{}{
+			"observedGeneration": int64(1),
+			"replicas": []interface{}{
+				map[string]interface{}{"updated": true, "count": int64(2)},
+				map[string]interface{}{"updated": false, "count": int64(0)},
+			},
+		},
+	})
+	pc, err := kind.makePodController(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.status != cluster.StatusReady {
+		t.Errorf("expected status %q, got %q", cluster.StatusReady, pc.status)
+	}
+	if len(pc.podTemplate.Spec.Containers) != 1 || pc.podTemplate.Spec.Containers[0].Image != "frob:v1" {
+		t.Errorf("expected container from pod template, got %#v", pc.podTemplate.Spec.Containers)
+	}
+
+	if _, err := makeWorkloadKind(kresource.WorkloadKind{
+		APIVersion:  "example.com/v1",
+		Kind:        "Frobnicator",
+		PodTemplate: "{.spec.pod}",
+		Status:      kresource.WorkloadStatus{Desired: "{.spec.replicas"},
+	}); err == nil {
+		t.Error("expected error for malformed status path")
+	}
+}
+
+func TestRegisterWorkloadKindGroups(t *testing.T) {
+	wk := kresource.WorkloadKind{APIVersion: "example.com/v1", Kind: "Gadget", PodTemplate: "{.spec.template}"}
+	if err := RegisterWorkloadKind(wk); err != nil {
+		t.Fatal(err)
+	}
+	if !isWorkloadKind("example.com/v1beta1", "Gadget") {
+		t.Error("expected Gadget to be a workload kind in example.com")
+	}
+	if isWorkloadKind("other.io/v1", "Gadget") {
+		t.Error("expected Gadget not to be a workload kind in other.io")
+	}
+	if !isWorkloadKind("extensions/v1beta1", "Deployment") {
+		t.Error("expected Deployment to be a workload kind")
+	}
+
+	// Resource IDs don't include the group, so the same kind can't
+	// be registered in another group
+	wk.APIVersion = "other.io/v1"
+	if err := RegisterWorkloadKind(wk); err == nil {
+		t.Error("expected error registering Gadget in another group")
+	}
+}
+
+func TestInitContainers(t *testing.T) {
+	pc := podController{
+		k8sObject: &apiapps.Deployment{},
+		podTemplate: apiv1.PodTemplateSpec{
+			Spec: apiv1.PodSpec{
+				InitContainers: []apiv1.Container{{Name: "migrate", Image: "quay.io/example/app:v1"}},
+				Containers:     []apiv1.Container{{Name: "app", Image: "quay.io/example/app:v1"}},
+			},
+		},
+	}
+	id := flux.MustParseResourceID("default:deployment/app")
+	containers := pc.toClusterController(id).ContainersOrNil()
+	if len(containers) != 2 {
+		t.Fatalf("expected two containers, got %#v", containers)
+	}
+	if containers[0].Name != "app" || containers[0].Init {
+		t.Errorf("expected app container first, and not marked init, got %#v", containers[0])
+	}
+	if containers[1].Name != "migrate" || !containers[1].Init {
+		t.Errorf("expected migrate container marked init, got %#v", containers[1])
+	}
+
+	pc.podTemplate.Spec.Containers[0].Image = "quay.io/example/app:"
+	c := pc.toClusterController(id)
+	if c.ContainersOrNil() != nil || c.Containers.Excuse == "" {
+		t.Errorf("expected no containers and an excuse for bad image, got %#v", c.Containers)
+	}
+}
@@ -2,13 +2,16 @@ package kubernetes
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os/exec"
-	"sort"
+	"reflect"
 	"strings"
 	"time"
 
+	k8syaml "github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	rest "k8s.io/client-go/rest"
 
 	"github.com/go-kit/kit/log"
@@ -31,7 +34,13 @@ func (c *changeSet) stage(cmd string, o *apiObject) {
 
 // Applier is something that will apply a changeset to the cluster.
 type Applier interface {
-	apply(log.Logger, changeSet, map[flux.ResourceID]error) cluster.SyncError
+	// apply applies the changeset, giving the outcome for each object
+	// that was applied or deleted, and an error for each that
+	// wasn't.
+	apply(log.Logger, changeSet, map[flux.ResourceID]error) (cluster.SyncResult, cluster.SyncError)
+	// plan works out what applying the changeset would do, without
+	// changing anything in the cluster.
+	plan(log.Logger, changeSet) cluster.SyncPlan
 }
 
 type Kubectl struct {
@@ -72,49 +81,8 @@ func (c *Kubectl) connectArgs() []string {
 	return args
 }
 
-// rankOfKind returns an int denoting the position of the given kind
-// in the partial ordering of Kubernetes resources, according to which
-// kinds depend on which (derived by hand).
-func rankOfKind(kind string) int {
-	switch kind {
-	// Namespaces answer to NOONE
-	case "Namespace":
-		return 0
-	// These don't go in namespaces; or do, but don't depend on anything else
-	case "CustomResourceDefinition", "ServiceAccount", "ClusterRole", "Role", "PersistentVolume", "Service":
-		return 1
-	// These depend on something above, but not each other
-	case "ResourceQuota", "LimitRange", "Secret", "ConfigMap", "RoleBinding", "ClusterRoleBinding", "PersistentVolumeClaim", "Ingress":
-		return 2
-	// Same deal, next layer
-	case "DaemonSet", "Deployment", "ReplicationController", "ReplicaSet", "Job", "CronJob", "StatefulSet":
-		return 3
-	// Assumption: anything not mentioned isn't depended _upon_, so
-	// can come last.
-	default:
-		return 4
-	}
-}
-
-type applyOrder []*apiObject
-
-func (objs applyOrder) Len() int {
-	return len(objs)
-}
-
-func (objs applyOrder) Swap(i, j int) {
-	objs[i], objs[j] = objs[j], objs[i]
-}
-
-func (objs applyOrder) Less(i, j int) bool {
-	ranki, rankj := rankOfKind(objs[i].Kind), rankOfKind(objs[j].Kind)
-	if ranki == rankj {
-		return objs[i].Metadata.Name < objs[j].Metadata.Name
-	}
-	return ranki < rankj
-}
-
-func (c *Kubectl) apply(logger log.Logger, cs changeSet, errored map[flux.ResourceID]error) (errs cluster.SyncError) {
+func (c *Kubectl) apply(logger log.Logger, cs changeSet, errored map[flux.ResourceID]error) (result cluster.SyncResult, errs cluster.SyncError) {
+	result = cluster.SyncResult{}
 	f := func(objs []*apiObject, cmd string, args ...string) {
 		if len(objs) == 0 {
 			return
@@ -138,14 +106,18 @@ func (c *Kubectl) apply(logger log.Logger, cs changeSet, errored map[flux.Resour
 		}
 
 		if len(multi) > 0 {
-			if err := c.doCommand(logger, makeMultidoc(multi), args...); err != nil {
+			if out, err := c.doCommand(logger, makeMultidoc(multi), args...); err != nil {
 				single = append(single, multi...)
+			} else {
+				recordOutcomes(result, cmd, multi, out)
 			}
 		}
 		for _, obj := range single {
 			r := bytes.NewReader(obj.Bytes())
-			if err := c.doCommand(logger, r, args...); err != nil {
+			if out, err := c.doCommand(logger, r, args...); err != nil {
 				errs = append(errs, cluster.ResourceError{obj.Resource, err})
+			} else {
+				recordOutcomes(result, cmd, []*apiObject{obj}, out)
 			}
 		}
 	}
@@ -153,20 +125,100 @@ func (c *Kubectl) apply(logger log.Logger, cs changeSet, errored map[flux.Resour
 	// When deleting objects, the only real concern is that we don't
 	// try to delete things that have already been deleted by
 	// Kubernete's GC -- most notably, resources in a namespace which
-	// is also being deleted. GC does not have the dependency ranking,
+	// is also being deleted. GC does not have the dependency ordering,
 	// but we can use it as a shortcut to avoid the above problem at
 	// least.
-	objs := cs.objs["delete"]
-	sort.Sort(sort.Reverse(applyOrder(objs)))
-	f(objs, "delete")
+	f(deleteOrder(cs.objs["delete"]), "delete")
+
+	stages, orderErrs := applyStages(cs.objs["apply"])
+	errs = append(errs, orderErrs...)
+	for i, stage := range stages {
+		f(stage, "apply")
+		// Custom resources can't be applied until their definitions
+		// are established; if waiting fails, so will applying them,
+		// and that's where the error will be reported.
+		if crds := crdsIn(stage); len(crds) > 0 && i < len(stages)-1 {
+			c.doCommand(logger, makeMultidoc(crds), "wait", "--for=condition=established", fmt.Sprintf("--timeout=%s", crdEstablishedTimeout))
+		}
+	}
+	return result, errs
+}
+
+// doCommand runs kubectl with the given arguments, logging the
+// outcome, and returns what was printed to stdout.
+func (c *Kubectl) doCommand(logger log.Logger, r io.Reader, args ...string) (string, error) {
+	begin := time.Now()
+	stdout, err := c.runCommand(r, args...)
+	logger.Log("cmd", "kubectl "+strings.Join(args, " ")+" -f -", "took", time.Since(begin), "err", err, "output", stdout)
+	return stdout, err
+}
 
-	objs = cs.objs["apply"]
-	sort.Sort(applyOrder(objs))
-	f(objs, "apply")
-	return errs
+// recordOutcomes reads what kubectl reports having done to each of
+// the objects given from its output, which has a line per object, in
+// the order they were supplied; e.g.,
+//
+//	deployment.apps/helloworld configured
+//	service "helloworld" deleted
+//
+// Lines are matched up with objects by kind and name, since kubectl
+// may not report objects in the order given. An object without a line
+// of its own was nonetheless dealt with (the command succeeded), so
+// gets the outcome expected for the command.
+func recordOutcomes(result cluster.SyncResult, cmd string, objs []*apiObject, out string) {
+	outcomes := map[string][]cluster.SyncOutcome{}
+	for _, line := range strings.Split(out, "\n") {
+		ref, outcome, ok := parseOutcome(line)
+		if ok {
+			outcomes[ref] = append(outcomes[ref], outcome)
+		}
+	}
+
+	for _, obj := range objs {
+		outcome := cluster.SyncConfigured
+		if cmd == "delete" {
+			outcome = cluster.SyncDeleted
+		}
+		ref := strings.ToLower(obj.Kind) + "/" + obj.Metadata.Name
+		if found := outcomes[ref]; len(found) > 0 {
+			outcome, outcomes[ref] = found[0], found[1:]
+		}
+		result[obj.ResourceID()] = outcome
+	}
 }
 
-func (c *Kubectl) doCommand(logger log.Logger, r io.Reader, args ...string) error {
+// parseOutcome parses a line of kubectl output into a reference to
+// the object it concerns, as `kind/name` with the kind lower-cased
+// and without its group, and what was done to it. kubectl refers to
+// objects either as `kind.group/name` or `kind.group "name"`.
+func parseOutcome(line string) (string, cluster.SyncOutcome, bool) {
+	fields := strings.Fields(line)
+	var kind, name, outcome string
+	switch len(fields) {
+	case 2:
+		i := strings.Index(fields[0], "/")
+		if i < 0 {
+			return "", "", false
+		}
+		kind, name, outcome = fields[0][:i], fields[0][i+1:], fields[1]
+	case 3:
+		kind, name, outcome = fields[0], strings.Trim(fields[1], `"`), fields[2]
+	default:
+		return "", "", false
+	}
+	if i := strings.Index(kind, "."); i >= 0 {
+		kind = kind[:i]
+	}
+	switch o := cluster.SyncOutcome(outcome); o {
+	case cluster.SyncCreated, cluster.SyncConfigured, cluster.SyncUnchanged, cluster.SyncDeleted:
+		return strings.ToLower(kind) + "/" + name, o, true
+	}
+	return "", "", false
+}
+
+// runCommand runs kubectl with the given arguments, supplying the
+// reader as the file to operate on, and returns what was printed to
+// stdout.
+func (c *Kubectl) runCommand(r io.Reader, args ...string) (string, error) {
 	args = append(args, "-f", "-")
 	cmd := c.kubectlCommand(args...)
 	cmd.Stdin = r
@@ -175,14 +227,87 @@ func (c *Kubectl) doCommand(logger log.Logger, r io.Reader, args ...string) erro
 	stdout := &bytes.Buffer{}
 	cmd.Stdout = stdout
 
-	begin := time.Now()
 	err := cmd.Run()
 	if err != nil {
 		err = errors.Wrap(errors.New(strings.TrimSpace(stderr.String())), "running kubectl")
 	}
+	return strings.TrimSpace(stdout.String()), err
+}
+
+func (c *Kubectl) plan(logger log.Logger, cs changeSet) cluster.SyncPlan {
+	var plan cluster.SyncPlan
+
+	// Deletions are taken at face value; the resources to delete
+	// were found in the cluster in the first place.
+	for _, obj := range deleteOrder(cs.objs["delete"]) {
+		plan = append(plan, cluster.ResourcePlan{
+			ID:     obj.ResourceID(),
+			Source: obj.Source(),
+			Action: cluster.PlanDelete,
+		})
+	}
 
-	logger.Log("cmd", "kubectl "+strings.Join(args, " "), "took", time.Since(begin), "err", err, "output", strings.TrimSpace(stdout.String()))
-	return err
+	stages, errs := applyStages(cs.objs["apply"])
+	for _, stage := range stages {
+		for _, obj := range stage {
+			p := cluster.ResourcePlan{
+				ID:     obj.ResourceID(),
+				Source: obj.Source(),
+			}
+			action, err := c.planApply(obj)
+			if err != nil {
+				logger.Log("resource", obj.ResourceID(), "err", err)
+				p.Error = err.Error()
+			} else {
+				p.Action = action
+			}
+			plan = append(plan, p)
+		}
+	}
+	return append(plan, errorPlan(errs)...)
+}
+
+// errorPlan gives plan entries for resources that couldn't be
+// considered for syncing at all.
+func errorPlan(errs cluster.SyncError) cluster.SyncPlan {
+	var plan cluster.SyncPlan
+	for _, e := range errs {
+		plan = append(plan, cluster.ResourcePlan{
+			ID:     e.ResourceID(),
+			Source: e.Source(),
+			Error:  e.Error.Error(),
+		})
+	}
+	return plan
+}
+
+// planApply does a dry run of applying a single object. A
+// (client-side) dry run with kubectl only tells us whether the object
+// would be created or configured; to tell if configuring it would
+// make no difference, we compare the definition with the live
+// object.
+func (c *Kubectl) planApply(obj *apiObject) (cluster.PlanAction, error) {
+	out, err := c.runCommand(bytes.NewReader(obj.Bytes()), "apply", "--dry-run")
+	if err != nil {
+		return "", err
+	}
+	// e.g., "deployment.apps/helloworld created (dry run)"
+	if fields := strings.Fields(out); len(fields) > 1 && fields[1] == "created" {
+		return cluster.PlanCreate, nil
+	}
+
+	live, err := c.runCommand(bytes.NewReader(obj.Bytes()), "get", "-o", "json")
+	if err != nil {
+		return "", err
+	}
+	applied, err := isApplied(obj.Bytes(), []byte(live))
+	if err != nil {
+		return "", err
+	}
+	if applied {
+		return cluster.PlanUnchanged, nil
+	}
+	return cluster.PlanUpdate, nil
 }
 
 func makeMultidoc(objs []*apiObject) *bytes.Buffer {
@@ -197,3 +322,67 @@ func makeMultidoc(objs []*apiObject) *bytes.Buffer {
 func (c *Kubectl) kubectlCommand(args ...string) *exec.Cmd {
 	return exec.Command(c.exe, append(c.connectArgs(), args...)...)
 }
+
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// isApplied says whether applying the definition given would leave
+// the live object (given as JSON) as it is; that is, whether the
+// definition is the one last applied, and none of the fields it
+// specifies have been changed since.
+func isApplied(def, live []byte) (bool, error) {
+	var desired, current map[string]interface{}
+	if err := k8syaml.Unmarshal(def, &desired); err != nil {
+		return false, errors.Wrap(err, "parsing definition")
+	}
+	if err := json.Unmarshal(live, &current); err != nil {
+		return false, errors.Wrap(err, "parsing live object")
+	}
+
+	lastApplied, _, _ := unstructured.NestedString(current, "metadata", "annotations", lastAppliedAnnotation)
+	if lastApplied == "" {
+		return false, nil
+	}
+	var last map[string]interface{}
+	if err := json.Unmarshal([]byte(lastApplied), &last); err != nil {
+		return false, errors.Wrap(err, "parsing last applied configuration")
+	}
+	// kubectl fills in the namespace, if it's not given in the
+	// definition.
+	if _, ok, _ := unstructured.NestedString(desired, "metadata", "namespace"); !ok {
+		unstructured.RemoveNestedField(last, "metadata", "namespace")
+	}
+	unstructured.RemoveNestedField(desired, "metadata", "annotations", lastAppliedAnnotation)
+	return reflect.DeepEqual(desired, last) && isSubset(desired, current), nil
+}
+
+// isSubset says whether every field in `a` has the same value in
+// `b`. Fields in `b` that are not in `a` (e.g., those filled in with
+// defaults by the API server) don't matter.
+func isSubset(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range a {
+			if !isSubset(v, b[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !isSubset(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
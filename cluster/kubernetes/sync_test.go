@@ -1,7 +1,8 @@
 package kubernetes
 
 import (
-	"sort"
+	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/go-kit/kit/log"
@@ -15,10 +16,14 @@ type mockApplier struct {
 	commandRun bool
 }
 
-func (m *mockApplier) apply(_ log.Logger, c changeSet, errored map[flux.ResourceID]error) cluster.SyncError {
+func (m *mockApplier) apply(_ log.Logger, c changeSet, errored map[flux.ResourceID]error) (cluster.SyncResult, cluster.SyncError) {
 	if len(c.objs) != 0 {
 		m.commandRun = true
 	}
+	return nil, nil
+}
+
+func (m *mockApplier) plan(_ log.Logger, c changeSet) cluster.SyncPlan {
 	return nil
 }
 
@@ -56,7 +61,7 @@ func setup(t *testing.T) (*Cluster, *mockApplier) {
 
 func TestSyncNop(t *testing.T) {
 	kube, mock := setup(t)
-	if err := kube.Sync(cluster.SyncDef{}); err != nil {
+	if _, err := kube.Sync(cluster.SyncDef{}); err != nil {
 		t.Errorf("%#v", err)
 	}
 	if mock.commandRun {
@@ -66,7 +71,7 @@ func TestSyncNop(t *testing.T) {
 
 func TestSyncMalformed(t *testing.T) {
 	kube, mock := setup(t)
-	err := kube.Sync(cluster.SyncDef{
+	_, err := kube.Sync(cluster.SyncDef{
 		Actions: []cluster.SyncAction{
 			cluster.SyncAction{
 				Apply: rsc{"default:deployment/trash", []byte("garbage")},
@@ -81,32 +86,80 @@ func TestSyncMalformed(t *testing.T) {
 	}
 }
 
-// TestApplyOrder checks that applyOrder works as expected.
-func TestApplyOrder(t *testing.T) {
-	objs := []*apiObject{
-		{
-			Kind: "Deployment",
-			Metadata: metadata{
-				Name: "deploy",
-			},
-		},
-		{
-			Kind: "Secret",
-			Metadata: metadata{
-				Name: "secret",
-			},
-		},
-		{
-			Kind: "Namespace",
-			Metadata: metadata{
-				Name: "namespace",
+func TestPlanSyncMalformed(t *testing.T) {
+	kube, _ := setup(t)
+	plan, err := kube.PlanSync(cluster.SyncDef{
+		Actions: []cluster.SyncAction{
+			cluster.SyncAction{
+				Apply: rsc{"default:deployment/trash", []byte("garbage")},
 			},
 		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 || plan[0].Error == "" || plan[0].Action != "" {
+		t.Errorf("expected a single entry with an error, got %#v", plan)
 	}
-	sort.Sort(applyOrder(objs))
-	for i, name := range []string{"namespace", "secret", "deploy"} {
-		if objs[i].Metadata.Name != name {
-			t.Errorf("Expected %q at position %d, got %q", name, i, objs[i].Metadata.Name)
+}
+
+func TestIsApplied(t *testing.T) {
+	def := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+data:
+  key: value
+`)
+	const lastApplied = `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"foo","namespace":"default"},"data":{"key":"value"}}`
+	for _, c := range []struct {
+		live     string
+		expected bool
+	}{
+		// never applied by kubectl
+		{`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"foo","namespace":"default"},"data":{"key":"value"}}`, false},
+		// applied, and not changed since
+		{`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"foo","namespace":"default","uid":"abc","annotations":{"` + lastAppliedAnnotation + `":` + strconv.Quote(lastApplied) + `}},"data":{"key":"value"}}`, true},
+		// applied, then changed by hand
+		{`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"foo","namespace":"default","annotations":{"` + lastAppliedAnnotation + `":` + strconv.Quote(lastApplied) + `}},"data":{"key":"other"}}`, false},
+	} {
+		applied, err := isApplied(def, []byte(c.live))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied != c.expected {
+			t.Errorf("expected isApplied to be %v for %s", c.expected, c.live)
 		}
 	}
 }
+
+func TestRecordOutcomes(t *testing.T) {
+	objs := []*apiObject{
+		stagedObj(t, "default:deployment/helloworld", "kind: Deployment\nmetadata:\n  name: helloworld\n"),
+		stagedObj(t, "default:service/helloworld", "kind: Service\nmetadata:\n  name: helloworld\n"),
+		stagedObj(t, "default:configmap/config", "kind: ConfigMap\nmetadata:\n  name: config\n"),
+		stagedObj(t, "default:secret/quiet", "kind: Secret\nmetadata:\n  name: quiet\n"),
+	}
+	result := cluster.SyncResult{}
+	// The deployment and service have the same name, and aren't
+	// reported in the order given
+	recordOutcomes(result, "apply", objs, `service/helloworld created
+deployment.apps/helloworld configured
+configmap/config unchanged`)
+	expected := cluster.SyncResult{
+		flux.MustParseResourceID("default:deployment/helloworld"): cluster.SyncConfigured,
+		flux.MustParseResourceID("default:service/helloworld"):    cluster.SyncCreated,
+		flux.MustParseResourceID("default:configmap/config"):      cluster.SyncUnchanged,
+		// no line of its own, but applied all the same
+		flux.MustParseResourceID("default:secret/quiet"): cluster.SyncConfigured,
+	}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("expected %#v, got %#v", expected, result)
+	}
+
+	result = cluster.SyncResult{}
+	recordOutcomes(result, "delete", objs[:1], `deployment.extensions "helloworld" deleted`)
+	if outcome := result[objs[0].ResourceID()]; outcome != cluster.SyncDeleted {
+		t.Errorf("expected deployment to be deleted, got %q", outcome)
+	}
+}
@@ -0,0 +1,111 @@
+package testfiles
+
+// OpenAPISchema is a cut-down version of the OpenAPI schema served by
+// Kubernetes, covering the kinds of resource in the test files, for
+// validating them without a cluster to hand.
+const OpenAPISchema = `{
+  "swagger": "2.0",
+  "info": {
+    "title": "Kubernetes",
+    "version": "v1.11.0"
+  },
+  "paths": {},
+  "definitions": {
+    "io.k8s.api.apps.v1.Deployment": {
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {"$ref": "#/definitions/io.k8s.api.apps.v1.DeploymentSpec"}
+      },
+      "x-kubernetes-group-version-kind": [
+        {"group": "apps", "kind": "Deployment", "version": "v1"}
+      ]
+    },
+    "io.k8s.api.apps.v1.DeploymentSpec": {
+      "required": ["selector", "template"],
+      "properties": {
+        "minReadySeconds": {"type": "integer", "format": "int32"},
+        "replicas": {"type": "integer", "format": "int32"},
+        "selector": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.LabelSelector"},
+        "template": {"$ref": "#/definitions/io.k8s.api.core.v1.PodTemplateSpec"}
+      }
+    },
+    "io.k8s.api.extensions.v1beta1.Deployment": {
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {"$ref": "#/definitions/io.k8s.api.extensions.v1beta1.DeploymentSpec"}
+      },
+      "x-kubernetes-group-version-kind": [
+        {"group": "extensions", "kind": "Deployment", "version": "v1beta1"}
+      ]
+    },
+    "io.k8s.api.extensions.v1beta1.DeploymentSpec": {
+      "required": ["template"],
+      "properties": {
+        "minReadySeconds": {"type": "integer", "format": "int32"},
+        "replicas": {"type": "integer", "format": "int32"},
+        "selector": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.LabelSelector"},
+        "template": {"$ref": "#/definitions/io.k8s.api.core.v1.PodTemplateSpec"}
+      }
+    },
+    "io.k8s.api.core.v1.ConfigMap": {
+      "properties": {
+        "apiVersion": {"type": "string"},
+        "kind": {"type": "string"},
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "data": {"type": "object", "additionalProperties": {"type": "string"}}
+      },
+      "x-kubernetes-group-version-kind": [
+        {"group": "", "kind": "ConfigMap", "version": "v1"}
+      ]
+    },
+    "io.k8s.api.core.v1.PodTemplateSpec": {
+      "properties": {
+        "metadata": {"$ref": "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+        "spec": {"$ref": "#/definitions/io.k8s.api.core.v1.PodSpec"}
+      }
+    },
+    "io.k8s.api.core.v1.PodSpec": {
+      "required": ["containers"],
+      "properties": {
+        "containers": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.Container"}},
+        "initContainers": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.Container"}}
+      }
+    },
+    "io.k8s.api.core.v1.Container": {
+      "required": ["name"],
+      "properties": {
+        "args": {"type": "array", "items": {"type": "string"}},
+        "image": {"type": "string"},
+        "imagePullPolicy": {"type": "string"},
+        "name": {"type": "string"},
+        "ports": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.ContainerPort"}}
+      }
+    },
+    "io.k8s.api.core.v1.ContainerPort": {
+      "required": ["containerPort"],
+      "properties": {
+        "containerPort": {"type": "integer", "format": "int32"},
+        "name": {"type": "string"},
+        "protocol": {"type": "string"}
+      }
+    },
+    "io.k8s.apimachinery.pkg.apis.meta.v1.LabelSelector": {
+      "properties": {
+        "matchLabels": {"type": "object", "additionalProperties": {"type": "string"}}
+      }
+    },
+    "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+      "properties": {
+        "annotations": {"type": "object", "additionalProperties": {"type": "string"}},
+        "labels": {"type": "object", "additionalProperties": {"type": "string"}},
+        "name": {"type": "string"},
+        "namespace": {"type": "string"}
+      }
+    }
+  }
+}
+`
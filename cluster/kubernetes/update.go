@@ -14,8 +14,10 @@ import (
 // the container has been replaced with the imageRef supplied.
 func updatePodController(in []byte, resource flux.ResourceID, container string, newImageID image.Ref) ([]byte, error) {
 	namespace, kind, name := resource.Components()
-	if _, ok := resourceKinds[strings.ToLower(kind)]; !ok {
+	out, err := (KubeYAML{}).Image(in, namespace, kind, name, container, newImageID.String())
+	if _, ok := resourceKinds[strings.ToLower(kind)]; !ok && err != nil {
+		// Other kinds can only have images marked by annotations
 		return nil, UpdateNotSupportedError(kind)
 	}
-	return (KubeYAML{}).Image(in, namespace, kind, name, container, newImageID.String())
+	return out, err
 }
@@ -269,8 +269,8 @@ const case3out = `---
 apiVersion: extensions/v1beta1
 kind: Deployment
 metadata:
-  namespace: monitoring
-  name: grafana # comment, and only one space indent
+ namespace: monitoring
+ name: grafana # comment, and only one space indent
 spec:
   replicas: 1
   template:
@@ -0,0 +1,170 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/googleapis/gnostic/OpenAPIv2"
+	"github.com/googleapis/gnostic/compiler"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"k8s.io/kube-openapi/pkg/util/proto/validation"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/resource"
+)
+
+// The extension used in the OpenAPI schema served by Kubernetes to
+// say which API group, version and kind a model represents.
+const groupVersionKindExtension = "x-kubernetes-group-version-kind"
+
+// SchemaValidator checks resource definitions against an OpenAPI
+// schema; usually that served by the cluster, which it fetches the
+// first time it's needed. Resources of kinds that aren't in the
+// schema (e.g., custom resources) are not checked.
+type SchemaValidator struct {
+	source discovery.OpenAPISchemaInterface
+
+	mu     sync.Mutex
+	models proto.Models
+	kinds  map[schema.GroupVersionKind]string
+}
+
+var _ cluster.Validator = &SchemaValidator{}
+
+func NewSchemaValidator(source discovery.OpenAPISchemaInterface) *SchemaValidator {
+	return &SchemaValidator{source: source}
+}
+
+// StaticSchema supplies an OpenAPI schema from a JSON or YAML
+// document, rather than fetching it from a cluster.
+type StaticSchema []byte
+
+func (s StaticSchema) OpenAPISchema() (*openapi_v2.Document, error) {
+	var info yaml.MapSlice
+	if err := yaml.Unmarshal(s, &info); err != nil {
+		return nil, err
+	}
+	return openapi_v2.NewDocument(info, compiler.NewContext("$root", nil))
+}
+
+func (v *SchemaValidator) Validate(resources map[string]resource.Resource) error {
+	models, kinds, err := v.schema()
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(resources))
+	for id := range resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var errs cluster.ValidationErrors
+	for _, id := range ids {
+		res := resources[id]
+		var obj map[string]interface{}
+		if err := k8syaml.Unmarshal(res.Bytes(), &obj); err != nil {
+			errs = append(errs, cluster.ValidationError{File: res.Source(), Message: err.Error()})
+			continue
+		}
+		apiVersion, _ := obj["apiVersion"].(string)
+		kind, _ := obj["kind"].(string)
+		gv, err := schema.ParseGroupVersion(apiVersion)
+		if err != nil {
+			errs = append(errs, cluster.ValidationError{File: res.Source(), Path: "apiVersion", Message: err.Error()})
+			continue
+		}
+		model, ok := kinds[gv.WithKind(kind)]
+		if !ok {
+			continue
+		}
+		for _, err := range validation.ValidateModel(obj, models.LookupModel(model), "") {
+			errs = append(errs, validationError(res.Source(), err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// schema gives the models in the OpenAPI schema, and the model for
+// each kind, fetching the schema if it hasn't been already.
+func (v *SchemaValidator) schema() (proto.Models, map[schema.GroupVersionKind]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.models != nil {
+		return v.models, v.kinds, nil
+	}
+
+	doc, err := v.source.OpenAPISchema()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "fetching OpenAPI schema")
+	}
+	models, err := proto.NewOpenAPIData(doc)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parsing OpenAPI schema")
+	}
+	kinds := map[schema.GroupVersionKind]string{}
+	for _, name := range models.ListModels() {
+		for _, gvk := range modelKinds(models.LookupModel(name)) {
+			kinds[gvk] = name
+		}
+	}
+	v.models, v.kinds = models, kinds
+	return models, kinds, nil
+}
+
+// modelKinds gives the kinds a model in the schema represents, if
+// any. Most models represent only part of a resource (e.g., a
+// PodSpec), and have none.
+func modelKinds(model proto.Schema) []schema.GroupVersionKind {
+	list, _ := model.GetExtensions()[groupVersionKindExtension].([]interface{})
+	var gvks []schema.GroupVersionKind
+	for _, item := range list {
+		m, ok := item.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		group, _ := m["group"].(string)
+		version, _ := m["version"].(string)
+		kind, _ := m["kind"].(string)
+		gvks = append(gvks, schema.GroupVersionKind{Group: group, Version: version, Kind: kind})
+	}
+	return gvks
+}
+
+// validationError turns an error from validating against the schema
+// into one that says which field has a problem, in the same terms
+// as used in the definition.
+func validationError(file string, err error) cluster.ValidationError {
+	verr, ok := err.(validation.ValidationError)
+	if !ok {
+		return cluster.ValidationError{File: file, Message: err.Error()}
+	}
+	path := strings.TrimPrefix(verr.Path, ".")
+	switch e := verr.Err.(type) {
+	case validation.UnknownFieldError:
+		return cluster.ValidationError{File: file, Path: fieldPath(path, e.Field), Message: "unknown field"}
+	case validation.MissingRequiredFieldError:
+		return cluster.ValidationError{File: file, Path: fieldPath(path, e.Field), Message: "missing required field"}
+	case validation.InvalidTypeError:
+		return cluster.ValidationError{File: file, Path: path, Message: fmt.Sprintf("expected %s, got %s", e.Expected, e.Actual)}
+	default:
+		return cluster.ValidationError{File: file, Path: path, Message: verr.Err.Error()}
+	}
+}
+
+func fieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
@@ -0,0 +1,65 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	validator := NewSchemaValidator(StaticSchema(testfiles.OpenAPISchema))
+
+	valid, err := kresource.ParseMultidoc([]byte(testfiles.Files["helloworld-deploy.yaml"]), "helloworld-deploy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validator.Validate(valid); err != nil {
+		t.Errorf("expected valid deployment to pass, got %v", err)
+	}
+
+	invalid, err := kresource.ParseMultidoc([]byte(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: broken
+spec:
+  minReadySeconds: soon
+  selector:
+    matchLabels:
+      name: broken
+  template:
+    spec:
+      containers:
+      - image: quay.io/weaveworks/helloworld:master-a000001
+        imagePullPolicy: IfNotPresent
+        pots:
+        - containerPort: 80
+---
+# Kinds that aren't in the schema can't be checked, so pass
+apiVersion: example.com/v1
+kind: Frobnicator
+metadata:
+  name: broken
+spec:
+  anything: goes
+`), "broken.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = validator.Validate(invalid)
+	errs, ok := err.(cluster.ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+	expected := cluster.ValidationErrors{
+		{File: "broken.yaml", Path: "spec.minReadySeconds", Message: "expected integer, got string"},
+		{File: "broken.yaml", Path: "spec.template.spec.containers[0].pots", Message: "unknown field"},
+		{File: "broken.yaml", Path: "spec.template.spec.containers[0].name", Message: "missing required field"},
+	}
+	if !reflect.DeepEqual(expected, errs) {
+		t.Errorf("expected %#v, got %#v", expected, errs)
+	}
+}
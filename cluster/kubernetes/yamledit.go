@@ -0,0 +1,1155 @@
+package kubernetes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// This file has a minimal YAML "round-tripper": it parses the
+// structure of a YAML stream (block and flow mappings and sequences,
+// and where each value is in the text) into a tree that can be
+// edited. Edits to the tree are then made to the text itself, so
+// everything that wasn't edited -- comments, indentation, quoting --
+// stays exactly as it was. Values are decoded, when needed, by
+// handing their text to the YAML library.
+//
+// New entries are lined up with the entries beside them, or, if
+// they are the first in a mapping, indented by the same step as
+// other nested mappings in the document.
+
+type yamlKind int
+
+const (
+	yamlScalar yamlKind = iota
+	yamlMapping
+	yamlSequence
+)
+
+// yamlNode is a value in a YAML document.
+type yamlNode struct {
+	kind yamlKind
+	// for collections: whether it's in flow style (`{...}` or
+	// `[...]`) rather than block style
+	flow bool
+	// for scalars: the text of the value, which may span lines
+	text string
+	// where the value is in the document
+	start, end int
+	// for block collections: the column the entries start at
+	indent int
+	// for collections: any anchor or tag given before it
+	props   string
+	entries []*yamlEntry
+
+	// set for values made by editing the tree, which are written
+	// out when the document is; for scalars, the string value and
+	// the quoting style preferred for it
+	added bool
+	str   string
+	style byte
+}
+
+// yamlEntry is a key and value in a mapping, or an item in a
+// sequence (which has no key).
+type yamlEntry struct {
+	key string
+	// for block entries: the column the key or item indicator is
+	// at; and whether it's the first entry of a mapping that starts
+	// on the same line as a sequence item indicator
+	indent  int
+	compact bool
+	// where the entry is in the document: from the start of any
+	// comment lines before it (for block entries), or from the key,
+	// to just after the value (and the end of its line, for block
+	// entries)
+	from, at, end int
+	// where a value would go, just after the `:` or item indicator;
+	// and where the value is, which is empty if there's no value
+	valueAt, valueStart, valueEnd int
+	// set for keys in flow mappings given without a `:`
+	needsColon bool
+	// nil if there's no value (i.e., null)
+	value *yamlNode
+	// a comment trailing the value, and where
+	comment   string
+	commentAt int
+
+	added, removed bool
+}
+
+type yamlDoc struct {
+	// the text of the document, with line endings as "\n"; and
+	// whether they were "\r\n" originally
+	text string
+	crlf bool
+	root *yamlNode
+	err  error
+	// how far nested mappings are indented relative to their key
+	step    int
+	changed bool
+}
+
+// parseYAMLStream splits a YAML stream into documents, and parses
+// each. A document that can't be parsed is kept with the error, so
+// that it can be written out untouched if it's not the one of
+// interest.
+func parseYAMLStream(in []byte) []*yamlDoc {
+	text := string(in)
+	crlf := strings.Contains(text, "\r\n")
+	if crlf {
+		text = strings.Replace(text, "\r\n", "\n", -1)
+	}
+	if strings.TrimSuffix(text, "\n") == "" {
+		return nil
+	}
+	var docs []*yamlDoc
+	var start, offset int
+	var hasContent, hasMarker bool
+	for _, line := range strings.SplitAfter(text, "\n") {
+		line = strings.TrimSuffix(line, "\n")
+		if isDocStart(line) && (hasContent || hasMarker) {
+			docs = append(docs, &yamlDoc{text: text[start:offset], crlf: crlf})
+			start = offset
+			hasContent, hasMarker = false, false
+		}
+		switch {
+		case isDocStart(line):
+			hasMarker = true
+		case !isYAMLComment(line):
+			hasContent = true
+		}
+		offset += len(line) + 1
+	}
+	docs = append(docs, &yamlDoc{text: text[start:], crlf: crlf})
+	for _, doc := range docs {
+		doc.parse()
+	}
+	return docs
+}
+
+func isDocStart(line string) bool {
+	return line == "---" || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "---\t")
+}
+
+// isYAMLComment says whether a line is blank or a comment, or is
+// otherwise not part of the content of a document (e.g., a directive
+// or document marker).
+func isYAMLComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || trimmed[0] == '#' ||
+		line == "---" || line == "..." || strings.HasPrefix(line, "%") ||
+		strings.HasPrefix(line, "--- #") || strings.HasPrefix(line, "... #")
+}
+
+func (doc *yamlDoc) parse() {
+	p := newYAMLParser(doc.text)
+	doc.step = 2
+	if !p.skip() {
+		return
+	}
+	p.takePending()
+	root, err := p.parseBlockAt(indentOf(p.lines[p.pos]))
+	if err == nil && root.kind != yamlMapping {
+		err = fmt.Errorf("line %d: expected a mapping", p.pos)
+	}
+	if err == nil && p.skip() {
+		err = fmt.Errorf("line %d: unexpected content", p.pos+1)
+	}
+	if err != nil {
+		doc.err = err
+		return
+	}
+	doc.root = root
+	if p.step > 0 {
+		doc.step = p.step
+	}
+}
+
+// writeYAMLStream writes the documents out again; unchanged ones as
+// they were, and changed ones with the changes made to their tree.
+func writeYAMLStream(docs []*yamlDoc) []byte {
+	buf := &bytes.Buffer{}
+	for _, doc := range docs {
+		text := doc.text
+		if doc.changed {
+			text = doc.edited()
+		}
+		if doc.crlf {
+			text = strings.Replace(text, "\n", "\r\n", -1)
+		}
+		buf.WriteString(text)
+	}
+	return buf.Bytes()
+}
+
+type yamlParser struct {
+	text  string
+	lines []string
+	// where each line starts in the text
+	offsets []int
+	pos     int
+	// the line after the last one that had content
+	end int
+	// the first of the comment lines skipped over, or -1
+	pending int
+	// how far the first nested mapping was indented relative to
+	// its key
+	step int
+}
+
+func newYAMLParser(text string) *yamlParser {
+	p := &yamlParser{text: text, lines: strings.Split(text, "\n"), pending: -1}
+	offset := 0
+	for _, line := range p.lines {
+		p.offsets = append(p.offsets, offset)
+		offset += len(line) + 1
+	}
+	return p
+}
+
+// offset gives the position in the text of a line and column.
+func (p *yamlParser) offset(line, col int) int {
+	if line >= len(p.lines) {
+		return len(p.text)
+	}
+	return p.offsets[line] + col
+}
+
+// lineOf gives the line a position in the text is on.
+func (p *yamlParser) lineOf(offset int) int {
+	return sort.Search(len(p.offsets), func(i int) bool { return p.offsets[i] > offset }) - 1
+}
+
+// contentEnd gives the position at the end of the last line that
+// had content.
+func (p *yamlParser) contentEnd() int {
+	return p.offset(p.end-1, len(p.lines[p.end-1]))
+}
+
+// skip moves past comments and blank lines, remembering where they
+// started so they can be attached to whatever comes next; and says
+// whether there is anything else left.
+func (p *yamlParser) skip() bool {
+	for ; p.pos < len(p.lines); p.pos++ {
+		if !isYAMLComment(p.lines[p.pos]) {
+			return true
+		}
+		if p.pending < 0 {
+			p.pending = p.pos
+		}
+	}
+	return false
+}
+
+// takePending gives the position of the start of the comment lines
+// skipped over before the current line, or of the current line if
+// there were none.
+func (p *yamlParser) takePending() int {
+	line := p.pos
+	if p.pending >= 0 {
+		line = p.pending
+	}
+	p.pending = -1
+	return p.offset(line, 0)
+}
+
+// parseBlockAt parses the mapping, sequence or scalar starting on
+// the current line at the column given.
+func (p *yamlParser) parseBlockAt(indent int) (*yamlNode, error) {
+	line := p.lines[p.pos]
+	if isSequenceItem(line, indent) {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok := splitKey(line[indent:]); ok {
+		return p.parseMapping(indent)
+	}
+	entry := &yamlEntry{indent: indent}
+	if err := p.parseValue(entry, indent, indent, indent-1, false); err != nil {
+		return nil, err
+	}
+	return entry.value, nil
+}
+
+// parseNested parses the value, if any, that follows a key or
+// sequence item that has nothing else on its line. Sequences are
+// allowed to be at the same indent as a key.
+func (p *yamlParser) parseNested(parentIndent int, allowSequence bool) (*yamlNode, error) {
+	if !p.skip() {
+		return nil, nil
+	}
+	line := p.lines[p.pos]
+	indent := indentOf(line)
+	if indent > parentIndent || (allowSequence && indent == parentIndent && isSequenceItem(line, indent)) {
+		return p.parseBlockAt(indent)
+	}
+	return nil, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlMapping, indent: indent, start: p.offset(p.pos, indent)}
+	for p.skip() {
+		line := p.lines[p.pos]
+		if indentOf(line) != indent || isSequenceItem(line, indent) {
+			break
+		}
+		key, after, ok := splitKey(line[indent:])
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected a key", p.pos+1)
+		}
+		entry := &yamlEntry{from: p.takePending(), at: p.offset(p.pos, indent), indent: indent, key: key}
+		col := len(line) - len(strings.TrimLeft(after, " \t"))
+		if err := p.parseValue(entry, len(line)-len(after), col, indent, true); err != nil {
+			return nil, err
+		}
+		node.entries = append(node.entries, entry)
+	}
+	node.end = p.contentEnd()
+	return node, nil
+}
+
+func (p *yamlParser) parseSequence(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlSequence, indent: indent, start: p.offset(p.pos, indent)}
+	for p.skip() {
+		line := p.lines[p.pos]
+		if indentOf(line) != indent || !isSequenceItem(line, indent) {
+			break
+		}
+		entry := &yamlEntry{from: p.takePending(), at: p.offset(p.pos, indent), indent: indent}
+		entry.valueAt = entry.at + 1
+		col := indent + 1
+		for col < len(line) && line[col] == ' ' {
+			col++
+		}
+		rest := line[col:]
+		// A mapping or sequence can start on the same line as the
+		// item; blank out the indicator so it looks like it's on
+		// its own line, at the column it starts.
+		_, _, isMapping := splitKey(rest)
+		if isMapping || isSequenceItem(rest, 0) {
+			p.lines[p.pos] = strings.Repeat(" ", col) + rest
+			value, err := p.parseBlockAt(col)
+			if err != nil {
+				return nil, err
+			}
+			if value.kind == yamlMapping {
+				value.entries[0].compact = true
+			}
+			entry.value = value
+			entry.valueStart, entry.valueEnd = value.start, value.end
+			entry.end = p.offset(p.end, 0)
+		} else if err := p.parseValue(entry, indent+1, col, indent, false); err != nil {
+			return nil, err
+		}
+		node.entries = append(node.entries, entry)
+	}
+	node.end = p.contentEnd()
+	return node, nil
+}
+
+// parseValue parses the value starting at the column given in the
+// current line, and assigns it to the entry; `sep` is the column
+// just after the key or item indicator. Any lines that belong to
+// the value must be indented further than `indent`.
+func (p *yamlParser) parseValue(entry *yamlEntry, sep, col, indent int, allowSequence bool) error {
+	line := p.lines[p.pos]
+	text := line[col:]
+	entry.valueAt = p.offset(p.pos, sep)
+	entry.valueStart, entry.valueEnd = entry.valueAt, entry.valueAt
+	defer func() {
+		if entry.value != nil {
+			entry.valueStart, entry.valueEnd = entry.value.start, entry.value.end
+		}
+		entry.end = p.offset(p.end, 0)
+	}()
+
+	var props string
+	if strings.HasPrefix(text, "&") || strings.HasPrefix(text, "!") {
+		end := strings.IndexAny(text, " \t")
+		if end > 0 {
+			rest := strings.TrimLeft(text[end:], " \t")
+			if rest == "" || rest[0] == '#' {
+				props = text[:end]
+				col += len(text) - len(rest)
+				text = rest
+			}
+		} else {
+			props, col, text = text, len(line), ""
+		}
+	}
+
+	switch {
+	case text == "" || text[0] == '#':
+		entry.setComment(text, p.offset(p.pos, col))
+		p.pos++
+		p.end = p.pos
+		value, err := p.parseNested(indent, allowSequence)
+		if err != nil {
+			return err
+		}
+		if value != nil && value.kind != yamlScalar {
+			value.props = props
+			if value.kind == yamlMapping && !value.flow && entry.key != "" && p.step == 0 {
+				p.step = value.indent - entry.indent
+			}
+		} else if props != "" {
+			return fmt.Errorf("line %d: expected a collection", p.pos)
+		}
+		entry.value = value
+		return nil
+
+	case text[0] == '|' || text[0] == '>':
+		header, comment, commentCol := splitComment(text, col)
+		entry.setComment(comment, p.offset(p.pos, commentCol))
+		node := &yamlNode{kind: yamlScalar, start: p.offset(p.pos, col)}
+		node.end = node.start + len(header)
+		first := p.pos
+		p.pos++
+		keep := strings.Contains(header, "+")
+		last := p.pos
+		for i := p.pos; i < len(p.lines); i++ {
+			l := p.lines[i]
+			if strings.TrimSpace(l) == "" {
+				if keep {
+					last = i + 1
+				}
+				continue
+			}
+			if indentOf(l) <= indent {
+				break
+			}
+			last = i + 1
+		}
+		node.text = strings.Join(append([]string{header}, p.lines[first+1:last]...), "\n")
+		if last > first+1 {
+			node.end = p.offset(last-1, len(p.lines[last-1]))
+		}
+		p.pos, p.end = last, last
+		entry.value = node
+		return nil
+
+	case text[0] == '"' || text[0] == '\'' || text[0] == '[' || text[0] == '{':
+		var node *yamlNode
+		start := p.offset(p.pos, col)
+		if text[0] == '"' || text[0] == '\'' {
+			end, err := scanQuoted(p.text, start)
+			if err != nil {
+				return fmt.Errorf("line %d: %s", p.pos+1, err)
+			}
+			node = &yamlNode{kind: yamlScalar, start: start, end: end, text: p.text[start:end]}
+		} else {
+			f := &flowParser{text: p.text, pos: start}
+			var err error
+			if node, err = f.parseCollection(); err != nil {
+				return fmt.Errorf("line %d: %s", p.lineOf(f.pos)+1, err)
+			}
+		}
+		last := p.lineOf(node.end)
+		rest := p.text[node.end:p.offset(last, len(p.lines[last]))]
+		trimmed := strings.TrimLeft(rest, " \t")
+		if trimmed != "" {
+			if trimmed[0] != '#' || trimmed == rest {
+				return fmt.Errorf("line %d: unexpected text after value", last+1)
+			}
+			entry.setComment(trimmed, node.end+len(rest)-len(trimmed))
+		}
+		p.pos, p.end = last+1, last+1
+		entry.value = node
+		return nil
+
+	default:
+		// A plain scalar, which may continue onto subsequent lines
+		value, comment, commentCol := splitComment(text, col)
+		entry.setComment(comment, p.offset(p.pos, commentCol))
+		node := &yamlNode{kind: yamlScalar, start: p.offset(p.pos, col)}
+		node.end = node.start + len(value)
+		first := p.pos
+		p.pos++
+		last := p.pos
+		if comment == "" {
+			for i := p.pos; i < len(p.lines); i++ {
+				l := p.lines[i]
+				if strings.TrimSpace(l) == "" {
+					continue
+				}
+				if isYAMLComment(l) || indentOf(l) <= indent {
+					break
+				}
+				last = i + 1
+			}
+		}
+		node.text = strings.Join(append([]string{value}, p.lines[first+1:last]...), "\n")
+		if last > first+1 {
+			node.end = p.offset(last-1, len(strings.TrimRight(p.lines[last-1], " \t")))
+		}
+		p.pos, p.end = last, last
+		entry.value = node
+		return nil
+	}
+}
+
+func (e *yamlEntry) setComment(comment string, at int) {
+	e.comment, e.commentAt = comment, at
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isSequenceItem(line string, indent int) bool {
+	return len(line) > indent && line[indent] == '-' &&
+		(len(line) == indent+1 || line[indent+1] == ' ' || line[indent+1] == '\t')
+}
+
+// splitKey tries to interpret the text given as the start of a
+// mapping entry, giving the key and the remainder after the colon.
+func splitKey(text string) (key, after string, ok bool) {
+	if text == "" {
+		return "", "", false
+	}
+	i := 0
+	switch text[0] {
+	case '"', '\'':
+		end, err := scanQuoted(text, 0)
+		if err != nil || strings.Contains(text[:end], "\n") {
+			return "", "", false
+		}
+		i = end
+		for i < len(text) && text[i] == ' ' {
+			i++
+		}
+		if i == len(text) || text[i] != ':' {
+			return "", "", false
+		}
+	case '#', '[', '{', '|', '>', '&', '*', '!', '?', '%', '@', '`':
+		return "", "", false
+	}
+	for ; i < len(text); i++ {
+		switch text[i] {
+		case ':':
+			if i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\t' {
+				return strings.TrimRight(text[:i], " "), text[i+1:], true
+			}
+		case '#':
+			if i > 0 && (text[i-1] == ' ' || text[i-1] == '\t') {
+				return "", "", false
+			}
+		}
+	}
+	return "", "", false
+}
+
+// splitComment separates a plain value from any trailing comment,
+// giving the column of the comment (the value starts at `col`).
+func splitComment(text string, col int) (value, comment string, commentCol int) {
+	for i := 0; i < len(text); i++ {
+		if text[i] == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t') {
+			return strings.TrimRight(text[:i], " \t"), text[i:], col + i
+		}
+	}
+	return strings.TrimRight(text, " \t"), "", 0
+}
+
+// scanQuoted finds the end of the quoted scalar starting at the
+// position given, which may extend over several lines.
+func scanQuoted(text string, start int) (int, error) {
+	quote := text[start]
+	for i := start + 1; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case c != quote:
+		case quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		default:
+			return i + 1, nil
+		}
+	}
+	return 0, errors.New("unterminated string")
+}
+
+// flowParser parses flow collections (`{...}` and `[...]`), which
+// may span several lines.
+type flowParser struct {
+	text string
+	pos  int
+}
+
+// skipSpace moves past whitespace, line breaks and comments.
+func (f *flowParser) skipSpace() {
+	for f.pos < len(f.text) {
+		switch c := f.text[f.pos]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			f.pos++
+		case c == '#' && strings.IndexByte(" \t\n", f.text[f.pos-1]) >= 0:
+			for f.pos < len(f.text) && f.text[f.pos] != '\n' {
+				f.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// next gives the character at the current position, skipping
+// whitespace and comments first; or 0 if there's nothing left.
+func (f *flowParser) next() byte {
+	f.skipSpace()
+	if f.pos == len(f.text) {
+		return 0
+	}
+	return f.text[f.pos]
+}
+
+func (f *flowParser) parseCollection() (*yamlNode, error) {
+	node := &yamlNode{kind: yamlSequence, flow: true, start: f.pos}
+	close := byte(']')
+	if f.text[f.pos] == '{' {
+		node.kind, close = yamlMapping, '}'
+	}
+	f.pos++
+	for {
+		switch f.next() {
+		case 0:
+			return nil, errors.New("unterminated flow collection")
+		case close:
+			f.pos++
+			node.end = f.pos
+			return node, nil
+		}
+		entry, err := f.parseEntry(node.kind == yamlMapping)
+		if err != nil {
+			return nil, err
+		}
+		node.entries = append(node.entries, entry)
+		switch f.next() {
+		case ',':
+			f.pos++
+		case close:
+		default:
+			return nil, fmt.Errorf("expected ',' or '%c'", close)
+		}
+	}
+}
+
+func (f *flowParser) parseEntry(mapping bool) (*yamlEntry, error) {
+	key, err := f.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if !mapping {
+		entry := &yamlEntry{from: key.start, at: key.start, end: key.end, value: key}
+		entry.valueAt, entry.valueStart, entry.valueEnd = key.start, key.start, key.end
+		if f.next() == ':' {
+			return nil, errors.New("mappings in flow sequences are not supported")
+		}
+		return entry, nil
+	}
+	if key.kind != yamlScalar {
+		return nil, errors.New("expected a key")
+	}
+	entry := &yamlEntry{key: key.text, from: key.start, at: key.start, end: key.end, needsColon: true}
+	entry.valueAt, entry.valueStart, entry.valueEnd = key.end, key.end, key.end
+	if f.next() != ':' {
+		f.pos = key.end
+		return entry, nil
+	}
+	f.pos++
+	entry.needsColon = false
+	entry.valueAt, entry.valueStart, entry.valueEnd, entry.end = f.pos, f.pos, f.pos, f.pos
+	if c := f.next(); c == ',' || c == '}' {
+		f.pos = entry.valueAt
+		return entry, nil
+	}
+	if entry.value, err = f.parseValue(); err != nil {
+		return nil, err
+	}
+	entry.valueStart, entry.valueEnd, entry.end = entry.value.start, entry.value.end, entry.value.end
+	return entry, nil
+}
+
+// parseValue parses a flow collection or scalar. Plain scalars are
+// allowed to contain `:`, so long as it's not followed by a space.
+func (f *flowParser) parseValue() (*yamlNode, error) {
+	start := f.pos
+	switch c := f.text[start]; c {
+	case '{', '[':
+		return f.parseCollection()
+	case '"', '\'':
+		end, err := scanQuoted(f.text, start)
+		if err != nil {
+			return nil, err
+		}
+		f.pos = end
+		return &yamlNode{kind: yamlScalar, start: start, end: end, text: f.text[start:end]}, nil
+	case ',', ']', '}', ':', '&', '*', '!', '|', '>', '%', '@', '`':
+		return nil, fmt.Errorf("unexpected '%c'", c)
+	}
+	end := start
+scan:
+	for ; f.pos < len(f.text); f.pos++ {
+		switch c := f.text[f.pos]; {
+		case strings.IndexByte(",[]{}", c) >= 0:
+			break scan
+		case c == ':' && (f.pos+1 == len(f.text) || strings.IndexByte(" \t\n,[]{}", f.text[f.pos+1]) >= 0):
+			break scan
+		case c == '#' && strings.IndexByte(" \t\n", f.text[f.pos-1]) >= 0:
+			break scan
+		case c != ' ' && c != '\t' && c != '\n':
+			end = f.pos + 1
+		}
+	}
+	f.pos = end
+	return &yamlNode{kind: yamlScalar, start: start, end: end, text: f.text[start:end]}, nil
+}
+
+// ---
+
+// yamlEdit replaces the text between two positions in a document.
+type yamlEdit struct {
+	start, end int
+	text       string
+}
+
+// edited gives the text of the document with the changes made to
+// its tree.
+func (doc *yamlDoc) edited() string {
+	w := &yamlWriter{doc: doc}
+	w.collection(doc.root)
+	sort.SliceStable(w.edits, func(i, j int) bool {
+		return w.edits[i].start < w.edits[j].start
+	})
+	buf := &bytes.Buffer{}
+	pos := 0
+	for _, edit := range w.edits {
+		if edit.start > pos {
+			buf.WriteString(doc.text[pos:edit.start])
+		}
+		buf.WriteString(edit.text)
+		if edit.end > pos {
+			pos = edit.end
+		}
+	}
+	buf.WriteString(doc.text[pos:])
+	return buf.String()
+}
+
+// yamlWriter works out the edits to make to the text of a document
+// from the changes made to its tree.
+type yamlWriter struct {
+	doc   *yamlDoc
+	edits []yamlEdit
+}
+
+func (w *yamlWriter) replace(start, end int, text string) {
+	w.edits = append(w.edits, yamlEdit{start: start, end: end, text: text})
+}
+
+// insertLines puts the lines given into the text, before the
+// position given (which is at the start of a line).
+func (w *yamlWriter) insertLines(at int, lines []string) {
+	text := strings.Join(lines, "\n") + "\n"
+	if at == len(w.doc.text) && at > 0 && w.doc.text[at-1] != '\n' {
+		text = "\n" + strings.TrimSuffix(text, "\n")
+	}
+	w.replace(at, at, text)
+}
+
+// collection finds the changes made to a collection, and the
+// collections nested in it.
+func (w *yamlWriter) collection(node *yamlNode) {
+	if node == nil || node.kind == yamlScalar {
+		return
+	}
+	for _, entry := range node.entries {
+		switch {
+		case entry.added || entry.removed:
+		case entry.value != nil && entry.value.added:
+			w.value(node, entry)
+		default:
+			w.collection(entry.value)
+		}
+	}
+	w.removed(node)
+	w.added(node)
+}
+
+// value writes the new value of an entry over the old one.
+func (w *yamlWriter) value(parent *yamlNode, entry *yamlEntry) {
+	value := entry.value
+	if value.kind == yamlMapping && !value.flow {
+		// The entries go on the lines after the key
+		w.replace(entry.valueAt, entry.valueEnd, "")
+		w.insertLines(entry.end, w.blockEntries(value.entries, entry.indent+w.doc.step))
+		return
+	}
+
+	first, more := w.render(value, parent.flow, entry.indent+w.doc.step)
+	start, end := entry.valueStart, entry.valueEnd
+	if start == end {
+		if entry.needsColon {
+			first = ": " + first
+		} else {
+			first = " " + first
+		}
+	}
+	if entry.comment != "" {
+		// Keep the comment where it was, if there's room
+		pad := 1
+		if !strings.Contains(w.doc.text[start:entry.commentAt], "\n") && entry.commentAt-start-len(first) > 1 {
+			pad = entry.commentAt - start - len(first)
+		}
+		first += strings.Repeat(" ", pad) + entry.comment
+		if commentEnd := entry.commentAt + len(entry.comment); commentEnd > end {
+			end = commentEnd
+		}
+	}
+	w.replace(start, end, strings.Join(append([]string{first}, more...), "\n"))
+}
+
+// removed takes the entries removed from a mapping out of the text.
+func (w *yamlWriter) removed(node *yamlNode) {
+	var original []*yamlEntry
+	for _, entry := range node.entries {
+		if !entry.added {
+			original = append(original, entry)
+		}
+	}
+	for i := 0; i < len(original); i++ {
+		if !original[i].removed {
+			continue
+		}
+		j := i
+		for j+1 < len(original) && original[j+1].removed {
+			j++
+		}
+		first, last := original[i], original[j]
+		switch {
+		case node.flow && j+1 < len(original):
+			w.replace(first.at, original[j+1].at, "")
+		case node.flow && i > 0:
+			w.replace(original[i-1].end, last.end, "")
+		case node.flow:
+			w.replace(first.at, last.end, "")
+		case first.compact && j+1 < len(original):
+			// the next entry moves up to the item indicator
+			w.replace(first.at, original[j+1].at, "")
+		case first.compact:
+			w.replace(first.at, last.end, "{}\n")
+		case last.end == len(w.doc.text) && !strings.HasSuffix(w.doc.text, "\n") && first.from > 0:
+			// there's no line end to take with the entries, so take
+			// the one before them
+			w.replace(first.from-1, last.end, "")
+		default:
+			w.replace(first.from, last.end, "")
+		}
+		i = j
+	}
+}
+
+// added puts the entries added to a mapping into the text, after
+// the entries already there.
+func (w *yamlWriter) added(node *yamlNode) {
+	var added []*yamlEntry
+	var last, lastKept *yamlEntry
+	for _, entry := range node.entries {
+		switch {
+		case entry.added:
+			added = append(added, entry)
+		case !entry.removed:
+			lastKept = entry
+			fallthrough
+		default:
+			last = entry
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+	if !node.flow {
+		w.insertLines(last.end, w.blockEntries(added, node.indent))
+		return
+	}
+	var texts []string
+	for _, entry := range added {
+		texts = append(texts, w.flowEntry(entry))
+	}
+	text := strings.Join(texts, ", ")
+	if lastKept == nil {
+		w.replace(node.end-1, node.end-1, text)
+		return
+	}
+	w.replace(lastKept.end, lastKept.end, ", "+text)
+}
+
+// blockEntries renders mapping entries made by editing, as lines
+// indented to the column given.
+func (w *yamlWriter) blockEntries(entries []*yamlEntry, indent int) []string {
+	var lines []string
+	for _, entry := range entries {
+		if entry.removed {
+			continue
+		}
+		line := strings.Repeat(" ", indent) + entry.key + ":"
+		switch value := entry.value; {
+		case value == nil:
+			lines = append(lines, line)
+		case value.kind == yamlMapping && !value.flow:
+			lines = append(lines, line)
+			lines = append(lines, w.blockEntries(value.entries, indent+w.doc.step)...)
+		default:
+			first, more := w.render(value, false, indent+w.doc.step)
+			lines = append(lines, line+" "+first)
+			lines = append(lines, more...)
+		}
+	}
+	return lines
+}
+
+func (w *yamlWriter) flowEntry(entry *yamlEntry) string {
+	if entry.value == nil {
+		return entry.key
+	}
+	first, _ := w.render(entry.value, true, 0)
+	return entry.key + ": " + first
+}
+
+// render gives the text of a value made by editing, as its first
+// line and any lines after that (which are indented to the column
+// given).
+func (w *yamlWriter) render(value *yamlNode, flow bool, indent int) (string, []string) {
+	if value.kind == yamlScalar {
+		return encodeString(value.str, value.style, indent, flow)
+	}
+	var texts []string
+	for _, entry := range value.entries {
+		if !entry.removed {
+			texts = append(texts, w.flowEntry(entry))
+		}
+	}
+	return "{" + strings.Join(texts, ", ") + "}", nil
+}
+
+// ---
+
+// get gives the entry for the key given in a mapping, or nil.
+func (node *yamlNode) get(key string) *yamlEntry {
+	if node == nil || node.kind != yamlMapping {
+		return nil
+	}
+	for _, entry := range node.entries {
+		if !entry.removed && entry.keyString() == key {
+			return entry
+		}
+	}
+	return nil
+}
+
+// lookup follows a path of keys through nested mappings.
+func (node *yamlNode) lookup(path ...string) *yamlNode {
+	for _, key := range path {
+		entry := node.get(key)
+		if entry == nil {
+			return nil
+		}
+		node = entry.value
+	}
+	return node
+}
+
+// size gives the number of entries in a collection.
+func (node *yamlNode) size() int {
+	var n int
+	for _, entry := range node.entries {
+		if !entry.removed {
+			n++
+		}
+	}
+	return n
+}
+
+// newYAMLMapping makes an empty mapping, to be assigned to an entry.
+func newYAMLMapping(flow bool) *yamlNode {
+	return &yamlNode{kind: yamlMapping, flow: flow, added: true}
+}
+
+// add appends an entry with the key given to a mapping.
+func (node *yamlNode) add(key string) *yamlEntry {
+	encoded, _ := encodeString(key, 0, 0, node.flow)
+	entry := &yamlEntry{key: encoded, added: true}
+	node.entries = append(node.entries, entry)
+	return entry
+}
+
+// remove takes the entry with the key given out of a mapping,
+// saying whether it was there.
+func (node *yamlNode) remove(key string) bool {
+	for i, entry := range node.entries {
+		if entry.removed || entry.keyString() != key {
+			continue
+		}
+		if entry.added {
+			node.entries = append(node.entries[:i], node.entries[i+1:]...)
+		} else {
+			entry.removed = true
+		}
+		return true
+	}
+	return false
+}
+
+func (e *yamlEntry) keyString() string {
+	if e.key == "" || (e.key[0] != '"' && e.key[0] != '\'') {
+		return e.key
+	}
+	var key string
+	if err := yaml.Unmarshal([]byte(e.key), &key); err != nil {
+		return e.key
+	}
+	return key
+}
+
+// decode gives the value of a node as the YAML library would.
+func (node *yamlNode) decode() (interface{}, error) {
+	if node == nil {
+		return nil, nil
+	}
+	switch node.kind {
+	case yamlMapping:
+		m := map[interface{}]interface{}{}
+		for _, entry := range node.entries {
+			if entry.removed {
+				continue
+			}
+			var key interface{}
+			if err := yaml.Unmarshal([]byte(entry.key), &key); err != nil {
+				return nil, err
+			}
+			value, err := entry.value.decode()
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case yamlSequence:
+		var s []interface{}
+		for _, entry := range node.entries {
+			value, err := entry.value.decode()
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, value)
+		}
+		return s, nil
+	default:
+		if node.added {
+			return node.str, nil
+		}
+		var value interface{}
+		err := yaml.Unmarshal([]byte(node.text), &value)
+		return value, err
+	}
+}
+
+// stringValue gives the value of a scalar, if it is a string.
+func (node *yamlNode) stringValue() (string, bool) {
+	if node == nil || node.kind != yamlScalar {
+		return "", false
+	}
+	value, err := node.decode()
+	s, ok := value.(string)
+	return s, err == nil && ok
+}
+
+// setString sets the value of an entry to the string given, keeping
+// the quoting style it had if possible. It says whether the value
+// had to change.
+func (e *yamlEntry) setString(value string) bool {
+	if current, ok := e.value.stringValue(); ok && current == value {
+		return false
+	}
+	style := byte(0)
+	if v := e.value; v != nil && v.kind == yamlScalar {
+		switch {
+		case v.added:
+			style = v.style
+		case v.text != "" && !strings.Contains(v.text, "\n") && (v.text[0] == '\'' || v.text[0] == '"'):
+			style = v.text[0]
+		}
+	}
+	e.value = &yamlNode{kind: yamlScalar, added: true, str: value, style: style}
+	return true
+}
+
+// encodeString gives the text for the string given, preferring the
+// quoting style given (0 for plain), but using whatever is needed to
+// represent the string faithfully. Outside of flow collections,
+// multiline strings are encoded as block scalars, the lines of which
+// are indented to the column given.
+func encodeString(s string, style byte, indent int, flow bool) (string, []string) {
+	if !flow && strings.Contains(s, "\n") && s[0] != ' ' && isPrintable(s) {
+		trimmed := strings.TrimRight(s, "\n")
+		header := "|-"
+		switch len(s) - len(trimmed) {
+		case 0:
+		case 1:
+			header = "|"
+		default:
+			header = "|+"
+		}
+		var lines []string
+		for _, line := range strings.Split(s[:len(trimmed)], "\n") {
+			if line != "" {
+				line = strings.Repeat(" ", indent) + line
+			}
+			lines = append(lines, line)
+		}
+		for i := len(trimmed) + 1; i < len(s); i++ {
+			lines = append(lines, "")
+		}
+		return header, lines
+	}
+
+	if style == 0 && isPlainSafe(s, flow) {
+		return s, nil
+	}
+	if style != '"' && isPrintable(s) && !strings.Contains(s, "\n") {
+		return "'" + strings.Replace(s, "'", "''", -1) + "'", nil
+	}
+	// The escapes Go uses are all valid in YAML double-quoted strings
+	return strconv.Quote(s), nil
+}
+
+// isPlainSafe says whether a string can be written as a plain
+// scalar, and read back as the same string. In flow collections,
+// strings with `:` are quoted too, since older YAML parsers don't
+// accept them otherwise.
+func isPlainSafe(s string, flow bool) bool {
+	if s == "" || strings.TrimSpace(s) != s || !isPrintable(s) ||
+		strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") ||
+		strings.HasSuffix(s, ":") || strings.ContainsAny(s, "\n\t") ||
+		(flow && strings.ContainsAny(s, ",[]{}:")) {
+		return false
+	}
+	var decoded interface{}
+	if err := yaml.Unmarshal([]byte(s), &decoded); err != nil {
+		return false
+	}
+	return decoded == s
+}
+
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if r != '\n' && (r < ' ' || r == 0x7f) {
+			return false
+		}
+	}
+	return true
+}
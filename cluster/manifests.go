@@ -37,21 +37,77 @@ type Manifests interface {
 	UpdatePolicies([]byte, flux.ResourceID, policy.Update) ([]byte, error)
 }
 
+// ManifestGenerator is implemented by Manifests that can generate
+// resources by running commands, as well as by reading files.
+// Generated resources can't be edited in place; instead, the
+// generator is asked to make the change to whatever it generated the
+// resources from.
+type ManifestGenerator interface {
+	// Generated reports whether the resource was generated, rather
+	// than read from a file.
+	Generated(resource.Resource) bool
+	// GeneratedFrom reports whether the file at the path given is
+	// in a directory whose manifests are generated, so that loading
+	// it means running the generators.
+	GeneratedFrom(baseDir, path string) bool
+	// SetGeneratedContainerImage changes the image used for a
+	// container in a generated workload.
+	SetGeneratedContainerImage(baseDir string, res resource.Resource, container string, newImageID image.Ref) error
+	// UpdateGeneratedPolicies applies a policy update to a generated
+	// resource.
+	UpdateGeneratedPolicies(baseDir string, res resource.Resource, update policy.Update) error
+}
+
 // UpdateManifest looks for the manifest for the identified resource,
 // reads its contents, applies f(contents), and writes the results
 // back to the file.
 func UpdateManifest(m Manifests, root string, paths []string, id flux.ResourceID, f func(manifest []byte) ([]byte, error)) error {
-	resources, err := m.LoadManifests(root, paths)
+	res, err := findResource(m, root, paths, id)
 	if err != nil {
 		return err
 	}
+	return updateFile(filepath.Join(root, res.Source()), f)
+}
+
+// UpdatePolicies applies the policy update given to the identified
+// resource; either by editing its manifest, or if it was generated,
+// by asking the generator to do it. It returns false if the manifest
+// was unchanged by the update; this is not known for generated
+// resources, which are always reported as changed.
+func UpdatePolicies(m Manifests, root string, paths []string, id flux.ResourceID, u policy.Update) (bool, error) {
+	res, err := findResource(m, root, paths, id)
+	if err != nil {
+		return false, err
+	}
+	if gen, ok := m.(ManifestGenerator); ok && gen.Generated(res) {
+		return true, gen.UpdateGeneratedPolicies(root, res, u)
+	}
+
+	var changed bool
+	err = updateFile(filepath.Join(root, res.Source()), func(def []byte) ([]byte, error) {
+		newDef, err := m.UpdatePolicies(def, id, u)
+		if err != nil {
+			return nil, err
+		}
+		changed = string(newDef) != string(def)
+		return newDef, nil
+	})
+	return changed, err
+}
 
-	resource, ok := resources[id.String()]
+func findResource(m Manifests, root string, paths []string, id flux.ResourceID) (resource.Resource, error) {
+	resources, err := m.LoadManifests(root, paths)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := resources[id.String()]
 	if !ok {
-		return ErrResourceNotFound(id.String())
+		return nil, ErrResourceNotFound(id.String())
 	}
+	return res, nil
+}
 
-	path := filepath.Join(root, resource.Source())
+func updateFile(path string, f func(manifest []byte) ([]byte, error)) error {
 	def, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
@@ -14,7 +14,9 @@ type Mock struct {
 	SomeServicesFunc   func([]flux.ResourceID) ([]Controller, error)
 	PingFunc           func() error
 	ExportFunc         func() ([]byte, error)
-	SyncFunc           func(SyncDef) error
+	ExportSyncedFunc   func(source string) ([]byte, error)
+	SyncFunc           func(SyncDef) (SyncResult, error)
+	PlanSyncFunc       func(SyncDef) (SyncPlan, error)
 	PublicSSHKeyFunc   func(regenerate bool) (ssh.PublicKey, error)
 	UpdateImageFunc    func(def []byte, id flux.ResourceID, container string, newImageID image.Ref) ([]byte, error)
 	LoadManifestsFunc  func(base string, paths []string) (map[string]resource.Resource, error)
@@ -39,10 +41,18 @@ func (m *Mock) Export() ([]byte, error) {
 	return m.ExportFunc()
 }
 
-func (m *Mock) Sync(c SyncDef) error {
+func (m *Mock) ExportSynced(source string) ([]byte, error) {
+	return m.ExportSyncedFunc(source)
+}
+
+func (m *Mock) Sync(c SyncDef) (SyncResult, error) {
 	return m.SyncFunc(c)
 }
 
+func (m *Mock) PlanSync(c SyncDef) (SyncPlan, error) {
+	return m.PlanSyncFunc(c)
+}
+
 func (m *Mock) PublicSSHKey(regenerate bool) (ssh.PublicKey, error) {
 	return m.PublicSSHKeyFunc(regenerate)
 }
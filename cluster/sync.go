@@ -3,6 +3,7 @@ package cluster
 import (
 	"strings"
 
+	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/resource"
 )
 
@@ -16,10 +17,65 @@ type SyncAction struct {
 }
 
 type SyncDef struct {
+	// Identifies where the resources came from (e.g., a git repo,
+	// branch and paths). If non-empty, applied resources are marked
+	// as belonging to the source, so that they can be garbage
+	// collected once they are removed from it.
+	Source string
 	// The actions to undertake
 	Actions []SyncAction
 }
 
+// PlanAction is what a sync would do to a resource.
+type PlanAction string
+
+const (
+	PlanCreate    PlanAction = "create"
+	PlanUpdate    PlanAction = "update"
+	PlanUnchanged PlanAction = "unchanged"
+	PlanDelete    PlanAction = "delete"
+)
+
+// ResourcePlan records what a sync would do to a single resource. If
+// the outcome can't be determined (e.g., because the definition is
+// invalid), Error explains why and Action is empty.
+type ResourcePlan struct {
+	ID     flux.ResourceID
+	Source string
+	Action PlanAction
+	Error  string `json:",omitempty"`
+}
+
+// SyncPlan is the result of a dry run of a sync; it has an entry for
+// each of the actions in the SyncDef.
+type SyncPlan []ResourcePlan
+
+// SyncOutcome is what a sync did to a resource.
+type SyncOutcome string
+
+const (
+	SyncCreated    SyncOutcome = "created"
+	SyncConfigured SyncOutcome = "configured"
+	SyncUnchanged  SyncOutcome = "unchanged"
+	SyncDeleted    SyncOutcome = "deleted"
+)
+
+// SyncResult records the outcome for each resource that was synced
+// successfully; resources that could not be synced are reported in a
+// SyncError instead.
+type SyncResult map[flux.ResourceID]SyncOutcome
+
+// Deleted gives the IDs of the resources deleted by the sync.
+func (r SyncResult) Deleted() []flux.ResourceID {
+	var deleted []flux.ResourceID
+	for id, outcome := range r {
+		if outcome == SyncDeleted {
+			deleted = append(deleted, id)
+		}
+	}
+	return deleted
+}
+
 type ResourceError struct {
 	resource.Resource
 	Error error
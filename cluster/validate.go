@@ -0,0 +1,46 @@
+package cluster
+
+import (
+	"strings"
+
+	"github.com/weaveworks/flux/resource"
+)
+
+// Validator checks resource definitions against the schema for their
+// kind, so that malformed definitions can be caught before they are
+// committed to git (and break every subsequent sync).
+type Validator interface {
+	// Validate checks each of the resources given. If there are
+	// problems with any of them, a ValidationErrors is returned;
+	// any other error means the resources could not be checked.
+	Validate(resources map[string]resource.Resource) error
+}
+
+// ValidationError is a problem with a single field in a resource
+// definition.
+type ValidationError struct {
+	// The file the resource is defined in, relative to the repo
+	File string
+	// The path to the field, e.g., `spec.template.spec.containers[0].image`
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.File + ": " + e.Message
+	}
+	return e.File + ": " + e.Path + ": " + e.Message
+}
+
+// ValidationErrors is all the problems found when validating a set of
+// resources.
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
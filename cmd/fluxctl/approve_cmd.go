@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/update"
+)
+
+type approveOpts struct {
+	*rootOpts
+	outputOpts
+	cause update.Cause
+}
+
+func newApprove(parent *rootOpts) *approveOpts {
+	return &approveOpts{rootOpts: parent}
+}
+
+func (opts *approveOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "approve <release ID>",
+		Short: "Approve an automated release that is waiting for approval.",
+		Example: makeExample(
+			"fluxctl list-pending",
+			"fluxctl approve 8e597d3a-2e60-900c-0319-ac44772206c7 -m 'tested in staging'",
+		),
+		RunE: opts.RunE,
+	}
+	AddOutputFlags(cmd, &opts.outputOpts)
+	AddCauseFlags(cmd, &opts.cause)
+	return cmd
+}
+
+func (opts *approveOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return newUsageError("please supply the ID of a pending release, as given by 'fluxctl list-pending'")
+	}
+
+	ctx := context.Background()
+	jobID, err := opts.API.ApproveRelease(ctx, job.ID(args[0]), opts.cause)
+	if err != nil {
+		return err
+	}
+	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, true, opts.verbosity)
+}
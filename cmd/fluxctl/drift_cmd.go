@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/api/v12"
+)
+
+type driftOpts struct {
+	*rootOpts
+	output string
+}
+
+func newDrift(parent *rootOpts) *driftOpts {
+	return &driftOpts{rootOpts: parent}
+}
+
+func (opts *driftOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "show how resources in the cluster differ from their definitions as last synced from git",
+		Example: makeExample(
+			"fluxctl drift",
+			"fluxctl drift --output json",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "table", `output format; either "table" or "json"`)
+	return cmd
+}
+
+func (opts *driftOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	if opts.output != "table" && opts.output != "json" {
+		return newUsageError(`--output must be "table" or "json"`)
+	}
+
+	ctx := context.Background()
+	report, err := opts.API.DriftReport(ctx)
+	if err != nil {
+		return err
+	}
+
+	if opts.output == "json" {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return printDrift(cmd, report)
+}
+
+func printDrift(cmd *cobra.Command, report v12.DriftReport) error {
+	rev := report.Revision
+	if len(rev) > 7 {
+		rev = rev[:7]
+	}
+	if len(report.Resources) == 0 {
+		fmt.Fprintf(cmd.OutOrStderr(), "No resources have drifted from their definitions as of the last sync (%s)\n", rev)
+		return nil
+	}
+	fmt.Fprintf(cmd.OutOrStderr(), "Resources that differ from their definitions as of the last sync (%s)\n", rev)
+
+	out := newTabwriter()
+	fmt.Fprintln(out, "RESOURCE\tFIELD\tGIT\tCLUSTER")
+	for _, res := range report.Resources {
+		if res.Missing {
+			fmt.Fprintf(out, "%s\t\t\t(missing)\n", res.ID)
+			continue
+		}
+		if res.Untracked {
+			fmt.Fprintf(out, "%s\t\t\t(untracked)\n", res.ID)
+			continue
+		}
+		for i, diff := range res.Differences {
+			id := ""
+			if i == 0 {
+				id = res.ID.String()
+			}
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", id, diff.Path, driftValue(diff.Git), driftValue(diff.Cluster))
+		}
+	}
+	out.Flush()
+	return nil
+}
+
+// driftValue formats a field value for display; strings are shown as
+// they are, and anything else as JSON.
+func driftValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "(none)"
+	case string:
+		return v
+	default:
+		bytes, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(bytes)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/freeze"
+	"github.com/weaveworks/flux/update"
+)
+
+type freezeOpts struct {
+	*rootOpts
+	namespace string
+	until     string
+	cause     update.Cause
+}
+
+func newFreeze(parent *rootOpts) *freezeOpts {
+	return &freezeOpts{rootOpts: parent}
+}
+
+func (opts *freezeOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "freeze",
+		Short: "Stop releases, in a namespace or everywhere, until a given time.",
+		Long: `
+Stop releases, in a namespace or everywhere, until a given time.
+
+The daemon keeps the freeze in a config map (--k8s-freeze-configmap),
+so it stays in force if the daemon restarts. If the daemon is run
+without a config map for freezes, the freeze is kept only in memory,
+and is lost if the daemon restarts.
+        `,
+		Example: makeExample(
+			"fluxctl freeze --until=2h -m 'investigating outage'",
+			"fluxctl freeze --namespace=production --until=2018-12-27T09:00:00Z -m 'holidays'",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "", "Namespace to freeze, blank for all namespaces")
+	cmd.Flags().StringVar(&opts.until, "until", "", "When the freeze ends; either a time (RFC3339), or a duration from now (e.g., 90m)")
+	AddCauseFlags(cmd, &opts.cause)
+	return cmd
+}
+
+func (opts *freezeOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	if opts.until == "" {
+		return newUsageError("please supply --until")
+	}
+	until, err := parseUntil(opts.until, time.Now())
+	if err != nil {
+		return newUsageError(err.Error())
+	}
+
+	f := freeze.Freeze{
+		Namespace: opts.namespace,
+		Until:     until.UTC(),
+		User:      opts.cause.User,
+		Reason:    opts.cause.Message,
+	}
+	if err := opts.API.SetFreeze(context.Background(), f); err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStderr(), f)
+	return nil
+}
+
+// parseUntil parses the end of a freeze, given either as a time, or
+// as a duration from the time given.
+func parseUntil(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("--until %q: duration must be positive", s)
+		}
+		return now.Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("--until %q: expected a time (RFC3339), or a duration", s)
+	}
+	if !t.After(now) {
+		return time.Time{}, fmt.Errorf("--until %q: time is in the past", s)
+	}
+	return t, nil
+}
+
+type unfreezeOpts struct {
+	*rootOpts
+	namespace string
+	cause     update.Cause
+}
+
+func newUnfreeze(parent *rootOpts) *unfreezeOpts {
+	return &unfreezeOpts{rootOpts: parent}
+}
+
+func (opts *unfreezeOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unfreeze",
+		Short: "Lift a freeze set with 'fluxctl freeze'.",
+		Example: makeExample(
+			"fluxctl unfreeze",
+			"fluxctl unfreeze --namespace=production",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "", "Namespace to unfreeze, blank for the freeze on all namespaces")
+	AddCauseFlags(cmd, &opts.cause)
+	return cmd
+}
+
+func (opts *unfreezeOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	// A freeze that has already ended lifts the freeze
+	f := freeze.Freeze{
+		Namespace: opts.namespace,
+		User:      opts.cause.User,
+		Reason:    opts.cause.Message,
+	}
+	return opts.API.SetFreeze(context.Background(), f)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type listFreezesOpts struct {
+	*rootOpts
+}
+
+func newListFreezes(parent *rootOpts) *listFreezesOpts {
+	return &listFreezesOpts{rootOpts: parent}
+}
+
+func (opts *listFreezesOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list-freezes",
+		Short: "List the freeze windows, and the freezes in effect.",
+		Example: makeExample(
+			"fluxctl list-freezes",
+		),
+		RunE: opts.RunE,
+	}
+	return cmd
+}
+
+func (opts *listFreezesOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+
+	ctx := context.Background()
+	freezes, err := opts.API.ListFreezes(ctx)
+	if err != nil {
+		return err
+	}
+	if len(freezes) == 0 {
+		fmt.Fprintln(cmd.OutOrStderr(), "No freezes")
+		return nil
+	}
+
+	out := newTabwriter()
+	fmt.Fprintln(out, "NAMESPACE\tWINDOW\tFROZEN UNTIL\tUSER\tREASON")
+	for _, f := range freezes {
+		namespace := f.Namespace
+		if namespace == "" {
+			namespace = "(all)"
+		}
+		until := "-"
+		if !f.Until.IsZero() {
+			until = f.Until.Format(time.RFC3339)
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n", namespace, f.Window, until, f.User, f.Reason)
+	}
+	out.Flush()
+	return nil
+}
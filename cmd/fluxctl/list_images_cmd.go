@@ -87,6 +87,9 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 		for _, container := range controller.Containers {
 			var lineCount int
 			containerName := container.Name
+			if container.Init {
+				containerName += " (init)"
+			}
 			reg, repo, currentTag := container.Current.ID.Components()
 			if reg != "" {
 				reg += "/"
@@ -115,7 +118,7 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 				var printEllipsis, printLine bool
 				if opts.limit <= 0 || lineCount <= opts.limit {
 					printEllipsis, printLine = false, true
-				} else if container.Current.ID == available.ID {
+				} else if currentTag == tag {
 					printEllipsis, printLine = lineCount > (opts.limit+1), true
 				}
 				if printEllipsis {
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+type listPendingOpts struct {
+	*rootOpts
+}
+
+func newListPending(parent *rootOpts) *listPendingOpts {
+	return &listPendingOpts{rootOpts: parent}
+}
+
+func (opts *listPendingOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list-pending",
+		Short: "List the automated releases that are waiting for approval.",
+		Example: makeExample(
+			"fluxctl list-pending",
+		),
+		RunE: opts.RunE,
+	}
+	return cmd
+}
+
+func (opts *listPendingOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+
+	ctx := context.Background()
+	pending, err := opts.API.ListPendingReleases(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Fprintln(cmd.OutOrStderr(), "No releases are waiting for approval")
+		return nil
+	}
+
+	out := newTabwriter()
+	fmt.Fprintln(out, "ID\tCONTROLLER\tCONTAINER\tCURRENT -> NEW\tAPPROVAL\tBRANCH")
+	for _, p := range pending {
+		ids := p.Result.AffectedResources()
+		ids.Sort()
+		for _, id := range ids {
+			for _, c := range p.Result[id].PerContainer {
+				fmt.Fprintf(out, "%s\t%s\t%s\t%s -> %s\t%s\t%s\n", p.ID, id, c.Container, c.Current.String(), c.Target.Tag, p.Approval, p.Branch)
+			}
+		}
+	}
+	out.Flush()
+	return nil
+}
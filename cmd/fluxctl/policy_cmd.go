@@ -142,16 +142,22 @@ func calculatePolicyChanges(opts *controllerPolicyOpts) (policy.Update, error) {
 			Add(policy.LockedUser)
 	}
 	if opts.tagAll != "" {
+		if err := policy.ValidatePattern(opts.tagAll); err != nil {
+			return policy.Update{}, err
+		}
 		add = add.Set(policy.TagAll, policy.NewPattern(opts.tagAll).String())
 	}
 
 	for _, tagPair := range opts.tags {
-		parts := strings.Split(tagPair, "=")
+		parts := strings.SplitN(tagPair, "=", 2)
 		if len(parts) != 2 {
 			return policy.Update{}, fmt.Errorf("invalid container/tag pair: %q. Expected format is 'container=filter'", tagPair)
 		}
 
 		container, tag := parts[0], parts[1]
+		if err := policy.ValidatePattern(tag); err != nil {
+			return policy.Update{}, err
+		}
 		if tag != "*" {
 			add = add.Set(policy.TagPrefix(container), policy.NewPattern(tag).String())
 		} else {
@@ -86,6 +86,12 @@ func (opts *rootOpts) Command() *cobra.Command {
 		newSave(opts).Command(),
 		newIdentity(opts).Command(),
 		newSync(opts).Command(),
+		newDrift(opts).Command(),
+		newListPending(opts).Command(),
+		newApprove(opts).Command(),
+		newFreeze(opts).Command(),
+		newUnfreeze(opts).Command(),
+		newListFreezes(opts).Command(),
 	)
 
 	return cmd
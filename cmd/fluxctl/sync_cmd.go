@@ -12,6 +12,7 @@ import (
 
 type syncOpts struct {
 	*rootOpts
+	dryRun bool
 }
 
 func newSync(parent *rootOpts) *syncOpts {
@@ -24,6 +25,7 @@ func (opts *syncOpts) Command() *cobra.Command {
 		Short: "synchronize the cluster with the git repository, now",
 		RunE:  opts.RunE,
 	}
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "show what syncing would do to each resource, without changing anything")
 	return cmd
 }
 
@@ -48,6 +50,10 @@ func (opts *syncOpts) RunE(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("git repository %s is not ready to sync (status: %s)", gitConfig.Remote.URL, string(gitConfig.Status))
 	}
 
+	if opts.dryRun {
+		return opts.showPlan(ctx, cmd, gitConfig.Remote.Branch)
+	}
+
 	fmt.Fprintf(cmd.OutOrStderr(), "Synchronizing with %s\n", gitConfig.Remote.URL)
 
 	updateSpec := update.Spec{
@@ -74,3 +80,28 @@ func (opts *syncOpts) RunE(cmd *cobra.Command, args []string) error {
 	fmt.Fprintln(cmd.OutOrStderr(), "Done.")
 	return nil
 }
+
+func (opts *syncOpts) showPlan(ctx context.Context, cmd *cobra.Command, branch string) error {
+	plan, err := opts.API.SyncPlan(ctx)
+	if err != nil {
+		return err
+	}
+
+	rev := plan.Revision
+	if len(rev) > 7 {
+		rev = rev[:7]
+	}
+	fmt.Fprintf(cmd.OutOrStderr(), "Plan for syncing HEAD of %s (%s); nothing has been changed\n", branch, rev)
+
+	out := newTabwriter()
+	fmt.Fprintln(out, "RESOURCE\tACTION\tSOURCE")
+	for _, res := range plan.Resources {
+		action := string(res.Action)
+		if res.Error != "" {
+			action = "error: " + res.Error
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\n", res.ID, action, res.Source)
+	}
+	out.Flush()
+	return nil
+}
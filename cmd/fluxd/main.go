@@ -18,6 +18,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 	k8sifclient "github.com/weaveworks/flux/integrations/client/clientset/versioned"
+	k8sdynamic "k8s.io/client-go/dynamic"
 	k8sclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
@@ -25,15 +26,19 @@ import (
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/cluster/kubernetes"
 	"github.com/weaveworks/flux/daemon"
+	"github.com/weaveworks/flux/freeze"
 	"github.com/weaveworks/flux/git"
 	transport "github.com/weaveworks/flux/http"
 	"github.com/weaveworks/flux/http/client"
 	daemonhttp "github.com/weaveworks/flux/http/daemon"
+	"github.com/weaveworks/flux/http/webhook"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/registry/cache"
+	registryDisk "github.com/weaveworks/flux/registry/cache/disk"
 	registryMemcache "github.com/weaveworks/flux/registry/cache/memcached"
+	registryMemory "github.com/weaveworks/flux/registry/cache/memory"
 	registryMiddleware "github.com/weaveworks/flux/registry/middleware"
 	"github.com/weaveworks/flux/remote"
 	"github.com/weaveworks/flux/ssh"
@@ -74,14 +79,18 @@ func main() {
 	}
 	// This mirrors how kubectl extracts information from the environment.
 	var (
-		listenAddr        = fs.StringP("listen", "l", ":3030", "Listen address where /metrics and API will be served")
-		listenMetricsAddr = fs.String("listen-metrics", "", "Listen address for /metrics endpoint")
-		kubernetesKubectl = fs.String("kubernetes-kubectl", "", "Optional, explicit path to kubectl tool")
-		versionFlag       = fs.Bool("version", false, "Get version number")
+		listenAddr         = fs.StringP("listen", "l", ":3030", "Listen address where /metrics and API will be served")
+		listenMetricsAddr  = fs.String("listen-metrics", "", "Listen address for /metrics endpoint")
+		kubernetesKubectl  = fs.String("kubernetes-kubectl", "", "Optional, explicit path to kubectl tool")
+		kubernetesApplier  = fs.String("kubernetes-applier", "kubectl", `how to apply manifests to the cluster; either "kubectl", which runs the kubectl tool, or "client-go", which uses the Kubernetes API directly`)
+		manifestGeneration = fs.Bool("manifest-generation", false, "generate the manifests in directories with a .flux.yaml file by running the commands given there")
+		manifestValidation = fs.Bool("manifest-validation", true, "check changed manifests against the OpenAPI schema served by the cluster before committing them")
+		versionFlag        = fs.Bool("version", false, "Get version number")
 		// Git repo & key etc.
 		gitURL       = fs.String("git-url", "", "URL of git repo with Kubernetes manifests; e.g., git@github.com:weaveworks/flux-example")
 		gitBranch    = fs.String("git-branch", "master", "branch of git repo to use for Kubernetes manifests")
 		gitPath      = fs.StringSlice("git-path", []string{}, "relative paths within the git repo to locate Kubernetes manifests")
+		gitSources   = fs.StringArray("git-source", nil, "additional git repo to sync to the cluster, as <name>=<url>[?branch=<branch>&path=<path>&namespace=<namespace>...]; may be repeated")
 		gitUser      = fs.String("git-user", "Weave Flux", "username to use as git committer")
 		gitEmail     = fs.String("git-email", "support@weave.works", "email to use as git committer")
 		gitSetAuthor = fs.Bool("git-set-author", false, "If set, the author of git commits will reflect the user who initiated the commit and will differ from the git committer.")
@@ -94,9 +103,22 @@ func main() {
 
 		gitPollInterval = fs.Duration("git-poll-interval", 5*time.Minute, "period at which to poll git repo for new commits")
 		gitTimeout      = fs.Duration("git-timeout", 20*time.Second, "duration after which git operations time out")
+		gitHookSecret   = fs.String("git-webhook-secret", "", "shared secret with which git host webhooks, received at /hook/git/..., are authenticated; if not given, git host webhooks are refused")
 		// syncing
 		syncInterval = fs.Duration("sync-interval", 5*time.Minute, "apply config in git to cluster at least this often, even if there are no new commits")
+		syncGC       = fs.Bool("sync-garbage-collection", false, "experimental; delete resources that were created by fluxd, but are no longer in the git repo")
+		syncRollout  = fs.Duration("sync-rollout-timeout", 0, "after syncing, wait this long for changed workloads to roll out, and record the outcome in the sync event; zero means don't wait")
+		// automation
+		stagedAutomation = fs.Bool("staged-automation", false, "make automated releases that change more than one workload in stages: first to the canaries, then to the rest in batches, halting if a stage fails to roll out")
+		stagedCanaries   = fs.StringSlice("staged-automation-canary-labels", []string{}, "workloads with all these labels (as <key>=<value>) are released to first in staged releases, as well as those annotated flux.weave.works/canary: \"true\"")
+		stagedBatchSize  = fs.Int("staged-automation-batch-size", 10, "the most workloads released to in each stage after the canaries; zero means all of them at once")
+		stagedSoak       = fs.Duration("staged-automation-soak", 5*time.Minute, "how long the workloads released to in each stage have to roll out, before the next stage")
+		// releases
+		freezeWindows = fs.StringArray("freeze-window", nil, "stop releases during a recurring window, given as [<namespace>:]<schedule> for <duration>, where the schedule is in cron format and UTC (e.g., \"production:0 18 * * mon-fri for 15h\"); may be repeated")
 		// registry
+		registryCache        = fs.String("registry-cache", "memcached", "where to cache image metadata: memcached; memory, bounded by --registry-cache-memory-size; or disk, in --registry-cache-dir")
+		registryCacheSize    = fs.Int("registry-cache-memory-size", 128, "the most image metadata to cache in memory, in megabytes, when --registry-cache=memory")
+		registryCacheDir     = fs.String("registry-cache-dir", "/var/fluxd/registry-cache", "directory in which to cache image metadata when --registry-cache=disk; mount a volume here so the cache survives restarts")
 		memcachedHostname    = fs.String("memcached-hostname", "memcached", "Hostname for memcached service.")
 		memcachedTimeout     = fs.Duration("memcached-timeout", time.Second, "Maximum time to wait before giving up on memcached requests.")
 		memcachedService     = fs.String("memcached-service", "memcached", "SRV service used to discover memcache servers.")
@@ -105,12 +127,20 @@ func main() {
 		registryBurst        = fs.Int("registry-burst", defaultRemoteConnections, "maximum number of warmer connections to remote and memcache")
 		registryTrace        = fs.Bool("registry-trace", false, "output trace of image registry requests to log")
 		registryInsecure     = fs.StringSlice("registry-insecure-host", []string{}, "use HTTP for this image registry domain (e.g., registry.cluster.local), instead of HTTPS")
+		registryExcludeTags  = fs.StringSlice("registry-exclude-tag", nil, "don't fetch metadata for image tags matching this, given as [<image>:]<tag>, where each may be a glob (e.g., \"ci-*\" or \"quay.io/weaveworks/*:ci-*\"); may be repeated")
+		registryTagsInUse    = fs.Bool("registry-tags-in-use-only", false, "only fetch metadata for the tags of an image that could be selected by the tag filters of the workloads using it; goes by the manifests last synced from the git repo and the sync sources; images used by workloads without a tag filter are not affected, and the tags in use are always kept")
+		registryTagRetention = fs.Int("registry-tag-retention", 0, "the most tags to fetch metadata for in each image repository, keeping the newest according to --registry-tag-retention-order, and any tags in use; zero means no limit")
+		registryTagOrder     = fs.String("registry-tag-retention-order", "semver", "how to decide the newest tags to keep: \"name\", the last by name; or \"semver\", the highest semantic versions then the last by name")
+		registryHookSecret   = fs.String("registry-webhook-secret", "", "shared secret with which image registry webhooks, received at /hook/registry/..., are authenticated; if not given, registry webhooks are refused")
+		registryProviders    = fs.StringSlice("registry-credential-provider", []string{"gcr"}, "obtain image registry credentials for the hosts of these cloud registries from the cloud provider, when image pull secrets have none for them; one or more of gcr, ecr and acr")
 
 		// k8s-secret backed ssh keyring configuration
 		k8sSecretName            = fs.String("k8s-secret-name", "flux-git-deploy", "Name of the k8s secret used to store the private SSH key")
 		k8sSecretVolumeMountPath = fs.String("k8s-secret-volume-mount-path", "/etc/fluxd/ssh", "Mount location of the k8s secret storing the private SSH key")
 		k8sSecretDataKey         = fs.String("k8s-secret-data-key", "identity", "Data key holding the private SSH key within the k8s secret")
+		k8sFreezeConfigMap       = fs.String("k8s-freeze-configmap", "flux-freezes", "Name of the k8s config map, in fluxd's namespace, used to keep the freezes set with fluxctl freeze over restarts; if empty, they are kept only in memory")
 		k8sNamespaceWhitelist    = fs.StringSlice("k8s-namespace-whitelist", []string{}, "Experimental, optional: restrict the view of the cluster to the namespaces listed. All namespaces are included if this is not set.")
+		k8sWorkloadKinds         = fs.String("k8s-workload-kinds", "", "path to a YAML file describing additional kinds of resource to treat as workloads (e.g., custom resources that run pods from a template)")
 		// SSH key generation
 		sshKeyBits   = optionalVar(fs, &ssh.KeyBitsValue{}, "ssh-keygen-bits", "-b argument to ssh-keygen (default unspecified)")
 		sshKeyType   = optionalVar(fs, &ssh.KeyTypeValue{}, "ssh-keygen-type", "-t argument to ssh-keygen (default unspecified)")
@@ -173,6 +203,35 @@ func main() {
 		}
 	}
 
+	var windows []freeze.Window
+	for _, spec := range *freezeWindows {
+		w, err := freeze.ParseWindow(spec)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		logger.Log("freeze-window", w)
+		windows = append(windows, w)
+	}
+	freezes := freeze.New(windows...)
+
+	var staged *daemon.StagedAutomation
+	if *stagedAutomation {
+		staged = &daemon.StagedAutomation{
+			CanaryLabels: map[string]string{},
+			BatchSize:    *stagedBatchSize,
+			Soak:         *stagedSoak,
+		}
+		for _, label := range *stagedCanaries {
+			kv := strings.SplitN(label, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				logger.Log("err", fmt.Sprintf("invalid canary label %q; expected <key>=<value>", label))
+				os.Exit(1)
+			}
+			staged.CanaryLabels[kv[0]] = kv[1]
+		}
+	}
+
 	if *sshKeygenDir == "" {
 		logger.Log("info", fmt.Sprintf("SSH keygen dir (--ssh-keygen-dir) not provided, so using the deploy key volume (--k8s-secret-volume-mount-path=%s); this may cause problems if the deploy key volume is mounted read-only", *k8sSecretVolumeMountPath))
 		*sshKeygenDir = *k8sSecretVolumeMountPath
@@ -184,7 +243,15 @@ func main() {
 	var k8s cluster.Cluster
 	var imageCreds func() registry.ImageCreds
 	var k8sManifests cluster.Manifests
+	var k8sValidator cluster.Validator
 	{
+		if *k8sWorkloadKinds != "" {
+			if err := kubernetes.LoadWorkloadKinds(*k8sWorkloadKinds); err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+		}
+
 		restClientConfig, err := rest.InClusterConfig()
 		if err != nil {
 			logger.Log("err", err)
@@ -200,6 +267,12 @@ func main() {
 			os.Exit(1)
 		}
 
+		dynamicClientset, err := k8sdynamic.NewForConfig(restClientConfig)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+
 		ifclientset, err := k8sifclient.NewForConfig(restClientConfig)
 		if err != nil {
 			logger.Log("error", fmt.Sprintf("Error building integrations clientset: %v", err))
@@ -219,6 +292,17 @@ func main() {
 			os.Exit(1)
 		}
 
+		if *k8sFreezeConfigMap != "" {
+			store := &kubernetes.FreezeStore{
+				ConfigMapAPI: clientset.CoreV1().ConfigMaps(string(namespace)),
+				Name:         *k8sFreezeConfigMap,
+			}
+			if err := freezes.Restore(store, time.Now()); err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+		}
+
 		sshKeyRing, err = kubernetes.NewSSHKeyRing(kubernetes.SSHKeyRingConfig{
 			SecretAPI:             clientset.Core().Secrets(string(namespace)),
 			SecretName:            *k8sSecretName,
@@ -240,20 +324,30 @@ func main() {
 		logger.Log("identity.pub", strings.TrimSpace(publicKey.Key))
 		logger.Log("host", restClientConfig.Host, "version", clusterVersion)
 
-		kubectl := *kubernetesKubectl
-		if kubectl == "" {
-			kubectl, err = exec.LookPath("kubectl")
-		} else {
-			_, err = os.Stat(kubectl)
-		}
-		if err != nil {
-			logger.Log("err", err)
+		var applier kubernetes.Applier
+		switch *kubernetesApplier {
+		case "kubectl":
+			kubectl := *kubernetesKubectl
+			if kubectl == "" {
+				kubectl, err = exec.LookPath("kubectl")
+			} else {
+				_, err = os.Stat(kubectl)
+			}
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			logger.Log("kubectl", kubectl)
+			applier = kubernetes.NewKubectl(kubectl, restClientConfig)
+		case "client-go":
+			logger.Log("applier", "client-go")
+			applier = kubernetes.NewDynamicApplier(clientset.Discovery(), dynamicClientset)
+		default:
+			logger.Log("err", fmt.Sprintf("unknown value for --kubernetes-applier: %q", *kubernetesApplier))
 			os.Exit(1)
 		}
-		logger.Log("kubectl", kubectl)
 
-		kubectlApplier := kubernetes.NewKubectl(kubectl, restClientConfig)
-		k8sInst := kubernetes.NewCluster(clientset, ifclientset, kubectlApplier, sshKeyRing, logger, *k8sNamespaceWhitelist)
+		k8sInst := kubernetes.NewCluster(clientset, ifclientset, dynamicClientset, applier, sshKeyRing, logger, *k8sNamespaceWhitelist)
 
 		if err := k8sInst.Ping(); err != nil {
 			logger.Log("ping", err)
@@ -273,7 +367,10 @@ func main() {
 		k8s = k8sInst
 		// There is only one way we currently interpret a repo of
 		// files as manifests, and that's as Kubernetes yamels.
-		k8sManifests = &kubernetes.Manifests{}
+		k8sManifests = &kubernetes.Manifests{Generate: *manifestGeneration}
+		if *manifestValidation {
+			k8sValidator = kubernetes.NewSchemaValidator(clientset.Discovery())
+		}
 	}
 
 	// Registry components
@@ -282,16 +379,37 @@ func main() {
 	{
 		// Cache client, for use by registry and cache warmer
 		var cacheClient cache.Client
-		memcacheClient := registryMemcache.NewMemcacheClient(registryMemcache.MemcacheConfig{
-			Host:           *memcachedHostname,
-			Service:        *memcachedService,
-			Timeout:        *memcachedTimeout,
-			UpdateInterval: 1 * time.Minute,
-			Logger:         log.With(logger, "component", "memcached"),
-			MaxIdleConns:   *registryBurst,
-		})
-		defer memcacheClient.Stop()
-		cacheClient = cache.InstrumentClient(memcacheClient)
+		switch *registryCache {
+		case "memcached":
+			memcacheClient := registryMemcache.NewMemcacheClient(registryMemcache.MemcacheConfig{
+				Host:           *memcachedHostname,
+				Service:        *memcachedService,
+				Timeout:        *memcachedTimeout,
+				UpdateInterval: 1 * time.Minute,
+				Logger:         log.With(logger, "component", "memcached"),
+				MaxIdleConns:   *registryBurst,
+			})
+			defer memcacheClient.Stop()
+			cacheClient = memcacheClient
+		case "memory":
+			cacheClient = registryMemory.NewLRUClient(*registryCacheSize * 1024 * 1024)
+		case "disk":
+			diskClient, err := registryDisk.NewDiskClient(registryDisk.DiskConfig{
+				Dir:           *registryCacheDir,
+				SweepInterval: 10 * time.Minute,
+				Logger:        log.With(logger, "component", "diskcache"),
+			})
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			defer diskClient.Stop()
+			cacheClient = diskClient
+		default:
+			logger.Log("err", fmt.Sprintf("unknown registry cache %q; expected memcached, memory or disk", *registryCache))
+			os.Exit(1)
+		}
+		cacheClient = cache.InstrumentClient(cacheClient)
 
 		cacheRegistry = &cache.Cache{
 			Reader: cacheClient,
@@ -305,11 +423,29 @@ func main() {
 			Burst:  *registryBurst,
 			Logger: log.With(logger, "component", "ratelimiter"),
 		}
+		// Cloud providers' credentials for their registries
+		var providers []registry.CredentialProvider
+		providerClient := &http.Client{Timeout: 10 * time.Second}
+		for _, name := range *registryProviders {
+			switch name {
+			case "gcr":
+				providers = append(providers, &registry.GCRProvider{Client: providerClient})
+			case "ecr":
+				providers = append(providers, &registry.ECRProvider{Client: providerClient})
+			case "acr":
+				providers = append(providers, &registry.ACRProvider{Client: providerClient})
+			default:
+				logger.Log("err", fmt.Sprintf("unknown registry credential provider %q; expected gcr, ecr or acr", name))
+				os.Exit(1)
+			}
+		}
+
 		remoteFactory := &registry.RemoteClientFactory{
-			Logger:        registryLogger,
-			Limiters:      registryLimits,
-			Trace:         *registryTrace,
-			InsecureHosts: *registryInsecure,
+			Logger:              registryLogger,
+			Limiters:            registryLimits,
+			Trace:               *registryTrace,
+			InsecureHosts:       *registryInsecure,
+			CredentialProviders: registry.NewCredentialProviders(providers...),
 		}
 
 		// Warmer
@@ -319,6 +455,28 @@ func main() {
 			logger.Log("err", err)
 			os.Exit(1)
 		}
+		if len(*registryExcludeTags) > 0 || *registryTagsInUse || *registryTagRetention > 0 {
+			filter := &cache.TagFilter{
+				InUseOnly:   *registryTagsInUse,
+				Retain:      *registryTagRetention,
+				RetainOrder: *registryTagOrder,
+			}
+			for _, s := range *registryExcludeTags {
+				rule, err := cache.ParseExcludeRule(s)
+				if err != nil {
+					logger.Log("err", err)
+					os.Exit(1)
+				}
+				filter.Exclude = append(filter.Exclude, rule)
+			}
+			switch *registryTagOrder {
+			case cache.RetainByName, cache.RetainBySemver:
+			default:
+				logger.Log("err", fmt.Sprintf("unknown tag retention order %q; expected %s or %s", *registryTagOrder, cache.RetainByName, cache.RetainBySemver))
+				os.Exit(1)
+			}
+			cacheWarmer.Filter = filter
+		}
 	}
 
 	// Mechanical components.
@@ -381,6 +539,28 @@ func main() {
 		}()
 	}
 
+	var syncSources []daemon.SyncSource
+	sourceConfigs := map[string]git.Config{}
+	sourceMirrors := git.NewMirrors()
+	for _, s := range *gitSources {
+		source, err := daemon.ParseSyncSource(s, gitConfig)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		if sourceMirrors.Mirror(source.Name, source.Remote, git.PollInterval(*gitPollInterval), git.Timeout(*gitTimeout)) {
+			logger.Log("err", fmt.Sprintf("git source %q given more than once", source.Name))
+			os.Exit(1)
+		}
+		logger.Log("source", source.Name, "url", source.Remote.URL, "branch", source.Config.Branch, "sync-tag", source.Config.SyncTag)
+		syncSources = append(syncSources, source)
+		sourceConfigs[source.Name] = source.Config
+	}
+	go func() {
+		<-shutdown
+		sourceMirrors.StopAllAndWait()
+	}()
+
 	logger.Log(
 		"url", *gitURL,
 		"user", *gitUser,
@@ -399,6 +579,7 @@ func main() {
 		V:              version,
 		Cluster:        k8s,
 		Manifests:      k8sManifests,
+		Validator:      k8sValidator,
 		Registry:       cacheRegistry,
 		ImageRefresh:   make(chan image.Name, 100), // size chosen by fair dice roll
 		Repo:           repo,
@@ -406,8 +587,14 @@ func main() {
 		Jobs:           jobs,
 		JobStatusCache: &job.StatusCache{Size: 100},
 		Logger:         log.With(logger, "component", "daemon"),
+		SyncSources:    syncSources,
+		SourceMirrors:  sourceMirrors,
+		Freezes:        freezes,
 		LoopVars: &daemon.LoopVars{
 			SyncInterval:         *syncInterval,
+			SyncGC:               *syncGC,
+			SyncRolloutTimeout:   *syncRollout,
+			Staged:               staged,
 			RegistryPollInterval: *registryPollInterval,
 		},
 	}
@@ -446,6 +633,9 @@ func main() {
 	cacheWarmer.Notify = daemon.AskForImagePoll
 	cacheWarmer.Priority = daemon.ImageRefresh
 	cacheWarmer.Trace = *registryTrace
+	if cacheWarmer.Filter != nil {
+		cacheWarmer.Filter.InUse = daemon.TagsInUse
+	}
 	shutdownWg.Add(1)
 	go cacheWarmer.Loop(log.With(logger, "component", "warmer"), shutdown, shutdownWg, imageCreds)
 
@@ -457,6 +647,24 @@ func main() {
 		}
 		handler := daemonhttp.NewHandler(daemon, daemonhttp.NewRouter())
 		mux.Handle("/api/flux/", http.StripPrefix("/api/flux", handler))
+		mux.Handle("/hook/", webhook.NewHandler(&webhook.Receiver{
+			RegistrySecret: *registryHookSecret,
+			ImageRefresh:   daemon.ImageRefresh,
+			GitSecret:      *gitHookSecret,
+			GitConfig:      gitConfig,
+			GitNotify: func() {
+				repo.Notify()
+				daemon.AskForSync()
+			},
+			GitSources: sourceConfigs,
+			SourceNotify: func(name string) {
+				if mirror, ok := sourceMirrors.Get(name); ok {
+					mirror.Notify()
+				}
+				daemon.AskForSync()
+			},
+			Logger: log.With(logger, "component", "webhook"),
+		}, webhook.NewRouter()))
 		logger.Log("addr", *listenAddr)
 		errc <- http.ListenAndServe(*listenAddr, mux)
 	}()
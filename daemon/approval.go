@@ -0,0 +1,252 @@
+package daemon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v12"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/release"
+	"github.com/weaveworks/flux/update"
+)
+
+// Automated releases of workloads with an approval policy are not
+// pushed as soon as they are calculated. Instead, each image poll
+// keeps a pending release per gated workload, which is run as a job
+// when it's approved. With the branch approval policy, the pending
+// release is also pushed to a branch, which can be merged instead;
+// the branch is deleted once there's nothing pending for the workload.
+//
+// Pending releases are only kept in memory, but the ID of each is
+// derived from what it releases, so the same release is given the
+// same ID when it's calculated again after a restart.
+
+// approvalBranchPrefix is prepended to the branch that a pending
+// release is pushed to.
+const approvalBranchPrefix = "flux-release/"
+
+type pendingRelease struct {
+	v12.PendingRelease
+	// set once the release has been approved and queued as a job
+	approved bool
+}
+
+// approvalBranch gives the branch that pending releases of the
+// workload given are pushed to. Resource IDs have characters that are
+// not allowed in branch names, so those are replaced.
+func approvalBranch(id flux.ResourceID) string {
+	return approvalBranchPrefix + strings.NewReplacer(":", "-", "/", "-").Replace(id.String())
+}
+
+// pendingReleaseID gives the ID for the pending release of the
+// changes given to a workload, with the approval policy given. It's
+// formatted like the random IDs given to other jobs.
+func pendingReleaseID(workload flux.ResourceID, approval string, changes *update.Automated) (job.ID, error) {
+	bs, err := json.Marshal(struct {
+		Workload flux.ResourceID
+		Approval string
+		Changes  []update.Change
+	}{workload, approval, changes.Changes})
+	if err != nil {
+		return "", err
+	}
+	b := sha256.Sum256(bs)
+	return job.ID(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])), nil
+}
+
+// ListPendingReleases gives the automated releases that are waiting
+// to be approved.
+func (d *Daemon) ListPendingReleases(ctx context.Context) ([]v12.PendingRelease, error) {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	var ids []string
+	byID := map[string]v12.PendingRelease{}
+	for workload, pending := range d.pending {
+		if !pending.approved {
+			ids = append(ids, workload.String())
+			byID[workload.String()] = pending.PendingRelease
+		}
+	}
+	sort.Strings(ids)
+	res := []v12.PendingRelease{}
+	for _, id := range ids {
+		res = append(res, byID[id])
+	}
+	return res, nil
+}
+
+// ApproveRelease queues the pending release with the ID given, to be
+// run as a job with the same ID. The cause is recorded with the
+// release, in the note on the commit.
+func (d *Daemon) ApproveRelease(ctx context.Context, id job.ID, cause update.Cause) (job.ID, error) {
+	d.pendingMu.Lock()
+	defer d.pendingMu.Unlock()
+	for workload, pending := range d.pending {
+		if pending.ID != id || pending.approved {
+			continue
+		}
+		changes, ok := pending.Spec.Spec.(*update.Automated)
+		if !ok {
+			return "", errors.Errorf("pending release %s is not an automated release", id)
+		}
+		spec := pending.Spec
+		spec.Cause = cause
+		pending.approved = true
+		d.pending[workload] = pending
+		return d.queueJobWithID(id, d.makeLoggingJobFunc(d.makeJobFromUpdate(d.release(spec, changes)))), nil
+	}
+	return "", unknownPendingReleaseError(id)
+}
+
+// updatePendingReleases brings the pending releases up to date with
+// the automated releases calculated for gated workloads, given with
+// the approval policy of each. A pending release is kept, with the
+// same ID, for as long as the same changes are calculated; otherwise
+// it's replaced, or dropped if there's nothing to release any more.
+func (d *Daemon) updatePendingReleases(ctx context.Context, gated map[flux.ResourceID]*update.Automated, approval map[flux.ResourceID]string, logger log.Logger) {
+	d.pendingMu.Lock()
+	previous := map[flux.ResourceID]pendingRelease{}
+	for workload, pending := range d.pending {
+		previous[workload] = pending
+	}
+	d.pendingMu.Unlock()
+
+	current := map[flux.ResourceID]pendingRelease{}
+	for workload, pending := range previous {
+		// Approved releases are left alone until their job is done;
+		// if it succeeded, there will be nothing to release, and if
+		// it failed, the release is pending again.
+		if pending.approved {
+			if status, ok := d.JobStatusCache.Status(pending.ID); ok &&
+				(status.StatusString == job.StatusQueued || status.StatusString == job.StatusRunning) {
+				current[workload] = pending
+			}
+			continue
+		}
+		changes, ok := gated[workload]
+		if ok && pending.Approval == approval[workload] && reflect.DeepEqual(pending.Spec.Spec, changes) {
+			current[workload] = pending
+		}
+	}
+
+	// Workloads whose pending release couldn't be calculated; any
+	// branch they have is left, since it may still be wanted
+	failed := map[flux.ResourceID]bool{}
+	for workload, changes := range gated {
+		if _, ok := current[workload]; ok {
+			continue
+		}
+		logger := log.With(logger, "workload", workload, "approval", approval[workload])
+		pending, ok, err := d.calculatePendingRelease(ctx, workload, approval[workload], changes, logger)
+		if err != nil {
+			logger.Log("err", errors.Wrap(err, "calculating pending release"))
+			failed[workload] = true
+			if previous, ok := previous[workload]; ok && !previous.approved {
+				current[workload] = previous
+			}
+			continue
+		}
+		if ok {
+			logger.Log("info", "release pending approval", "job", pending.ID, "branch", pending.Branch)
+			current[workload] = pendingRelease{PendingRelease: pending}
+		}
+	}
+
+	d.pendingMu.Lock()
+	// Anything approved meanwhile stays approved
+	for workload, pending := range d.pending {
+		if pending.approved && !previous[workload].approved {
+			current[workload] = pending
+		}
+	}
+	d.pending = current
+	d.pendingMu.Unlock()
+
+	// Clean up the branches of workloads that have nothing pending
+	// any more, because their release has been approved and run, or
+	// the branch merged, or the policy removed. Those of workloads
+	// with the branch policy are looked for too, since there's no
+	// record of what was pending before a restart.
+	stale := map[flux.ResourceID]bool{}
+	for workload, pending := range previous {
+		if pending.Branch != "" {
+			stale[workload] = true
+		}
+	}
+	for workload, mode := range approval {
+		if mode == policy.ApprovalBranch {
+			stale[workload] = true
+		}
+	}
+	for workload := range stale {
+		if current[workload].Branch != "" || failed[workload] {
+			continue
+		}
+		branch := approvalBranch(workload)
+		if err := d.Repo.DeleteBranch(ctx, branch); err != nil {
+			logger.Log("workload", workload, "branch", branch, "err", errors.Wrap(err, "deleting branch of released workload"))
+		}
+	}
+}
+
+// calculatePendingRelease works out the automated release given for
+// a gated workload, in a fresh clone; and, if the approval policy
+// says to, pushes it to a branch. It returns false if there is
+// nothing to release.
+func (d *Daemon) calculatePendingRelease(ctx context.Context, workload flux.ResourceID, approval string, changes *update.Automated, logger log.Logger) (v12.PendingRelease, bool, error) {
+	id, err := pendingReleaseID(workload, approval, changes)
+	if err != nil {
+		return v12.PendingRelease{}, false, err
+	}
+	pending := v12.PendingRelease{
+		ID:       id,
+		Spec:     update.Spec{Type: update.Auto, Spec: changes},
+		Approval: approval,
+		Created:  time.Now().UTC(),
+	}
+	var ok bool
+	err = d.WithClone(ctx, func(working *git.Checkout) error {
+		result, err := release.Release(d.newReleaseContext(working), changes, logger)
+		if err != nil {
+			return err
+		}
+		pending.Result = result
+		if ok = result[workload].Status == update.ReleaseStatusSuccess; !ok || approval != policy.ApprovalBranch {
+			return nil
+		}
+
+		// The branch may have the release already, e.g., if it was
+		// pushed before a restart
+		branch := approvalBranch(workload)
+		if rev, err := d.Repo.Revision(ctx, branch); err == nil {
+			var n note
+			if ok, err := working.GetNote(ctx, rev, &n); err == nil && ok && n.JobID == pending.ID {
+				pending.Branch = branch
+				return nil
+			}
+		}
+
+		if err := d.validateChanges(ctx, working); err != nil {
+			return err
+		}
+		commitAction := git.CommitAction{Message: changes.CommitMessage(result)}
+		if err := working.CommitAndPushBranch(ctx, branch, commitAction, &note{JobID: pending.ID, Spec: pending.Spec, Result: result}); err != nil {
+			return err
+		}
+		pending.Branch = branch
+		return nil
+	})
+	return pending, ok, err
+}
@@ -0,0 +1,225 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	fluxerr "github.com/weaveworks/flux/errors"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
+)
+
+// setApproval automates the workload svc, with the approval policy
+// given, directly in the repo.
+func setApproval(t *testing.T, d *Daemon, approval string) {
+	addPolicies(t, d, policy.Set{policy.Automated: "true", policy.Approval: approval})
+}
+
+// addPolicies adds the policies given to the workload svc, directly
+// in the repo.
+func addPolicies(t *testing.T, d *Daemon, policies policy.Set) {
+	ctx := context.Background()
+	if err := d.Repo.Ready(ctx); err != nil {
+		t.Fatal(err)
+	}
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		update := policy.Update{Add: policies}
+		if _, err := cluster.UpdatePolicies(d.Manifests, checkout.Dir(), checkout.ManifestDirs(), flux.MustParseResourceID(svc), update); err != nil {
+			return err
+		}
+		return checkout.CommitAndPush(ctx, git.CommitAction{Message: "add policies"}, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDaemon_ApproveRelease(t *testing.T) {
+	d, _, clean, _, _, _ := mockDaemon(t)
+	defer clean()
+	setApproval(t, d, policy.ApprovalManual)
+	logger := log.NewNopLogger()
+	ctx := context.Background()
+
+	// The automated release is pending, rather than pushed
+	d.pollForNewImages(logger)
+	pending, err := d.ListPendingReleases(ctx)
+	assert.NoError(t, err)
+	if !assert.Len(t, pending, 1) {
+		t.FailNow()
+	}
+	id := pending[0].ID
+	assert.Equal(t, policy.ApprovalManual, pending[0].Approval)
+	assert.Equal(t, "", pending[0].Branch)
+	assert.Equal(t, update.ReleaseStatusSuccess, pending[0].Result[flux.MustParseResourceID(svc)].Status)
+
+	// Polling again, with the same changes, keeps the same release
+	d.pollForNewImages(logger)
+	pending, err = d.ListPendingReleases(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, id, pending[0].ID)
+	}
+
+	_, err = d.ApproveRelease(ctx, job.ID("not-a-pending-release"), update.Cause{})
+	if ferr, ok := err.(*fluxerr.Error); !ok || ferr.Type != fluxerr.Missing {
+		t.Errorf("expected missing error, got %v", err)
+	}
+
+	// Approving the release runs it as a job, with the same ID
+	cause := update.Cause{User: "approver", Message: "release it"}
+	jobID, err := d.ApproveRelease(ctx, id, cause)
+	assert.NoError(t, err)
+	assert.Equal(t, id, jobID)
+	pending, err = d.ListPendingReleases(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 0)
+
+	// Run the job as the loop would
+	queued := <-d.Jobs.Ready()
+	assert.Equal(t, id, queued.ID)
+	assert.NoError(t, queued.Do(logger))
+	w := newWait(t)
+	status := w.ForJobSucceeded(d, id)
+	if assert.NotNil(t, status.Result.Spec) {
+		assert.Equal(t, cause, status.Result.Spec.Cause)
+	}
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	w.ForImageTag(t, d, svc, container, "2")
+
+	// Once released, there's nothing pending
+	d.pollForNewImages(logger)
+	pending, err = d.ListPendingReleases(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 0)
+}
+
+func TestDaemon_ApproveRelease_restart(t *testing.T) {
+	d, _, clean, _, _, _ := mockDaemon(t)
+	defer clean()
+	setApproval(t, d, policy.ApprovalManual)
+	logger := log.NewNopLogger()
+	ctx := context.Background()
+
+	d.pollForNewImages(logger)
+	pending, err := d.ListPendingReleases(ctx)
+	assert.NoError(t, err)
+	if !assert.Len(t, pending, 1) {
+		t.FailNow()
+	}
+	id := pending[0].ID
+
+	// Forgetting the pending releases, as a restart would, then
+	// polling again gives the same release the same ID ...
+	d.pendingMu.Lock()
+	d.pending = nil
+	d.pendingMu.Unlock()
+	d.pollForNewImages(logger)
+	pending, err = d.ListPendingReleases(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, id, pending[0].ID)
+	}
+
+	// ... so it can still be approved with that ID
+	jobID, err := d.ApproveRelease(ctx, id, update.Cause{})
+	assert.NoError(t, err)
+	assert.Equal(t, id, jobID)
+}
+
+func TestDaemon_ApproveRelease_branch(t *testing.T) {
+	d, _, clean, _, _, _ := mockDaemon(t)
+	defer clean()
+	setApproval(t, d, policy.ApprovalBranch)
+	logger := log.NewNopLogger()
+	ctx := context.Background()
+
+	head, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.pollForNewImages(logger)
+	pending, err := d.ListPendingReleases(ctx)
+	assert.NoError(t, err)
+	if !assert.Len(t, pending, 1) {
+		t.FailNow()
+	}
+	assert.Equal(t, "flux-release/default-deployment-helloworld", pending[0].Branch)
+
+	// The release is pushed to its own branch, and the note on the
+	// commit records the pending release's ID
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	branchHead, err := d.Repo.Revision(ctx, pending[0].Branch)
+	assert.NoError(t, err)
+	err = d.WithClone(ctx, func(checkout *git.Checkout) error {
+		var n note
+		ok, err := checkout.GetNote(ctx, branchHead, &n)
+		assert.True(t, ok)
+		assert.Equal(t, pending[0].ID, n.JobID)
+		return err
+	})
+	assert.NoError(t, err)
+
+	// ... and not to the branch being synced
+	newHead, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+	assert.NoError(t, err)
+	assert.Equal(t, head, newHead)
+
+	// After a restart, the same release is found on the branch,
+	// rather than being pushed again
+	id := pending[0].ID
+	d.pendingMu.Lock()
+	d.pending = nil
+	d.pendingMu.Unlock()
+	d.pollForNewImages(logger)
+	pending, err = d.ListPendingReleases(ctx)
+	assert.NoError(t, err)
+	if !assert.Len(t, pending, 1) {
+		t.FailNow()
+	}
+	assert.Equal(t, id, pending[0].ID)
+	assert.Equal(t, "flux-release/default-deployment-helloworld", pending[0].Branch)
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	newBranchHead, err := d.Repo.Revision(ctx, pending[0].Branch)
+	assert.NoError(t, err)
+	assert.Equal(t, branchHead, newBranchHead)
+
+	// Once the release is approved and run, the branch is deleted
+	_, err = d.ApproveRelease(ctx, id, update.Cause{User: "approver", Message: "release it"})
+	assert.NoError(t, err)
+	queued := <-d.Jobs.Ready()
+	assert.NoError(t, queued.Do(logger))
+	w := newWait(t)
+	w.ForJobSucceeded(d, id)
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	w.ForImageTag(t, d, svc, container, "2")
+
+	d.pollForNewImages(logger)
+	pending, err = d.ListPendingReleases(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 0)
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.Repo.Revision(ctx, "flux-release/default-deployment-helloworld")
+	assert.Error(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -15,10 +16,12 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v12"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/freeze"
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/guid"
 	"github.com/weaveworks/flux/image"
@@ -27,6 +30,7 @@ import (
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/release"
 	"github.com/weaveworks/flux/resource"
+	fluxsync "github.com/weaveworks/flux/sync"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -53,6 +57,14 @@ type Daemon struct {
 	JobStatusCache *job.StatusCache
 	EventWriter    event.EventWriter
 	Logger         log.Logger
+	// If non-nil, used to check changed manifests before they are
+	// committed
+	Validator cluster.Validator
+	// Additional repos to sync from, and the mirrors of them
+	SyncSources   []SyncSource
+	SourceMirrors *git.Mirrors
+	// The freezes on releases; if nil, releases are never frozen
+	Freezes *freeze.Freezes
 	// bookkeeping
 	*LoopVars
 }
@@ -294,7 +306,12 @@ func (d *Daemon) makeLoggingJobFunc(f jobFunc) jobFunc {
 
 // queueJob queues a job func to be executed.
 func (d *Daemon) queueJob(do jobFunc) job.ID {
-	id := job.ID(guid.New())
+	return d.queueJobWithID(job.ID(guid.New()), do)
+}
+
+// queueJobWithID queues a job func to be executed, as the job with the
+// ID given.
+func (d *Daemon) queueJobWithID(id job.ID, do jobFunc) job.ID {
 	enqueuedAt := time.Now()
 	d.Jobs.Enqueue(&job.Job{
 		ID: id,
@@ -371,37 +388,26 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 			if policy.Set(u.Add).Has(policy.Automated) {
 				anythingAutomated = true
 			}
-			// find the service manifest
-			err := cluster.UpdateManifest(d.Manifests, working.Dir(), working.ManifestDirs(), serviceID, func(def []byte) ([]byte, error) {
-				newDef, err := d.Manifests.UpdatePolicies(def, serviceID, u)
-				if err != nil {
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusFailed,
-						Error:  err.Error(),
-					}
-					return nil, err
+			// find the service manifest, and update it
+			changed, err := cluster.UpdatePolicies(d.Manifests, working.Dir(), working.ManifestDirs(), serviceID, u)
+			if err != nil {
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusFailed,
+					Error:  err.Error(),
 				}
-				if string(newDef) == string(def) {
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusSkipped,
-					}
-				} else {
-					serviceIDs = append(serviceIDs, serviceID)
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusSuccess,
-					}
+				if _, ok := err.(cluster.ManifestError); ok {
+					continue
 				}
-				return newDef, nil
-			})
-			if err != nil {
-				switch err := err.(type) {
-				case cluster.ManifestError:
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusFailed,
-						Error:  err.Error(),
-					}
-				default:
-					return result, err
+				return result, err
+			}
+			if changed {
+				serviceIDs = append(serviceIDs, serviceID)
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusSuccess,
+				}
+			} else {
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusSkipped,
 				}
 			}
 		}
@@ -413,6 +419,9 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 		if d.GitConfig.SetAuthor {
 			commitAuthor = spec.Cause.User
 		}
+		if err := d.validateChanges(ctx, working); err != nil {
+			return result, err
+		}
 		commitAction := git.CommitAction{Author: commitAuthor, Message: policyCommitMessage(updates, spec.Cause)}
 		if err := working.CommitAndPush(ctx, commitAction, &note{JobID: jobID, Spec: spec}); err != nil {
 			// On the chance pushing failed because it was not
@@ -436,7 +445,7 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 
 func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 	return func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error) {
-		rc := release.NewReleaseContext(d.Cluster, d.Manifests, d.Registry, working)
+		rc := d.newReleaseContext(working)
 		result, err := release.Release(rc, c, logger)
 
 		var zero job.Result
@@ -447,6 +456,16 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 		var revision string
 
 		if c.ReleaseKind() == update.ReleaseKindExecute {
+			if frozen := frozenResult(result); len(frozen) > 0 {
+				if err := d.logFrozenEvent(&spec, frozen); err != nil {
+					logger.Log("err", errors.Wrap(err, "logging event for frozen release"))
+				}
+				// If everything was frozen, there's nothing to
+				// commit; the result says why.
+				if len(result.AffectedResources()) == 0 {
+					return job.Result{Spec: &spec, Result: result}, nil
+				}
+			}
 			commitMsg := spec.Cause.Message
 			if commitMsg == "" {
 				commitMsg = c.CommitMessage(result)
@@ -455,8 +474,15 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 			if d.GitConfig.SetAuthor {
 				commitAuthor = spec.Cause.User
 			}
+			if err := d.validateChanges(ctx, working); err != nil {
+				return zero, err
+			}
 			commitAction := git.CommitAction{Author: commitAuthor, Message: commitMsg}
-			if err := working.CommitAndPush(ctx, commitAction, &note{JobID: jobID, Spec: spec, Result: result}); err != nil {
+			n := &note{JobID: jobID, Spec: spec, Result: result}
+			if s, ok := c.(*stagedChanges); ok {
+				n.Stage = &s.stage
+			}
+			if err := working.CommitAndPush(ctx, commitAction, n); err != nil {
 				// On the chance pushing failed because it was not
 				// possible to fast-forward, ask the repo to fetch
 				// from upstream ASAP, so the next attempt is more
@@ -477,6 +503,54 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 	}
 }
 
+// validateChanges checks the resources in the files changed in the
+// working checkout, so that malformed manifests are never committed.
+// If the resources can't be checked, e.g., because the schema isn't
+// available, the changes are let through with a warning, rather than
+// holding up every release and policy update. Changes to directories
+// whose manifests are generated aren't checked either, since that
+// would mean running the generators while holding up the job.
+func (d *Daemon) validateChanges(ctx context.Context, working *git.Checkout) error {
+	if d.Validator == nil {
+		return nil
+	}
+	changed, err := working.ChangedFiles(ctx, "HEAD")
+	if err != nil {
+		return errors.Wrap(err, "finding changed files")
+	}
+	if gen, ok := d.Manifests.(cluster.ManifestGenerator); ok {
+		var plain, generated []string
+		for _, path := range changed {
+			if gen.GeneratedFrom(working.Dir(), path) {
+				rel, _ := filepath.Rel(working.Dir(), path)
+				generated = append(generated, rel)
+			} else {
+				plain = append(plain, path)
+			}
+		}
+		if len(generated) > 0 {
+			d.Logger.Log("warning", "changes to generated manifests not validated", "files", strings.Join(generated, ","))
+		}
+		changed = plain
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	resources, err := d.Manifests.LoadManifests(working.Dir(), changed)
+	if err != nil {
+		return manifestLoadError(err)
+	}
+	switch err := d.Validator.Validate(resources).(type) {
+	case nil:
+		return nil
+	case cluster.ValidationErrors:
+		return invalidManifestsError(err)
+	default:
+		d.Logger.Log("warning", "changed manifests not validated", "err", err)
+		return nil
+	}
+}
+
 // Tell the daemon to synchronise the cluster with the manifests in
 // the git repo. This has an error return value because upstream there
 // may be comms difficulties or other sources of problems; here, we
@@ -565,6 +639,29 @@ func (d *Daemon) SyncStatus(ctx context.Context, commitRef string) ([]string, er
 	return revs, nil
 }
 
+// SyncPlan reports what syncing the head of the branch would do to
+// the cluster, without doing it.
+func (d *Daemon) SyncPlan(ctx context.Context) (v12.SyncPlan, error) {
+	var plan v12.SyncPlan
+	err := d.WithClone(ctx, func(working *git.Checkout) error {
+		rev, err := working.HeadRevision(ctx)
+		if err != nil {
+			return err
+		}
+		resources, err := d.Manifests.LoadManifests(working.Dir(), working.ManifestDirs())
+		if err != nil {
+			return errors.Wrap(err, "loading resources from repo")
+		}
+		resourcePlan, err := fluxsync.Plan(d.Logger, d.Manifests, syncSource(d.Repo.Origin(), d.GitConfig), resources, d.Cluster, d.SyncGC)
+		if err != nil {
+			return err
+		}
+		plan = v12.SyncPlan{Revision: rev, Resources: resourcePlan}
+		return nil
+	})
+	return plan, err
+}
+
 func (d *Daemon) GitRepoConfig(ctx context.Context, regenerate bool) (v6.GitConfig, error) {
 	publicSSHKey, err := d.Cluster.PublicSSHKey(regenerate)
 	if err != nil {
@@ -585,6 +682,7 @@ func (d *Daemon) GitRepoConfig(ctx context.Context, regenerate bool) (v6.GitConf
 		},
 		PublicSSHKey: publicSSHKey,
 		Status:       status,
+		Sources:      d.sourcesConfig(ctx, d.Logger),
 	}, nil
 }
 
@@ -615,6 +713,7 @@ func containers2containers(cs []resource.Container) []v6.Container {
 	for i, c := range cs {
 		res[i] = v6.Container{
 			Name: c.Name,
+			Init: c.Init,
 			Current: image.Info{
 				ID: c.Image,
 			},
@@ -639,6 +738,7 @@ func getServiceContainers(service cluster.Controller, imageRepos update.ImageRep
 		if err != nil {
 			return res, err
 		}
+		container.Init = c.Init
 		res = append(res, container)
 	}
 
@@ -4,8 +4,11 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -22,6 +25,7 @@ import (
 	"github.com/weaveworks/flux/cluster/kubernetes"
 	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	fluxerr "github.com/weaveworks/flux/errors"
 	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/git/gittest"
@@ -359,12 +363,12 @@ func TestDaemon_NotifyChange(t *testing.T) {
 	var syncCalled int
 	var syncDef *cluster.SyncDef
 	var syncMu sync.Mutex
-	mockK8s.SyncFunc = func(def cluster.SyncDef) error {
+	mockK8s.SyncFunc = func(def cluster.SyncDef) (cluster.SyncResult, error) {
 		syncMu.Lock()
 		syncCalled++
 		syncDef = &def
 		syncMu.Unlock()
-		return nil
+		return nil, nil
 	}
 
 	start()
@@ -586,6 +590,121 @@ func TestDaemon_Automated_semver(t *testing.T) {
 	w.ForImageTag(t, d, resid.String(), container, "3")
 }
 
+// When the validator finds a problem with the changed files, the job
+// is rejected before anything is committed.
+func TestDaemon_ValidateChanges(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.Validator = kubernetes.NewSchemaValidator(kubernetes.StaticSchema(testfiles.OpenAPISchema))
+
+	ctx := context.Background()
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		// Nothing has changed yet
+		if err := d.validateChanges(ctx, checkout); err != nil {
+			t.Errorf("expected no error with no changes, got %v", err)
+		}
+
+		def := strings.Replace(testfiles.Files["helloworld-deploy.yaml"], "- name: sidecar", "- nmae: sidecar", 1)
+		if err := ioutil.WriteFile(filepath.Join(checkout.Dir(), "helloworld-deploy.yaml"), []byte(def), 0600); err != nil {
+			return err
+		}
+		err := d.validateChanges(ctx, checkout)
+		ferr, ok := err.(*fluxerr.Error)
+		if !ok || ferr.Type != fluxerr.User {
+			t.Fatalf("expected user error, got %v", err)
+		}
+		expected := cluster.ValidationErrors{
+			{File: "helloworld-deploy.yaml", Path: "spec.template.spec.containers[1].nmae", Message: "unknown field"},
+			{File: "helloworld-deploy.yaml", Path: "spec.template.spec.containers[1].name", Message: "missing required field"},
+		}
+		if !reflect.DeepEqual(expected, ferr.Err) {
+			t.Errorf("expected %#v, got %#v", expected, ferr.Err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// When the changes can't be validated, they're let through rather
+// than blocked.
+func TestDaemon_ValidateChanges_SchemaUnavailable(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.Validator = kubernetes.NewSchemaValidator(kubernetes.StaticSchema("{"))
+
+	ctx := context.Background()
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		def := strings.Replace(testfiles.Files["helloworld-deploy.yaml"], "replicas: 5", "replicas: 4", 1)
+		if err := ioutil.WriteFile(filepath.Join(checkout.Dir(), "helloworld-deploy.yaml"), []byte(def), 0600); err != nil {
+			return err
+		}
+		if err := d.validateChanges(ctx, checkout); err != nil {
+			t.Errorf("expected no error when the schema is unavailable, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Changes to generated manifests aren't validated, since that would
+// mean running the generators during the job.
+func TestDaemon_ValidateChanges_Generated(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.Manifests = &kubernetes.Manifests{Generate: true}
+	d.Validator = kubernetes.NewSchemaValidator(kubernetes.StaticSchema(testfiles.OpenAPISchema))
+
+	ctx := context.Background()
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		dir := filepath.Join(checkout.Dir(), "generated")
+		if err := os.Mkdir(dir, 0700); err != nil {
+			return err
+		}
+		config := "version: 1\ngenerators:\n- command: exit 1\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, ".flux.yaml"), []byte(config), 0600); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "values.txt"), []byte("image: app:v1\n"), 0600); err != nil {
+			return err
+		}
+		// Flux only commits changes to files already in the repo, so
+		// add these directly
+		for _, args := range [][]string{
+			{"add", "generated"},
+			{"-c", "user.name=flux", "-c", "user.email=flux@example.com", "commit", "-m", "add generated"},
+		} {
+			if out, err := exec.Command("git", append([]string{"-C", checkout.Dir()}, args...)...).CombinedOutput(); err != nil {
+				return fmt.Errorf("git %s: %s", strings.Join(args, " "), out)
+			}
+		}
+
+		// The generator would fail, but isn't run
+		if err := ioutil.WriteFile(filepath.Join(dir, "values.txt"), []byte("image: app:v2\n"), 0600); err != nil {
+			return err
+		}
+		if err := d.validateChanges(ctx, checkout); err != nil {
+			t.Errorf("expected changes to generated manifests not to be validated, got %v", err)
+		}
+
+		// Other changes are validated as usual
+		def := strings.Replace(testfiles.Files["helloworld-deploy.yaml"], "- name: sidecar", "- nmae: sidecar", 1)
+		if err := ioutil.WriteFile(filepath.Join(checkout.Dir(), "helloworld-deploy.yaml"), []byte(def), 0600); err != nil {
+			return err
+		}
+		if _, ok := d.validateChanges(ctx, checkout).(*fluxerr.Error); !ok {
+			t.Errorf("expected invalid manifest to be rejected")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func makeImageInfo(ref string, t time.Time) image.Info {
 	return image.Info{ID: mustParseImageRef(ref), CreatedAt: t}
 }
@@ -650,6 +769,7 @@ func mockDaemon(t *testing.T) (*Daemon, func(), func(), *cluster.Mock, *mockEven
 			return []cluster.Controller{}, nil
 		}
 		k8s.ExportFunc = func() ([]byte, error) { return testBytes, nil }
+		k8s.ExportSyncedFunc = func(string) ([]byte, error) { return nil, nil }
 		k8s.LoadManifestsFunc = kresource.Load
 		k8s.ParseManifestsFunc = func(allDefs []byte) (map[string]resource.Resource, error) {
 			return kresource.ParseMultidoc(allDefs, "test")
@@ -660,7 +780,7 @@ func mockDaemon(t *testing.T) (*Daemon, func(), func(), *cluster.Mock, *mockEven
 				singleService,
 			}, nil
 		}
-		k8s.SyncFunc = func(def cluster.SyncDef) error { return nil }
+		k8s.SyncFunc = func(def cluster.SyncDef) (cluster.SyncResult, error) { return nil, nil }
 		k8s.UpdatePoliciesFunc = (&kubernetes.Manifests{}).UpdatePolicies
 		k8s.UpdateImageFunc = (&kubernetes.Manifests{}).UpdateImage
 	}
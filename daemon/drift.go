@@ -0,0 +1,186 @@
+package daemon
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/api/v12"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/drift"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+	"github.com/weaveworks/flux/resource"
+)
+
+// DriftReport compares the resources in the cluster with their
+// definitions at the revision last synced from the repo.
+func (d *Daemon) DriftReport(ctx context.Context) (v12.DriftReport, error) {
+	target := d.mainSyncTarget()
+	rev, err := d.Repo.Revision(ctx, d.GitConfig.SyncTag)
+	if err != nil {
+		if isUnknownRevision(err) {
+			return v12.DriftReport{}, notSyncedError(d.GitConfig.SyncTag)
+		}
+		return v12.DriftReport{}, err
+	}
+	repoResources, err := d.loadResourcesAt(ctx, target, rev)
+	if err != nil {
+		return v12.DriftReport{}, err
+	}
+	// Since this is on request, it's worth looking for everything
+	// marked as synced, even if that's not needed for syncing
+	report, err := d.detectDrift(d.Cluster, target, repoResources, true)
+	if err != nil {
+		return v12.DriftReport{}, err
+	}
+	return v12.DriftReport{Revision: rev, Resources: report}, nil
+}
+
+// driftSinceSync compares the resources in the cluster with their
+// definitions at the revision last synced from the target, given the
+// resources at the head revision (which are the same, if nothing has
+// been committed since).
+func (d *Daemon) driftSinceSync(ctx context.Context, clus cluster.Cluster, target syncTarget, syncedRev, headRev string, headResources map[string]resource.Resource) (drift.Report, error) {
+	repoResources := headResources
+	if syncedRev != headRev {
+		var err error
+		if repoResources, err = d.loadResourcesAt(ctx, target, syncedRev); err != nil {
+			return nil, err
+		}
+	}
+	return d.detectDrift(clus, target, repoResources, d.SyncGC)
+}
+
+// loadResourcesAt loads the resources defined in the target's repo at
+// the revision given, leaving out any the target doesn't sync.
+func (d *Daemon) loadResourcesAt(ctx context.Context, target syncTarget, rev string) (map[string]resource.Resource, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
+	export, err := target.repo.Export(ctx, rev)
+	cancel()
+	if err != nil {
+		return nil, errors.Wrapf(err, "exporting revision %s", rev)
+	}
+	defer export.Clean()
+
+	paths := []string{export.Dir()}
+	if len(target.config.Paths) > 0 {
+		paths = nil
+		for _, p := range target.config.Paths {
+			paths = append(paths, filepath.Join(export.Dir(), p))
+		}
+	}
+	repoResources, err := d.Manifests.LoadManifests(export.Dir(), paths)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading resources from repo")
+	}
+	repoResources, _ = target.restrict(repoResources)
+	return repoResources, nil
+}
+
+// detectDrift compares the resources given, from the target's repo,
+// with those in the cluster. Listing everything marked as synced is
+// expensive, so unless `synced` is true, only the resources exported
+// from the cluster for syncing are looked at, and the rest are
+// reported as untracked.
+func (d *Daemon) detectDrift(clus cluster.Cluster, target syncTarget, repoResources map[string]resource.Resource, synced bool) (drift.Report, error) {
+	clusterResources, err := d.exportResources(clus, syncSource(target.repo.Origin(), target.config), synced)
+	if err != nil {
+		return nil, err
+	}
+	return drift.Detect(repoResources, clusterResources)
+}
+
+// exportResources gets the resources running in the cluster that can
+// have come from the sync source given: all the workloads, plus (if
+// `synced` is true) anything marked as having been synced from the
+// source.
+func (d *Daemon) exportResources(clus cluster.Cluster, source string, synced bool) (map[string]resource.Resource, error) {
+	exported, err := clus.Export()
+	if err != nil {
+		return nil, errors.Wrap(err, "exporting resources from cluster")
+	}
+	resources, err := d.Manifests.ParseManifests(exported)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing resources exported from cluster")
+	}
+	if !synced {
+		return resources, nil
+	}
+
+	syncedDefs, err := clus.ExportSynced(source)
+	if err != nil {
+		return nil, errors.Wrap(err, "exporting synced resources from cluster")
+	}
+	syncedResources, err := d.Manifests.ParseManifests(syncedDefs)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing synced resources exported from cluster")
+	}
+	for id, res := range syncedResources {
+		resources[id] = res
+	}
+	return resources, nil
+}
+
+// exportedCluster remembers what is exported from the cluster, so
+// that detecting drift and then syncing fetch the resources from the
+// cluster only once between them.
+type exportedCluster struct {
+	cluster.Cluster
+	exported []byte
+	synced   map[string][]byte
+}
+
+func (c *exportedCluster) Export() ([]byte, error) {
+	if c.exported == nil {
+		exported, err := c.Cluster.Export()
+		if err != nil {
+			return nil, err
+		}
+		c.exported = exported
+	}
+	return c.exported, nil
+}
+
+func (c *exportedCluster) ExportSynced(source string) ([]byte, error) {
+	if synced, ok := c.synced[source]; ok {
+		return synced, nil
+	}
+	synced, err := c.Cluster.ExportSynced(source)
+	if err != nil {
+		return nil, err
+	}
+	if c.synced == nil {
+		c.synced = map[string][]byte{}
+	}
+	c.synced[source] = synced
+	return synced, nil
+}
+
+// recordDrift updates the gauge of drifted resources with the report
+// for the named sync target. The gauge is summed over all targets;
+// and, once nothing has drifted in a namespace, it's set to zero
+// rather than left at its last value.
+func (d *Daemon) recordDrift(target string, report drift.Report) {
+	d.driftMu.Lock()
+	defer d.driftMu.Unlock()
+	if d.driftCounts == nil {
+		d.driftCounts = map[string]map[string]int{}
+		d.driftReported = map[string]bool{}
+	}
+	d.driftCounts[target] = report.CountByNamespace()
+
+	totals := map[string]int{}
+	for ns := range d.driftReported {
+		totals[ns] = 0
+	}
+	for _, counts := range d.driftCounts {
+		for ns, n := range counts {
+			totals[ns] += n
+		}
+	}
+	for ns, n := range totals {
+		driftedResources.With(fluxmetrics.LabelNamespace, ns).Set(float64(n))
+		d.driftReported[ns] = true
+	}
+}
@@ -0,0 +1,170 @@
+package daemon
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/drift"
+	fluxerr "github.com/weaveworks/flux/errors"
+	"github.com/weaveworks/flux/git"
+)
+
+func TestDaemon_DriftReport(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, err := d.DriftReport(ctx)
+	if err, ok := err.(*fluxerr.Error); !ok || err.Type != fluxerr.Missing {
+		t.Errorf("expected missing error before anything is synced, got %v", err)
+	}
+
+	err = d.WithClone(ctx, func(checkout *git.Checkout) error {
+		return checkout.MoveSyncTagAndPush(ctx, "HEAD", "Sync pointer")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone has scaled helloworld by hand; and nothing else is
+	// running.
+	k8s.ExportFunc = func() ([]byte, error) {
+		return []byte(strings.Replace(testfiles.Files["helloworld-deploy.yaml"], "replicas: 5", "replicas: 2", 1)), nil
+	}
+
+	report, err := d.DriftReport(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headRev, _ := d.Repo.Revision(ctx, "HEAD")
+	if report.Revision != headRev {
+		t.Errorf("expected report for synced revision %s, got %s", headRev, report.Revision)
+	}
+
+	var found bool
+	for _, res := range report.Resources {
+		if res.ID.String() != "default:deployment/helloworld" {
+			// Only workloads are known to be missing; services may
+			// just not be marked as synced
+			_, kind, _ := res.ID.Components()
+			if kind == "service" {
+				if !res.Untracked || res.Missing {
+					t.Errorf("expected %s to be untracked, got %#v", res.ID, res)
+				}
+			} else if !res.Missing || res.Untracked {
+				t.Errorf("expected %s to be missing from the cluster, got %#v", res.ID, res)
+			}
+			continue
+		}
+		found = true
+		expected := []drift.Difference{{Path: "spec.replicas", Git: float64(5), Cluster: float64(2)}}
+		if !reflect.DeepEqual(expected, res.Differences) {
+			t.Errorf("expected differences %#v, got %#v", expected, res.Differences)
+		}
+	}
+	if !found {
+		t.Errorf("expected drift in helloworld, got %#v", report.Resources)
+	}
+}
+
+func TestDoSync_RecordsDrift(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		return checkout.MoveSyncTagAndPush(ctx, "HEAD", "Sync pointer")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	exportWith := func(edit func(file, def string) string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			files := map[string]bool{}
+			for _, file := range testfiles.ResourceMap {
+				files[file] = true
+			}
+			var all []string
+			for file := range files {
+				all = append(all, edit(file, testfiles.Files[file]))
+			}
+			return []byte(strings.Join(all, "\n---\n")), nil
+		}
+	}
+	// Everything is as it should be
+	k8s.ExportFunc = exportWith(func(_, def string) string { return def })
+	k8s.SyncFunc = func(def cluster.SyncDef) (cluster.SyncResult, error) { return nil, nil }
+
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+	expected := map[string]map[string]int{"": {}}
+	if !reflect.DeepEqual(expected, d.driftCounts) {
+		t.Errorf("expected no drift, got %#v", d.driftCounts)
+	}
+
+	// Now someone edits a deployment
+	k8s.ExportFunc = exportWith(func(file, def string) string {
+		if file == "helloworld-deploy.yaml" {
+			return strings.Replace(def, "replicas: 5", "replicas: 2", 1)
+		}
+		return def
+	})
+
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+	expected = map[string]map[string]int{"": {"default": 1}}
+	if !reflect.DeepEqual(expected, d.driftCounts) {
+		t.Errorf("expected drift to be recorded, got %#v", d.driftCounts)
+	}
+}
+
+func TestDoSync_DriftUsesSyncExport(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		return checkout.MoveSyncTagAndPush(ctx, "HEAD", "Sync pointer")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var exports, syncedExports int
+	k8s.ExportFunc = func() ([]byte, error) {
+		exports++
+		return []byte(testfiles.Files["helloworld-deploy.yaml"]), nil
+	}
+	k8s.ExportSyncedFunc = func(string) ([]byte, error) {
+		syncedExports++
+		return nil, nil
+	}
+	k8s.SyncFunc = func(def cluster.SyncDef) (cluster.SyncResult, error) { return nil, nil }
+
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+	if exports != 1 || syncedExports != 0 {
+		t.Errorf("expected one export and no synced export without GC, got %d and %d", exports, syncedExports)
+	}
+
+	exports, syncedExports = 0, 0
+	d.SyncGC = true
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+	if exports != 1 || syncedExports != 1 {
+		t.Errorf("expected one export and one synced export with GC, got %d and %d", exports, syncedExports)
+	}
+}
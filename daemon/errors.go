@@ -2,9 +2,11 @@ package daemon
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
 	fluxerr "github.com/weaveworks/flux/errors"
 	"github.com/weaveworks/flux/job"
 )
@@ -42,6 +44,62 @@ and include the problematic file, if possible.
 	}
 }
 
+func invalidManifestsError(errs cluster.ValidationErrors) error {
+	var problems []string
+	for _, e := range errs {
+		problems = append(problems, "    "+e.Error())
+	}
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  errs,
+		Help: `Changed manifests are not valid
+
+The changes made to the files in the git repo would leave some
+resources with definitions that don't match the schema for their kind,
+as given by the cluster:
+
+` + strings.Join(problems, "\n") + `
+
+Nothing has been committed. Flux only changes images and annotations,
+so most likely the files mentioned were malformed already; fix them in
+git, and try again. If they look fine to you, please log an issue at
+
+    https://github.com/weaveworks/flux/issues
+
+and include the problematic file, if possible.
+`,
+	}
+}
+
+func notSyncedError(syncTag string) error {
+	return &fluxerr.Error{
+		Type: fluxerr.Missing,
+		Err:  fmt.Errorf("sync tag %q not found", syncTag),
+		Help: `Nothing has been synced yet
+
+Drift is measured against the revision most recently synced to the
+cluster, which is marked with the sync tag; but the sync tag does not
+exist yet. Wait for the first sync to complete (or run 'fluxctl sync')
+and try again.
+`,
+	}
+}
+
+func unknownPendingReleaseError(id job.ID) error {
+	return &fluxerr.Error{
+		Type: fluxerr.Missing,
+		Err:  fmt.Errorf("no pending release %q", string(id)),
+		Help: `Pending release not found
+
+There is no release waiting for approval with the ID given. It may
+have been approved already, or replaced by a release of newer images,
+or it may no longer be needed (e.g., because its branch was merged).
+
+Use 'fluxctl list-pending' to see the releases waiting for approval.
+`,
+	}
+}
+
 func unknownJobError(id job.ID) error {
 	return &fluxerr.Error{
 		Type: fluxerr.Missing,
@@ -0,0 +1,131 @@
+package daemon
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/freeze"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/release"
+	"github.com/weaveworks/flux/update"
+)
+
+// Releases are not made to namespaces that are frozen, either by a
+// freeze window or an ad-hoc freeze. Releases asked for skip the
+// controllers that are frozen; automated releases are deferred until
+// the freeze is over, which just means the image poll doesn't include
+// them until then.
+
+// ListFreezes gives the freeze windows, and the ad-hoc freezes in
+// effect.
+func (d *Daemon) ListFreezes(ctx context.Context) ([]freeze.Freeze, error) {
+	res := d.Freezes.List(time.Now())
+	if res == nil {
+		res = []freeze.Freeze{}
+	}
+	return res, nil
+}
+
+// SetFreeze sets an ad-hoc freeze, replacing any freeze set before
+// for the same namespace (or all namespaces). A freeze with an
+// `Until` that has already passed lifts the freeze.
+func (d *Daemon) SetFreeze(ctx context.Context, f freeze.Freeze) error {
+	if d.Freezes == nil {
+		return errors.New("freezes are not supported by this daemon")
+	}
+	now := time.Now()
+	if err := d.Freezes.Set(f, now); err != nil {
+		return errors.Wrap(err, "saving freezes")
+	}
+	if f.Until.After(now) {
+		d.Logger.Log("info", "releases frozen", "namespace", f.Namespace, "until", f.Until, "user", f.User, "reason", f.Reason)
+	} else {
+		d.Logger.Log("info", "releases unfrozen", "namespace", f.Namespace, "user", f.User)
+		d.AskForImagePoll()
+	}
+	return nil
+}
+
+// frozen says whether releases to the namespace given are frozen now.
+func (d *Daemon) frozen(namespace string) bool {
+	_, ok := d.Freezes.Frozen(namespace, time.Now())
+	return ok
+}
+
+// newReleaseContext gives a release context for the working checkout,
+// which skips controllers in namespaces that are frozen, and those
+// whose images can't be changed.
+func (d *Daemon) newReleaseContext(working *git.Checkout) *release.ReleaseContext {
+	return release.NewReleaseContext(d.Cluster, d.Manifests, d.Registry, working).
+		WithFilters(&update.FrozenFilter{Frozen: d.frozen}, &update.ImmutableFilter{})
+}
+
+// frozenResult gives the results in result that were skipped because
+// of a freeze.
+func frozenResult(result update.Result) update.Result {
+	frozen := update.Result{}
+	for id, r := range result {
+		if r.Status == update.ReleaseStatusSkipped && r.Error == update.Frozen {
+			frozen[id] = r
+		}
+	}
+	return frozen
+}
+
+// logFrozenEvent records that the controllers in result were not
+// released because of a freeze. The spec is nil for automated
+// releases deferred by the image poll.
+func (d *Daemon) logFrozenEvent(spec *update.Spec, result update.Result) error {
+	var serviceIDs []flux.ResourceID
+	for id := range result {
+		serviceIDs = append(serviceIDs, id)
+	}
+	now := time.Now().UTC()
+	return d.LogEvent(event.Event{
+		ServiceIDs: serviceIDs,
+		Type:       event.EventFrozen,
+		StartedAt:  now,
+		EndedAt:    now,
+		LogLevel:   event.LogLevelInfo,
+		Metadata:   &event.FrozenEventMetadata{Spec: spec, Result: result},
+	})
+}
+
+// deferFrozen records the automated changes that the image poll found,
+// but did not release because they are in frozen namespaces. An event
+// is logged for those that were not deferred, or were deferred with
+// different changes, the last time around.
+func (d *Daemon) deferFrozen(frozen map[flux.ResourceID]*update.Automated, logger log.Logger) {
+	deferred := update.Result{}
+	news := update.Result{}
+	for id, changes := range frozen {
+		r := update.ControllerResult{
+			Status: update.ReleaseStatusSkipped,
+			Error:  update.Frozen,
+		}
+		for _, c := range changes.Changes {
+			r.PerContainer = append(r.PerContainer, update.ContainerUpdate{
+				Container: c.Container.Name,
+				Current:   c.Container.Image,
+				Target:    c.ImageID,
+			})
+		}
+		deferred[id] = r
+		if previous, ok := d.deferred[id]; !ok || !reflect.DeepEqual(previous, r) {
+			news[id] = r
+			logger.Log("info", "automated release deferred by freeze", "service", id)
+		}
+	}
+	d.deferred = deferred
+	if len(news) > 0 {
+		if err := d.logFrozenEvent(nil, news); err != nil {
+			logger.Log("err", errors.Wrap(err, "logging event for deferred release"))
+		}
+	}
+}
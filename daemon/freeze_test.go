@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/freeze"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
+)
+
+func frozenEvents(t *testing.T, events *mockEventWriter) []event.Event {
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []event.Event
+	for _, e := range es {
+		if e.Type == event.EventFrozen {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func TestDaemon_FreezeDefersAutomation(t *testing.T) {
+	d, _, clean, _, events, _ := mockDaemon(t)
+	defer clean()
+	d.Freezes = freeze.New()
+	addPolicies(t, d, policy.Set{policy.Automated: "true"})
+	logger := log.NewNopLogger()
+	ctx := context.Background()
+
+	err := d.SetFreeze(ctx, freeze.Freeze{Namespace: ns, Until: time.Now().Add(time.Hour), User: "someone", Reason: "holidays"})
+	assert.NoError(t, err)
+	freezes, err := d.ListFreezes(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, freezes, 1)
+
+	// The automated release is deferred, and that's recorded in an
+	// event
+	d.pollForNewImages(logger)
+	d.Jobs.Sync()
+	assert.Equal(t, 0, d.Jobs.Len())
+	frozen := frozenEvents(t, events)
+	if assert.Len(t, frozen, 1) {
+		metadata := frozen[0].Metadata.(*event.FrozenEventMetadata)
+		assert.Nil(t, metadata.Spec)
+		r := metadata.Result[flux.MustParseResourceID(svc)]
+		assert.Equal(t, update.ReleaseStatusSkipped, r.Status)
+		assert.Equal(t, update.Frozen, r.Error)
+		assert.Len(t, r.PerContainer, 1)
+	}
+
+	// Polling again doesn't record the same thing again
+	d.pollForNewImages(logger)
+	assert.Len(t, frozenEvents(t, events), 1)
+
+	// Once unfrozen, the release goes ahead
+	assert.NoError(t, d.SetFreeze(ctx, freeze.Freeze{Namespace: ns}))
+	d.pollForNewImages(logger)
+	d.Jobs.Sync()
+	assert.Equal(t, 1, d.Jobs.Len())
+}
+
+func TestDaemon_FreezeRejectsRelease(t *testing.T) {
+	d, _, clean, _, events, _ := mockDaemon(t)
+	defer clean()
+	window, err := freeze.ParseWindow("* * * * * for 1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Freezes = freeze.New(window)
+	logger := log.NewNopLogger()
+	ctx := context.Background()
+	if err := d.Repo.Ready(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	id := updateImage(ctx, d, t)
+	queued := <-d.Jobs.Ready()
+	assert.Equal(t, id, queued.ID)
+	assert.NoError(t, queued.Do(logger))
+
+	w := newWait(t)
+	status := w.ForJobSucceeded(d, id)
+	assert.Equal(t, "", status.Result.Revision)
+	r := status.Result.Result[flux.MustParseResourceID(svc)]
+	assert.Equal(t, update.ReleaseStatusSkipped, r.Status)
+	assert.Equal(t, update.Frozen, r.Error)
+
+	frozen := frozenEvents(t, events)
+	if assert.Len(t, frozen, 1) {
+		assert.NotNil(t, frozen[0].Metadata.(*event.FrozenEventMetadata).Spec)
+	}
+}
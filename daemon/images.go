@@ -3,6 +3,7 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
@@ -25,6 +26,11 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 	}
 	if len(candidateServices) == 0 {
 		logger.Log("msg", "no automated services")
+		d.updatePendingReleases(ctx, nil, nil, logger)
+		d.deferFrozen(nil, logger)
+		if d.Staged != nil {
+			d.releaseStaged(ctx, &update.Automated{}, nil, time.Now(), logger)
+		}
 		return
 	}
 	// Find images to check
@@ -41,11 +47,33 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 	}
 
 	changes := &update.Automated{}
+	// Workloads with an approval policy get their own release, which
+	// waits to be approved
+	gated := map[flux.ResourceID]*update.Automated{}
+	approval := map[flux.ResourceID]string{}
+	// Workloads in frozen namespaces are left until the freeze is over
+	frozen := map[flux.ResourceID]*update.Automated{}
+	// Workloads released to first, if releases are staged
+	canaries := flux.ResourceIDSet{}
 	for _, service := range services {
 		var p policy.Set
 		if resource, ok := candidateServices[service.ID]; ok {
 			p = resource.Policy()
 		}
+		if d.Staged != nil && d.Staged.IsCanary(service, p) {
+			canaries.Add([]flux.ResourceID{service.ID})
+		}
+		pinned := policy.PinsDigest(p)
+		serviceChanges := changes
+		if mode := policy.ApprovalMode(p); mode != "" {
+			serviceChanges = &update.Automated{}
+			approval[service.ID] = mode
+		}
+		ns, _, _ := service.ID.Components()
+		isFrozen := d.frozen(ns)
+		if isFrozen {
+			serviceChanges = &update.Automated{}
+		}
 	containers:
 		for _, container := range service.ContainersOrNil() {
 			currentImageID := container.Image
@@ -55,33 +83,64 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 
 			filteredImages := imageRepos.GetRepoImages(repo).FilterAndSort(pattern)
 
-			if latest, ok := filteredImages.Latest(); ok && latest.ID != currentImageID {
-				if latest.ID.Tag == "" {
-					logger.Log("warning", "untagged image in available images", "action", "skip container")
+			latest, ok := filteredImages.Latest()
+			if !ok {
+				continue
+			}
+			// When images are pinned to digests, the tag being moved
+			// to another image is a change too.
+			tagChanged := latest.ID.Tag != currentImageID.Tag
+			if !tagChanged && !(pinned && latest.Digest != currentImageID.Digest) {
+				continue
+			}
+			if latest.ID.Tag == "" {
+				logger.Log("warning", "untagged image in available images", "action", "skip container")
+				continue containers
+			}
+			if pinned && latest.Digest == "" {
+				logger.Log("warning", "no digest for latest image", "image", latest.ID, "action", "skip container")
+				continue containers
+			}
+			currentCreatedAt := ""
+			for _, info := range filteredImages {
+				if info.CreatedAt.IsZero() {
+					logger.Log("warning", "image with zero created timestamp", "image", info.ID, "action", "skip container")
 					continue containers
 				}
-				currentCreatedAt := ""
-				for _, info := range filteredImages {
-					if info.CreatedAt.IsZero() {
-						logger.Log("warning", "image with zero created timestamp", "image", info.ID, "action", "skip container")
-						continue containers
-					}
-					if info.ID == currentImageID {
-						currentCreatedAt = info.CreatedAt.String()
-					}
+				if info.ID.Tag == currentImageID.Tag {
+					currentCreatedAt = info.CreatedAt.String()
 				}
-				if currentCreatedAt == "" {
-					currentCreatedAt = "filtered out or missing"
-					logger.Log("warning", "current image not in filtered images", "action", "proceed anyway")
+			}
+			if currentCreatedAt == "" {
+				currentCreatedAt = "filtered out or missing"
+				logger.Log("warning", "current image not in filtered images", "action", "proceed anyway")
+			}
+			newImage := currentImageID.WithNewTag(latest.ID.Tag)
+			reason := fmt.Sprintf("latest %s (%s) > current %s (%s)", latest.ID.Tag, latest.CreatedAt, currentImageID.Tag, currentCreatedAt)
+			if pinned {
+				newImage = newImage.WithDigest(latest.Digest)
+				if !tagChanged {
+					reason = fmt.Sprintf("tag %s moved to %s", latest.ID.Tag, latest.Digest)
 				}
-				newImage := currentImageID.WithNewTag(latest.ID.Tag)
-				changes.Add(service.ID, container, newImage)
-				logger.Log("info", "added update to automation run", "new", newImage, "reason", fmt.Sprintf("latest %s (%s) > current %s (%s)", latest.ID.Tag, latest.CreatedAt, currentImageID.Tag, currentCreatedAt))
 			}
+			serviceChanges.Add(service.ID, container, newImage)
+			logger.Log("info", "added update to automation run", "new", newImage, "reason", reason)
+		}
+		switch {
+		case serviceChanges == changes || len(serviceChanges.Changes) == 0:
+		case isFrozen:
+			frozen[service.ID] = serviceChanges
+		default:
+			gated[service.ID] = serviceChanges
 		}
 	}
 
-	if len(changes.Changes) > 0 {
+	d.deferFrozen(frozen, logger)
+	d.updatePendingReleases(ctx, gated, approval, logger)
+	switch {
+	case d.Staged != nil:
+		d.releaseStaged(ctx, changes, canaries, time.Now(), logger)
+	case len(changes.Changes) > 0:
 		d.UpdateManifests(ctx, update.Spec{Type: update.Auto, Spec: changes})
 	}
 }
@@ -96,7 +155,7 @@ func (r resources) IDs() (ids []flux.ResourceID) {
 }
 
 // getUnlockedAutomatedServices returns all the resources that are
-// both automated, and not locked.
+// both automated, and not locked, and whose images can be changed.
 func (d *Daemon) getUnlockedAutomatedResources(ctx context.Context) (resources, error) {
 	resources, _, err := d.getResources(ctx)
 	if err != nil {
@@ -104,10 +163,10 @@ func (d *Daemon) getUnlockedAutomatedResources(ctx context.Context) (resources,
 	}
 
 	result := map[flux.ResourceID]resource.Resource{}
-	for _, resource := range resources {
-		policies := resource.Policy()
-		if policies.Has(policy.Automated) && !policies.Has(policy.Locked) {
-			result[resource.ResourceID()] = resource
+	for _, res := range resources {
+		policies := res.Policy()
+		if policies.Has(policy.Automated) && !policies.Has(policy.Locked) && !resource.IsImmutable(res) {
+			result[res.ResourceID()] = res
 		}
 	}
 	return result, nil
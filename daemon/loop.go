@@ -28,10 +28,48 @@ const (
 type LoopVars struct {
 	SyncInterval         time.Duration
 	RegistryPollInterval time.Duration
+	// Whether to delete resources previously synced from the repo,
+	// that have since been removed from it
+	SyncGC bool
+	// How long to wait for workloads changed by a sync to roll out,
+	// before considering the rollout to have failed; zero means don't
+	// wait
+	SyncRolloutTimeout time.Duration
+	// How automated releases that change more than one workload are
+	// made in stages; if nil, they are made all at once
+	Staged *StagedAutomation
 
 	initOnce       sync.Once
 	syncSoon       chan struct{}
 	pollImagesSoon chan struct{}
+
+	// Drifted resources per namespace, for each sync target
+	driftMu       sync.Mutex
+	driftCounts   map[string]map[string]int
+	driftReported map[string]bool
+
+	// Automated releases waiting for approval, per workload
+	pendingMu sync.Mutex
+	pending   map[flux.ResourceID]pendingRelease
+
+	// Automated releases deferred by freezes, as of the last image
+	// poll; only used from the loop
+	deferred update.Result
+
+	// The staged automated release in progress, and the changes
+	// left unreleased by staged releases that failed; only used from
+	// the loop
+	rollout *stagedRollout
+	halted  map[string]bool
+
+	// The revision at which each workload last rolled out
+	// successfully, for each sync target; only used from the loop
+	rolledOut map[string]map[flux.ResourceID]string
+
+	// How workloads use image tags, as of the last sync from each
+	// sync target
+	tagPatternsMu sync.Mutex
+	tagPatterns   map[string]tagUse
 }
 
 func (loop *LoopVars) ensureInit() {
@@ -56,6 +94,12 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 	// mirror notification as a change. Otherwise, we'll just sync
 	// every timer tick as well as every mirror refresh.
 	syncHead := ""
+	// .. and similarly for each of the sync sources.
+	sourceHeads := map[string]string{}
+	var sourceChanges <-chan map[string]struct{}
+	if d.SourceMirrors != nil {
+		sourceChanges = d.SourceMirrors.Changes()
+	}
 
 	// Ask for a sync, and to poll images, straight away
 	d.AskForSync()
@@ -102,6 +146,25 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 				syncHead = newSyncHead
 				d.AskForSync()
 			}
+		case changed := <-sourceChanges:
+			for name := range changed {
+				target, ok := d.sourceSyncTarget(name)
+				if !ok {
+					continue
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), gitOpTimeout)
+				newHead, err := target.repo.Revision(ctx, target.config.Branch)
+				cancel()
+				if err != nil {
+					logger.Log("source", name, "err", err)
+					continue
+				}
+				if newHead != sourceHeads[name] {
+					logger.Log("event", "refreshed", "source", name, "branch", target.config.Branch, "HEAD", newHead)
+					sourceHeads[name] = newHead
+					d.AskForSync()
+				}
+			}
 		case job := <-d.Jobs.Ready():
 			queueLength.Set(float64(d.Jobs.Len()))
 			jobLogger := log.With(logger, "jobID", job.ID)
@@ -149,7 +212,23 @@ func (d *LoopVars) AskForImagePoll() {
 
 // -- extra bits the loop needs
 
-func (d *Daemon) doSync(logger log.Logger) (retErr error) {
+// doSync syncs the main repo, then each of the sync sources, in
+// turn. Only a failure to sync the main repo is returned; failures
+// with the sync sources are logged.
+func (d *Daemon) doSync(logger log.Logger) error {
+	err := d.syncFrom(logger, d.mainSyncTarget())
+	for _, target := range d.sourceSyncTargets() {
+		sourceLogger := log.With(logger, "source", target.name)
+		if err := d.syncFrom(sourceLogger, target); err != nil {
+			sourceLogger.Log("err", err)
+		}
+	}
+	return err
+}
+
+// syncFrom applies the config in the target repo to the cluster,
+// reports what it did as events, and moves the target's sync tag.
+func (d *Daemon) syncFrom(logger log.Logger, target syncTarget) (retErr error) {
 	started := time.Now().UTC()
 	defer func() {
 		syncDuration.With(
@@ -167,7 +246,7 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 		var err error
 		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
 		defer cancel()
-		working, err = d.Repo.Clone(ctx, d.GitConfig)
+		working, err = target.repo.Clone(ctx, target.config)
 		if err != nil {
 			return err
 		}
@@ -191,9 +270,35 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 		return errors.Wrap(err, "loading resources from repo")
 	}
 
-	var resourceErrors []event.ResourceError
-	// TODO supply deletes argument from somewhere (command-line?)
-	if err := fluxsync.Sync(logger, d.Manifests, allResources, d.Cluster, false); err != nil {
+	// Leave out anything the target isn't allowed to sync
+	allResources, resourceErrors := target.restrict(allResources)
+	d.recordTagPatterns(target.name, allResources)
+
+	// Before applying anything, see whether the cluster has drifted
+	// from what was last synced. The resources exported from the
+	// cluster for this are used again for syncing; and if nothing
+	// has been committed since, so are the resources from the repo.
+	clus := &exportedCluster{Cluster: d.Cluster}
+	if oldTagRev != "" {
+		report, err := d.driftSinceSync(ctx, clus, target, oldTagRev, newTagRev, allResources)
+		if err != nil {
+			logger.Log("err", errors.Wrap(err, "detecting drift"))
+		} else {
+			d.recordDrift(target.name, report)
+		}
+	}
+
+	result, err := fluxsync.Sync(logger, d.Manifests, syncSource(target.repo.Origin(), target.config), allResources, clus, d.SyncGC)
+	deleted := result.Deleted()
+	for _, id := range deleted {
+		logger.Log("resource", id, "deleted", "not present in repo")
+	}
+	outcomes := map[flux.ResourceID]string{}
+	for id, outcome := range result {
+		outcomes[id] = string(outcome)
+		syncResources.With(fluxmetrics.LabelOutcome, string(outcome)).Add(1)
+	}
+	if err != nil {
 		logger.Log("err", err)
 		switch syncerr := err.(type) {
 		case cluster.SyncError:
@@ -217,10 +322,10 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 		var err error
 		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
 		if oldTagRev != "" {
-			commits, err = d.Repo.CommitsBetween(ctx, oldTagRev, newTagRev, d.GitConfig.Paths...)
+			commits, err = target.repo.CommitsBetween(ctx, oldTagRev, newTagRev, target.config.Paths...)
 		} else {
 			initialSync = true
-			commits, err = d.Repo.CommitsBefore(ctx, newTagRev, d.GitConfig.Paths...)
+			commits, err = target.repo.CommitsBefore(ctx, newTagRev, target.config.Paths...)
 		}
 		cancel()
 		if err != nil {
@@ -246,12 +351,19 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 		if err != nil {
 			return errors.Wrap(err, "loading resources from repo")
 		}
+		changedResources, _ = target.restrict(changedResources)
 	}
 
 	serviceIDs := flux.ResourceIDSet{}
 	for _, r := range changedResources {
 		serviceIDs.Add([]flux.ResourceID{r.ResourceID()})
 	}
+	serviceIDs.Add(deleted)
+
+	var rollouts []event.RolloutResult
+	if d.SyncRolloutTimeout > 0 && len(changedResources) > 0 {
+		rollouts = d.checkRollouts(ctx, logger, target, working, oldTagRev, newTagRev, commits, changedResources)
+	}
 
 	var notes map[string]struct{}
 	{
@@ -269,7 +381,7 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 	// autoreleases, that we're already posting as events, so upstream
 	// can skip the sync event if it wants to.
 	includes := make(map[string]bool)
-	if len(commits) > 0 {
+	if len(commits) > 0 || len(deleted) > 0 {
 		var noteEvents []event.Event
 
 		// Find notes in revisions.
@@ -390,10 +502,14 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 			EndedAt:    started,
 			LogLevel:   event.LogLevelInfo,
 			Metadata: &event.SyncEventMetadata{
+				Source:      target.name,
 				Commits:     cs,
 				InitialSync: initialSync,
 				Includes:    includes,
 				Errors:      resourceErrors,
+				Deleted:     deleted,
+				Outcomes:    outcomes,
+				Rollouts:    rollouts,
 			},
 		}); err != nil {
 			logger.Log("err", err)
@@ -421,9 +537,9 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 	}
 
 	if oldTagRev != newTagRev {
-		logger.Log("tag", d.GitConfig.SyncTag, "old", oldTagRev, "new", newTagRev)
+		logger.Log("tag", target.config.SyncTag, "old", oldTagRev, "new", newTagRev)
 		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
-		err := d.Repo.Refresh(ctx)
+		err := target.repo.Refresh(ctx)
 		cancel()
 		return err
 	}
@@ -431,6 +547,13 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 	return nil
 }
 
+// syncSource gives a string identifying the repo, branch and paths
+// being synced, so that resources synced from there can be recognised
+// later.
+func syncSource(remote git.Remote, conf git.Config) string {
+	return fmt.Sprintf("%s#%s:%s", remote.URL, conf.Branch, strings.Join(conf.Paths, ","))
+}
+
 func isUnknownRevision(err error) bool {
 	return err != nil &&
 		(strings.Contains(err.Error(), "unknown revision or path not in the working tree.") ||
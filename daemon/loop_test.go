@@ -47,6 +47,7 @@ func daemon(t *testing.T) (*Daemon, func()) {
 		return kresource.ParseMultidoc(allDefs, "exported")
 	}
 	k8s.ExportFunc = func() ([]byte, error) { return nil, nil }
+	k8s.ExportSyncedFunc = func(string) ([]byte, error) { return nil, nil }
 
 	events = &mockEventWriter{}
 
@@ -100,10 +101,14 @@ func TestPullAndSync_InitialSync(t *testing.T) {
 		expectedResourceIDs = append(expectedResourceIDs, id)
 	}
 	expectedResourceIDs.Sort()
-	k8s.SyncFunc = func(def cluster.SyncDef) error {
+	k8s.SyncFunc = func(def cluster.SyncDef) (cluster.SyncResult, error) {
 		syncCalled++
 		syncDef = &def
-		return nil
+		result := cluster.SyncResult{}
+		for _, action := range def.Actions {
+			result[action.Apply.ResourceID()] = cluster.SyncCreated
+		}
+		return result, nil
 	}
 
 	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
@@ -131,6 +136,16 @@ func TestPullAndSync_InitialSync(t *testing.T) {
 		if !reflect.DeepEqual(gotResourceIDs, []flux.ResourceID(expectedResourceIDs)) {
 			t.Errorf("Unexpected event service ids: %#v, expected: %#v", gotResourceIDs, expectedResourceIDs)
 		}
+		// ... and what was done to each
+		outcomes := es[0].Metadata.(*event.SyncEventMetadata).Outcomes
+		if len(outcomes) != len(expectedResourceIDs) {
+			t.Errorf("Expected an outcome for each resource, got %#v", outcomes)
+		}
+		for id, outcome := range outcomes {
+			if outcome != string(cluster.SyncCreated) {
+				t.Errorf("Expected %s to be created, got %q", id, outcome)
+			}
+		}
 	}
 	// It creates the tag at HEAD
 	if err := d.Repo.Refresh(context.Background()); err != nil {
@@ -169,10 +184,10 @@ func TestDoSync_NoNewCommits(t *testing.T) {
 		expectedResourceIDs = append(expectedResourceIDs, id)
 	}
 	expectedResourceIDs.Sort()
-	k8s.SyncFunc = func(def cluster.SyncDef) error {
+	k8s.SyncFunc = func(def cluster.SyncDef) (cluster.SyncResult, error) {
 		syncCalled++
 		syncDef = &def
-		return nil
+		return nil, nil
 	}
 
 	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err != nil {
@@ -263,10 +278,10 @@ func TestDoSync_WithNewCommit(t *testing.T) {
 		expectedResourceIDs = append(expectedResourceIDs, id)
 	}
 	expectedResourceIDs.Sort()
-	k8s.SyncFunc = func(def cluster.SyncDef) error {
+	k8s.SyncFunc = func(def cluster.SyncDef) (cluster.SyncResult, error) {
 		syncCalled++
 		syncDef = &def
-		return nil
+		return nil, nil
 	}
 
 	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
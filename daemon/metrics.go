@@ -18,6 +18,13 @@ var (
 		Buckets:   []float64{0.5, 5, 10, 20, 30, 40, 50, 60, 75, 90, 120, 240},
 	}, []string{fluxmetrics.LabelSuccess})
 
+	syncResources = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "sync_resources_total",
+		Help:      "Count of resources synced, by what syncing did to them.",
+	}, []string{fluxmetrics.LabelOutcome})
+
 	// For most jobs, the majority of the time will be spent pushing
 	// changes (git objects and refs) upstream.
 	jobDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
@@ -44,4 +51,11 @@ var (
 		Name:      "queue_length_count",
 		Help:      "Count of jobs waiting in the queue to be run.",
 	}, []string{})
+
+	driftedResources = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "drifted_resources_count",
+		Help:      "Count of resources in the cluster that differ from their definitions in git, as of the start of the last sync.",
+	}, []string{fluxmetrics.LabelNamespace})
 )
@@ -9,4 +9,6 @@ type note struct {
 	JobID  job.ID        `json:"jobID"`
 	Spec   update.Spec   `json:"spec"`
 	Result update.Result `json:"result"`
+	// The stage of a staged automated release this was, if it was one
+	Stage *stage `json:"stage,omitempty"`
 }
@@ -0,0 +1,286 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// How often to look at workloads while waiting for them to roll out
+var rolloutPollInterval = 5 * time.Second
+
+// checkRollouts waits for the workloads among the changed resources
+// to roll out, for up to `SyncRolloutTimeout`. Those that fail to
+// roll out, and are marked for it, are rolled back by reverting their
+// manifests to how they were at the revision they last rolled out
+// successfully, or failing that, the previously synced revision (if
+// there was one). Changes that are themselves rollbacks aren't rolled
+// back, so that a rollback that also fails doesn't flip-flop.
+//
+// Rollbacks are commits, so only workloads synced from the main repo
+// are rolled back; fluxd doesn't write to sync sources. The revisions
+// at which workloads last rolled out are kept only in memory, so
+// after fluxd restarts, workloads are rolled back to the previously
+// synced revision until they've rolled out again.
+func (d *Daemon) checkRollouts(ctx context.Context, logger log.Logger, target syncTarget, working *git.Checkout, prevRev, newRev string, commits []git.Commit, changed map[string]resource.Resource) []event.RolloutResult {
+	workloads := map[flux.ResourceID]resource.Resource{}
+	var ids []flux.ResourceID
+	for _, res := range changed {
+		if _, ok := res.(resource.Workload); ok {
+			workloads[res.ResourceID()] = res
+			ids = append(ids, res.ResourceID())
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+
+	results := d.waitForRollouts(logger, ids, d.SyncRolloutTimeout)
+
+	if d.rolledOut == nil {
+		d.rolledOut = map[string]map[flux.ResourceID]string{}
+	}
+	rolledOut := d.rolledOut[target.name]
+	if rolledOut == nil {
+		rolledOut = map[flux.ResourceID]string{}
+		d.rolledOut[target.name] = rolledOut
+	}
+	for _, r := range results {
+		if r.Outcome == event.RolloutReady {
+			rolledOut[r.ID] = newRev
+		}
+	}
+
+	if onlyRollbacks(commits) {
+		return results
+	}
+
+	revs := map[flux.ResourceID]string{}
+	var rollBack []resource.Resource
+	for _, r := range results {
+		if r.Outcome == event.RolloutReady || !workloads[r.ID].Policy().Has(policy.RollbackOnFailure) {
+			continue
+		}
+		rev, ok := rolledOut[r.ID]
+		if !ok {
+			rev = prevRev
+		}
+		if rev == "" {
+			continue
+		}
+		revs[r.ID] = rev
+		rollBack = append(rollBack, workloads[r.ID])
+	}
+	if len(rollBack) == 0 {
+		return results
+	}
+	if target.name != "" {
+		logger.Log("rollback", "skipped", "reason", "workloads from a sync source are not rolled back")
+		return results
+	}
+
+	rolledBack := d.rollBack(ctx, logger, target.repo, working, revs, rollBack)
+	for i := range results {
+		if rolledBack.Contains(results[i].ID) {
+			results[i].RolledBack = true
+		}
+	}
+	if len(rolledBack) > 0 {
+		// Apply the rollback as soon as we're done here
+		d.AskForSync()
+	}
+	return results
+}
+
+// waitForRollouts polls the workloads given until each has either
+// finished rolling out or failed, or the timeout is reached. Workloads
+// whose status can't be interpreted as the progress of a rollout
+// (e.g., Helm releases) are left out of the results.
+func (d *Daemon) waitForRollouts(logger log.Logger, ids []flux.ResourceID, timeout time.Duration) []event.RolloutResult {
+	results := make([]event.RolloutResult, len(ids))
+	pending := map[int]bool{}
+	untracked := map[int]bool{}
+	for i, id := range ids {
+		results[i] = event.RolloutResult{ID: id, Outcome: event.RolloutTimeout}
+		pending[i] = true
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		for i := range results {
+			if !pending[i] {
+				continue
+			}
+			controllers, err := d.Cluster.SomeControllers([]flux.ResourceID{results[i].ID})
+			if err != nil {
+				logger.Log("resource", results[i].ID, "err", err)
+				continue
+			}
+			if len(controllers) == 0 {
+				delete(pending, i)
+				untracked[i] = true
+				continue
+			}
+			c := controllers[0]
+			results[i].Messages = c.Rollout.Messages
+			outcome, tracked := rolloutOutcome(c)
+			switch {
+			case !tracked:
+				delete(pending, i)
+				untracked[i] = true
+			case outcome != event.RolloutTimeout:
+				results[i].Outcome = outcome
+				delete(pending, i)
+			}
+		}
+
+		remaining := time.Until(deadline)
+		if len(pending) == 0 || remaining <= 0 {
+			break
+		}
+		if remaining > rolloutPollInterval {
+			remaining = rolloutPollInterval
+		}
+		time.Sleep(remaining)
+	}
+
+	var tracked []event.RolloutResult
+	for i, r := range results {
+		if untracked[i] {
+			continue
+		}
+		logger.Log("resource", r.ID, "rollout", r.Outcome)
+		tracked = append(tracked, r)
+	}
+	return tracked
+}
+
+// rolloutOutcome interprets the status of a workload as the outcome
+// of rolling it out so far: ready, failed, or (while it's still
+// going) timeout. It returns false if the status can't be interpreted
+// that way.
+func rolloutOutcome(c cluster.Controller) (string, bool) {
+	switch c.Status {
+	case cluster.StatusReady:
+		return event.RolloutReady, true
+	case cluster.StatusError:
+		return event.RolloutFailed, true
+	case cluster.StatusUpdating, cluster.StatusStarted, cluster.StatusUnknown:
+		return event.RolloutTimeout, true
+	}
+	return "", false
+}
+
+// The commit message used for rollbacks; the workloads are filled in
+const rollbackMessage = "Roll back %s after failed rollout"
+
+// onlyRollbacks says whether the commits given are all rollbacks
+// committed by checkRollouts.
+func onlyRollbacks(commits []git.Commit) bool {
+	prefix := rollbackMessage[:strings.Index(rollbackMessage, "%s")]
+	suffix := rollbackMessage[strings.Index(rollbackMessage, "%s")+2:]
+	for _, c := range commits {
+		if !strings.HasPrefix(c.Message, prefix) || !strings.HasSuffix(c.Message, suffix) {
+			return false
+		}
+	}
+	return len(commits) > 0
+}
+
+// rollBack reverts the manifests of the workloads given to how they
+// were at the revision given for each, and commits and pushes the
+// result. Only the document defining each workload is reverted;
+// anything else in the same file is left as it is. It returns the IDs
+// of the workloads that were rolled back.
+func (d *Daemon) rollBack(ctx context.Context, logger log.Logger, repo *git.Repo, working *git.Checkout, revs map[flux.ResourceID]string, workloads []resource.Resource) flux.ResourceIDSet {
+	exports := map[string]*git.Export{}
+	defer func() {
+		for _, export := range exports {
+			export.Clean()
+		}
+	}()
+
+	rolledBack := flux.ResourceIDSet{}
+	for _, res := range workloads {
+		id, rev := res.ResourceID(), revs[res.ResourceID()]
+		export, ok := exports[rev]
+		if !ok {
+			var err error
+			ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
+			export, err = repo.Export(ctx, rev)
+			cancel()
+			if err != nil {
+				logger.Log("resource", id, "rollback", "failed", "err", errors.Wrapf(err, "exporting revision %s", rev))
+				continue
+			}
+			exports[rev] = export
+		}
+		if err := d.revertManifest(working, export, res); err != nil {
+			// e.g., the workload wasn't defined in the same file at
+			// the revision
+			logger.Log("resource", id, "rollback", "failed", "err", err)
+			continue
+		}
+		rolledBack.Add([]flux.ResourceID{id})
+	}
+	if len(rolledBack) == 0 {
+		return rolledBack
+	}
+
+	var ids []string
+	for _, id := range rolledBack.ToSlice() {
+		ids = append(ids, id.String())
+	}
+	sort.Strings(ids)
+	commitAction := git.CommitAction{Message: fmt.Sprintf(rollbackMessage, strings.Join(ids, ", "))}
+	ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
+	err := working.CommitAndPush(ctx, commitAction, nil)
+	cancel()
+	if err != nil {
+		// ErrNoChanges means the manifests were the same at the
+		// revisions, so the failure is down to something else.
+		logger.Log("rollback", "failed", "err", err)
+		return flux.ResourceIDSet{}
+	}
+	logger.Log("rollback", strings.Join(ids, ", "))
+	return rolledBack
+}
+
+// revertManifest replaces the document defining the resource given,
+// in the working checkout, with the document defining it in the
+// export given.
+func (d *Daemon) revertManifest(working *git.Checkout, export *git.Export, res resource.Resource) error {
+	id := res.ResourceID()
+	previous, err := d.Manifests.LoadManifests(export.Dir(), []string{filepath.Join(export.Dir(), res.Source())})
+	if err != nil {
+		return err
+	}
+	prev, ok := previous[id.String()]
+	if !ok {
+		return cluster.ErrResourceNotFound(id.String())
+	}
+	path := filepath.Join(working.Dir(), res.Source())
+	return cluster.UpdateManifest(d.Manifests, working.Dir(), []string{path}, id, func(def []byte) ([]byte, error) {
+		if len(res.Bytes()) == 0 || !bytes.Contains(def, res.Bytes()) {
+			return nil, fmt.Errorf("definition of %s not found in %s", id, res.Source())
+		}
+		return bytes.Replace(def, res.Bytes(), prev.Bytes(), 1), nil
+	})
+}
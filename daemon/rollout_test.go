@@ -0,0 +1,335 @@
+package daemon
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/git"
+)
+
+func TestWaitForRollouts(t *testing.T) {
+	defer func(interval time.Duration) { rolloutPollInterval = interval }(rolloutPollInterval)
+	rolloutPollInterval = 10 * time.Millisecond
+
+	statuses := map[string]cluster.Controller{
+		"default:deployment/ready":    {Status: cluster.StatusReady},
+		"default:deployment/failed":   {Status: cluster.StatusError, Rollout: cluster.RolloutStatus{Messages: []string{"oops"}}},
+		"default:deployment/updating": {Status: cluster.StatusUpdating},
+		"default:helmrelease/release": {Status: "DEPLOYED"},
+	}
+	d := &Daemon{
+		Cluster: &cluster.Mock{
+			SomeServicesFunc: func(ids []flux.ResourceID) ([]cluster.Controller, error) {
+				var controllers []cluster.Controller
+				for _, id := range ids {
+					c := statuses[id.String()]
+					c.ID = id
+					controllers = append(controllers, c)
+				}
+				return controllers, nil
+			},
+		},
+	}
+
+	var ids []flux.ResourceID
+	for _, id := range []string{"default:deployment/failed", "default:deployment/ready", "default:deployment/updating", "default:helmrelease/release"} {
+		ids = append(ids, flux.MustParseResourceID(id))
+	}
+	results := d.waitForRollouts(log.NewNopLogger(), ids, 50*time.Millisecond)
+	expected := []event.RolloutResult{
+		{ID: ids[0], Outcome: event.RolloutFailed, Messages: []string{"oops"}},
+		{ID: ids[1], Outcome: event.RolloutReady},
+		{ID: ids[2], Outcome: event.RolloutTimeout},
+	}
+	if !reflect.DeepEqual(expected, results) {
+		t.Errorf("expected %#v, got %#v", expected, results)
+	}
+}
+
+func TestDoSync_RollbackOnFailure(t *testing.T) {
+	defer func(interval time.Duration) { rolloutPollInterval = interval }(rolloutPollInterval)
+	rolloutPollInterval = 10 * time.Millisecond
+
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.SyncRolloutTimeout = 50 * time.Millisecond
+
+	helloworld := flux.MustParseResourceID("default:deployment/helloworld")
+	ctx := context.Background()
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		if err := checkout.MoveSyncTagAndPush(ctx, "HEAD", "Sync pointer"); err != nil {
+			return err
+		}
+		err := cluster.UpdateManifest(k8s, checkout.Dir(), checkout.ManifestDirs(), helloworld, func(def []byte) ([]byte, error) {
+			def = []byte(strings.Replace(string(def), "replicas: 5", "replicas: 4", -1))
+			return []byte(strings.Replace(string(def), "  name: helloworld\nspec:", "  name: helloworld\n  annotations:\n    flux.weave.works/rollback-on-failure: \"true\"\nspec:", -1)), nil
+		})
+		if err != nil {
+			return err
+		}
+		return checkout.CommitAndPush(ctx, git.CommitAction{Message: "test commit"}, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	k8s.SyncFunc = func(def cluster.SyncDef) (cluster.SyncResult, error) { return nil, nil }
+	k8s.SomeServicesFunc = func(ids []flux.ResourceID) ([]cluster.Controller, error) {
+		return []cluster.Controller{{ID: ids[0], Status: cluster.StatusError}}, nil
+	}
+
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 1 {
+		t.Fatalf("expected one event, got %#v", es)
+	}
+	expected := []event.RolloutResult{{ID: helloworld, Outcome: event.RolloutFailed, RolledBack: true}}
+	if rollouts := es[0].Metadata.(*event.SyncEventMetadata).Rollouts; !reflect.DeepEqual(expected, rollouts) {
+		t.Errorf("expected rollouts %#v, got %#v", expected, rollouts)
+	}
+
+	// The rollback is committed to the repo
+	if err = d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	err = d.WithClone(ctx, func(checkout *git.Checkout) error {
+		def, err := ioutil.ReadFile(filepath.Join(checkout.Dir(), "helloworld-deploy.yaml"))
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(string(def), "replicas: 5") || strings.Contains(string(def), "rollback-on-failure") {
+			t.Errorf("expected helloworld to be rolled back, got:\n%s", string(def))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commitManifestChange edits the manifest of the workload given, and
+// commits and pushes the change.
+func commitManifestChange(t *testing.T, d *Daemon, id flux.ResourceID, f func(def string) string) {
+	ctx := context.Background()
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err := cluster.UpdateManifest(k8s, checkout.Dir(), checkout.ManifestDirs(), id, func(def []byte) ([]byte, error) {
+			return []byte(f(string(def))), nil
+		})
+		if err != nil {
+			return err
+		}
+		return checkout.CommitAndPush(ctx, git.CommitAction{Message: "change " + id.String()}, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readRepoFile(t *testing.T, d *Daemon, path string) string {
+	ctx := context.Background()
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var content []byte
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		var err error
+		content, err = ioutil.ReadFile(filepath.Join(checkout.Dir(), path))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func setRolloutStatus(status *string) {
+	k8s.SyncFunc = func(def cluster.SyncDef) (cluster.SyncResult, error) { return nil, nil }
+	k8s.SomeServicesFunc = func(ids []flux.ResourceID) ([]cluster.Controller, error) {
+		var controllers []cluster.Controller
+		for _, id := range ids {
+			controllers = append(controllers, cluster.Controller{ID: id, Status: *status})
+		}
+		return controllers, nil
+	}
+}
+
+func markForRollback(def string) string {
+	return strings.Replace(def, "\nspec:", "\n  annotations:\n    flux.weave.works/rollback-on-failure: \"true\"\nspec:", 1)
+}
+
+func TestDoSync_RollbackNotRolledBack(t *testing.T) {
+	defer func(interval time.Duration) { rolloutPollInterval = interval }(rolloutPollInterval)
+	rolloutPollInterval = 10 * time.Millisecond
+
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.SyncRolloutTimeout = 50 * time.Millisecond
+	logger := log.NewLogfmtLogger(ioutil.Discard)
+	ctx := context.Background()
+
+	status := cluster.StatusReady
+	setRolloutStatus(&status)
+	d.doSync(logger)
+
+	helloworld := flux.MustParseResourceID("default:deployment/helloworld")
+	commitManifestChange(t, d, helloworld, func(def string) string {
+		return markForRollback(strings.Replace(def, "replicas: 5", "replicas: 4", 1))
+	})
+	status = cluster.StatusError
+	d.doSync(logger)
+	if def := readRepoFile(t, d, "helloworld-deploy.yaml"); !strings.Contains(def, "replicas: 5") {
+		t.Fatalf("expected helloworld to be rolled back, got:\n%s", def)
+	}
+
+	// The rollback fails too; it's not rolled back in turn
+	head, err := d.Repo.Revision(ctx, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.doSync(logger)
+	if err = d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	newHead, err := d.Repo.Revision(ctx, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newHead != head {
+		t.Errorf("expected no commits after the rollback was synced, got %s", newHead)
+	}
+}
+
+func TestDoSync_RollbackToLastRolledOut(t *testing.T) {
+	defer func(interval time.Duration) { rolloutPollInterval = interval }(rolloutPollInterval)
+	rolloutPollInterval = 10 * time.Millisecond
+
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.SyncRolloutTimeout = 50 * time.Millisecond
+	logger := log.NewLogfmtLogger(ioutil.Discard)
+
+	status := cluster.StatusReady
+	setRolloutStatus(&status)
+	d.doSync(logger)
+
+	helloworld := flux.MustParseResourceID("default:deployment/helloworld")
+	commitManifestChange(t, d, helloworld, func(def string) string {
+		return markForRollback(strings.Replace(def, "replicas: 5", "replicas: 4", 1))
+	})
+	d.doSync(logger)
+
+	// This fails, but isn't marked to be rolled back
+	commitManifestChange(t, d, helloworld, func(def string) string {
+		def = strings.Replace(def, "    flux.weave.works/rollback-on-failure: \"true\"\n", "", 1)
+		return strings.Replace(def, "replicas: 4", "replicas: 3", 1)
+	})
+	status = cluster.StatusError
+	d.doSync(logger)
+
+	// This is rolled back to the revision that last rolled out,
+	// rather than the previous revision
+	commitManifestChange(t, d, helloworld, func(def string) string {
+		return markForRollback(strings.Replace(def, "replicas: 3", "replicas: 2", 1))
+	})
+	d.doSync(logger)
+	if def := readRepoFile(t, d, "helloworld-deploy.yaml"); !strings.Contains(def, "replicas: 4") {
+		t.Errorf("expected helloworld to be rolled back to 4 replicas, got:\n%s", def)
+	}
+}
+
+func TestDoSync_RollbackOnlyFailedDocument(t *testing.T) {
+	defer func(interval time.Duration) { rolloutPollInterval = interval }(rolloutPollInterval)
+	rolloutPollInterval = 10 * time.Millisecond
+
+	d, cleanup := daemon(t)
+	defer cleanup()
+	d.SyncRolloutTimeout = 50 * time.Millisecond
+	logger := log.NewLogfmtLogger(ioutil.Discard)
+
+	status := cluster.StatusReady
+	setRolloutStatus(&status)
+	d.doSync(logger)
+
+	// Both the deployment and the service in the file are changed;
+	// only the deployment fails to roll out
+	commitManifestChange(t, d, flux.MustParseResourceID("default:service/multi-service"), func(def string) string {
+		def = strings.Replace(def, "  - port: 80", "  - port: 81", 1)
+		def = strings.Replace(def, "replicas: 1", "replicas: 2", 1)
+		return strings.Replace(def, "automated: \"true\"", "automated: \"true\"\n    flux.weave.works/rollback-on-failure: \"true\"", 1)
+	})
+	status = cluster.StatusError
+	d.doSync(logger)
+
+	def := readRepoFile(t, d, "multi.yaml")
+	if !strings.Contains(def, "replicas: 1") || strings.Contains(def, "rollback-on-failure") {
+		t.Errorf("expected multi-deploy to be rolled back, got:\n%s", def)
+	}
+	if !strings.Contains(def, "port: 81") {
+		t.Errorf("expected multi-service to be left as it was, got:\n%s", def)
+	}
+}
+
+func TestCheckRollouts_SyncSource(t *testing.T) {
+	defer func(interval time.Duration) { rolloutPollInterval = interval }(rolloutPollInterval)
+	rolloutPollInterval = 10 * time.Millisecond
+
+	changed, err := kresource.ParseMultidoc([]byte(markForRollback(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: apps
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: quay.io/example/app:1
+`)), "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Daemon{
+		Cluster: &cluster.Mock{
+			SomeServicesFunc: func(ids []flux.ResourceID) ([]cluster.Controller, error) {
+				return []cluster.Controller{{ID: ids[0], Status: cluster.StatusError}}, nil
+			},
+		},
+		LoopVars: &LoopVars{SyncRolloutTimeout: 50 * time.Millisecond},
+	}
+
+	// There's no repo to commit a rollback to; the failure is
+	// reported, but not rolled back
+	target := syncTarget{name: "apps"}
+	results := d.checkRollouts(context.Background(), log.NewNopLogger(), target, nil, "prev", "new", nil, changed)
+	expected := []event.RolloutResult{{ID: flux.MustParseResourceID("apps:deployment/app"), Outcome: event.RolloutFailed}}
+	if !reflect.DeepEqual(expected, results) {
+		t.Errorf("expected %#v, got %#v", expected, results)
+	}
+}
@@ -0,0 +1,192 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/resource"
+)
+
+// SyncSource is a git repo, other than the main one, from which
+// config is synced to the cluster. fluxd only reads from a sync
+// source (apart from moving its sync tag); releases, automation and
+// policy changes are all committed to the main repo.
+type SyncSource struct {
+	Name   string
+	Remote git.Remote
+	Config git.Config
+	// If not empty, resources synced from this source must be in one
+	// of these namespaces
+	Namespaces []string
+}
+
+var sourceNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// ParseSyncSource parses a sync source as given to `--git-source`:
+//
+//	<name>=<url>[?<param>=<value>&...]
+//
+// The parameters are `branch`, `path` and `namespace` (the last two
+// can be repeated), and `sync-tag` and `notes-ref`. The sync tag and
+// notes ref default to those in the base config with the name of the
+// source appended, so that sources don't trample on each other; the
+// committer details are taken from the base config.
+func ParseSyncSource(s string, base git.Config) (SyncSource, error) {
+	eq := strings.Index(s, "=")
+	if eq < 0 {
+		return SyncSource{}, fmt.Errorf("expected <name>=<url> in git source %q", s)
+	}
+	name, rest := s[:eq], s[eq+1:]
+	if !sourceNameRegexp.MatchString(name) {
+		return SyncSource{}, fmt.Errorf("git source name %q must be lowercase letters, digits and dashes", name)
+	}
+
+	repoURL, rawParams := rest, ""
+	if q := strings.LastIndex(rest, "?"); q >= 0 {
+		repoURL, rawParams = rest[:q], rest[q+1:]
+	}
+	if repoURL == "" {
+		return SyncSource{}, fmt.Errorf("no URL given for git source %q", name)
+	}
+	params, err := url.ParseQuery(rawParams)
+	if err != nil {
+		return SyncSource{}, errors.Wrapf(err, "parsing parameters of git source %q", name)
+	}
+
+	source := SyncSource{
+		Name:   name,
+		Remote: git.Remote{URL: repoURL},
+		Config: git.Config{
+			Branch:      "master",
+			SyncTag:     base.SyncTag + "-" + name,
+			NotesRef:    base.NotesRef + "-" + name,
+			UserName:    base.UserName,
+			UserEmail:   base.UserEmail,
+			SetAuthor:   base.SetAuthor,
+			SkipMessage: base.SkipMessage,
+		},
+	}
+	for param, values := range params {
+		last := values[len(values)-1]
+		switch param {
+		case "branch":
+			source.Config.Branch = last
+		case "path":
+			source.Config.Paths = values
+		case "sync-tag":
+			source.Config.SyncTag = last
+		case "notes-ref":
+			source.Config.NotesRef = last
+		case "namespace":
+			source.Namespaces = values
+		default:
+			return SyncSource{}, fmt.Errorf("unknown parameter %q for git source %q", param, name)
+		}
+	}
+	return source, nil
+}
+
+// syncTarget is everything needed to sync from a particular repo;
+// either the main repo, or one of the sync sources.
+type syncTarget struct {
+	name       string // empty for the main repo
+	repo       *git.Repo
+	config     git.Config
+	namespaces []string
+}
+
+func (d *Daemon) mainSyncTarget() syncTarget {
+	return syncTarget{repo: d.Repo, config: d.GitConfig}
+}
+
+// sourceSyncTargets gives a target for each of the sync sources being
+// mirrored.
+func (d *Daemon) sourceSyncTargets() []syncTarget {
+	if d.SourceMirrors == nil {
+		return nil
+	}
+	var targets []syncTarget
+	for _, source := range d.SyncSources {
+		repo, ok := d.SourceMirrors.Get(source.Name)
+		if !ok {
+			continue
+		}
+		targets = append(targets, syncTarget{
+			name:       source.Name,
+			repo:       repo,
+			config:     source.Config,
+			namespaces: source.Namespaces,
+		})
+	}
+	return targets
+}
+
+func (d *Daemon) sourceSyncTarget(name string) (syncTarget, bool) {
+	for _, target := range d.sourceSyncTargets() {
+		if target.name == name {
+			return target, true
+		}
+	}
+	return syncTarget{}, false
+}
+
+// restrict removes any resources that are outside the namespaces the
+// target is allowed to sync to, returning an error for each.
+func (t syncTarget) restrict(resources map[string]resource.Resource) (map[string]resource.Resource, []event.ResourceError) {
+	if len(t.namespaces) == 0 {
+		return resources, nil
+	}
+	allowed := map[string]bool{}
+	for _, ns := range t.namespaces {
+		allowed[ns] = true
+	}
+	restricted := map[string]resource.Resource{}
+	var errs []event.ResourceError
+	for key, res := range resources {
+		ns, _, _ := res.ResourceID().Components()
+		if !allowed[ns] {
+			errs = append(errs, event.ResourceError{
+				ID:    res.ResourceID(),
+				Path:  res.Source(),
+				Error: fmt.Sprintf("namespace %q is not one of those allowed for git source %q", ns, t.name),
+			})
+			continue
+		}
+		restricted[key] = res
+	}
+	return restricted, errs
+}
+
+// sourcesConfig reports the configuration and status of each of the
+// sync sources.
+func (d *Daemon) sourcesConfig(ctx context.Context, logger log.Logger) []v6.GitSourceConfig {
+	var sources []v6.GitSourceConfig
+	for _, target := range d.sourceSyncTargets() {
+		status, _ := target.repo.Status()
+		syncRev, err := target.repo.Revision(ctx, target.config.SyncTag)
+		if err != nil && !isUnknownRevision(err) {
+			logger.Log("source", target.name, "err", err)
+		}
+		sources = append(sources, v6.GitSourceConfig{
+			Name: target.name,
+			Remote: v6.GitRemoteConfig{
+				URL:    target.repo.Origin().URL,
+				Branch: target.config.Branch,
+				Path:   strings.Join(target.config.Paths, ","),
+			},
+			Namespaces:   target.namespaces,
+			Status:       status,
+			SyncRevision: syncRev,
+		})
+	}
+	return sources
+}
@@ -0,0 +1,167 @@
+package daemon
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/git/gittest"
+)
+
+func TestParseSyncSource(t *testing.T) {
+	base := git.Config{SyncTag: "flux-sync", NotesRef: "flux", UserName: "Weave Flux"}
+
+	source, err := ParseSyncSource("platform=git@github.com:example/platform?branch=prod&path=base&path=prod&namespace=kube-system", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := SyncSource{
+		Name:   "platform",
+		Remote: git.Remote{URL: "git@github.com:example/platform"},
+		Config: git.Config{
+			Branch:   "prod",
+			Paths:    []string{"base", "prod"},
+			SyncTag:  "flux-sync-platform",
+			NotesRef: "flux-platform",
+			UserName: "Weave Flux",
+		},
+		Namespaces: []string{"kube-system"},
+	}
+	if !reflect.DeepEqual(expected, source) {
+		t.Errorf("expected %#v, got %#v", expected, source)
+	}
+
+	source, err = ParseSyncSource("apps=https://example.com/apps.git?sync-tag=apps-sync", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.Remote.URL != "https://example.com/apps.git" || source.Config.Branch != "master" || source.Config.SyncTag != "apps-sync" {
+		t.Errorf("unexpected source %#v", source)
+	}
+
+	for _, bad := range []string{
+		"git@github.com:example/platform",
+		"=git@github.com:example/platform",
+		"Platform=git@github.com:example/platform",
+		"platform=",
+		"platform=git@github.com:example/platform?colour=blue",
+	} {
+		if _, err := ParseSyncSource(bad, base); err == nil {
+			t.Errorf("expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestSyncTargetRestrict(t *testing.T) {
+	resources, err := kresource.ParseMultidoc([]byte(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: allowed
+  namespace: team-a
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: disallowed
+  namespace: team-b
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: team-b
+`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := syncTarget{name: "team-a", namespaces: []string{"team-a"}}
+	restricted, errs := target.restrict(resources)
+	if len(restricted) != 1 {
+		t.Errorf("expected one resource to be allowed, got %#v", restricted)
+	}
+	for _, res := range restricted {
+		if res.ResourceID().String() != "team-a:configmap/allowed" {
+			t.Errorf("unexpected resource allowed: %s", res.ResourceID())
+		}
+	}
+	if len(errs) != 2 {
+		t.Errorf("expected two errors, got %#v", errs)
+	}
+
+	unrestricted, errs := syncTarget{}.restrict(resources)
+	if len(unrestricted) != len(resources) || len(errs) != 0 {
+		t.Errorf("expected all resources to be allowed without namespaces, got %#v, %#v", unrestricted, errs)
+	}
+}
+
+func TestDoSync_Sources(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	// Another repo, with the same files in it
+	sourceRepo, sourceCleanup := gittest.Repo(t)
+	defer sourceCleanup()
+
+	d.SourceMirrors = git.NewMirrors()
+	defer d.SourceMirrors.StopAllAndWait()
+	source, err := ParseSyncSource("extra="+sourceRepo.Origin().URL, d.GitConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SourceMirrors.Mirror(source.Name, source.Remote)
+	d.SyncSources = []SyncSource{source}
+
+	// The mirror signals a change once it's ready
+	select {
+	case <-d.SourceMirrors.Changes():
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for source mirror to be ready")
+	}
+	mirror, _ := d.SourceMirrors.Get(source.Name)
+	if _, err := mirror.Status(); err != nil {
+		t.Fatal(err)
+	}
+
+	var syncSources []string
+	k8s.SyncFunc = func(def cluster.SyncDef) (cluster.SyncResult, error) {
+		syncSources = append(syncSources, def.Source)
+		return nil, nil
+	}
+
+	d.doSync(log.NewLogfmtLogger(ioutil.Discard))
+
+	if len(syncSources) != 2 {
+		t.Fatalf("expected a sync for each of the main repo and the source, got %#v", syncSources)
+	}
+	if syncSources[0] == syncSources[1] {
+		t.Errorf("expected the main repo and source to be synced as different sources, got %#v", syncSources)
+	}
+
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var eventSources []string
+	for _, e := range es {
+		if e.Type == event.EventSync {
+			eventSources = append(eventSources, e.Metadata.(*event.SyncEventMetadata).Source)
+		}
+	}
+	if len(eventSources) != 2 || eventSources[0] != "" || eventSources[1] != "extra" {
+		t.Errorf("expected a sync event for each of the main repo and the source, got %#v", eventSources)
+	}
+
+	// The source has its own sync tag
+	if _, err := mirror.Revision(context.Background(), "flux-sync-extra"); err != nil {
+		t.Errorf("expected sync tag for the source to have been created: %s", err)
+	}
+}
@@ -0,0 +1,383 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
+)
+
+// Automated releases that change many workloads (e.g., because they
+// all use the same image) can be made in stages, rather than all at
+// once: first to the canaries, then to the rest of the workloads in
+// batches. Each stage is a release job, and so a commit, of its own.
+// Each stage releases the latest automated changes to its workloads
+// as of when the stage starts, rather than those there were when the
+// staged release started. Once a stage has been pushed, its workloads
+// are given the soak period to roll out; if any of them fails along the way, or they are
+// not all running the new images and ready at the end of it, the
+// staged release is halted. The changes left unreleased by a halted
+// release are not attempted again by automation, though a newer image
+// will start a new staged release.
+
+// StagedAutomation says how automated releases are made in stages.
+type StagedAutomation struct {
+	// Workloads with all these labels are canaries, as well as those
+	// with the canary policy
+	CanaryLabels map[string]string
+	// The most workloads released to in each stage after the
+	// canaries; zero means all of them, in one stage
+	BatchSize int
+	// How long the workloads released to in a stage have to roll out
+	Soak time.Duration
+}
+
+// IsCanary says whether the workload given, with the policies given,
+// is a canary.
+func (s *StagedAutomation) IsCanary(c cluster.Controller, policies policy.Set) bool {
+	if policies.Has(policy.Canary) {
+		return true
+	}
+	if len(s.CanaryLabels) == 0 {
+		return false
+	}
+	for k, v := range s.CanaryLabels {
+		if c.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Stages splits automated changes into stages: the changes to the
+// canaries, if there are any, then the rest in batches.
+func (s *StagedAutomation) Stages(changes *update.Automated, canaries flux.ResourceIDSet) []*update.Automated {
+	byWorkload := map[flux.ResourceID][]update.Change{}
+	var canaryIDs, otherIDs []flux.ResourceID
+	for _, c := range changes.Changes {
+		if _, ok := byWorkload[c.ServiceID]; !ok {
+			if canaries.Contains(c.ServiceID) {
+				canaryIDs = append(canaryIDs, c.ServiceID)
+			} else {
+				otherIDs = append(otherIDs, c.ServiceID)
+			}
+		}
+		byWorkload[c.ServiceID] = append(byWorkload[c.ServiceID], c)
+	}
+
+	var stages []*update.Automated
+	addStage := func(ids []flux.ResourceID) {
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i].String() < ids[j].String()
+		})
+		stage := &update.Automated{}
+		for _, id := range ids {
+			stage.Changes = append(stage.Changes, byWorkload[id]...)
+		}
+		stages = append(stages, stage)
+	}
+	if len(canaryIDs) > 0 {
+		addStage(canaryIDs)
+	}
+	sort.Slice(otherIDs, func(i, j int) bool {
+		return otherIDs[i].String() < otherIDs[j].String()
+	})
+	for len(otherIDs) > 0 {
+		n := len(otherIDs)
+		if s.BatchSize > 0 && s.BatchSize < n {
+			n = s.BatchSize
+		}
+		addStage(otherIDs[:n])
+		otherIDs = otherIDs[n:]
+	}
+	return stages
+}
+
+// stage says which stage of a staged release a release is, counting
+// from one.
+type stage struct {
+	Stage  int `json:"stage"`
+	Stages int `json:"stages"`
+}
+
+// stagedChanges are the changes released in a stage; the commit
+// message and note say which stage it is.
+type stagedChanges struct {
+	*update.Automated
+	stage stage
+}
+
+func (s *stagedChanges) CommitMessage(result update.Result) string {
+	buf := bytes.NewBufferString(s.Automated.CommitMessage(result))
+	fmt.Fprintf(buf, "\n\nStage %d of %d of a staged release", s.stage.Stage, s.stage.Stages)
+	return buf.String()
+}
+
+// stagedRollout is a staged release in progress.
+type stagedRollout struct {
+	// the changes in each stage; those in stages yet to start are
+	// only used to say which workloads are in the stage
+	stages  []*update.Automated
+	current int
+	// the job releasing the current stage, and when it pushed the
+	// release
+	jobID  job.ID
+	pushed time.Time
+}
+
+// haltedKey identifies a change left unreleased by a halted release.
+func haltedKey(c update.Change) string {
+	return fmt.Sprintf("%s %s %s", c.ServiceID, c.Container.Name, c.ImageID)
+}
+
+// releaseStaged moves the staged release in progress along, if there
+// is one; otherwise, it starts a staged release of the automated
+// changes given (or, if they make only one stage, just releases them).
+// While a staged release is in progress, no other automated releases
+// are started.
+func (d *Daemon) releaseStaged(ctx context.Context, changes *update.Automated, canaries flux.ResourceIDSet, now time.Time, logger log.Logger) {
+	if d.rollout != nil {
+		d.advanceRollout(changes, now, logger)
+		if d.rollout != nil {
+			logger.Log("info", "staged release in progress", "stage", d.rollout.current+1, "stages", len(d.rollout.stages))
+			return
+		}
+	}
+
+	// Leave out what was left by halted releases; and forget those
+	// that are no longer automated changes (e.g., because a newer
+	// image has turned up, or they were released by other means).
+	halted := map[string]bool{}
+	toRelease := &update.Automated{}
+	for _, c := range changes.Changes {
+		if key := haltedKey(c); d.halted[key] {
+			halted[key] = true
+			continue
+		}
+		toRelease.Changes = append(toRelease.Changes, c)
+	}
+	d.halted = halted
+	if len(toRelease.Changes) == 0 {
+		return
+	}
+
+	stages := d.Staged.Stages(toRelease, canaries)
+	if len(stages) == 1 {
+		d.UpdateManifests(ctx, update.Spec{Type: update.Auto, Spec: toRelease})
+		return
+	}
+	logger.Log("info", "starting staged release", "stages", len(stages), "canaries", len(canaries))
+	d.rollout = &stagedRollout{stages: stages}
+	d.startStage(logger)
+}
+
+// startStage queues the job that releases the current stage.
+func (d *Daemon) startStage(logger log.Logger) {
+	r := d.rollout
+	changes := &stagedChanges{
+		Automated: r.stages[r.current],
+		stage:     stage{Stage: r.current + 1, Stages: len(r.stages)},
+	}
+	spec := update.Spec{Type: update.Auto, Spec: changes.Automated}
+	do := d.makeLoggingJobFunc(d.makeJobFromUpdate(d.release(spec, changes)))
+	current := r.current
+	r.jobID = d.queueJob(func(ctx context.Context, id job.ID, logger log.Logger) (job.Result, error) {
+		result, err := do(ctx, id, logger)
+		// The soak period starts when the release is pushed, so note
+		// when that was (as long as this is still the stage in
+		// progress), and make sure there's a look at the end of it
+		if err == nil && result.Revision != "" && d.rollout == r && r.current == current {
+			r.pushed = time.Now()
+			time.AfterFunc(d.Staged.Soak, d.AskForImagePoll)
+		}
+		return result, err
+	})
+	r.pushed = time.Time{}
+	logger.Log("info", "releasing stage", "stage", changes.stage.Stage, "stages", changes.stage.Stages, "job", r.jobID)
+}
+
+// advanceRollout checks on the current stage of the staged release in
+// progress, and starts the next stage, with the latest of the
+// automated changes given, once the current one has soaked; or halts
+// the release, if the current stage has failed.
+func (d *Daemon) advanceRollout(changes *update.Automated, now time.Time, logger log.Logger) {
+	r := d.rollout
+	status, ok := d.JobStatusCache.Status(r.jobID)
+	switch {
+	case !ok:
+		d.haltRollout("", errors.New("status of release job lost"), nil, logger)
+		return
+	case status.StatusString == job.StatusQueued || status.StatusString == job.StatusRunning:
+		return
+	case status.StatusString == job.StatusFailed:
+		d.haltRollout("", errors.New(status.Err), nil, logger)
+		return
+	}
+
+	released := status.Result.Result.AffectedResources()
+	if len(released) == 0 {
+		d.haltRollout(status.Result.Revision, errors.New("nothing was released"), nil, logger)
+		return
+	}
+	if r.pushed.IsZero() {
+		// The job didn't say when it pushed (e.g., because the daemon
+		// restarted), so go from when it was seen to have succeeded
+		r.pushed = now
+		time.AfterFunc(d.Staged.Soak, d.AskForImagePoll)
+	}
+
+	rollouts, ready := d.checkStage(r.stages[r.current], released, logger)
+	for _, ro := range rollouts {
+		if ro.Outcome == event.RolloutFailed {
+			d.haltRollout(status.Result.Revision, nil, rollouts, logger)
+			return
+		}
+	}
+	if now.Sub(r.pushed) < d.Staged.Soak {
+		return
+	}
+	if !ready {
+		d.haltRollout(status.Result.Revision, nil, rollouts, logger)
+		return
+	}
+
+	for r.current++; r.current < len(r.stages); r.current++ {
+		r.stages[r.current] = latestChanges(changes, r.stages[r.current])
+		if len(r.stages[r.current].Changes) > 0 {
+			break
+		}
+		logger.Log("info", "nothing left to release in stage", "stage", r.current+1, "stages", len(r.stages))
+	}
+	if r.current == len(r.stages) {
+		logger.Log("info", "staged release complete", "stages", len(r.stages))
+		d.rollout = nil
+		return
+	}
+	d.startStage(logger)
+}
+
+// latestChanges gives those of the changes given that are to the
+// workloads in the stage given. Workloads that no longer have
+// changes (e.g., because they have been released to by other means)
+// are left out.
+func latestChanges(changes, stage *update.Automated) *update.Automated {
+	inStage := flux.ResourceIDSet{}
+	for _, c := range stage.Changes {
+		inStage.Add([]flux.ResourceID{c.ServiceID})
+	}
+	latest := &update.Automated{}
+	for _, c := range changes.Changes {
+		if inStage.Contains(c.ServiceID) {
+			latest.Changes = append(latest.Changes, c)
+		}
+	}
+	return latest
+}
+
+// checkStage looks at how the workloads released in a stage are
+// rolling out. They are ready if they are running the images released
+// and (if their status can be interpreted as the progress of a
+// rollout) have finished rolling out.
+func (d *Daemon) checkStage(changes *update.Automated, released []flux.ResourceID, logger log.Logger) ([]event.RolloutResult, bool) {
+	controllers, err := d.Cluster.SomeControllers(released)
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "checking workloads in stage"))
+		return nil, false
+	}
+	byID := map[flux.ResourceID]cluster.Controller{}
+	for _, c := range controllers {
+		byID[c.ID] = c
+	}
+
+	ready := true
+	var results []event.RolloutResult
+	for _, id := range released {
+		result := event.RolloutResult{ID: id, Outcome: event.RolloutTimeout}
+		c, ok := byID[id]
+		if !ok {
+			results = append(results, result)
+			ready = false
+			continue
+		}
+		result.Messages = c.Rollout.Messages
+		applied := true
+		for _, change := range changes.Changes {
+			if change.ServiceID != id {
+				continue
+			}
+			running := false
+			for _, container := range c.ContainersOrNil() {
+				if container.Name == change.Container.Name && container.Image.String() == change.ImageID.String() {
+					running = true
+				}
+			}
+			applied = applied && running
+		}
+		outcome, tracked := rolloutOutcome(c)
+		switch {
+		case tracked && outcome == event.RolloutFailed:
+			result.Outcome = outcome
+		case applied && (!tracked || outcome == event.RolloutReady):
+			result.Outcome = event.RolloutReady
+		}
+		if result.Outcome != event.RolloutReady {
+			ready = false
+		}
+		results = append(results, result)
+	}
+	return results, ready
+}
+
+// haltRollout halts the staged release in progress, remembering the
+// changes that have not been released so automation doesn't try them
+// again, and records the failed stage in an event.
+func (d *Daemon) haltRollout(revision string, err error, rollouts []event.RolloutResult, logger log.Logger) {
+	r := d.rollout
+	d.rollout = nil
+	if d.halted == nil {
+		d.halted = map[string]bool{}
+	}
+	for _, s := range r.stages[r.current:] {
+		for _, c := range s.Changes {
+			d.halted[haltedKey(c)] = true
+		}
+	}
+
+	metadata := &event.StageFailedEventMetadata{
+		Stage:    r.current + 1,
+		Stages:   len(r.stages),
+		Revision: revision,
+		Rollouts: rollouts,
+	}
+	if err != nil {
+		metadata.Error = err.Error()
+	}
+	logger.Log("warning", "staged release halted", "stage", metadata.Stage, "stages", metadata.Stages, "err", err)
+
+	ids := flux.ResourceIDSet{}
+	for _, c := range r.stages[r.current].Changes {
+		ids.Add([]flux.ResourceID{c.ServiceID})
+	}
+	now := time.Now().UTC()
+	if err := d.LogEvent(event.Event{
+		ServiceIDs: ids.ToSlice(),
+		Type:       event.EventStageFailed,
+		StartedAt:  now,
+		EndedAt:    now,
+		LogLevel:   event.LogLevelError,
+		Metadata:   metadata,
+	}); err != nil {
+		logger.Log("err", errors.Wrap(err, "logging event for halted staged release"))
+	}
+}
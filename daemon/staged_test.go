@@ -0,0 +1,247 @@
+package daemon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
+)
+
+func TestStagedAutomation_Stages(t *testing.T) {
+	s := &StagedAutomation{BatchSize: 2, CanaryLabels: map[string]string{"track": "canary"}}
+
+	canary := cluster.Controller{Labels: map[string]string{"track": "canary", "app": "foo"}}
+	assert.True(t, s.IsCanary(canary, nil))
+	assert.False(t, s.IsCanary(cluster.Controller{Labels: map[string]string{"app": "foo"}}, nil))
+	assert.True(t, s.IsCanary(cluster.Controller{}, policy.Set{policy.Canary: "true"}))
+
+	changes := &update.Automated{}
+	for _, id := range []string{"default:deployment/e", "default:deployment/d", "default:deployment/c", "default:deployment/b", "default:deployment/a"} {
+		changes.Add(flux.MustParseResourceID(id), resource.Container{Name: "sidecar"}, mustParseImageRef("weaveworks/sidecar:2"))
+	}
+	canaries := flux.ResourceIDSet{}
+	canaries.Add([]flux.ResourceID{flux.MustParseResourceID("default:deployment/d")})
+
+	var stages [][]string
+	for _, stage := range s.Stages(changes, canaries) {
+		var ids []string
+		for _, c := range stage.Changes {
+			ids = append(ids, c.ServiceID.String())
+		}
+		stages = append(stages, ids)
+	}
+	assert.Equal(t, [][]string{
+		{"default:deployment/d"},
+		{"default:deployment/a", "default:deployment/b"},
+		{"default:deployment/c", "default:deployment/e"},
+	}, stages)
+
+	// Without canaries or batches, there's just the one stage
+	s = &StagedAutomation{}
+	assert.Len(t, s.Stages(changes, flux.ResourceIDSet{}), 1)
+}
+
+func TestDaemon_StagedRelease(t *testing.T) {
+	d, _, clean, k8s, events, _ := mockDaemon(t)
+	defer clean()
+	d.Staged = &StagedAutomation{Soak: time.Minute}
+	logger := log.NewNopLogger()
+
+	helloID := flux.MustParseResourceID(svc)
+	anotherID := flux.MakeResourceID("another", "deployment", "service")
+	stage1 := &update.Automated{}
+	stage1.Add(helloID, resource.Container{Name: container, Image: mustParseImageRef(currentHelloImage)}, mustParseImageRef(newHelloImage))
+	stage2 := &update.Automated{}
+	stage2.Add(anotherID, resource.Container{Name: anotherContainer, Image: mustParseImageRef(anotherImage)}, mustParseImageRef("another/service:2"))
+
+	succeeded := func(id job.ID, released flux.ResourceID) {
+		d.JobStatusCache.SetStatus(id, job.Status{
+			StatusString: job.StatusSucceeded,
+			Result: job.Result{
+				Revision: "abc123",
+				Result:   update.Result{released: update.ControllerResult{Status: update.ReleaseStatusSuccess}},
+			},
+		})
+	}
+	running := func(id flux.ResourceID, containerName, image, status string) {
+		k8s.SomeServicesFunc = func([]flux.ResourceID) ([]cluster.Controller, error) {
+			return []cluster.Controller{{
+				ID:     id,
+				Status: status,
+				Containers: cluster.ContainersOrExcuse{
+					Containers: []resource.Container{{Name: containerName, Image: mustParseImageRef(image)}},
+				},
+			}}, nil
+		}
+	}
+
+	all := &update.Automated{}
+	all.Changes = append(append(all.Changes, stage1.Changes...), stage2.Changes...)
+
+	d.rollout = &stagedRollout{stages: []*update.Automated{stage1, stage2}, jobID: job.ID("stage-1")}
+	succeeded("stage-1", helloID)
+	now := time.Now()
+
+	// The first stage has been released, and is soaking
+	running(helloID, container, newHelloImage, cluster.StatusReady)
+	d.advanceRollout(all, now, logger)
+	if assert.NotNil(t, d.rollout) {
+		assert.Equal(t, 0, d.rollout.current)
+	}
+
+	// Having soaked, the next stage is released
+	d.advanceRollout(all, now.Add(time.Minute), logger)
+	if !assert.NotNil(t, d.rollout) {
+		t.FailNow()
+	}
+	assert.Equal(t, 1, d.rollout.current)
+	queued := <-d.Jobs.Ready()
+	assert.Equal(t, d.rollout.jobID, queued.ID)
+
+	// The next stage fails to roll out, which halts the release
+	succeeded(queued.ID, anotherID)
+	running(anotherID, anotherContainer, "another/service:2", cluster.StatusError)
+	d.advanceRollout(all, now.Add(2*time.Minute), logger)
+	assert.Nil(t, d.rollout)
+	es, _ := events.AllEvents(time.Time{}, -1, time.Time{})
+	var failed []event.Event
+	for _, e := range es {
+		if e.Type == event.EventStageFailed {
+			failed = append(failed, e)
+		}
+	}
+	if assert.Len(t, failed, 1) {
+		metadata := failed[0].Metadata.(*event.StageFailedEventMetadata)
+		assert.Equal(t, 2, metadata.Stage)
+		assert.Equal(t, 2, metadata.Stages)
+		if assert.Len(t, metadata.Rollouts, 1) {
+			assert.Equal(t, event.RolloutFailed, metadata.Rollouts[0].Outcome)
+		}
+	}
+
+	// ... and automation doesn't try the same changes again
+	d.releaseStaged(context.Background(), stage2, flux.ResourceIDSet{}, now.Add(3*time.Minute), logger)
+	d.Jobs.Sync()
+	assert.Equal(t, 0, d.Jobs.Len())
+	assert.Nil(t, d.rollout)
+}
+
+func TestDaemon_StagedRelease_LatestChanges(t *testing.T) {
+	d, _, clean, k8s, _, _ := mockDaemon(t)
+	defer clean()
+	if err := d.Repo.Ready(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.Staged = &StagedAutomation{Soak: time.Minute}
+	logger := log.NewNopLogger()
+
+	helloID := flux.MustParseResourceID(svc)
+	anotherID := flux.MakeResourceID("another", "deployment", "service")
+	stage1 := &update.Automated{}
+	stage1.Add(anotherID, resource.Container{Name: anotherContainer, Image: mustParseImageRef(anotherImage)}, mustParseImageRef("another/service:2"))
+	stage2 := &update.Automated{}
+	stage2.Add(helloID, resource.Container{Name: container, Image: mustParseImageRef(currentHelloImage)}, mustParseImageRef(newHelloImage))
+
+	d.rollout = &stagedRollout{stages: []*update.Automated{stage1, stage2}, jobID: job.ID("stage-1")}
+	d.JobStatusCache.SetStatus("stage-1", job.Status{
+		StatusString: job.StatusSucceeded,
+		Result: job.Result{
+			Revision: "abc123",
+			Result:   update.Result{anotherID: update.ControllerResult{Status: update.ReleaseStatusSuccess}},
+		},
+	})
+	running := map[flux.ResourceID]resource.Container{
+		anotherID: {Name: anotherContainer, Image: mustParseImageRef("another/service:2")},
+		helloID:   {Name: container, Image: mustParseImageRef(currentHelloImage)},
+	}
+	k8s.SomeServicesFunc = func(ids []flux.ResourceID) ([]cluster.Controller, error) {
+		var controllers []cluster.Controller
+		for _, id := range ids {
+			controllers = append(controllers, cluster.Controller{
+				ID:         id,
+				Status:     cluster.StatusReady,
+				Containers: cluster.ContainersOrExcuse{Containers: []resource.Container{running[id]}},
+			})
+		}
+		return controllers, nil
+	}
+
+	// A newer image has turned up since the staged release started;
+	// the next stage releases that
+	newer := "quay.io/weaveworks/helloworld:3"
+	latest := &update.Automated{}
+	latest.Add(helloID, resource.Container{Name: container, Image: mustParseImageRef(currentHelloImage)}, mustParseImageRef(newer))
+
+	now := time.Now()
+	d.advanceRollout(latest, now, logger)
+	d.advanceRollout(latest, now.Add(time.Minute), logger)
+	if !assert.NotNil(t, d.rollout) || !assert.Equal(t, 1, d.rollout.current) {
+		t.FailNow()
+	}
+	if assert.Len(t, d.rollout.stages[1].Changes, 1) {
+		assert.Equal(t, newer, d.rollout.stages[1].Changes[0].ImageID.String())
+	}
+
+	// The soak period starts when the stage is pushed, rather than
+	// when that's noticed
+	queued := <-d.Jobs.Ready()
+	if err := queued.Do(logger); err != nil {
+		t.Fatal(err)
+	}
+	pushed := d.rollout.pushed
+	if pushed.IsZero() {
+		t.Fatal("expected the time the stage was pushed to be recorded")
+	}
+	running[helloID] = resource.Container{Name: container, Image: mustParseImageRef(newer)}
+	d.advanceRollout(latest, pushed.Add(time.Minute), logger)
+	assert.Nil(t, d.rollout)
+}
+
+func TestDaemon_StagedRelease_NothingLeftInStage(t *testing.T) {
+	d, _, clean, k8s, _, _ := mockDaemon(t)
+	defer clean()
+	d.Staged = &StagedAutomation{Soak: time.Minute}
+	logger := log.NewNopLogger()
+
+	helloID := flux.MustParseResourceID(svc)
+	anotherID := flux.MakeResourceID("another", "deployment", "service")
+	stage1 := &update.Automated{}
+	stage1.Add(anotherID, resource.Container{Name: anotherContainer, Image: mustParseImageRef(anotherImage)}, mustParseImageRef("another/service:2"))
+	stage2 := &update.Automated{}
+	stage2.Add(helloID, resource.Container{Name: container, Image: mustParseImageRef(currentHelloImage)}, mustParseImageRef(newHelloImage))
+
+	d.rollout = &stagedRollout{stages: []*update.Automated{stage1, stage2}, jobID: job.ID("stage-1"), pushed: time.Now()}
+	d.JobStatusCache.SetStatus("stage-1", job.Status{
+		StatusString: job.StatusSucceeded,
+		Result: job.Result{
+			Revision: "abc123",
+			Result:   update.Result{anotherID: update.ControllerResult{Status: update.ReleaseStatusSuccess}},
+		},
+	})
+	k8s.SomeServicesFunc = func(ids []flux.ResourceID) ([]cluster.Controller, error) {
+		return []cluster.Controller{{
+			ID:     anotherID,
+			Status: cluster.StatusReady,
+			Containers: cluster.ContainersOrExcuse{
+				Containers: []resource.Container{{Name: anotherContainer, Image: mustParseImageRef("another/service:2")}},
+			},
+		}}, nil
+	}
+
+	// helloworld has been released to by other means, so there's no
+	// change left for it; the staged release is done
+	d.advanceRollout(&update.Automated{}, time.Now().Add(time.Minute), logger)
+	assert.Nil(t, d.rollout)
+	d.Jobs.Sync()
+	assert.Equal(t, 0, d.Jobs.Len())
+}
@@ -0,0 +1,112 @@
+package daemon
+
+import (
+	"sort"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/registry/cache"
+	"github.com/weaveworks/flux/resource"
+)
+
+// tagUse is how the workloads synced from a repo use the tags of
+// each image.
+type tagUse struct {
+	patterns map[image.CanonicalName][]policy.Pattern
+	// images used by some workload without a tag filter
+	unfiltered map[image.CanonicalName]bool
+	// the tags used by the workloads now
+	current map[image.CanonicalName]map[string]bool
+}
+
+// TagsInUse gives the tag patterns that workloads use for each image,
+// and the tags they use now, so that the cache warmer can skip tags
+// that no workload would select. It goes by the manifests as of the
+// last sync from the main repo and each of the sync sources; before
+// anything has been synced, it gives nothing. Images used by any
+// workload without a tag filter are given without patterns, since
+// any of their tags could be selected.
+func (d *Daemon) TagsInUse() map[image.CanonicalName]cache.TagsInUse {
+	d.tagPatternsMu.Lock()
+	defer d.tagPatternsMu.Unlock()
+	if d.tagPatterns == nil {
+		return nil
+	}
+	inUse := map[image.CanonicalName]cache.TagsInUse{}
+	unfiltered := map[image.CanonicalName]bool{}
+	current := map[image.CanonicalName]map[string]bool{}
+	for _, use := range d.tagPatterns {
+		for name, ps := range use.patterns {
+			u := inUse[name]
+			u.Patterns = append(u.Patterns, ps...)
+			inUse[name] = u
+		}
+		for name := range use.unfiltered {
+			unfiltered[name] = true
+		}
+		for name, tags := range use.current {
+			if current[name] == nil {
+				current[name] = map[string]bool{}
+			}
+			for tag := range tags {
+				current[name][tag] = true
+			}
+		}
+	}
+	for name := range unfiltered {
+		u := inUse[name]
+		u.Patterns = nil
+		inUse[name] = u
+	}
+	for name, tags := range current {
+		u := inUse[name]
+		for tag := range tags {
+			u.Current = append(u.Current, tag)
+		}
+		sort.Strings(u.Current)
+		inUse[name] = u
+	}
+	return inUse
+}
+
+// recordTagPatterns records how the workloads among the resources
+// synced from the named sync target use image tags, for TagsInUse.
+func (d *Daemon) recordTagPatterns(target string, resources map[string]resource.Resource) {
+	use := tagPatterns(resources)
+	d.tagPatternsMu.Lock()
+	defer d.tagPatternsMu.Unlock()
+	if d.tagPatterns == nil {
+		d.tagPatterns = map[string]tagUse{}
+	}
+	d.tagPatterns[target] = use
+}
+
+func tagPatterns(resources map[string]resource.Resource) tagUse {
+	use := tagUse{
+		patterns:   map[image.CanonicalName][]policy.Pattern{},
+		unfiltered: map[image.CanonicalName]bool{},
+		current:    map[image.CanonicalName]map[string]bool{},
+	}
+	for _, res := range resources {
+		workload, ok := res.(resource.Workload)
+		if !ok {
+			continue
+		}
+		for _, c := range workload.Containers() {
+			name := c.Image.CanonicalName()
+			if c.Image.Tag != "" {
+				if use.current[name] == nil {
+					use.current[name] = map[string]bool{}
+				}
+				use.current[name][c.Image.Tag] = true
+			}
+			pattern := policy.GetTagPattern(res.Policy(), c.Name)
+			if pattern.String() == policy.PatternAll.String() {
+				use.unfiltered[name] = true
+				continue
+			}
+			use.patterns[name] = append(use.patterns[name], pattern)
+		}
+	}
+	return use
+}
@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/policy"
+)
+
+func TestDaemon_TagPatterns(t *testing.T) {
+	d, _, clean, _, _, _ := mockDaemon(t)
+	defer clean()
+
+	addPolicies(t, d, policy.Set{
+		policy.TagPrefix("greeter"): "semver:~1",
+		policy.TagPrefix("sidecar"): "glob:master-*",
+	})
+
+	// Nothing is known until there's been a sync
+	assert.Nil(t, d.TagsInUse())
+	d.doSync(log.NewNopLogger())
+
+	inUse := d.TagsInUse()
+	// The greeter image is used by other workloads without a tag
+	// filter, so it's not filtered
+	greeter := mustParseImageRef(currentHelloImage)
+	assert.Empty(t, inUse[greeter.CanonicalName()].Patterns)
+	assert.Contains(t, inUse[greeter.CanonicalName()].Current, greeter.Tag)
+	sidecar := inUse[mustParseImageRef("weaveworks/sidecar:master-a000001").CanonicalName()]
+	assert.Equal(t, []string{"master-a000001"}, sidecar.Current)
+	if assert.Len(t, sidecar.Patterns, 1) {
+		assert.True(t, sidecar.Patterns[0].Matches("master-a000002"))
+		assert.False(t, sidecar.Patterns[0].Matches("feature-a000002"))
+	}
+}
+
+const sourceDefs = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: apps
+  annotations:
+    flux.weave.works/tag.app: glob:release-*
+    flux.weave.works/tag.sidecar: semver:~2
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: quay.io/example/app:release-1
+      - name: sidecar
+        image: weaveworks/sidecar:2.0.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: other
+  namespace: apps
+spec:
+  template:
+    spec:
+      containers:
+      - name: other
+        image: quay.io/example/other:1
+`
+
+func TestDaemon_TagPatterns_Sources(t *testing.T) {
+	d := &Daemon{LoopVars: &LoopVars{}}
+
+	main, err := kresource.ParseMultidoc([]byte(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  namespace: default
+  annotations:
+    flux.weave.works/tag.sidecar: glob:master-*
+    flux.weave.works/tag.other: semver:~1
+spec:
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: weaveworks/sidecar:master-a000001
+      - name: other
+        image: quay.io/example/other:1
+`), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := kresource.ParseMultidoc([]byte(sourceDefs), "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.recordTagPatterns("", main)
+	d.recordTagPatterns("apps", source)
+
+	inUse := d.TagsInUse()
+	// The patterns and tags used in all the repos are included
+	sidecar := inUse[mustParseImageRef("weaveworks/sidecar:1").CanonicalName()]
+	assert.Len(t, sidecar.Patterns, 2)
+	assert.Equal(t, []string{"2.0.0", "master-a000001"}, sidecar.Current)
+	assert.Len(t, inUse[mustParseImageRef("quay.io/example/app:1").CanonicalName()].Patterns, 1)
+	// An image used without a tag filter in any of the repos isn't
+	// filtered
+	other := inUse[mustParseImageRef("quay.io/example/other:1").CanonicalName()]
+	assert.Empty(t, other.Patterns)
+	assert.Equal(t, []string{"1"}, other.Current)
+}
@@ -0,0 +1,277 @@
+// Package drift compares the resources defined in git with those
+// running in the cluster, to find any that have been changed by
+// means other than syncing (e.g., `kubectl edit`).
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// Difference is a single field that has a different value in the
+// cluster to that in git. Cluster is nil if the field is missing from
+// the resource in the cluster.
+type Difference struct {
+	Path    string
+	Git     interface{}
+	Cluster interface{}
+}
+
+// ResourceDrift records how a resource in the cluster differs from
+// its definition in git. If the resource is missing from the cluster
+// altogether, Missing is true and there are no Differences. If it
+// can't be told whether the resource is in the cluster, Untracked is
+// true and there are no Differences.
+type ResourceDrift struct {
+	ID          flux.ResourceID
+	Source      string
+	Missing     bool         `json:",omitempty"`
+	Untracked   bool         `json:",omitempty"`
+	Differences []Difference `json:",omitempty"`
+}
+
+// Report has an entry for each resource that has drifted, in order of
+// resource ID.
+type Report []ResourceDrift
+
+// CountByNamespace gives the number of drifted resources in each
+// namespace. Untracked resources aren't counted, since they may not
+// have drifted.
+func (r Report) CountByNamespace() map[string]int {
+	counts := map[string]int{}
+	for _, res := range r {
+		if res.Untracked {
+			continue
+		}
+		ns, _, _ := res.ID.Components()
+		counts[ns]++
+	}
+	return counts
+}
+
+// Detect compares each of the resources defined in the repo with the
+// same resource in the cluster. Resources with the `ignore` policy
+// are skipped, since they are not synced and are expected to differ.
+// Resources in the cluster with no definition in the repo are not
+// considered.
+//
+// All the workloads in the cluster are expected to be among the
+// cluster resources given, but other resources only if they are
+// marked as synced; so a workload that isn't there is missing, but
+// anything else may be missing, or just not marked (e.g., if it was
+// last synced by a version of flux that didn't mark resources), and
+// is reported as untracked.
+func Detect(repoResources, clusterResources map[string]resource.Resource) (Report, error) {
+	var report Report
+	for id, res := range repoResources {
+		if res.Policy().Has(policy.Ignore) {
+			continue
+		}
+		live, ok := clusterResources[id]
+		if !ok {
+			_, isWorkload := res.(resource.Workload)
+			report = append(report, ResourceDrift{ID: res.ResourceID(), Source: res.Source(), Missing: isWorkload, Untracked: !isWorkload})
+			continue
+		}
+		diffs, err := Diff(res.Bytes(), live.Bytes())
+		if err != nil {
+			return nil, errors.Wrapf(err, "comparing %s", id)
+		}
+		if len(diffs) > 0 {
+			report = append(report, ResourceDrift{ID: res.ResourceID(), Source: res.Source(), Differences: diffs})
+		}
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].ID.String() < report[j].ID.String()
+	})
+	return report, nil
+}
+
+// Diff compares the definition of a resource from git with the same
+// resource as exported from the cluster. Both are normalised first,
+// by removing the fields that are maintained by the cluster (e.g.,
+// `status`); and, since the cluster fills in defaults for fields that
+// aren't given, only fields that are present in the definition from
+// git are compared.
+func Diff(gitDef, clusterDef []byte) ([]Difference, error) {
+	gitObj, err := normalise(gitDef)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing definition from git")
+	}
+	clusterObj, err := normalise(clusterDef)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing definition from cluster")
+	}
+	var diffs []Difference
+	compare("", gitObj, clusterObj, &diffs)
+	return diffs, nil
+}
+
+// Fields in the metadata that are set by the cluster, and always
+// differ from (or are absent in) the definition in git.
+var clusterMetadata = []string{
+	"creationTimestamp",
+	"generation",
+	"resourceVersion",
+	"selfLink",
+	"uid",
+}
+
+// Annotations set when applying, rather than given in git.
+var clusterAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+}
+
+// normalise parses a YAML definition into JSON-like values (so that
+// numbers compare equal regardless of where they came from), and
+// removes the fields that are not expected to match.
+func normalise(def []byte) (map[string]interface{}, error) {
+	jsonBytes, err := k8syaml.YAMLToJSON(def)
+	if err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(jsonBytes, &obj); err != nil {
+		return nil, err
+	}
+
+	// The API version may be different depending on how the
+	// resource was fetched, without there being any change
+	delete(obj, "apiVersion")
+	delete(obj, "status")
+	if meta, ok := obj["metadata"].(map[string]interface{}); ok {
+		for _, field := range clusterMetadata {
+			delete(meta, field)
+		}
+		if annotations, ok := meta["annotations"].(map[string]interface{}); ok {
+			for _, a := range clusterAnnotations {
+				delete(annotations, a)
+			}
+		}
+	}
+	normaliseQuantities(obj)
+	return obj, nil
+}
+
+// Fields that hold a map of resource names to quantities (e.g., the
+// `limits` and `requests` of a container, or the `hard` limits of a
+// ResourceQuota).
+var quantityFields = map[string]bool{
+	"capacity": true,
+	"hard":     true,
+	"limits":   true,
+	"requests": true,
+}
+
+// normaliseQuantities rewrites resource quantities in one form, since
+// the cluster may give them differently than they were written (e.g.,
+// `0.5` as `500m`). Values that aren't quantities are left as
+// they are.
+func normaliseQuantities(val interface{}) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if quantities, ok := field.(map[string]interface{}); ok && quantityFields[k] {
+				for name, q := range quantities {
+					if canonical, ok := canonicalQuantity(q); ok {
+						quantities[name] = canonical
+					}
+				}
+			}
+			normaliseQuantities(field)
+		}
+	case []interface{}:
+		for _, item := range v {
+			normaliseQuantities(item)
+		}
+	}
+}
+
+func canonicalQuantity(val interface{}) (string, bool) {
+	var s string
+	switch v := val.(type) {
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return "", false
+	}
+	q, err := k8sresource.ParseQuantity(s)
+	if err != nil {
+		return "", false
+	}
+	// Written as a decimal, so that e.g. `128Mi` and `134217728`
+	// come out the same; unless it's too big to be converted exactly
+	decimal := k8sresource.NewMilliQuantity(q.MilliValue(), k8sresource.DecimalSI)
+	if decimal.Cmp(q) != 0 {
+		return q.String(), true
+	}
+	return decimal.String(), true
+}
+
+// compare records the differences between the value from git and the
+// value from the cluster, at the path given.
+func compare(path string, gitVal, clusterVal interface{}, diffs *[]Difference) {
+	switch g := gitVal.(type) {
+	case map[string]interface{}:
+		c, ok := clusterVal.(map[string]interface{})
+		if !ok {
+			if clusterVal == nil && len(g) == 0 {
+				return
+			}
+			*diffs = append(*diffs, Difference{Path: path, Git: gitVal, Cluster: clusterVal})
+			return
+		}
+		keys := make([]string, 0, len(g))
+		for k := range g {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			compare(fieldPath(path, k), g[k], c[k], diffs)
+		}
+	case []interface{}:
+		c, ok := clusterVal.([]interface{})
+		if !ok || len(c) != len(g) {
+			if clusterVal == nil && len(g) == 0 {
+				return
+			}
+			*diffs = append(*diffs, Difference{Path: path, Git: gitVal, Cluster: clusterVal})
+			return
+		}
+		for i := range g {
+			compare(fmt.Sprintf("%s[%d]", path, i), g[i], c[i], diffs)
+		}
+	case nil:
+		// Not given in git, so anything goes
+	default:
+		if !reflect.DeepEqual(gitVal, clusterVal) {
+			*diffs = append(*diffs, Difference{Path: path, Git: gitVal, Cluster: clusterVal})
+		}
+	}
+}
+
+// fieldPath appends a field name to a path, quoting it if it would be
+// ambiguous otherwise (as is usually the case for annotations).
+func fieldPath(path, field string) string {
+	if strings.ContainsAny(field, `.[]"`) {
+		return fmt.Sprintf("%s[%q]", path, field)
+	}
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
@@ -0,0 +1,225 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+)
+
+const gitDefs = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  namespace: default
+  annotations:
+    flux.weave.works/automated: "true"
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: hello
+        image: quay.io/weaveworks/helloworld:v1
+        ports:
+        - containerPort: 80
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: helloworld
+  namespace: default
+spec:
+  ports:
+  - port: 80
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: missing
+  namespace: other
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: gone
+  namespace: other
+spec:
+  replicas: 1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+  namespace: other
+  annotations:
+    flux.weave.works/ignore: "true"
+data:
+  foo: bar
+`
+
+// The cluster has defaults filled in, status, server-maintained
+// metadata and so on, as well as some edits.
+const clusterDefs = `---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+  namespace: default
+  uid: 4a2d4e0c-1f9b-11e9-a41c-42010a80012c
+  resourceVersion: "12345"
+  generation: 4
+  creationTimestamp: 2019-01-23T10:00:00Z
+  annotations:
+    flux.weave.works/automated: "true"
+    deployment.kubernetes.io/revision: "3"
+    kubectl.kubernetes.io/last-applied-configuration: '{}'
+spec:
+  replicas: 5
+  progressDeadlineSeconds: 600
+  template:
+    spec:
+      containers:
+      - name: hello
+        image: quay.io/weaveworks/helloworld:v1
+        imagePullPolicy: IfNotPresent
+        ports:
+        - containerPort: 80
+          protocol: TCP
+status:
+  replicas: 5
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: helloworld
+  namespace: default
+spec:
+  clusterIP: 10.0.0.1
+  ports:
+  - port: 80
+    protocol: TCP
+    targetPort: 80
+  - port: 8080
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+  namespace: other
+data:
+  foo: baz
+`
+
+func TestDetect(t *testing.T) {
+	repoResources, err := kresource.ParseMultidoc([]byte(gitDefs), "git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusterResources, err := kresource.ParseMultidoc([]byte(clusterDefs), "exported")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Detect(repoResources, clusterResources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report) != 4 {
+		t.Fatalf("expected four drifted resources, got %#v", report)
+	}
+	if id := report[0].ID.String(); id != "default:deployment/helloworld" {
+		t.Errorf("expected deployment first, got %s", id)
+	}
+	expected := []Difference{{Path: "spec.replicas", Git: float64(2), Cluster: float64(5)}}
+	if !reflect.DeepEqual(expected, report[0].Differences) {
+		t.Errorf("expected differences %#v, got %#v", expected, report[0].Differences)
+	}
+
+	if id := report[1].ID.String(); id != "default:service/helloworld" {
+		t.Errorf("expected service second, got %s", id)
+	}
+	if len(report[1].Differences) != 1 || report[1].Differences[0].Path != "spec.ports" {
+		t.Errorf("expected the extra port to be reported, got %#v", report[1].Differences)
+	}
+
+	// The configmap may just not be marked as synced, so it's not
+	// known to be missing; whereas all workloads are exported
+	if id := report[2].ID.String(); id != "other:configmap/missing" || report[2].Missing || !report[2].Untracked {
+		t.Errorf("expected untracked configmap third, got %#v", report[2])
+	}
+	if id := report[3].ID.String(); id != "other:deployment/gone" || !report[3].Missing || report[3].Untracked {
+		t.Errorf("expected missing deployment last, got %#v", report[3])
+	}
+
+	expectedCounts := map[string]int{"default": 2, "other": 1}
+	if counts := report.CountByNamespace(); !reflect.DeepEqual(expectedCounts, counts) {
+		t.Errorf("expected counts %v, got %v", expectedCounts, counts)
+	}
+}
+
+func TestDiffPaths(t *testing.T) {
+	diffs, err := Diff([]byte(`
+metadata:
+  annotations:
+    flux.weave.works/locked: "true"
+spec:
+  containers:
+  - name: app
+    image: app:v1
+`), []byte(`
+metadata:
+  annotations: {}
+spec:
+  containers:
+  - name: app
+    image: app:v2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Difference{
+		{Path: `metadata.annotations["flux.weave.works/locked"]`, Git: "true"},
+		{Path: "spec.containers[0].image", Git: "app:v1", Cluster: "app:v2"},
+	}
+	if !reflect.DeepEqual(expected, diffs) {
+		t.Errorf("expected %#v, got %#v", expected, diffs)
+	}
+}
+
+func TestDiffQuantities(t *testing.T) {
+	diffs, err := Diff([]byte(`
+spec:
+  containers:
+  - name: app
+    resources:
+      limits:
+        cpu: 0.5
+        memory: 1Gi
+      requests:
+        cpu: 100m
+        memory: 128Mi
+`), []byte(`
+spec:
+  containers:
+  - name: app
+    resources:
+      limits:
+        cpu: 500m
+        memory: 1024Mi
+      requests:
+        cpu: 200m
+        memory: "134217728"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Difference{
+		{Path: "spec.containers[0].resources.requests.cpu", Git: "100m", Cluster: "200m"},
+	}
+	if !reflect.DeepEqual(expected, diffs) {
+		t.Errorf("expected %#v, got %#v", expected, diffs)
+	}
+}
@@ -24,6 +24,8 @@ const (
 	EventLock         = "lock"
 	EventUnlock       = "unlock"
 	EventUpdatePolicy = "update_policy"
+	EventFrozen       = "frozen"
+	EventStageFailed  = "stage_failed"
 
 	// This is used to label e.g., commits that we _don't_ consider an event in themselves.
 	NoneOfTheAbove = "other"
@@ -154,7 +156,20 @@ func (e Event) String() string {
 		if len(strServiceIDs) > 0 {
 			svcStr = strings.Join(strServiceIDs, ", ")
 		}
-		return fmt.Sprintf("Sync: %s, %s", revStr, svcStr)
+		var failed []string
+		for _, r := range metadata.Rollouts {
+			if r.Outcome != RolloutReady {
+				failed = append(failed, r.ID.String())
+			}
+		}
+		prefix := "Sync"
+		if metadata.Source != "" {
+			prefix = fmt.Sprintf("Sync (%s)", metadata.Source)
+		}
+		if len(failed) > 0 {
+			return fmt.Sprintf("%s: %s, %s; rollout failed: %s", prefix, revStr, svcStr, strings.Join(failed, ", "))
+		}
+		return fmt.Sprintf("%s: %s, %s", prefix, revStr, svcStr)
 	case EventAutomate:
 		return fmt.Sprintf("Automated: %s", strings.Join(strServiceIDs, ", "))
 	case EventDeautomate:
@@ -165,6 +180,15 @@ func (e Event) String() string {
 		return fmt.Sprintf("Unlocked: %s", strings.Join(strServiceIDs, ", "))
 	case EventUpdatePolicy:
 		return fmt.Sprintf("Updated policies: %s", strings.Join(strServiceIDs, ", "))
+	case EventFrozen:
+		metadata := e.Metadata.(*FrozenEventMetadata)
+		if metadata.Spec == nil || metadata.Spec.Type == update.Auto {
+			return fmt.Sprintf("Automated release deferred by freeze: %s", strings.Join(strServiceIDs, ", "))
+		}
+		return fmt.Sprintf("Release rejected by freeze: %s", strings.Join(strServiceIDs, ", "))
+	case EventStageFailed:
+		metadata := e.Metadata.(*StageFailedEventMetadata)
+		return fmt.Sprintf("Staged release halted at stage %d of %d: %s", metadata.Stage, metadata.Stages, strings.Join(strServiceIDs, ", "))
 	default:
 		return fmt.Sprintf("Unknown event: %s", e.Type)
 	}
@@ -203,8 +227,28 @@ type ResourceError struct {
 	Error string
 }
 
+// Outcomes of waiting for a workload to roll out
+const (
+	RolloutReady   = "ready"
+	RolloutFailed  = "failed"
+	RolloutTimeout = "timeout"
+)
+
+// RolloutResult records how a workload changed by a sync fared in
+// rolling out.
+type RolloutResult struct {
+	ID       flux.ResourceID `json:"id"`
+	Outcome  string          `json:"outcome"`
+	Messages []string        `json:"messages,omitempty"`
+	// `true` if the workload was rolled back to its definition at the
+	// previously synced revision
+	RolledBack bool `json:"rolledBack,omitempty"`
+}
+
 // SyncEventMetadata is the metadata for when new a commit is synced to the cluster
 type SyncEventMetadata struct {
+	// The name of the git source synced, if not the main repo
+	Source string `json:"source,omitempty"`
 	// for parsing old events; Commits is now used in preference
 	Revs    []string `json:"revisions,omitempty"`
 	Commits []Commit `json:"commits,omitempty"`
@@ -214,6 +258,15 @@ type SyncEventMetadata struct {
 	Includes map[string]bool `json:"includes,omitempty"`
 	// Per-resource errors
 	Errors []ResourceError `json:"errors,omitempty"`
+	// Resources deleted from the cluster because they were removed
+	// from the repo
+	Deleted []flux.ResourceID `json:"deleted,omitempty"`
+	// What the sync did to each resource: "created", "configured",
+	// "unchanged" or "deleted"
+	Outcomes map[flux.ResourceID]string `json:"outcomes,omitempty"`
+	// How the workloads changed by the sync fared in rolling out, if
+	// fluxd waited for them
+	Rollouts []RolloutResult `json:"rollouts,omitempty"`
 	// `true` if we have no record of having synced before
 	InitialSync bool `json:"initialSync,omitempty"`
 }
@@ -315,6 +368,32 @@ type AutoReleaseEventMetadata struct {
 	Spec update.Automated `json:"spec"`
 }
 
+// FrozenEventMetadata is for when releases are not made because
+// releases are frozen; either a release that was asked for is
+// rejected, or an automated release is deferred. The controllers
+// frozen have the status skipped, with the reason update.Frozen.
+type FrozenEventMetadata struct {
+	// The release asked for, if there was one
+	Spec   *update.Spec  `json:"spec,omitempty"`
+	Result update.Result `json:"result"`
+}
+
+// StageFailedEventMetadata is for when a stage of a staged automated
+// release fails, which halts the release; the stages after it are not
+// released.
+type StageFailedEventMetadata struct {
+	// The stage that failed, counting from one, and how many there
+	// were in all
+	Stage  int `json:"stage"`
+	Stages int `json:"stages"`
+	// The revision the stage was committed as, if it got that far
+	Revision string `json:"revision,omitempty"`
+	// Why the stage failed, if it wasn't down to rolling out
+	Error string `json:"error,omitempty"`
+	// How the workloads in the stage fared in rolling out
+	Rollouts []RolloutResult `json:"rollouts,omitempty"`
+}
+
 type UnknownEventMetadata map[string]interface{}
 
 func (e *Event) UnmarshalJSON(in []byte) error {
@@ -364,6 +443,20 @@ func (e *Event) UnmarshalJSON(in []byte) error {
 		}
 		e.Metadata = &metadata
 		break
+	case EventFrozen:
+		var metadata FrozenEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
+	case EventStageFailed:
+		var metadata StageFailedEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
 	default:
 		if len(wireEvent.MetadataBytes) > 0 {
 			var metadata UnknownEventMetadata
@@ -403,6 +496,14 @@ func (rem *AutoReleaseEventMetadata) Type() string {
 	return EventAutoRelease
 }
 
+func (fem *FrozenEventMetadata) Type() string {
+	return EventFrozen
+}
+
+func (sem *StageFailedEventMetadata) Type() string {
+	return EventStageFailed
+}
+
 // Special exception from pointer receiver rule, as UnknownEventMetadata is a
 // type alias for a map
 func (uem UnknownEventMetadata) Type() string {
@@ -95,3 +95,31 @@ func TestEvent_ParseOldReleaseMetaData(t *testing.T) {
 		t.Error("expected service specs of len 1")
 	}
 }
+
+func TestEvent_ParseFrozenMetadata(t *testing.T) {
+	origEvent := Event{
+		Type: EventFrozen,
+		Metadata: &FrozenEventMetadata{
+			Result: update.Result{},
+		},
+	}
+
+	bytes, _ := json.Marshal(origEvent)
+
+	e := Event{}
+	err := e.UnmarshalJSON(bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch r := e.Metadata.(type) {
+	case *FrozenEventMetadata:
+		if r.Spec != nil {
+			t.Fatal("Frozen event wasn't marshalled/unmarshalled")
+		}
+	default:
+		t.Fatal("Wrong event type unmarshalled")
+	}
+	if s := e.String(); s != "Automated release deferred by freeze: " {
+		t.Fatalf("Unexpected event string %q", s)
+	}
+}
@@ -0,0 +1,238 @@
+// Package freeze keeps track of the times when releases are not
+// allowed, either in particular namespaces or for the whole repo.
+// There are recurring freeze windows, given to the daemon as
+// schedules, and ad-hoc freezes, set until a given time.
+package freeze
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxWindowDuration is the longest a freeze window can last. A
+// window found to be in effect ends this long after it started, at
+// most.
+const MaxWindowDuration = 31 * 24 * time.Hour
+
+// Window is a recurring period during which releases are frozen,
+// which starts at each time given by the schedule and lasts for the
+// duration given.
+type Window struct {
+	// The namespace frozen; empty means all namespaces
+	Namespace string
+	Schedule  Schedule
+	Duration  time.Duration
+}
+
+// ParseWindow parses a freeze window given as
+//
+//	[<namespace>:]<schedule> for <duration>
+//
+// e.g., "production:0 18 * * mon-fri for 15h". The schedule is
+// interpreted in UTC.
+func ParseWindow(spec string) (Window, error) {
+	var w Window
+	s := strings.TrimSpace(spec)
+	if i := strings.Index(s, ":"); i >= 0 && !strings.ContainsAny(s[:i], " \t") {
+		w.Namespace, s = s[:i], s[i+1:]
+	}
+	i := strings.LastIndex(s, " for ")
+	if i < 0 {
+		return Window{}, fmt.Errorf("freeze window %q: expected \"<schedule> for <duration>\"", spec)
+	}
+	schedule, err := ParseSchedule(s[:i])
+	if err != nil {
+		return Window{}, fmt.Errorf("freeze window %q: %s", spec, err)
+	}
+	duration, err := time.ParseDuration(strings.TrimSpace(s[i+len(" for "):]))
+	if err != nil {
+		return Window{}, fmt.Errorf("freeze window %q: %s", spec, err)
+	}
+	if duration < time.Minute || duration > MaxWindowDuration {
+		return Window{}, fmt.Errorf("freeze window %q: duration must be between 1m and %s", spec, MaxWindowDuration)
+	}
+	w.Schedule, w.Duration = schedule, duration
+	return w, nil
+}
+
+// Until gives the time the window ends, if it is in effect at the
+// time given. If more than one of its start times is within the
+// duration, the window lasts until the latest of them has passed.
+func (w Window) Until(now time.Time) (time.Time, bool) {
+	now = now.UTC()
+	start, ok := w.Schedule.latest(now, now.Add(-w.Duration))
+	if !ok {
+		return time.Time{}, false
+	}
+	return start.Add(w.Duration), true
+}
+
+func (w Window) String() string {
+	s := fmt.Sprintf("%s for %s", w.Schedule, w.Duration)
+	if w.Namespace != "" {
+		return w.Namespace + ":" + s
+	}
+	return s
+}
+
+// Freeze is a freeze on releases, either an ad-hoc freeze, or a
+// freeze window.
+type Freeze struct {
+	// The namespace frozen; empty means all namespaces
+	Namespace string `json:",omitempty"`
+	// The freeze window, if this is a freeze window rather than an
+	// ad-hoc freeze
+	Window string `json:",omitempty"`
+	// When the freeze ends; for a window, this is zero when the window
+	// is not in effect
+	Until time.Time
+	// Who set an ad-hoc freeze, and why
+	User   string `json:",omitempty"`
+	Reason string `json:",omitempty"`
+}
+
+// Applies says whether the freeze applies to the namespace given.
+func (f Freeze) Applies(namespace string) bool {
+	return f.Namespace == "" || f.Namespace == namespace
+}
+
+func (f Freeze) String() string {
+	scope := "all namespaces"
+	if f.Namespace != "" {
+		scope = "namespace " + f.Namespace
+	}
+	s := fmt.Sprintf("%s frozen until %s", scope, f.Until.Format(time.RFC3339))
+	if f.Window != "" {
+		s += fmt.Sprintf(" (window %q)", f.Window)
+	}
+	if f.Reason != "" {
+		s += ": " + f.Reason
+	}
+	return s
+}
+
+// Store keeps the ad-hoc freezes somewhere they outlast the daemon,
+// so that they stay in force if it restarts.
+type Store interface {
+	Load() ([]Freeze, error)
+	Save([]Freeze) error
+}
+
+// Freezes holds the freeze windows and ad-hoc freezes in force. The
+// ad-hoc freezes can be changed concurrently. A nil *Freezes has no
+// freezes.
+type Freezes struct {
+	windows []Window
+
+	mu    sync.Mutex
+	adhoc map[string]Freeze
+	store Store
+}
+
+// New gives a set of freezes with the windows given, and no ad-hoc
+// freezes.
+func New(windows ...Window) *Freezes {
+	return &Freezes{windows: windows}
+}
+
+// Restore loads the ad-hoc freezes still in effect from the store
+// given, and saves them there whenever they are set from now on.
+func (fs *Freezes) Restore(store Store, now time.Time) error {
+	freezes, err := store.Load()
+	if err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.adhoc = map[string]Freeze{}
+	for _, f := range freezes {
+		if f.Until.After(now) {
+			f.Window = ""
+			fs.adhoc[f.Namespace] = f
+		}
+	}
+	fs.store = store
+	return nil
+}
+
+// Set sets the ad-hoc freeze for its namespace (or all namespaces),
+// replacing any there was. A freeze with an `Until` in the past
+// removes the ad-hoc freeze. If there's a store, the freezes are
+// saved to it before they take effect; if that fails, they are left
+// as they were.
+func (fs *Freezes) Set(f Freeze, now time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	adhoc := map[string]Freeze{}
+	for ns, f := range fs.adhoc {
+		if f.Until.After(now) {
+			adhoc[ns] = f
+		}
+	}
+	f.Window = ""
+	if f.Until.After(now) {
+		adhoc[f.Namespace] = f
+	} else {
+		delete(adhoc, f.Namespace)
+	}
+
+	if fs.store != nil {
+		var freezes []Freeze
+		for _, f := range adhoc {
+			freezes = append(freezes, f)
+		}
+		sort.Slice(freezes, func(i, j int) bool {
+			return freezes[i].Namespace < freezes[j].Namespace
+		})
+		if err := fs.store.Save(freezes); err != nil {
+			return err
+		}
+	}
+	fs.adhoc = adhoc
+	return nil
+}
+
+// Frozen gives the freeze in effect for the namespace given, at the
+// time given, if there is one. If more than one is in effect, it
+// gives the one that lasts longest.
+func (fs *Freezes) Frozen(namespace string, now time.Time) (Freeze, bool) {
+	var frozen Freeze
+	var ok bool
+	for _, f := range fs.List(now) {
+		if f.Applies(namespace) && f.Until.After(now) && (!ok || f.Until.After(frozen.Until)) {
+			frozen, ok = f, true
+		}
+	}
+	return frozen, ok
+}
+
+// List gives all the freeze windows, and the ad-hoc freezes still in
+// effect at the time given.
+func (fs *Freezes) List(now time.Time) []Freeze {
+	if fs == nil {
+		return nil
+	}
+	var res []Freeze
+	for _, w := range fs.windows {
+		until, _ := w.Until(now)
+		res = append(res, Freeze{Namespace: w.Namespace, Window: w.String(), Until: until})
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var adhoc []Freeze
+	for ns, f := range fs.adhoc {
+		if !f.Until.After(now) {
+			delete(fs.adhoc, ns)
+			continue
+		}
+		adhoc = append(adhoc, f)
+	}
+	sort.Slice(adhoc, func(i, j int) bool {
+		return adhoc[i].Namespace < adhoc[j].Namespace
+	})
+	return append(res, adhoc...)
+}
@@ -0,0 +1,223 @@
+package freeze
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseSchedule(t *testing.T) {
+	for spec, cases := range map[string]map[string]bool{
+		"* * * * *": {
+			"2018-12-24T10:11:00Z": true,
+		},
+		"30 9 * * *": {
+			"2018-12-24T09:30:00Z": true,
+			"2018-12-24T09:31:00Z": false,
+			"2018-12-24T10:30:00Z": false,
+		},
+		"*/15 9-17 * * mon-fri": {
+			"2018-12-24T09:45:00Z": true,  // Monday
+			"2018-12-24T09:40:00Z": false, // not a quarter hour
+			"2018-12-24T18:00:00Z": false, // after hours
+			"2018-12-22T10:00:00Z": false, // Saturday
+		},
+		"0 0 25 dec *": {
+			"2018-12-25T00:00:00Z": true,
+			"2018-11-25T00:00:00Z": false,
+		},
+		"0 0 1,15 * 7": {
+			"2018-12-01T00:00:00Z": true,  // the 1st
+			"2018-12-02T00:00:00Z": true,  // Sunday
+			"2018-12-03T00:00:00Z": false, // neither
+		},
+		"0 5/6 * * *": {
+			"2018-12-24T05:00:00Z": true,
+			"2018-12-24T11:00:00Z": true,
+			"2018-12-24T06:00:00Z": false,
+		},
+	} {
+		s, err := ParseSchedule(spec)
+		if !assert.NoError(t, err, spec) {
+			continue
+		}
+		for at, expected := range cases {
+			assert.Equal(t, expected, s.Matches(mustParseTime(at)), "%s at %s", spec, at)
+		}
+	}
+
+	for _, invalid := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * foo *", "5-1 * * * *", "*/0 * * * *", "* * * * 8"} {
+		_, err := ParseSchedule(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	w, err := ParseWindow("production:0 18 * * mon-fri for 15h")
+	assert.NoError(t, err)
+	assert.Equal(t, "production", w.Namespace)
+	assert.Equal(t, 15*time.Hour, w.Duration)
+	assert.Equal(t, "production:0 18 * * mon-fri for 15h0m0s", w.String())
+
+	w, err = ParseWindow("0 0 * * sat for 48h")
+	assert.NoError(t, err)
+	assert.Equal(t, "", w.Namespace)
+
+	for _, invalid := range []string{"0 18 * * *", "0 18 * * * for", "0 18 * * * for 10s", "0 18 * * * for 1000h", "ns:0 18 * * for 1h"} {
+		_, err := ParseWindow(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestWindow_Until(t *testing.T) {
+	// Weekday evenings and nights, 18:00-09:00
+	w, err := ParseWindow("0 18 * * mon-fri for 15h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	until, ok := w.Until(mustParseTime("2018-12-24T20:00:00Z"))
+	assert.True(t, ok)
+	assert.Equal(t, mustParseTime("2018-12-25T09:00:00Z"), until)
+
+	until, ok = w.Until(mustParseTime("2018-12-25T08:59:00Z"))
+	assert.True(t, ok)
+	assert.Equal(t, mustParseTime("2018-12-25T09:00:00Z"), until)
+
+	_, ok = w.Until(mustParseTime("2018-12-25T09:00:00Z"))
+	assert.False(t, ok)
+	_, ok = w.Until(mustParseTime("2018-12-25T17:59:00Z"))
+	assert.False(t, ok)
+}
+
+func TestFreezes(t *testing.T) {
+	now := mustParseTime("2018-12-24T12:00:00Z")
+	w, err := ParseWindow("production:0 18 * * * for 15h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := New(w)
+
+	_, ok := fs.Frozen("production", now)
+	assert.False(t, ok)
+	f, ok := fs.Frozen("production", now.Add(7*time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, w.String(), f.Window)
+	_, ok = fs.Frozen("staging", now.Add(7*time.Hour))
+	assert.False(t, ok)
+
+	// An ad-hoc freeze for all namespaces
+	fs.Set(Freeze{Until: now.Add(time.Hour), User: "someone", Reason: "holidays"}, now)
+	f, ok = fs.Frozen("staging", now)
+	assert.True(t, ok)
+	assert.Equal(t, "holidays", f.Reason)
+	assert.Len(t, fs.List(now), 2)
+
+	// ... which runs out
+	_, ok = fs.Frozen("staging", now.Add(2*time.Hour))
+	assert.False(t, ok)
+	assert.Len(t, fs.List(now.Add(2*time.Hour)), 1)
+
+	// ... or can be lifted
+	fs.Set(Freeze{Until: now.Add(time.Hour)}, now)
+	fs.Set(Freeze{}, now)
+	_, ok = fs.Frozen("staging", now)
+	assert.False(t, ok)
+
+	// The freeze that lasts longest is given
+	fs.Set(Freeze{Namespace: "production", Until: now.Add(30 * time.Hour)}, now)
+	f, ok = fs.Frozen("production", now.Add(7*time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, "", f.Window)
+
+	var none *Freezes
+	_, ok = none.Frozen("production", now)
+	assert.False(t, ok)
+}
+
+type memStore struct {
+	freezes []Freeze
+	err     error
+}
+
+func (s *memStore) Load() ([]Freeze, error) {
+	return s.freezes, s.err
+}
+
+func (s *memStore) Save(freezes []Freeze) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.freezes = freezes
+	return nil
+}
+
+func TestFreezes_Store(t *testing.T) {
+	now := mustParseTime("2018-12-24T12:00:00Z")
+	store := &memStore{freezes: []Freeze{
+		{Namespace: "production", Until: now.Add(time.Hour), Reason: "holidays"},
+		{Namespace: "staging", Until: now.Add(-time.Hour)},
+	}}
+
+	// Freezes still in effect are restored
+	fs := New()
+	assert.NoError(t, fs.Restore(store, now))
+	f, ok := fs.Frozen("production", now)
+	assert.True(t, ok)
+	assert.Equal(t, "holidays", f.Reason)
+	_, ok = fs.Frozen("staging", now)
+	assert.False(t, ok)
+
+	// ... and freezes set are saved
+	assert.NoError(t, fs.Set(Freeze{Until: now.Add(2 * time.Hour)}, now))
+	assert.NoError(t, fs.Set(Freeze{Namespace: "production"}, now))
+	assert.Equal(t, []Freeze{{Until: now.Add(2 * time.Hour)}}, store.freezes)
+
+	// A freeze that can't be saved doesn't take effect
+	store.err = errors.New("unavailable")
+	assert.Error(t, fs.Set(Freeze{Namespace: "production", Until: now.Add(time.Hour)}, now))
+	assert.Equal(t, []Freeze{{Until: now.Add(2 * time.Hour)}}, fs.List(now))
+}
+
+// Until is worked out from the schedule, rather than by looking at
+// each minute in the window; it should agree with doing that.
+func TestWindow_UntilAgreesWithScan(t *testing.T) {
+	scan := func(w Window, now time.Time) (time.Time, bool) {
+		for t := now.Truncate(time.Minute); now.Sub(t) < w.Duration; t = t.Add(-time.Minute) {
+			if w.Schedule.Matches(t) {
+				return t.Add(w.Duration), true
+			}
+		}
+		return time.Time{}, false
+	}
+	for _, spec := range []string{
+		"0 18 * * mon-fri for 15h",
+		"*/20 9-17 * * * for 5m",
+		"30 23 31 * * for 72h",
+		"59 * 1,15 feb,mar sun for 90m",
+		"0 0 29 2 * for 240h",
+		"* * * * * for 1m",
+	} {
+		w, err := ParseWindow(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := mustParseTime("2019-12-28T00:00:00Z")
+		for now := start; now.Before(start.AddDate(0, 3, 0)); now = now.Add(97*time.Minute + 13*time.Second) {
+			expected, expectedOK := scan(w, now)
+			until, ok := w.Until(now)
+			if ok != expectedOK || !until.Equal(expected) {
+				t.Fatalf("%s at %s: expected %s, %v; got %s, %v", spec, now, expected, expectedOK, until, ok)
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package freeze
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule is a cron-like schedule, given as the five fields
+// "minute hour day-of-month month day-of-week". Each field is `*`, or
+// a comma-separated list of values or ranges (`a-b`), either of which
+// may have a step (`*/n`, `a-b/n`). Months and days of the week may
+// be given by their three-letter English names. As with cron, if both
+// the day of the month and the day of the week are restricted, a time
+// matches if either does.
+type Schedule struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12,
+		names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	dowField = field{name: "day of week", min: 0, max: 7,
+		names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// ParseSchedule parses a schedule in the form described for
+// Schedule.
+func ParseSchedule(spec string) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("schedule %q: expected 5 fields, got %d", spec, len(fields))
+	}
+	s := Schedule{spec: strings.Join(fields, " ")}
+	var err error
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return Schedule{}, errors.Wrapf(err, "schedule %q", spec)
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return Schedule{}, errors.Wrapf(err, "schedule %q", spec)
+	}
+	if s.dom, err = domField.parse(fields[2]); err != nil {
+		return Schedule{}, errors.Wrapf(err, "schedule %q", spec)
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return Schedule{}, errors.Wrapf(err, "schedule %q", spec)
+	}
+	if s.dow, err = dowField.parse(fields[4]); err != nil {
+		return Schedule{}, errors.Wrapf(err, "schedule %q", spec)
+	}
+	// Sunday can be given as 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = fields[2] == "*"
+	s.dowStar = fields[4] == "*"
+	return s, nil
+}
+
+func (f field) parse(expr string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(expr, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %s %q", f.name, part)
+			}
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			i := strings.Index(rng, "-")
+			var err error
+			if lo, err = f.value(rng[:i]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(rng[i+1:]); err != nil {
+				return 0, err
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range in %s %q", f.name, part)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rng); err != nil {
+				return 0, err
+			}
+			// `a/n` means every n from a
+			if rng == part {
+				hi = lo
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q; expected %d-%d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Matches says whether the minute of the time given is in the
+// schedule.
+func (s Schedule) Matches(t time.Time) bool {
+	return s.minute&(1<<uint(t.Minute())) != 0 &&
+		s.hour&(1<<uint(t.Hour())) != 0 &&
+		s.dayMatches(t)
+}
+
+// latest gives the latest minute at or before the time given that is
+// in the schedule, as long as it's after the time `after`. Rather
+// than looking at each minute in turn, it skips whole days and hours
+// that aren't in the schedule.
+func (s Schedule) latest(t, after time.Time) (time.Time, bool) {
+	t = t.UTC().Truncate(time.Minute)
+	for t.After(after) {
+		switch {
+		case !s.dayMatches(t):
+			// the last minute of the day before
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Add(-time.Minute)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			// the last minute of the hour before
+			t = t.Truncate(time.Hour).Add(-time.Minute)
+		default:
+			// the latest minute in the schedule, in this hour
+			minutes := s.minute & (1<<uint(t.Minute()+1) - 1)
+			if minutes == 0 {
+				t = t.Truncate(time.Hour).Add(-time.Minute)
+				continue
+			}
+			t = t.Truncate(time.Hour).Add(time.Duration(bits.Len64(minutes)-1) * time.Minute)
+			if !t.After(after) {
+				return time.Time{}, false
+			}
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// dayMatches says whether the day of the time given is in the
+// schedule.
+func (s Schedule) dayMatches(t time.Time) bool {
+	if s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func (s Schedule) String() string {
+	return s.spec
+}
@@ -66,6 +66,62 @@ func TestCommit(t *testing.T) {
 	}
 }
 
+func TestCommitAndPushBranch(t *testing.T) {
+	checkout, repo, cleanup := CheckoutWithConfig(t, TestConfig)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	before, err := checkout.HeadRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, _ := range testfiles.Files {
+		path := filepath.Join(checkout.ManifestDirs()[0], file)
+		if err := ioutil.WriteFile(path, []byte("BRANCH CHANGE"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	expectedNote := Note{Comment: "On a branch"}
+	if err := checkout.CommitAndPushBranch(ctx, "flux-test-branch", git.CommitAction{Message: "Changed file on branch"}, &expectedNote); err != nil {
+		t.Fatal(err)
+	}
+	after, err := checkout.HeadRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// The branch has the commit, ...
+	branchRev, err := repo.Revision(ctx, "flux-test-branch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branchRev != after {
+		t.Errorf("expected branch to be at %s, got %s", after, branchRev)
+	}
+	// ... and the branch of the checkout doesn't.
+	headRev, err := repo.Revision(ctx, TestConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headRev != before {
+		t.Errorf("expected %s to stay at %s, got %s", TestConfig.Branch, before, headRev)
+	}
+
+	var note Note
+	if ok, err := checkout.GetNote(ctx, after, &note); !ok || err != nil {
+		t.Fatalf("expected note on branch commit, got %v, %v", ok, err)
+	}
+	if !reflect.DeepEqual(note, expectedNote) {
+		t.Errorf("note is not what we supplied when committing: %#v", note)
+	}
+}
+
 func TestCheckout(t *testing.T) {
 	repo, cleanup := Repo(t)
 	defer cleanup()
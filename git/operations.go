@@ -102,6 +102,14 @@ func push(ctx context.Context, workingDir, upstream string, refs []string) error
 	return nil
 }
 
+// deleteRef deletes the ref given from the repo in workingDir.
+func deleteRef(ctx context.Context, workingDir, ref string) error {
+	if err := execGitCmd(ctx, workingDir, nil, "update-ref", "-d", ref); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("git update-ref -d %s", ref))
+	}
+	return nil
+}
+
 // fetch updates refs from the upstream.
 func fetch(ctx context.Context, workingDir, upstream string, refspec ...string) error {
 	args := append([]string{"fetch", "--tags", upstream}, refspec...)
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"strings"
 	"sync"
 
 	"context"
@@ -223,6 +224,30 @@ func (r *Repo) CommitsBetween(ctx context.Context, ref1, ref2 string, paths ...s
 	return onelinelog(ctx, r.dir, ref1+".."+ref2, paths)
 }
 
+// DeleteBranch deletes the branch given from the upstream repo, if
+// it's there.
+func (r *Repo) DeleteBranch(ctx context.Context, branch string) error {
+	if r.readonly {
+		return ErrReadOnly
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.errorIfNotReady(); err != nil {
+		return err
+	}
+	ref := "refs/heads/" + branch
+	if ok, err := refExists(ctx, r.dir, ref); !ok || err != nil {
+		return err
+	}
+	// The branch may have been deleted upstream since it was last
+	// fetched, in which case there's nothing to push
+	if err := push(ctx, r.dir, r.origin.URL, []string{":" + ref}); err != nil &&
+		!strings.Contains(err.Error(), "remote ref does not exist") {
+		return PushError(r.origin.URL, err)
+	}
+	return deleteRef(ctx, r.dir, ref)
+}
+
 // step attempts to advance the repo state machine, and returns `true`
 // if it has made progress, `false` otherwise.
 func (r *Repo) step(bg context.Context) bool {
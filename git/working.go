@@ -117,6 +117,18 @@ func (c *Checkout) ManifestDirs() []string {
 // CommitAndPush commits changes made in this checkout, along with any
 // extra data as a note, and pushes the commit and note to the remote repo.
 func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction, note interface{}) error {
+	return c.commitAndPush(ctx, c.config.Branch, commitAction, note)
+}
+
+// CommitAndPushBranch commits changes made in this checkout, along
+// with any note given, and pushes the commit to the branch given
+// rather than the branch the checkout is of. The branch is
+// overwritten if it already exists upstream.
+func (c *Checkout) CommitAndPushBranch(ctx context.Context, branch string, commitAction CommitAction, note interface{}) error {
+	return c.commitAndPush(ctx, "+HEAD:refs/heads/"+branch, commitAction, note)
+}
+
+func (c *Checkout) commitAndPush(ctx context.Context, ref string, commitAction CommitAction, note interface{}) error {
 	if !check(ctx, c.dir, c.config.Paths) {
 		return ErrNoChanges
 	}
@@ -137,7 +149,7 @@ func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction,
 		}
 	}
 
-	refs := []string{c.config.Branch}
+	refs := []string{ref}
 	ok, err := refExists(ctx, c.dir, c.realNotesRef)
 	if ok {
 		refs = append(refs, c.realNotesRef)
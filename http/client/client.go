@@ -15,9 +15,11 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v12"
 	"github.com/weaveworks/flux/api/v6"
 	fluxerr "github.com/weaveworks/flux/errors"
 	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/freeze"
 	transport "github.com/weaveworks/flux/http"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/update"
@@ -115,6 +117,40 @@ func (c *Client) GitRepoConfig(ctx context.Context, regenerate bool) (v6.GitConf
 	return res, err
 }
 
+func (c *Client) SyncPlan(ctx context.Context) (v12.SyncPlan, error) {
+	var res v12.SyncPlan
+	err := c.Get(ctx, &res, transport.SyncPlan)
+	return res, err
+}
+
+func (c *Client) DriftReport(ctx context.Context) (v12.DriftReport, error) {
+	var res v12.DriftReport
+	err := c.Get(ctx, &res, transport.DriftReport)
+	return res, err
+}
+
+func (c *Client) ListPendingReleases(ctx context.Context) ([]v12.PendingRelease, error) {
+	var res []v12.PendingRelease
+	err := c.Get(ctx, &res, transport.ListPendingReleases)
+	return res, err
+}
+
+func (c *Client) ApproveRelease(ctx context.Context, id job.ID, cause update.Cause) (job.ID, error) {
+	var res job.ID
+	err := c.methodWithResp(ctx, "POST", &res, transport.ApproveRelease, cause, "id", string(id))
+	return res, err
+}
+
+func (c *Client) ListFreezes(ctx context.Context) ([]freeze.Freeze, error) {
+	var res []freeze.Freeze
+	err := c.Get(ctx, &res, transport.ListFreezes)
+	return res, err
+}
+
+func (c *Client) SetFreeze(ctx context.Context, f freeze.Freeze) error {
+	return c.PostWithBody(ctx, transport.SetFreeze, f)
+}
+
 // --- Request helpers
 
 // post is a simple query-param only post request
@@ -14,6 +14,7 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/freeze"
 	transport "github.com/weaveworks/flux/http"
 	"github.com/weaveworks/flux/job"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
@@ -57,6 +58,12 @@ func NewHandler(s api.Server, r *mux.Router) http.Handler {
 	r.Get(transport.SyncStatus).HandlerFunc(handle.SyncStatus)
 	r.Get(transport.Export).HandlerFunc(handle.Export)
 	r.Get(transport.GitRepoConfig).HandlerFunc(handle.GitRepoConfig)
+	r.Get(transport.SyncPlan).HandlerFunc(handle.SyncPlan)
+	r.Get(transport.DriftReport).HandlerFunc(handle.DriftReport)
+	r.Get(transport.ListPendingReleases).HandlerFunc(handle.ListPendingReleases)
+	r.Get(transport.ApproveRelease).HandlerFunc(handle.ApproveRelease)
+	r.Get(transport.ListFreezes).HandlerFunc(handle.ListFreezes)
+	r.Get(transport.SetFreeze).HandlerFunc(handle.SetFreeze)
 
 	// These handlers persist to support requests from older fluxctls. In general we
 	// should avoid adding references to them so that they can eventually be removed.
@@ -185,6 +192,70 @@ func (s HTTPServer) GitRepoConfig(w http.ResponseWriter, r *http.Request) {
 	transport.JSONResponse(w, r, res)
 }
 
+func (s HTTPServer) SyncPlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := s.server.SyncPlan(r.Context())
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, plan)
+}
+
+func (s HTTPServer) DriftReport(w http.ResponseWriter, r *http.Request) {
+	report, err := s.server.DriftReport(r.Context())
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, report)
+}
+
+func (s HTTPServer) ListPendingReleases(w http.ResponseWriter, r *http.Request) {
+	pending, err := s.server.ListPendingReleases(r.Context())
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, pending)
+}
+
+func (s HTTPServer) ApproveRelease(w http.ResponseWriter, r *http.Request) {
+	id := job.ID(mux.Vars(r)["id"])
+	var cause update.Cause
+	if err := json.NewDecoder(r.Body).Decode(&cause); err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	jobID, err := s.server.ApproveRelease(r.Context(), id, cause)
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, jobID)
+}
+
+func (s HTTPServer) ListFreezes(w http.ResponseWriter, r *http.Request) {
+	freezes, err := s.server.ListFreezes(r.Context())
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, freezes)
+}
+
+func (s HTTPServer) SetFreeze(w http.ResponseWriter, r *http.Request) {
+	var f freeze.Freeze
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.server.SetFreeze(r.Context(), f); err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 // --- handlers supporting deprecated requests
 
 func (s HTTPServer) UpdateImages(w http.ResponseWriter, r *http.Request) {
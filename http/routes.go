@@ -10,6 +10,12 @@ const (
 	SyncStatus              = "SyncStatus"
 	Export                  = "Export"
 	GitRepoConfig           = "GitRepoConfig"
+	SyncPlan                = "SyncPlan"
+	DriftReport             = "DriftReport"
+	ListPendingReleases     = "ListPendingReleases"
+	ApproveRelease          = "ApproveRelease"
+	ListFreezes             = "ListFreezes"
+	SetFreeze               = "SetFreeze"
 
 	UpdateImages           = "UpdateImages"
 	UpdatePolicies         = "UpdatePolicies"
@@ -24,5 +30,6 @@ var (
 	RegisterDaemonV9  = "RegisterDaemonV9"
 	RegisterDaemonV10 = "RegisterDaemonV10"
 	RegisterDaemonV11 = "RegisterDaemonV11"
+	RegisterDaemonV12 = "RegisterDaemonV12"
 	LogEvent          = "LogEvent"
 )
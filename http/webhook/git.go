@@ -0,0 +1,240 @@
+package webhook
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/git"
+)
+
+// GitHub and GitLab list at most this many commits in a push event
+const maxListedCommits = 20
+
+// push is what's common to the push events of git hosts.
+type push struct {
+	branches []string
+	// The files changed by the push, if known
+	files      []string
+	filesKnown bool
+}
+
+// pushFunc extracts a push from a git host webhook, or returns nil if
+// the webhook is for some other kind of event.
+type pushFunc func(header http.Header, payload []byte) (*push, error)
+
+// gitHook makes a handler for a kind of git host webhook, which
+// authenticates the request, then if it notifies a push that's
+// relevant to the configured branch and paths, or those of a sync
+// source, notifies the daemon.
+func (rcv *Receiver) gitHook(auth authFunc, pushes pushFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := readPayload(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !auth(r, payload, rcv.GitSecret) {
+			http.Error(w, "webhook failed authentication", http.StatusUnauthorized)
+			return
+		}
+		p, err := pushes(r.Header, payload)
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "parsing webhook payload").Error(), http.StatusBadRequest)
+			return
+		}
+		if p == nil {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		// Pushes aren't told apart by repo, since there are too many
+		// ways of writing its URL; a push relevant to more than one
+		// of the repos is acted on for each
+		if relevant(p, rcv.GitConfig) {
+			rcv.Logger.Log("webhook", r.URL.Path, "branch", rcv.GitConfig.Branch, "msg", "notified of push")
+			rcv.GitNotify()
+		}
+		var names []string
+		for name := range rcv.GitSources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if conf := rcv.GitSources[name]; relevant(p, conf) {
+				rcv.Logger.Log("webhook", r.URL.Path, "source", name, "branch", conf.Branch, "msg", "notified of push")
+				rcv.SourceNotify(name)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// relevant says whether a push is to the branch of the config given,
+// and changes files under its paths. If the files changed aren't
+// known, it's assumed they might be relevant.
+func relevant(p *push, conf git.Config) bool {
+	var toBranch bool
+	for _, b := range p.branches {
+		if b == conf.Branch {
+			toBranch = true
+			break
+		}
+	}
+	if !toBranch {
+		return false
+	}
+	if !p.filesKnown || len(conf.Paths) == 0 {
+		return true
+	}
+	for _, f := range p.files {
+		for _, dir := range conf.Paths {
+			dir = path.Clean(dir)
+			if dir == "." || f == dir || strings.HasPrefix(f, dir+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The push events of GitHub, GitLab and Gitea share this much.
+type pushEvent struct {
+	Ref     string `json:"ref"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
+	} `json:"commits"`
+	// GitLab only includes the first few commits, and says how many
+	// there were in total
+	TotalCommitsCount int `json:"total_commits_count"`
+}
+
+func parsePushEvent(payload []byte) (*push, error) {
+	var event pushEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	// Without commits (e.g., for a forced push), or with what may be
+	// only some of them, the files changed can't be known
+	p := &push{
+		filesKnown: len(event.Commits) > 0 &&
+			len(event.Commits) < maxListedCommits &&
+			event.TotalCommitsCount <= len(event.Commits),
+	}
+	if strings.HasPrefix(event.Ref, "refs/heads/") {
+		p.branches = []string{strings.TrimPrefix(event.Ref, "refs/heads/")}
+	}
+	for _, c := range event.Commits {
+		p.files = append(p.files, c.Added...)
+		p.files = append(p.files, c.Removed...)
+		p.files = append(p.files, c.Modified...)
+	}
+	return p, nil
+}
+
+// githubAuth expects the payload to be signed with HMAC-SHA256, or
+// failing that HMAC-SHA1, as GitHub does.
+func githubAuth(r *http.Request, payload []byte, secret string) bool {
+	if signature := r.Header.Get("X-Hub-Signature-256"); signature != "" {
+		return validHMAC(signature, "sha256=", sha256.New, payload, secret)
+	}
+	return validHMAC(r.Header.Get("X-Hub-Signature"), "sha1=", sha1.New, payload, secret)
+}
+
+func githubPushes(header http.Header, payload []byte) (*push, error) {
+	if header.Get("X-GitHub-Event") != "push" {
+		return nil, nil
+	}
+	return parsePushEvent(payload)
+}
+
+// gitlabAuth expects the secret as the header X-Gitlab-Token, as
+// GitLab sends it.
+func gitlabAuth(r *http.Request, _ []byte, secret string) bool {
+	return secretEqual(r.Header.Get("X-Gitlab-Token"), secret)
+}
+
+func gitlabPushes(header http.Header, payload []byte) (*push, error) {
+	if header.Get("X-Gitlab-Event") != "Push Hook" {
+		return nil, nil
+	}
+	return parsePushEvent(payload)
+}
+
+// giteaAuth expects the header X-Gitea-Signature to be the
+// hex-encoded HMAC-SHA256 of the payload, as Gitea sends it.
+func giteaAuth(r *http.Request, payload []byte, secret string) bool {
+	return validHMAC(r.Header.Get("X-Gitea-Signature"), "", sha256.New, payload, secret)
+}
+
+func giteaPushes(header http.Header, payload []byte) (*push, error) {
+	if header.Get("X-Gitea-Event") != "push" {
+		return nil, nil
+	}
+	return parsePushEvent(payload)
+}
+
+// bitbucketAuth expects the payload to be signed with HMAC-SHA256, as
+// Bitbucket Server does; or, since Bitbucket Cloud can't sign
+// webhooks, the secret as the query parameter `token`.
+func bitbucketAuth(r *http.Request, payload []byte, secret string) bool {
+	if signature := r.Header.Get("X-Hub-Signature"); signature != "" {
+		return validHMAC(signature, "sha256=", sha256.New, payload, secret)
+	}
+	return tokenAuth(r, payload, secret)
+}
+
+// Bitbucket doesn't say which files a push changed; Bitbucket Cloud
+// and Bitbucket Server have different payloads, but both say which
+// branches were changed.
+func bitbucketPushes(header http.Header, payload []byte) (*push, error) {
+	switch header.Get("X-Event-Key") {
+	case "repo:push":
+		var event struct {
+			Push struct {
+				Changes []struct {
+					New struct {
+						Type string `json:"type"`
+						Name string `json:"name"`
+					} `json:"new"`
+				} `json:"changes"`
+			} `json:"push"`
+		}
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		p := &push{}
+		for _, c := range event.Push.Changes {
+			if c.New.Type == "branch" {
+				p.branches = append(p.branches, c.New.Name)
+			}
+		}
+		return p, nil
+	case "repo:refs_changed":
+		var event struct {
+			Changes []struct {
+				Ref struct {
+					ID string `json:"id"`
+				} `json:"ref"`
+			} `json:"changes"`
+		}
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		p := &push{}
+		for _, c := range event.Changes {
+			if strings.HasPrefix(c.Ref.ID, "refs/heads/") {
+				p.branches = append(p.branches, strings.TrimPrefix(c.Ref.ID, "refs/heads/"))
+			}
+		}
+		return p, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,213 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/git"
+)
+
+func setupGit(paths ...string) (http.Handler, *int) {
+	var notified int
+	return NewHandler(&Receiver{
+		GitSecret: secret,
+		GitConfig: git.Config{Branch: "master", Paths: paths},
+		GitNotify: func() { notified++ },
+		Logger:    log.NewNopLogger(),
+	}, NewRouter()), &notified
+}
+
+func signWith(header, prefix string, newHash func() hash.Hash, payload string) http.Header {
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write([]byte(payload))
+	return http.Header{header: {prefix + hex.EncodeToString(mac.Sum(nil))}}
+}
+
+func withHeader(h http.Header, k, v string) http.Header {
+	h.Set(k, v)
+	return h
+}
+
+const (
+	pushToMaster = `{"ref":"refs/heads/master","commits":[{"added":["deploy/app.yaml"],"removed":[],"modified":["README.md"]}]}`
+	pushToOther  = `{"ref":"refs/heads/feature","commits":[{"added":["deploy/app.yaml"],"removed":[],"modified":[]}]}`
+	pushOutside  = `{"ref":"refs/heads/master","commits":[{"added":[],"removed":[],"modified":["README.md"]}]}`
+)
+
+func TestGitHooks(t *testing.T) {
+	for _, v := range []struct {
+		name     string
+		path     string
+		payload  string
+		header   http.Header
+		status   int
+		notified int
+	}{
+		{
+			name:     "GitHub",
+			path:     "/hook/git/github",
+			payload:  pushToMaster,
+			header:   withHeader(signWith("X-Hub-Signature-256", "sha256=", sha256.New, pushToMaster), "X-GitHub-Event", "push"),
+			status:   http.StatusOK,
+			notified: 1,
+		},
+		{
+			name:     "GitHub, SHA1 signature",
+			path:     "/hook/git/github",
+			payload:  pushToMaster,
+			header:   withHeader(signWith("X-Hub-Signature", "sha1=", sha1.New, pushToMaster), "X-GitHub-Event", "push"),
+			status:   http.StatusOK,
+			notified: 1,
+		},
+		{
+			name:    "GitHub, wrong signature",
+			path:    "/hook/git/github",
+			payload: pushToMaster,
+			header:  withHeader(signWith("X-Hub-Signature-256", "sha256=", sha256.New, pushToOther), "X-GitHub-Event", "push"),
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "GitHub, ping",
+			path:    "/hook/git/github",
+			payload: `{"zen":"Keep it logically awesome."}`,
+			header:  withHeader(signWith("X-Hub-Signature-256", "sha256=", sha256.New, `{"zen":"Keep it logically awesome."}`), "X-GitHub-Event", "ping"),
+			status:  http.StatusOK,
+		},
+		{
+			name:    "GitHub, other branch",
+			path:    "/hook/git/github",
+			payload: pushToOther,
+			header:  withHeader(signWith("X-Hub-Signature-256", "sha256=", sha256.New, pushToOther), "X-GitHub-Event", "push"),
+			status:  http.StatusOK,
+		},
+		{
+			name:    "GitHub, outside paths",
+			path:    "/hook/git/github",
+			payload: pushOutside,
+			header:  withHeader(signWith("X-Hub-Signature-256", "sha256=", sha256.New, pushOutside), "X-GitHub-Event", "push"),
+			status:  http.StatusOK,
+		},
+		{
+			name:     "GitLab",
+			path:     "/hook/git/gitlab",
+			payload:  pushToMaster,
+			header:   http.Header{"X-Gitlab-Token": {secret}, "X-Gitlab-Event": {"Push Hook"}},
+			status:   http.StatusOK,
+			notified: 1,
+		},
+		{
+			// Not all the commits are listed, so it may be relevant
+			name:     "GitLab, more commits than listed",
+			path:     "/hook/git/gitlab",
+			payload:  `{"ref":"refs/heads/master","total_commits_count":30,"commits":[{"modified":["README.md"]}]}`,
+			header:   http.Header{"X-Gitlab-Token": {secret}, "X-Gitlab-Event": {"Push Hook"}},
+			status:   http.StatusOK,
+			notified: 1,
+		},
+		{
+			name:    "GitLab, wrong token",
+			path:    "/hook/git/gitlab",
+			payload: pushToMaster,
+			header:  http.Header{"X-Gitlab-Token": {"guess"}, "X-Gitlab-Event": {"Push Hook"}},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:     "Gitea",
+			path:     "/hook/git/gitea",
+			payload:  pushToMaster,
+			header:   withHeader(signWith("X-Gitea-Signature", "", sha256.New, pushToMaster), "X-Gitea-Event", "push"),
+			status:   http.StatusOK,
+			notified: 1,
+		},
+		{
+			name:     "Bitbucket Cloud",
+			path:     "/hook/git/bitbucket?token=" + secret,
+			payload:  `{"push":{"changes":[{"new":{"type":"branch","name":"master"}}]}}`,
+			header:   http.Header{"X-Event-Key": {"repo:push"}},
+			status:   http.StatusOK,
+			notified: 1,
+		},
+		{
+			name:    "Bitbucket Cloud, tag",
+			path:    "/hook/git/bitbucket?token=" + secret,
+			payload: `{"push":{"changes":[{"new":{"type":"tag","name":"master"}}]}}`,
+			header:  http.Header{"X-Event-Key": {"repo:push"}},
+			status:  http.StatusOK,
+		},
+		{
+			name:     "Bitbucket Server",
+			path:     "/hook/git/bitbucket",
+			payload:  `{"changes":[{"ref":{"id":"refs/heads/master","displayId":"master","type":"BRANCH"}}]}`,
+			header:   withHeader(signWith("X-Hub-Signature", "sha256=", sha256.New, `{"changes":[{"ref":{"id":"refs/heads/master","displayId":"master","type":"BRANCH"}}]}`), "X-Event-Key", "repo:refs_changed"),
+			status:   http.StatusOK,
+			notified: 1,
+		},
+		{
+			name:    "Bitbucket, no token",
+			path:    "/hook/git/bitbucket",
+			payload: `{"push":{"changes":[{"new":{"type":"branch","name":"master"}}]}}`,
+			header:  http.Header{"X-Event-Key": {"repo:push"}},
+			status:  http.StatusUnauthorized,
+		},
+	} {
+		h, notified := setupGit("deploy")
+		assert.Equal(t, v.status, post(h, v.path, v.payload, v.header), v.name)
+		assert.Equal(t, v.notified, *notified, v.name)
+	}
+}
+
+func TestGitHooks_Paths(t *testing.T) {
+	// Without paths, any change to the branch is relevant
+	h, notified := setupGit()
+	post(h, "/hook/git/gitlab", pushOutside, http.Header{"X-Gitlab-Token": {secret}, "X-Gitlab-Event": {"Push Hook"}})
+	assert.Equal(t, 1, *notified)
+
+	// A path may name a file, or the top of the repo
+	for _, paths := range [][]string{{"README.md"}, {"./"}, {"docs", "README.md"}} {
+		h, notified = setupGit(paths...)
+		post(h, "/hook/git/gitlab", pushOutside, http.Header{"X-Gitlab-Token": {secret}, "X-Gitlab-Event": {"Push Hook"}})
+		assert.Equal(t, 1, *notified, "%v", paths)
+	}
+	h, notified = setupGit("READ")
+	post(h, "/hook/git/gitlab", pushOutside, http.Header{"X-Gitlab-Token": {secret}, "X-Gitlab-Event": {"Push Hook"}})
+	assert.Equal(t, 0, *notified)
+}
+
+func TestGitHooks_Sources(t *testing.T) {
+	var notified int
+	var sources []string
+	h := NewHandler(&Receiver{
+		GitSecret: secret,
+		GitConfig: git.Config{Branch: "master", Paths: []string{"deploy"}},
+		GitNotify: func() { notified++ },
+		GitSources: map[string]git.Config{
+			"apps":  {Branch: "feature"},
+			"infra": {Branch: "master", Paths: []string{"README.md"}},
+		},
+		SourceNotify: func(name string) { sources = append(sources, name) },
+		Logger:       log.NewNopLogger(),
+	}, NewRouter())
+	header := http.Header{"X-Gitlab-Token": {secret}, "X-Gitlab-Event": {"Push Hook"}}
+
+	post(h, "/hook/git/gitlab", pushToOther, header)
+	assert.Equal(t, 0, notified)
+	assert.Equal(t, []string{"apps"}, sources)
+
+	sources = nil
+	post(h, "/hook/git/gitlab", pushOutside, header)
+	assert.Equal(t, 0, notified)
+	assert.Equal(t, []string{"infra"}, sources)
+
+	sources = nil
+	post(h, "/hook/git/gitlab", pushToMaster, header)
+	assert.Equal(t, 1, notified)
+	assert.Equal(t, []string{"infra"}, sources)
+}
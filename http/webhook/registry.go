@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/image"
+)
+
+// imagesFunc extracts the images named in a registry webhook payload.
+type imagesFunc func(payload []byte) ([]image.Name, error)
+
+// registryHook makes a handler for a kind of registry webhook, which
+// authenticates the request, then sends the images named in the
+// payload to be refreshed.
+func (rcv *Receiver) registryHook(auth authFunc, images imagesFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := readPayload(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !auth(r, payload, rcv.RegistrySecret) {
+			http.Error(w, "webhook failed authentication", http.StatusUnauthorized)
+			return
+		}
+		names, err := images(payload)
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "parsing webhook payload").Error(), http.StatusBadRequest)
+			return
+		}
+		for _, name := range names {
+			select {
+			case rcv.ImageRefresh <- name:
+				rcv.Logger.Log("webhook", r.URL.Path, "image", name.String())
+			default:
+				http.Error(w, "too many images waiting to be refreshed", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func parseNames(refs ...string) ([]image.Name, error) {
+	var names []image.Name
+	for _, s := range refs {
+		ref, err := image.ParseRef(s)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, ref.Name)
+	}
+	return names, nil
+}
+
+// Docker Hub, e.g.,
+//
+//	{"push_data": {"tag": "latest", ...},
+//	 "repository": {"repo_name": "weaveworks/flux", ...}}
+func dockerHubImages(payload []byte) ([]image.Name, error) {
+	var hook struct {
+		Repository struct {
+			RepoName string `json:"repo_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &hook); err != nil {
+		return nil, err
+	}
+	return parseNames(hook.Repository.RepoName)
+}
+
+// Quay, e.g.,
+//
+//	{"docker_url": "quay.io/weaveworks/flux", "updated_tags": ["latest"], ...}
+func quayImages(payload []byte) ([]image.Name, error) {
+	var hook struct {
+		DockerURL string `json:"docker_url"`
+	}
+	if err := json.Unmarshal(payload, &hook); err != nil {
+		return nil, err
+	}
+	return parseNames(hook.DockerURL)
+}
+
+// Google Container Registry notifications, pushed from a Cloud
+// Pub/Sub subscription to the topic `gcr`; the message data is e.g.,
+//
+//	{"action": "INSERT", "digest": "gcr.io/project/image@sha256:...", "tag": "gcr.io/project/image:1.0"}
+//
+// Only insertions are of interest.
+func gcrImages(payload []byte) ([]image.Name, error) {
+	var push struct {
+		Message struct {
+			Data string `json:"data"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(payload, &push); err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(push.Message.Data)
+	if err != nil {
+		return nil, err
+	}
+	var notification struct {
+		Action string `json:"action"`
+		Digest string `json:"digest"`
+		Tag    string `json:"tag"`
+	}
+	if err := json.Unmarshal(data, &notification); err != nil {
+		return nil, err
+	}
+	if notification.Action != "INSERT" {
+		return nil, nil
+	}
+	if notification.Tag != "" {
+		return parseNames(notification.Tag)
+	}
+	return parseNames(notification.Digest)
+}
+
+// Harbor, e.g.,
+//
+//	{"type": "pushImage",
+//	 "event_data": {"resources": [{"resource_url": "harbor.example.com/library/app:1.0", ...}], ...}}
+//
+// Only pushes are of interest.
+func harborImages(payload []byte) ([]image.Name, error) {
+	var hook struct {
+		Type      string `json:"type"`
+		EventData struct {
+			Resources []struct {
+				ResourceURL string `json:"resource_url"`
+			} `json:"resources"`
+		} `json:"event_data"`
+	}
+	if err := json.Unmarshal(payload, &hook); err != nil {
+		return nil, err
+	}
+	switch hook.Type {
+	case "pushImage", "PUSH_ARTIFACT":
+	default:
+		return nil, nil
+	}
+	var refs []string
+	for _, r := range hook.EventData.Resources {
+		refs = append(refs, r.ResourceURL)
+	}
+	return parseNames(refs...)
+}
+
+// Anything else that can sign its payload, e.g.,
+//
+//	{"image": "registry.example.com/app:1.0"}
+func genericImages(payload []byte) ([]image.Name, error) {
+	var hook struct {
+		Image string `json:"image"`
+	}
+	if err := json.Unmarshal(payload, &hook); err != nil {
+		return nil, err
+	}
+	if hook.Image == "" {
+		return nil, fmt.Errorf("no image given")
+	}
+	return parseNames(hook.Image)
+}
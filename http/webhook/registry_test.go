@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
+)
+
+const secret = "s3cr3t"
+
+func setup(buffer int) (http.Handler, chan image.Name) {
+	refresh := make(chan image.Name, buffer)
+	return NewHandler(&Receiver{
+		RegistrySecret: secret,
+		ImageRefresh:   refresh,
+		Logger:         log.NewNopLogger(),
+	}, NewRouter()), refresh
+}
+
+func post(h http.Handler, path, payload string, header http.Header) int {
+	req := httptest.NewRequest("POST", path, bytes.NewBufferString(payload))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+func refreshed(c chan image.Name) []string {
+	var names []string
+	for {
+		select {
+		case name := <-c:
+			names = append(names, name.String())
+		default:
+			return names
+		}
+	}
+}
+
+func sign(payload string) http.Header {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return http.Header{"X-Signature": {"sha256=" + hex.EncodeToString(mac.Sum(nil))}}
+}
+
+func TestRegistryHooks(t *testing.T) {
+	gcrData := base64.StdEncoding.EncodeToString([]byte(`{"action":"INSERT","digest":"gcr.io/project/app@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef","tag":"gcr.io/project/app:1.0"}`))
+	gcrDelete := base64.StdEncoding.EncodeToString([]byte(`{"action":"DELETE","tag":"gcr.io/project/app:1.0"}`))
+	generic := `{"image":"registry.example.com/team/app:1.0"}`
+
+	for _, v := range []struct {
+		name     string
+		path     string
+		payload  string
+		header   http.Header
+		status   int
+		expected []string
+	}{
+		{
+			name:     "Docker Hub",
+			path:     "/hook/registry/dockerhub?token=" + secret,
+			payload:  `{"push_data":{"tag":"latest"},"repository":{"repo_name":"weaveworks/flux","namespace":"weaveworks","name":"flux"}}`,
+			status:   http.StatusOK,
+			expected: []string{"weaveworks/flux"},
+		},
+		{
+			name:    "Docker Hub, wrong token",
+			path:    "/hook/registry/dockerhub?token=guess",
+			payload: `{"repository":{"repo_name":"weaveworks/flux"}}`,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:     "Quay",
+			path:     "/hook/registry/quay?token=" + secret,
+			payload:  `{"repository":"weaveworks/flux","docker_url":"quay.io/weaveworks/flux","updated_tags":["1.0"]}`,
+			status:   http.StatusOK,
+			expected: []string{"quay.io/weaveworks/flux"},
+		},
+		{
+			name:     "GCR",
+			path:     "/hook/registry/gcr?token=" + secret,
+			payload:  `{"message":{"data":"` + gcrData + `","messageId":"1"},"subscription":"projects/project/subscriptions/flux"}`,
+			status:   http.StatusOK,
+			expected: []string{"gcr.io/project/app"},
+		},
+		{
+			name:    "GCR, deletion",
+			path:    "/hook/registry/gcr?token=" + secret,
+			payload: `{"message":{"data":"` + gcrDelete + `"}}`,
+			status:  http.StatusOK,
+		},
+		{
+			name:     "Harbor",
+			path:     "/hook/registry/harbor",
+			payload:  `{"type":"pushImage","event_data":{"resources":[{"tag":"1.0","resource_url":"harbor.example.com/library/app:1.0"}]}}`,
+			header:   http.Header{"Authorization": {"Bearer " + secret}},
+			status:   http.StatusOK,
+			expected: []string{"harbor.example.com/library/app"},
+		},
+		{
+			name:    "Harbor, no authorization",
+			path:    "/hook/registry/harbor",
+			payload: `{"type":"pushImage","event_data":{"resources":[{"resource_url":"harbor.example.com/library/app:1.0"}]}}`,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:     "generic",
+			path:     "/hook/registry/generic",
+			payload:  generic,
+			header:   sign(generic),
+			status:   http.StatusOK,
+			expected: []string{"registry.example.com/team/app"},
+		},
+		{
+			name:    "generic, wrong signature",
+			path:    "/hook/registry/generic",
+			payload: generic,
+			header:  sign(`{"image":"registry.example.com/team/other:1.0"}`),
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "generic, bad payload",
+			path:    "/hook/registry/generic",
+			payload: `{"image":""}`,
+			header:  sign(`{"image":""}`),
+			status:  http.StatusBadRequest,
+		},
+	} {
+		h, c := setup(10)
+		assert.Equal(t, v.status, post(h, v.path, v.payload, v.header), v.name)
+		assert.Equal(t, v.expected, refreshed(c), v.name)
+	}
+}
+
+func TestRegistryHooks_NoSecret(t *testing.T) {
+	refresh := make(chan image.Name, 1)
+	h := NewHandler(&Receiver{ImageRefresh: refresh, Logger: log.NewNopLogger()}, NewRouter())
+	assert.Equal(t, http.StatusUnauthorized, post(h, "/hook/registry/dockerhub?token=", `{"repository":{"repo_name":"weaveworks/flux"}}`, nil))
+	assert.Equal(t, http.StatusUnauthorized, post(h, "/hook/registry/harbor", `{}`, http.Header{"Authorization": {""}}))
+}
+
+func TestRegistryHooks_Full(t *testing.T) {
+	h, c := setup(1)
+	payload := `{"repository":{"repo_name":"weaveworks/flux"}}`
+	assert.Equal(t, http.StatusOK, post(h, "/hook/registry/dockerhub?token="+secret, payload, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, post(h, "/hook/registry/dockerhub?token="+secret, payload, nil))
+	assert.Equal(t, []string{"weaveworks/flux"}, refreshed(c))
+}
@@ -0,0 +1,158 @@
+/*
+This package receives webhooks from image registries and git hosts,
+so that fluxd can find out about new images and commits as soon as
+they are pushed, rather than when it next polls.
+
+Each kind of webhook has its own endpoint, under /hook/registry/ or
+/hook/git/, and is authenticated with a shared secret; how the secret
+is supplied depends on what the sender is able to do.
+*/
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/weaveworks/common/middleware"
+
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/image"
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+const (
+	DockerHubHook = "DockerHubHook"
+	QuayHook      = "QuayHook"
+	GCRHook       = "GCRHook"
+	HarborHook    = "HarborHook"
+	GenericHook   = "GenericHook"
+	GitHubHook    = "GitHubHook"
+	GitLabHook    = "GitLabHook"
+	BitbucketHook = "BitbucketHook"
+	GiteaHook     = "GiteaHook"
+
+	// The largest payload accepted
+	maxPayloadBytes = 1 << 20
+)
+
+var (
+	requestDuration = stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "webhook",
+		Name:      "request_duration_seconds",
+		Help:      "Time (in seconds) spent serving webhook requests.",
+		Buckets:   stdprometheus.DefBuckets,
+	}, []string{fluxmetrics.LabelMethod, fluxmetrics.LabelRoute, "status_code", "ws"})
+)
+
+// Receiver handles webhooks, by passing on what they notify to the
+// daemon.
+type Receiver struct {
+	// The secret that registry webhooks must supply; if empty,
+	// registry webhooks are refused
+	RegistrySecret string
+	// Images named in registry webhooks are sent here, to be
+	// refreshed before others
+	ImageRefresh chan<- image.Name
+
+	// The secret that git host webhooks must supply; if empty, git
+	// host webhooks are refused
+	GitSecret string
+	// Only pushes to the branch, changing files under the paths,
+	// given here are acted on
+	GitConfig git.Config
+	// Called for each push that's acted on
+	GitNotify func()
+	// The config of each sync source, by name; pushes to the branch,
+	// changing files under the paths, of a source are acted on by
+	// calling SourceNotify with its name
+	GitSources   map[string]git.Config
+	SourceNotify func(name string)
+
+	Logger log.Logger
+}
+
+func NewRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.NewRoute().Name(DockerHubHook).Methods("POST").Path("/hook/registry/dockerhub")
+	r.NewRoute().Name(QuayHook).Methods("POST").Path("/hook/registry/quay")
+	r.NewRoute().Name(GCRHook).Methods("POST").Path("/hook/registry/gcr")
+	r.NewRoute().Name(HarborHook).Methods("POST").Path("/hook/registry/harbor")
+	r.NewRoute().Name(GenericHook).Methods("POST").Path("/hook/registry/generic")
+	r.NewRoute().Name(GitHubHook).Methods("POST").Path("/hook/git/github")
+	r.NewRoute().Name(GitLabHook).Methods("POST").Path("/hook/git/gitlab")
+	r.NewRoute().Name(BitbucketHook).Methods("POST").Path("/hook/git/bitbucket")
+	r.NewRoute().Name(GiteaHook).Methods("POST").Path("/hook/git/gitea")
+	return r
+}
+
+func NewHandler(rcv *Receiver, r *mux.Router) http.Handler {
+	r.Get(DockerHubHook).Handler(rcv.registryHook(tokenAuth, dockerHubImages))
+	r.Get(QuayHook).Handler(rcv.registryHook(tokenAuth, quayImages))
+	r.Get(GCRHook).Handler(rcv.registryHook(tokenAuth, gcrImages))
+	r.Get(HarborHook).Handler(rcv.registryHook(headerAuth, harborImages))
+	r.Get(GenericHook).Handler(rcv.registryHook(hmacAuth, genericImages))
+	r.Get(GitHubHook).Handler(rcv.gitHook(githubAuth, githubPushes))
+	r.Get(GitLabHook).Handler(rcv.gitHook(gitlabAuth, gitlabPushes))
+	r.Get(BitbucketHook).Handler(rcv.gitHook(bitbucketAuth, bitbucketPushes))
+	r.Get(GiteaHook).Handler(rcv.gitHook(giteaAuth, giteaPushes))
+
+	return middleware.Instrument{
+		RouteMatcher: r,
+		Duration:     requestDuration,
+	}.Wrap(r)
+}
+
+// authFunc says whether a request, with the payload given, supplies
+// the secret given.
+type authFunc func(r *http.Request, payload []byte, secret string) bool
+
+// tokenAuth expects the secret as the query parameter `token`, for
+// senders that can only be given a URL.
+func tokenAuth(r *http.Request, _ []byte, secret string) bool {
+	return secretEqual(r.URL.Query().Get("token"), secret)
+}
+
+// headerAuth expects the secret as the Authorization header, either
+// by itself or as a bearer token.
+func headerAuth(r *http.Request, _ []byte, secret string) bool {
+	return secretEqual(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), secret)
+}
+
+// hmacAuth expects the header X-Signature to be `sha256=` followed by
+// the hex-encoded HMAC-SHA256 of the payload, keyed with the secret.
+func hmacAuth(r *http.Request, payload []byte, secret string) bool {
+	return validHMAC(r.Header.Get("X-Signature"), "sha256=", sha256.New, payload, secret)
+}
+
+func secretEqual(given, secret string) bool {
+	return secret != "" && subtle.ConstantTimeCompare([]byte(given), []byte(secret)) == 1
+}
+
+func validHMAC(signature, prefix string, newHash func() hash.Hash, payload []byte, secret string) bool {
+	if secret == "" || !strings.HasPrefix(signature, prefix) {
+		return false
+	}
+	given, err := hex.DecodeString(strings.TrimPrefix(signature, prefix))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(given, mac.Sum(nil))
+}
+
+// readPayload reads the body of a request, up to the maximum size
+// accepted.
+func readPayload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadBytes))
+}
@@ -3,8 +3,10 @@ package image
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,6 +24,7 @@ var (
 	ErrInvalidImageID   = errors.New("invalid image ID")
 	ErrBlankImageID     = errors.Wrap(ErrInvalidImageID, "blank image name")
 	ErrMalformedImageID = errors.Wrap(ErrInvalidImageID, `expected image name as either <image>:<tag> or just <image>`)
+	ErrMalformedDigest  = errors.Wrap(ErrInvalidImageID, `expected digest as <algorithm>:<hex>`)
 )
 
 // Name represents an unversioned (i.e., untagged) image a.k.a.,
@@ -109,9 +112,13 @@ func (i Name) ToRef(tag string) Ref {
 //  * library/alpine:3.5
 //  * quay.io/weaveworks/flux:1.1.0
 //  * localhost:5000/arbitrary/path/to/repo:revision-sha1
+//  * quay.io/weaveworks/flux:1.1.0@sha256:<hex>
 type Ref struct {
 	Name
 	Tag string
+	// Digest pins the ref to a particular image manifest, e.g.,
+	// `sha256:<hex>`. It is empty unless given explicitly.
+	Digest string
 }
 
 // CanonicalRef is an image ref with none of the fields left to be
@@ -126,7 +133,11 @@ func (i Ref) String() string {
 	if i.Tag != "" {
 		tag = ":" + i.Tag
 	}
-	return fmt.Sprintf("%s%s", i.Name.String(), tag)
+	var digest string
+	if i.Digest != "" {
+		digest = "@" + i.Digest
+	}
+	return fmt.Sprintf("%s%s%s", i.Name.String(), tag, digest)
 }
 
 // ParseRef parses a string representation of an image id into an
@@ -138,6 +149,16 @@ func ParseRef(s string) (Ref, error) {
 	if s == "" {
 		return id, errors.Wrapf(ErrBlankImageID, "parsing %q", s)
 	}
+	if at := strings.Index(s, "@"); at > -1 {
+		id.Digest = s[at+1:]
+		if at == 0 {
+			return id, errors.Wrapf(ErrMalformedImageID, "parsing %q", s)
+		}
+		if !digestRegexp.MatchString(id.Digest) {
+			return id, errors.Wrapf(ErrMalformedDigest, "parsing %q", s)
+		}
+		s = s[:at]
+	}
 	if strings.HasPrefix(s, "/") || strings.HasSuffix(s, "/") {
 		return id, errors.Wrapf(ErrMalformedImageID, "parsing %q", s)
 	}
@@ -182,6 +203,7 @@ var (
 	domainComponent = `([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
 	domain          = fmt.Sprintf(`localhost|(%s([.]%s)+)(:[0-9]+)?`, domainComponent, domainComponent)
 	domainRegexp    = regexp.MustCompile(domain)
+	digestRegexp    = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*([-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
 )
 
 // ImageID is serialized/deserialized as a string
@@ -205,8 +227,9 @@ func (i Ref) CanonicalRef() CanonicalRef {
 	name := i.CanonicalName()
 	return CanonicalRef{
 		Ref: Ref{
-			Name: name.Name,
-			Tag:  i.Tag,
+			Name:   name.Name,
+			Tag:    i.Tag,
+			Digest: i.Digest,
 		},
 	}
 }
@@ -215,11 +238,21 @@ func (i Ref) Components() (domain, repo, tag string) {
 	return i.Domain, i.Image, i.Tag
 }
 
-// WithNewTag makes a new copy of an ImageID with a new tag
+// WithNewTag makes a new copy of an ImageID with a new tag. Since
+// the digest (if any) belonged to the old tag, it is dropped.
 func (i Ref) WithNewTag(t string) Ref {
 	var img Ref
 	img = i
 	img.Tag = t
+	img.Digest = ""
+	return img
+}
+
+// WithDigest makes a new copy of an ImageID pinned to the digest
+// given; an empty digest unpins it.
+func (i Ref) WithDigest(d string) Ref {
+	img := i
+	img.Digest = d
 	return img
 }
 
@@ -239,6 +272,12 @@ type Info struct {
 	CreatedAt time.Time `json:",omitempty"`
 	// the last time this image manifest was fetched
 	LastFetched time.Time `json:",omitempty"`
+	// the labels given in the image config
+	Labels map[string]string `json:",omitempty"`
+	// the first time this reference was seen pointing at this image
+	// (i.e., with this digest); for images built with a fixed
+	// creation time, it's the best guess at when it was pushed
+	FirstSeen time.Time `json:",omitempty"`
 }
 
 // MarshalJSON returns the Info value in JSON (as bytes). It is
@@ -247,18 +286,22 @@ type Info struct {
 // detect.
 func (im Info) MarshalJSON() ([]byte, error) {
 	type InfoAlias Info // alias to shed existing MarshalJSON implementation
-	var ca, lf string
+	var ca, lf, fs string
 	if !im.CreatedAt.IsZero() {
 		ca = im.CreatedAt.UTC().Format(time.RFC3339Nano)
 	}
 	if !im.LastFetched.IsZero() {
 		lf = im.LastFetched.UTC().Format(time.RFC3339Nano)
 	}
+	if !im.FirstSeen.IsZero() {
+		fs = im.FirstSeen.UTC().Format(time.RFC3339Nano)
+	}
 	encode := struct {
 		InfoAlias
 		CreatedAt   string `json:",omitempty"`
 		LastFetched string `json:",omitempty"`
-	}{InfoAlias(im), ca, lf}
+		FirstSeen   string `json:",omitempty"`
+	}{InfoAlias(im), ca, lf, fs}
 	return json.Marshal(encode)
 }
 
@@ -270,13 +313,16 @@ func (im *Info) UnmarshalJSON(b []byte) error {
 		InfoAlias
 		CreatedAt   string `json:",omitempty"`
 		LastFetched string `json:",omitempty"`
+		FirstSeen   string `json:",omitempty"`
 	}{}
 	json.Unmarshal(b, &unencode)
 	*im = Info(unencode.InfoAlias)
 
 	var err error
 	if err = decodeTime(unencode.CreatedAt, &im.CreatedAt); err == nil {
-		err = decodeTime(unencode.LastFetched, &im.LastFetched)
+		if err = decodeTime(unencode.LastFetched, &im.LastFetched); err == nil {
+			err = decodeTime(unencode.FirstSeen, &im.FirstSeen)
+		}
 	}
 	return err
 }
@@ -303,6 +349,51 @@ func NewerByCreated(lhs, rhs *Info) bool {
 	return lhs.CreatedAt.After(rhs.CreatedAt)
 }
 
+// NewerByFirstSeen returns true if lhs image should be sorted before
+// rhs with regard to when they were first seen descending. Images
+// that haven't been seen (i.e., with a zero time) sort last, by
+// creation date.
+func NewerByFirstSeen(lhs, rhs *Info) bool {
+	switch {
+	case lhs.FirstSeen.Equal(rhs.FirstSeen):
+		return NewerByCreated(lhs, rhs)
+	case lhs.FirstSeen.IsZero() || rhs.FirstSeen.IsZero():
+		return rhs.FirstSeen.IsZero()
+	}
+	return lhs.FirstSeen.After(rhs.FirstSeen)
+}
+
+// NewerByLabel returns a function that orders images by the value of
+// the label given, descending. The values are expected to be either
+// timestamps (RFC3339, as in `org.opencontainers.image.created`) or
+// numbers; images without a usable value sort last, by creation
+// date.
+func NewerByLabel(label string) func(lhs, rhs *Info) bool {
+	return func(lhs, rhs *Info) bool {
+		lv, lok := labelValue(lhs.Labels[label])
+		rv, rok := labelValue(rhs.Labels[label])
+		switch {
+		case lok && rok && lv != rv:
+			return lv > rv
+		case lok != rok:
+			return lok
+		}
+		return NewerByCreated(lhs, rhs)
+	}
+}
+
+// labelValue interprets a label value as a timestamp or a number,
+// for comparison.
+func labelValue(s string) (float64, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return float64(t.UnixNano()), true
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(n) {
+		return n, true
+	}
+	return 0, false
+}
+
 // NewerBySemver returns true if lhs image should be sorted
 // before rhs with regard to their semver order descending.
 func NewerBySemver(lhs, rhs *Info) bool {
@@ -318,6 +409,11 @@ func NewerBySemver(lhs, rhs *Info) bool {
 		return true
 	}
 	cmp := lv.Compare(rv)
+	// Build metadata doesn't count towards precedence in semver, but
+	// it's usually a build number or similar, so compare it anyway.
+	if cmp == 0 {
+		cmp = compareBuildMetadata(lv.Metadata(), rv.Metadata())
+	}
 	// In semver, `1.10` and `1.10.0` is the same but in favor of explicitness
 	// we should consider the latter newer.
 	if cmp == 0 {
@@ -326,6 +422,39 @@ func NewerBySemver(lhs, rhs *Info) bool {
 	return cmp > 0
 }
 
+// compareBuildMetadata compares the build metadata of two versions
+// identifier by identifier, numerically where both identifiers are
+// numbers. Having metadata counts as newer than not having it.
+func compareBuildMetadata(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return -1
+	case b == "":
+		return 1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		an, aerr := strconv.ParseUint(as[i], 10, 64)
+		bn, berr := strconv.ParseUint(bs[i], 10, 64)
+		switch {
+		case aerr == nil && berr == nil && an > bn:
+			return 1
+		case aerr == nil && berr == nil:
+			return -1
+		case as[i] > bs[i]:
+			return 1
+		default:
+			return -1
+		}
+	}
+	return len(as) - len(bs)
+}
+
 // Sort orders the given image infos according to `newer` func.
 func Sort(infos []Info, newer func(a, b *Info) bool) {
 	if newer == nil {
@@ -12,6 +12,8 @@ import (
 
 const constTime = "2017-01-13T16:22:58.009923189Z"
 
+const testDigest = "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"
+
 var (
 	testTime, _ = time.Parse(time.RFC3339Nano, constTime)
 )
@@ -52,6 +54,9 @@ func TestParseRef(t *testing.T) {
 		{"quay.io/library/alpine:latest", "quay.io", "library/alpine", "quay.io/library/alpine:latest"},
 		{"quay.io/library/alpine:mytag", "quay.io", "library/alpine", "quay.io/library/alpine:mytag"},
 		{"localhost:5000/path/to/repo/alpine:mytag", "localhost:5000", "path/to/repo/alpine", "localhost:5000/path/to/repo/alpine:mytag"},
+		// A ref can be pinned to a digest, with or without a tag
+		{"alpine:mytag@" + testDigest, dockerHubHost, "library/alpine", "index.docker.io/library/alpine:mytag@" + testDigest},
+		{"localhost:5000/hello@" + testDigest, "localhost:5000", "hello", "localhost:5000/hello@" + testDigest},
 	} {
 		i, err := ParseRef(x.test)
 		if err != nil {
@@ -80,6 +85,10 @@ func TestParseRefErrorCases(t *testing.T) {
 		{":tag"},
 		{"/leading/slash"},
 		{"trailing/slash/"},
+		{"alpine:mytag@"},
+		{"alpine:mytag@sha256"},
+		{"alpine:mytag@sha256:nothex"},
+		{"@" + testDigest},
 	} {
 		_, err := ParseRef(x.test)
 		if err == nil {
@@ -112,6 +121,18 @@ func TestComponents(t *testing.T) {
 	}
 }
 
+func TestWithDigest(t *testing.T) {
+	ref, err := ParseRef("quay.io/my/repo:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := ref.WithDigest(testDigest)
+	assert.Equal(t, "quay.io/my/repo:v1@"+testDigest, pinned.String())
+	assert.Equal(t, ref, pinned.WithDigest(""))
+	// A new tag doesn't keep the digest of the old one
+	assert.Equal(t, "quay.io/my/repo:v2", pinned.WithNewTag("v2").String())
+}
+
 func TestRefSerialization(t *testing.T) {
 	for _, x := range []struct {
 		test     Ref
@@ -153,6 +174,8 @@ func TestImageInfoSerialisation(t *testing.T) {
 	info.Digest = "sha256:digest"
 	info.ImageID = "sha256:layerID"
 	info.LastFetched = t1
+	info.FirstSeen = t1
+	info.Labels = map[string]string{"org.opencontainers.image.created": "2018-09-21T10:00:00Z"}
 	bytes, err := json.Marshal(info)
 	if err != nil {
 		t.Fatal(err)
@@ -233,6 +256,58 @@ func TestImage_OrderBySemverTagDesc(t *testing.T) {
 	assert.Equal(t, tags(expected), tags(imgs))
 }
 
+func TestImage_OrderBySemverBuildMetadata(t *testing.T) {
+	ti := time.Now()
+	aa := mustMakeInfo("my/image:1.2.3+build.9", ti)
+	bb := mustMakeInfo("my/image:1.2.3+build.10", ti)
+	cc := mustMakeInfo("my/image:1.2.3", ti)
+	dd := mustMakeInfo("my/image:1.2.4-rc.1", ti)
+
+	imgs := []Info{aa, bb, cc, dd}
+	Sort(imgs, NewerBySemver)
+	assert.Equal(t, tags([]Info{dd, bb, aa, cc}), tags(imgs))
+}
+
+func TestImage_OrderByFirstSeen(t *testing.T) {
+	ti := time.Now()
+	aa := mustMakeInfo("my/image:aa", ti)
+	aa.FirstSeen = ti.Add(-time.Hour)
+	bb := mustMakeInfo("my/image:bb", ti.Add(-time.Hour))
+	bb.FirstSeen = ti
+	cc := mustMakeInfo("my/image:cc", ti) // never seen
+
+	imgs := []Info{aa, bb, cc}
+	Sort(imgs, NewerByFirstSeen)
+	assert.Equal(t, tags([]Info{bb, aa, cc}), tags(imgs))
+}
+
+func TestImage_OrderByLabel(t *testing.T) {
+	const label = "org.opencontainers.image.created"
+	epoch := time.Unix(0, 0)
+	withLabel := func(ref, value string) Info {
+		info := mustMakeInfo(ref, epoch)
+		if value != "" {
+			info.Labels = map[string]string{label: value}
+		}
+		return info
+	}
+	aa := withLabel("my/image:aa", "2018-09-21T10:00:00Z")
+	bb := withLabel("my/image:bb", "2018-09-22T09:00:00+01:00")
+	cc := withLabel("my/image:cc", "")
+	dd := withLabel("my/image:dd", "not a time")
+
+	imgs := []Info{cc, aa, dd, bb}
+	Sort(imgs, NewerByLabel(label))
+	assert.Equal(t, tags([]Info{bb, aa, cc, dd}), tags(imgs))
+
+	// Numbers work too, e.g., for build numbers
+	ee := withLabel("my/image:ee", "9")
+	ff := withLabel("my/image:ff", "10")
+	imgs = []Info{ee, ff}
+	Sort(imgs, NewerByLabel(label))
+	assert.Equal(t, tags([]Info{ff, ee}), tags(imgs))
+}
+
 func tags(imgs []Info) []string {
 	var vs []string
 	for _, i := range imgs {
@@ -14,4 +14,10 @@ const (
 	LabelReleaseType = "release_type"
 	LabelReleaseKind = "release_kind"
 	LabelStage       = "stage"
+
+	// Labels for drift metrics
+	LabelNamespace = "namespace"
+
+	// Labels for sync metrics
+	LabelOutcome = "outcome"
 )
@@ -1,17 +1,24 @@
 package policy
 
 import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
 	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
 	"github.com/ryanuber/go-glob"
+
 	"github.com/weaveworks/flux/image"
-	"strings"
-	"regexp"
 )
 
 const (
-	globPrefix   = "glob:"
-	semverPrefix = "semver:"
-	regexpPrefix = "regexp:"
+	globPrefix    = "glob:"
+	semverPrefix  = "semver:"
+	regexpPrefix  = "regexp:"
+	calverPrefix  = "calver:"
+	numericPrefix = "numeric:"
 )
 
 var (
@@ -36,35 +43,142 @@ type GlobPattern string
 
 // SemverPattern matches by semantic versioning.
 // See https://semver.org/
+//
+// Pre-release versions only match if the constraints name a
+// pre-release, or if the pattern is given pre-release channels, as in
+//
+//	semver:~1.2 prerelease=rc,beta
+//
+// in which case pre-releases of those channels (e.g., `1.2.3-rc.1`
+// or `1.2.3-beta2`) match if their release version would.
 type SemverPattern struct {
 	pattern     string // pattern without prefix
 	constraints *semver.Constraints
+	prereleases []string
+	err         error
 }
 
 // RegexpPattern matches by regular expression.
 type RegexpPattern struct {
-	pattern	string // pattern without prefix
-	regexp	*regexp.Regexp
+	pattern string // pattern without prefix
+	regexp  *regexp.Regexp
+	err     error
+}
+
+// CalverPattern matches calendar versions in the format given, as
+// described at https://calver.org/; e.g., `calver:YYYY.0M.0D`
+// matches `2018.09.21`. The format is made of the elements YYYY, YY,
+// 0Y, MM, 0M, WW, 0W, DD, 0D, MAJOR, MINOR and MICRO separated by
+// `.`, `-` or `_`, and must include a year. Versions are ordered by
+// their elements, in order.
+type CalverPattern struct {
+	pattern  string // pattern without prefix
+	regexp   *regexp.Regexp
+	elements []calverElement
+	err      error
+}
+
+// NumericPattern matches tags made of the prefix given followed by
+// a number, e.g., `numeric:build-` matches `build-1234`. Tags are
+// ordered by the number.
+type NumericPattern string
+
+// The values of the Sort policy.
+const (
+	// SortCreated orders images by when they were created, according
+	// to their config; this is the default.
+	SortCreated = "created"
+	// SortFirstSeen orders images by when they were first seen in
+	// the registry.
+	SortFirstSeen = "first-seen"
+	// SortLabel orders images by the value of a label, given as
+	// `label:<name>`, or DefaultSortLabel if just `label`.
+	SortLabel        = "label"
+	DefaultSortLabel = "org.opencontainers.image.created"
+)
+
+// SortOrder gives the function for ordering images that's named by
+// the value of a Sort policy.
+func SortOrder(value string) (func(a, b *image.Info) bool, error) {
+	switch {
+	case value == SortCreated:
+		return image.NewerByCreated, nil
+	case value == SortFirstSeen:
+		return image.NewerByFirstSeen, nil
+	case value == SortLabel:
+		return image.NewerByLabel(DefaultSortLabel), nil
+	case strings.HasPrefix(value, SortLabel+":") && len(value) > len(SortLabel)+1:
+		return image.NewerByLabel(strings.TrimPrefix(value, SortLabel+":")), nil
+	}
+	return nil, fmt.Errorf("invalid sort order %q; expected %q, %q, %q or \"%s:<name>\"", value, SortCreated, SortFirstSeen, SortLabel, SortLabel)
+}
+
+// sortedPattern is a pattern that orders images according to a Sort
+// policy, rather than by when they were created.
+type sortedPattern struct {
+	Pattern
+	newer func(a, b *image.Info) bool
+}
+
+func (s sortedPattern) Newer(a, b *image.Info) bool {
+	return s.newer(a, b)
+}
+
+// WithSortOrder gives a pattern that orders images according to the
+// Sort policy in the policies given, if there is one and it's valid,
+// and the pattern given doesn't imply its own order (as semver,
+// calver and numeric patterns do).
+func WithSortOrder(pattern Pattern, policies Set) Pattern {
+	value, ok := policies.Get(Sort)
+	if !ok {
+		return pattern
+	}
+	newer, err := SortOrder(value)
+	if err != nil {
+		return pattern
+	}
+	switch pattern.(type) {
+	case GlobPattern, RegexpPattern:
+		return sortedPattern{pattern, newer}
+	}
+	return pattern
 }
 
 // NewPattern instantiates a Pattern according to the prefix
 // it finds. The prefix can be either `glob:` (default if omitted),
-// `semver:` or `regexp:`.
+// `semver:`, `regexp:`, `calver:` or `numeric:`.
 func NewPattern(pattern string) Pattern {
 	switch {
 	case strings.HasPrefix(pattern, semverPrefix):
-		pattern = strings.TrimPrefix(pattern, semverPrefix)
-		c, _ := semver.NewConstraint(pattern)
-		return SemverPattern{pattern, c}
+		return newSemverPattern(strings.TrimPrefix(pattern, semverPrefix))
 	case strings.HasPrefix(pattern, regexpPrefix):
 		pattern = strings.TrimPrefix(pattern, regexpPrefix)
-		r, _ := regexp.Compile(pattern)
-		return RegexpPattern{pattern, r}
+		r, err := regexp.Compile(pattern)
+		return RegexpPattern{pattern, r, err}
+	case strings.HasPrefix(pattern, calverPrefix):
+		return newCalverPattern(strings.TrimPrefix(pattern, calverPrefix))
+	case strings.HasPrefix(pattern, numericPrefix):
+		return NumericPattern(strings.TrimPrefix(pattern, numericPrefix))
 	default:
 		return GlobPattern(strings.TrimPrefix(pattern, globPrefix))
 	}
 }
 
+// ValidatePattern returns an error saying why the pattern given is
+// not valid, or nil if it is valid.
+func ValidatePattern(pattern string) error {
+	var err error
+	switch p := NewPattern(pattern).(type) {
+	case SemverPattern:
+		err = p.err
+	case RegexpPattern:
+		err = p.err
+	case CalverPattern:
+		err = p.err
+	}
+	return errors.Wrapf(err, "invalid tag pattern %q", pattern)
+}
+
 func (g GlobPattern) Matches(tag string) bool {
 	return glob.Glob(string(g), tag)
 }
@@ -81,6 +195,34 @@ func (g GlobPattern) Valid() bool {
 	return true
 }
 
+// semverOption matches the options that can follow the constraints
+// in a semver pattern.
+var semverOption = regexp.MustCompile(`^[a-z]+=`)
+
+func newSemverPattern(pattern string) SemverPattern {
+	p := SemverPattern{pattern: pattern}
+	fields := strings.Fields(pattern)
+	for len(fields) > 0 && semverOption.MatchString(fields[len(fields)-1]) {
+		option := strings.SplitN(fields[len(fields)-1], "=", 2)
+		fields = fields[:len(fields)-1]
+		switch option[0] {
+		case "prerelease":
+			for _, channel := range strings.Split(option[1], ",") {
+				if channel == "" {
+					p.err = errors.New("empty pre-release channel")
+					return p
+				}
+				p.prereleases = append(p.prereleases, channel)
+			}
+		default:
+			p.err = fmt.Errorf("unknown option %q", option[0])
+			return p
+		}
+	}
+	p.constraints, p.err = semver.NewConstraint(strings.Join(fields, " "))
+	return p
+}
+
 func (s SemverPattern) Matches(tag string) bool {
 	v, err := semver.NewVersion(tag)
 	if err != nil {
@@ -90,7 +232,30 @@ func (s SemverPattern) Matches(tag string) bool {
 		// Invalid constraints match anything
 		return true
 	}
-	return s.constraints.Check(v)
+	if len(s.prereleases) == 0 || v.Prerelease() == "" {
+		return s.constraints.Check(v)
+	}
+	if !s.inChannel(v.Prerelease()) {
+		return false
+	}
+	if s.constraints.Check(v) {
+		return true
+	}
+	release, err := semver.NewVersion(fmt.Sprintf("%d.%d.%d", v.Major(), v.Minor(), v.Patch()))
+	return err == nil && s.constraints.Check(release)
+}
+
+// inChannel says whether a pre-release is in one of the pattern's
+// channels; i.e., its first identifier is the channel name, possibly
+// followed by a number.
+func (s SemverPattern) inChannel(prerelease string) bool {
+	first := strings.SplitN(prerelease, ".", 2)[0]
+	for _, channel := range s.prereleases {
+		if strings.HasPrefix(first, channel) && isNumber(first[len(channel):]) {
+			return true
+		}
+	}
+	return false
 }
 
 func (s SemverPattern) String() string {
@@ -102,7 +267,7 @@ func (s SemverPattern) Newer(a, b *image.Info) bool {
 }
 
 func (s SemverPattern) Valid() bool {
-	return s.constraints != nil
+	return s.err == nil
 }
 
 func (r RegexpPattern) Matches(tag string) bool {
@@ -122,5 +287,175 @@ func (r RegexpPattern) Newer(a, b *image.Info) bool {
 }
 
 func (r RegexpPattern) Valid() bool {
-	return r.regexp != nil
+	return r.err == nil
+}
+
+// calverElement is an element of a calendar version format, with the
+// range of values it can take (zero meaning unbounded).
+type calverElement struct {
+	name     string
+	regexp   string
+	min, max int
+}
+
+// calverElements are the elements of calendar version formats,
+// longest first so that matching the format is unambiguous.
+var calverElements = []calverElement{
+	{"YYYY", `(\d{4})`, 0, 0},
+	{"MAJOR", `(\d+)`, 0, 0},
+	{"MINOR", `(\d+)`, 0, 0},
+	{"MICRO", `(\d+)`, 0, 0},
+	{"YY", `(\d{1,3})`, 0, 0},
+	{"0Y", `(\d{2,3})`, 0, 0},
+	{"MM", `(\d{1,2})`, 1, 12},
+	{"0M", `(\d{2})`, 1, 12},
+	{"WW", `(\d{1,2})`, 1, 53},
+	{"0W", `(\d{2})`, 1, 53},
+	{"DD", `(\d{1,2})`, 1, 31},
+	{"0D", `(\d{2})`, 1, 31},
+}
+
+func newCalverPattern(pattern string) CalverPattern {
+	p := CalverPattern{pattern: pattern}
+	expr := "^"
+	var hasYear bool
+	for rest := pattern; rest != ""; {
+		if strings.ContainsAny(rest[:1], ".-_") {
+			expr += regexp.QuoteMeta(rest[:1])
+			rest = rest[1:]
+			continue
+		}
+		var found bool
+		for _, element := range calverElements {
+			if strings.HasPrefix(rest, element.name) {
+				p.elements = append(p.elements, element)
+				expr += element.regexp
+				rest = rest[len(element.name):]
+				hasYear = hasYear || strings.HasSuffix(element.name, "Y")
+				found = true
+				break
+			}
+		}
+		if !found {
+			p.err = fmt.Errorf("unknown calendar version element at %q", rest)
+			return p
+		}
+	}
+	if !hasYear {
+		p.err = errors.New("calendar version format has no year")
+		return p
+	}
+	p.regexp = regexp.MustCompile(expr + "$")
+	return p
+}
+
+// values gives the values of the elements in the tag, or false if it
+// doesn't match the format.
+func (c CalverPattern) values(tag string) ([]int, bool) {
+	if c.regexp == nil {
+		return nil, false
+	}
+	match := c.regexp.FindStringSubmatch(tag)
+	if match == nil {
+		return nil, false
+	}
+	values := make([]int, len(c.elements))
+	for i, element := range c.elements {
+		v, err := strconv.Atoi(match[i+1])
+		if err != nil || (element.max > 0 && (v < element.min || v > element.max)) {
+			return nil, false
+		}
+		values[i] = v
+	}
+	return values, true
+}
+
+func (c CalverPattern) Matches(tag string) bool {
+	if c.regexp == nil {
+		// Invalid formats match anything
+		return true
+	}
+	_, ok := c.values(tag)
+	return ok
+}
+
+func (c CalverPattern) String() string {
+	return calverPrefix + c.pattern
+}
+
+func (c CalverPattern) Newer(a, b *image.Info) bool {
+	av, aok := c.values(a.ID.Tag)
+	bv, bok := c.values(b.ID.Tag)
+	switch {
+	case aok && !bok:
+		return true
+	case !aok || !bok:
+		return image.NewerByCreated(a, b)
+	}
+	for i := range av {
+		if av[i] != bv[i] {
+			return av[i] > bv[i]
+		}
+	}
+	return image.NewerByCreated(a, b)
+}
+
+func (c CalverPattern) Valid() bool {
+	return c.err == nil
+}
+
+func (n NumericPattern) number(tag string) (string, bool) {
+	if !strings.HasPrefix(tag, string(n)) {
+		return "", false
+	}
+	number := tag[len(n):]
+	if number == "" || !isNumber(number) {
+		return "", false
+	}
+	return number, true
+}
+
+func (n NumericPattern) Matches(tag string) bool {
+	_, ok := n.number(tag)
+	return ok
+}
+
+func (n NumericPattern) String() string {
+	return numericPrefix + string(n)
+}
+
+func (n NumericPattern) Newer(a, b *image.Info) bool {
+	an, aok := n.number(a.ID.Tag)
+	bn, bok := n.number(b.ID.Tag)
+	switch {
+	case aok && !bok:
+		return true
+	case !aok || !bok:
+		return image.NewerByCreated(a, b)
+	}
+	// Compare the numbers as strings, so that they can be of any
+	// length: a longer number (ignoring leading zeros) is bigger.
+	an, bn = strings.TrimLeft(an, "0"), strings.TrimLeft(bn, "0")
+	if len(an) != len(bn) {
+		return len(an) > len(bn)
+	}
+	if an != bn {
+		return an > bn
+	}
+	return image.NewerByCreated(a, b)
+}
+
+func (n NumericPattern) Valid() bool {
+	return true
+}
+
+// isNumber says whether the string is all digits (including when
+// it's empty).
+func isNumber(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
 }
@@ -1,10 +1,13 @@
 package policy
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
-	"fmt"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
 )
 
 func TestGlobPattern_Matches(t *testing.T) {
@@ -121,3 +124,119 @@ func TestRegexpPattern_Matches(t *testing.T) {
 		}
 	}
 }
+
+func TestSemverPattern_Prerelease(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		pattern string
+		true    []string
+		false   []string
+	}{
+		{
+			name:    "channel",
+			pattern: "semver:~1.2 prerelease=rc",
+			true:    []string{"1.2.3", "1.2.3-rc.1", "1.2.4-rc2", "1.2.0-rc"},
+			false:   []string{"1.2.3-beta.1", "1.2.3-rcx", "1.3.0-rc.1", "2.0.0"},
+		},
+		{
+			name:    "channels",
+			pattern: "semver:>=1.0 prerelease=rc,beta",
+			true:    []string{"1.0.0-beta.1", "1.4.0-rc.1", "2.0.0"},
+			false:   []string{"1.0.0-alpha.1", "0.9.0-rc.1"},
+		},
+	} {
+		pattern := NewPattern(tt.pattern)
+		assert.IsType(t, SemverPattern{}, pattern)
+		assert.True(t, pattern.Valid())
+		assert.Equal(t, tt.pattern, pattern.String())
+		for _, tag := range tt.true {
+			t.Run(fmt.Sprintf("%s[%q]", tt.name, tag), func(t *testing.T) {
+				assert.True(t, pattern.Matches(tag))
+			})
+		}
+		for _, tag := range tt.false {
+			t.Run(fmt.Sprintf("%s[%q]", tt.name, tag), func(t *testing.T) {
+				assert.False(t, pattern.Matches(tag))
+			})
+		}
+	}
+}
+
+func TestCalverPattern(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		pattern string
+		true    []string
+		false   []string
+	}{
+		{
+			name:    "date",
+			pattern: "calver:YYYY.0M.0D",
+			true:    []string{"2018.09.21", "2019.12.01"},
+			false:   []string{"2018.9.21", "2018.13.01", "2018.09.21.1", "18.09.21", "latest"},
+		},
+		{
+			name:    "short year with micro",
+			pattern: "calver:YY.MM-MICRO",
+			true:    []string{"18.9-1", "18.12-123"},
+			false:   []string{"18.9", "18.0-1", "2018.9-1"},
+		},
+	} {
+		pattern := NewPattern(tt.pattern)
+		assert.IsType(t, CalverPattern{}, pattern)
+		assert.True(t, pattern.Valid())
+		for _, tag := range tt.true {
+			t.Run(fmt.Sprintf("%s[%q]", tt.name, tag), func(t *testing.T) {
+				assert.True(t, pattern.Matches(tag))
+			})
+		}
+		for _, tag := range tt.false {
+			t.Run(fmt.Sprintf("%s[%q]", tt.name, tag), func(t *testing.T) {
+				assert.False(t, pattern.Matches(tag))
+			})
+		}
+	}
+
+	pattern := NewPattern("calver:YYYY.MM.MICRO")
+	older := &image.Info{ID: image.Ref{Tag: "2018.9.10"}, CreatedAt: time.Now()}
+	newer := &image.Info{ID: image.Ref{Tag: "2018.10.2"}, CreatedAt: time.Now().Add(-time.Hour)}
+	assert.True(t, pattern.Newer(newer, older))
+	assert.False(t, pattern.Newer(older, newer))
+}
+
+func TestNumericPattern(t *testing.T) {
+	pattern := NewPattern("numeric:build-")
+	assert.IsType(t, NumericPattern(""), pattern)
+	assert.True(t, pattern.Valid())
+	for _, tag := range []string{"build-1", "build-1234", "build-007"} {
+		assert.True(t, pattern.Matches(tag), tag)
+	}
+	for _, tag := range []string{"build-", "build-12a", "build1", "latest"} {
+		assert.False(t, pattern.Matches(tag), tag)
+	}
+
+	// Numbers sort numerically, not by creation time or as strings
+	b9 := &image.Info{ID: image.Ref{Tag: "build-9"}, CreatedAt: time.Now()}
+	b10 := &image.Info{ID: image.Ref{Tag: "build-10"}, CreatedAt: time.Now().Add(-time.Hour)}
+	b0011 := &image.Info{ID: image.Ref{Tag: "build-0011"}, CreatedAt: time.Now().Add(-2 * time.Hour)}
+	assert.True(t, pattern.Newer(b10, b9))
+	assert.False(t, pattern.Newer(b9, b10))
+	assert.True(t, pattern.Newer(b0011, b10))
+}
+
+func TestValidatePattern(t *testing.T) {
+	for _, valid := range []string{
+		"*", "glob:master-*", "semver:~1", "semver:~1.2 prerelease=rc", "regexp:^v[0-9]+$",
+		"calver:YYYY.0M.0D", "calver:0Y_0W", "numeric:build-", "numeric:",
+	} {
+		assert.NoError(t, ValidatePattern(valid), valid)
+		assert.True(t, NewPattern(valid).Valid(), valid)
+	}
+	for _, invalid := range []string{
+		"semver:invalid", "semver:~1 prerelease=", "semver:~1 channel=rc", "regexp:(",
+		"calver:", "calver:MAJOR.MINOR", "calver:YYYY.Month",
+	} {
+		assert.Error(t, ValidatePattern(invalid), invalid)
+		assert.False(t, NewPattern(invalid).Valid(), invalid)
+	}
+}
@@ -14,6 +14,35 @@ const (
 	LockedMsg  = Policy("locked_msg")
 	Automated  = Policy("automated")
 	TagAll     = Policy("tag_all")
+	// RollbackOnFailure means a workload that fails to roll out after
+	// a sync is returned to its previously synced definition.
+	RollbackOnFailure = Policy("rollback-on-failure")
+	// Pin says how the images of a workload are written when
+	// released; the only value understood is PinDigest.
+	Pin = Policy("pin")
+	// Sort says how the images of a workload are ordered, when its
+	// tag patterns don't imply an order; see SortOrder.
+	Sort = Policy("sort")
+	// Approval says how automated releases of a workload are gated;
+	// see ApprovalManual and ApprovalBranch.
+	Approval = Policy("approval")
+	// Canary marks a workload as one of those released to first,
+	// when automated releases are made in stages.
+	Canary = Policy("canary")
+)
+
+// PinDigest is the value of the Pin policy which means releases
+// write images as `repo:tag@digest`, so that moving a tag does not
+// change what is run.
+const PinDigest = "digest"
+
+// The values of the Approval policy. With ApprovalManual, automated
+// releases wait to be approved before they are pushed; with
+// ApprovalBranch, they are also pushed to a branch of their own, so
+// they can be reviewed and merged as a pull request.
+const (
+	ApprovalManual = "manual"
+	ApprovalBranch = "branch"
 )
 
 // Policy is an string, denoting the current deployment policy of a service,
@@ -22,7 +51,7 @@ type Policy string
 
 func Boolean(policy Policy) bool {
 	switch policy {
-	case Locked, Automated, Ignore:
+	case Locked, Automated, Ignore, RollbackOnFailure, Canary:
 		return true
 	}
 	return false
@@ -36,15 +65,31 @@ func Tag(policy Policy) bool {
 	return strings.HasPrefix(string(policy), "tag.")
 }
 
+// GetTagPattern gives the tag pattern for the container given, taking
+// into account any sort policy.
 func GetTagPattern(policies Set, container string) Pattern {
-	if policies == nil {
-		return PatternAll
+	pattern := PatternAll
+	if p, ok := policies.Get(TagPrefix(container)); ok {
+		pattern = NewPattern(p)
 	}
-	pattern, ok := policies.Get(TagPrefix(container))
-	if !ok {
-		return PatternAll
+	return WithSortOrder(pattern, policies)
+}
+
+// PinsDigest says whether the policies given pin images to digests.
+func PinsDigest(policies Set) bool {
+	v, ok := policies.Get(Pin)
+	return ok && v == PinDigest
+}
+
+// ApprovalMode gives the value of the Approval policy, if it is one
+// that's understood, or the empty string if automated releases are
+// not gated.
+func ApprovalMode(policies Set) string {
+	switch v, _ := policies.Get(Approval); v {
+	case ApprovalManual, ApprovalBranch:
+		return v
 	}
-	return NewPattern(pattern)
+	return ""
 }
 
 type Updates map[flux.ResourceID]Update
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
 )
 
 func TestJSON(t *testing.T) {
@@ -88,3 +91,49 @@ func Test_GetTagPattern(t *testing.T) {
 		})
 	}
 }
+
+func Test_GetTagPattern_sort(t *testing.T) {
+	container := "helloContainer"
+	older := &image.Info{ID: image.Ref{Tag: "master-a"}, CreatedAt: time.Now(), FirstSeen: time.Now().Add(-time.Hour)}
+	newer := &image.Info{ID: image.Ref{Tag: "master-b"}, CreatedAt: time.Now().Add(-time.Hour), FirstSeen: time.Now()}
+
+	// By default, images are ordered by when they were created
+	pattern := GetTagPattern(Set{TagPrefix(container): "glob:master-*"}, container)
+	assert.True(t, pattern.Newer(older, newer))
+
+	pattern = GetTagPattern(Set{TagPrefix(container): "glob:master-*", Sort: SortFirstSeen}, container)
+	assert.Equal(t, "glob:master-*", pattern.String())
+	assert.True(t, pattern.Matches("master-c"))
+	assert.True(t, pattern.Newer(newer, older))
+	assert.False(t, pattern.Newer(older, newer))
+
+	// The sort policy applies when there's no tag pattern, too
+	pattern = GetTagPattern(Set{Sort: SortFirstSeen}, container)
+	assert.True(t, pattern.Newer(newer, older))
+
+	// .. but not to patterns that have their own order
+	pattern = GetTagPattern(Set{TagPrefix(container): "semver:*", Sort: SortFirstSeen}, container)
+	assert.IsType(t, SemverPattern{}, pattern)
+
+	// An invalid sort policy is ignored
+	pattern = GetTagPattern(Set{Sort: "backwards"}, container)
+	assert.Equal(t, PatternAll, pattern)
+}
+
+func TestSortOrder(t *testing.T) {
+	for _, valid := range []string{SortCreated, SortFirstSeen, SortLabel, "label:com.example.build-number"} {
+		_, err := SortOrder(valid)
+		assert.NoError(t, err, valid)
+	}
+	for _, invalid := range []string{"", "label:", "newest"} {
+		_, err := SortOrder(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestApprovalMode(t *testing.T) {
+	assert.Equal(t, "", ApprovalMode(nil))
+	assert.Equal(t, ApprovalManual, ApprovalMode(Set{Approval: "manual"}))
+	assert.Equal(t, ApprovalBranch, ApprovalMode(Set{Approval: "branch"}))
+	assert.Equal(t, "", ApprovalMode(Set{Approval: "sometimes"}))
+}
@@ -0,0 +1,187 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	azureDefaultMetadataURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+	azureDefaultAuthority   = "https://login.microsoftonline.com/"
+	azureResource           = "https://management.azure.com/"
+	azureScope              = azureResource + ".default"
+	azureAssertionType      = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	// ACR accepts this as the username, with a refresh token as the
+	// password
+	acrTokenUsername = "00000000-0000-0000-0000-000000000000"
+)
+
+// ACR hosts look like <registry>.azurecr.io, or similar for the
+// national clouds
+var acrHostPattern = regexp.MustCompile(`^[a-z0-9]+\.azurecr\.(io|cn|de|us)$`)
+
+// ACRProvider gives credentials for Azure Container Registry, using
+// the identity the daemon runs as. An Azure AD access token for the
+// identity is obtained, then exchanged with the registry for a
+// refresh token.
+//
+// If AZURE_FEDERATED_TOKEN_FILE is set (as it is by AKS workload
+// identity), the access token is obtained from Azure AD for the
+// application AZURE_CLIENT_ID in the tenant AZURE_TENANT_ID, using the
+// token in that file as the client assertion. Otherwise, it's obtained
+// for the managed identity of the node from the instance metadata
+// service.
+type ACRProvider struct {
+	// The URL of the instance metadata service's token endpoint; if
+	// empty, the usual address is used
+	MetadataURL string
+	// The URL of the Azure AD authority, used with workload
+	// identity; if empty, AZURE_AUTHORITY_HOST is used, or failing
+	// that the public cloud's authority
+	AuthorityURL string
+	// The URL of the registry's token exchange endpoint; if empty,
+	// https://<host>/oauth2/exchange is used
+	ExchangeURL string
+	Client      *http.Client
+}
+
+func (p *ACRProvider) Name() string {
+	return "Azure identity"
+}
+
+func (p *ACRProvider) Matches(host string) bool {
+	return acrHostPattern.MatchString(host)
+}
+
+func (p *ACRProvider) Credentials(host string) (string, string, time.Time, error) {
+	var (
+		accessToken string
+		expiry      time.Time
+		err         error
+	)
+	if tokenFile := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); tokenFile != "" {
+		accessToken, expiry, err = p.workloadIdentityToken(tokenFile)
+	} else {
+		accessToken, expiry, err = p.managedIdentityToken()
+	}
+	if err != nil {
+		return "", "", time.Time{}, errors.Wrap(err, "obtaining Azure AD token")
+	}
+
+	exchangeURL := p.ExchangeURL
+	if exchangeURL == "" {
+		exchangeURL = fmt.Sprintf("https://%s/oauth2/exchange", host)
+	}
+	request, err := http.NewRequest("POST", exchangeURL, strings.NewReader(url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {host},
+		"access_token": {accessToken},
+	}.Encode()))
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var refreshToken struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := p.doJSON(request, &refreshToken); err != nil {
+		return "", "", time.Time{}, errors.Wrapf(err, "exchanging Azure AD token with %s", host)
+	}
+	return acrTokenUsername, refreshToken.RefreshToken, expiry, nil
+}
+
+// managedIdentityToken gets an access token for the managed identity
+// of the node from the instance metadata service.
+func (p *ACRProvider) managedIdentityToken() (string, time.Time, error) {
+	metadataURL := p.MetadataURL
+	if metadataURL == "" {
+		metadataURL = azureDefaultMetadataURL
+	}
+	request, err := http.NewRequest("GET", metadataURL+"?"+url.Values{
+		"api-version": {"2018-02-01"},
+		"resource":    {azureResource},
+	}.Encode(), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	request.Header.Set("Metadata", "true")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+	if err := p.doJSON(request, &token); err != nil {
+		return "", time.Time{}, err
+	}
+	expiresOn, err := strconv.ParseInt(token.ExpiresOn, 10, 64)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "parsing expiry of token")
+	}
+	return token.AccessToken, time.Unix(expiresOn, 0), nil
+}
+
+// workloadIdentityToken gets an access token for the application
+// given in the environment, using the federated token in the file
+// given as the client assertion.
+func (p *ACRProvider) workloadIdentityToken(tokenFile string) (string, time.Time, error) {
+	clientID, tenantID := os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_TENANT_ID")
+	if clientID == "" || tenantID == "" {
+		return "", time.Time{}, errors.New("AZURE_CLIENT_ID and AZURE_TENANT_ID must be set to use workload identity")
+	}
+	assertion, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "reading federated token")
+	}
+	authority := p.AuthorityURL
+	if authority == "" {
+		authority = os.Getenv("AZURE_AUTHORITY_HOST")
+	}
+	if authority == "" {
+		authority = azureDefaultAuthority
+	}
+
+	start := time.Now()
+	request, err := http.NewRequest("POST", strings.TrimSuffix(authority, "/")+"/"+tenantID+"/oauth2/v2.0/token", strings.NewReader(url.Values{
+		"client_id":             {clientID},
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {azureAssertionType},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+		"scope":                 {azureScope},
+	}.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := p.doJSON(request, &token); err != nil {
+		return "", time.Time{}, err
+	}
+	return token.AccessToken, start.Add(time.Duration(token.ExpiresIn) * time.Second), nil
+}
+
+func (p *ACRProvider) doJSON(request *http.Request, dest interface{}) error {
+	response, err := httpClient(p.Client).Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(dest)
+}
@@ -0,0 +1,220 @@
+/*
+This package implements an image DB cache on disk, so that the
+cache survives restarts of the daemon without needing memcached.
+
+Each entry is kept in its own file in a directory, named for a hash
+of the key; the file holds the refresh deadline and expiry of the
+entry, followed by its value. Entries are given an expiry in the same
+way as for memcached: based on their refresh deadline, with a minimum
+duration, so they will expire well after they would have been
+refreshed. Expired entries are removed periodically.
+*/
+package disk
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/registry/cache"
+)
+
+const (
+	// The minimum expiry given to an entry.
+	MinExpiry = time.Hour
+
+	// The refresh deadline and expiry, as nanoseconds since the
+	// epoch, precede the value in each file
+	headerSize = 16
+	tmpPrefix  = ".tmp-"
+)
+
+// DiskClient is a cache client that keeps entries in files in a
+// directory.
+type DiskClient struct {
+	dir    string
+	logger log.Logger
+	now    func() time.Time
+
+	quit chan struct{}
+	wait sync.WaitGroup
+}
+
+// DiskConfig defines how a DiskClient should be constructed.
+type DiskConfig struct {
+	// The directory in which to keep entries; it's created if it
+	// doesn't exist
+	Dir string
+	// How often to remove expired entries
+	SweepInterval time.Duration
+	Logger        log.Logger
+}
+
+// NewDiskClient constructs a DiskClient, and starts removing expired
+// entries in the background.
+func NewDiskClient(config DiskConfig) (*DiskClient, error) {
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "creating cache directory")
+	}
+	c := &DiskClient{
+		dir:    config.Dir,
+		logger: config.Logger,
+		now:    time.Now,
+		quit:   make(chan struct{}),
+	}
+	c.wait.Add(1)
+	go c.sweepLoop(config.SweepInterval)
+	return c, nil
+}
+
+// GetKey gets the value and its refresh deadline from the cache.
+func (c *DiskClient) GetKey(k cache.Keyer) ([]byte, time.Time, error) {
+	bytes, err := ioutil.ReadFile(c.path(k))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []byte{}, time.Time{}, cache.ErrNotCached
+		}
+		c.logger.Log("err", errors.Wrap(err, "reading from disk cache"))
+		return []byte{}, time.Time{}, err
+	}
+	if len(bytes) < headerSize {
+		return []byte{}, time.Time{}, cache.ErrNotCached
+	}
+	deadline, expiry := readHeader(bytes)
+	if !c.now().Before(expiry) {
+		return []byte{}, time.Time{}, cache.ErrNotCached
+	}
+	return bytes[headerSize:], deadline, nil
+}
+
+// SetKey sets the value and its refresh deadline at a key. NB the
+// entry's expiry is set _longer_ than the deadline, to give us a
+// grace period in which to refresh the value.
+func (c *DiskClient) SetKey(k cache.Keyer, refreshDeadline time.Time, v []byte) error {
+	now := c.now()
+	expiry := refreshDeadline.Sub(now) * 2
+	if expiry < MinExpiry {
+		expiry = MinExpiry
+	}
+	header := make([]byte, headerSize)
+	binary.BigEndian.PutUint64(header, uint64(refreshDeadline.UnixNano()))
+	binary.BigEndian.PutUint64(header[8:], uint64(now.Add(expiry).UnixNano()))
+
+	// Write to a temporary file then rename it, so that readers
+	// never see a partially written entry
+	if err := c.writeFile(c.path(k), append(header, v...)); err != nil {
+		c.logger.Log("err", errors.Wrap(err, "storing in disk cache"))
+		return err
+	}
+	return nil
+}
+
+// Stop removing expired entries.
+func (c *DiskClient) Stop() {
+	close(c.quit)
+	c.wait.Wait()
+}
+
+func (c *DiskClient) path(k cache.Keyer) string {
+	sum := sha256.Sum256([]byte(k.Key()))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+func (c *DiskClient) writeFile(path string, bytes []byte) error {
+	f, err := ioutil.TempFile(c.dir, tmpPrefix)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(bytes)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (c *DiskClient) sweepLoop(interval time.Duration) {
+	defer c.wait.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.sweep(); err != nil {
+			c.logger.Log("err", errors.Wrap(err, "removing expired entries from disk cache"))
+		}
+		select {
+		case <-ticker.C:
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// sweep removes expired entries, and any temporary files left over
+// from writes that didn't complete.
+func (c *DiskClient) sweep() error {
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	now := c.now()
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		path := filepath.Join(c.dir, info.Name())
+		if strings.HasPrefix(info.Name(), tmpPrefix) {
+			// Allow time for the write to finish
+			if now.Sub(info.ModTime()) > time.Minute {
+				os.Remove(path)
+			}
+			continue
+		}
+		expired, err := isExpired(path, now)
+		if err != nil {
+			return err
+		}
+		if expired {
+			os.Remove(path)
+		}
+	}
+	return nil
+}
+
+func isExpired(path string, now time.Time) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		// Not an entry we can make sense of
+		return true, nil
+	}
+	_, expiry := readHeader(header)
+	return !now.Before(expiry), nil
+}
+
+func readHeader(bytes []byte) (deadline, expiry time.Time) {
+	deadline = time.Unix(0, int64(binary.BigEndian.Uint64(bytes)))
+	expiry = time.Unix(0, int64(binary.BigEndian.Uint64(bytes[8:])))
+	return deadline, expiry
+}
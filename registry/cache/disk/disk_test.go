@@ -0,0 +1,92 @@
+package disk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/registry/cache"
+)
+
+type testKey string
+
+func (t testKey) Key() string {
+	return string(t)
+}
+
+func setup(t *testing.T) (*DiskClient, string, func()) {
+	dir, err := ioutil.TempDir("", "flux-disk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewDiskClient(DiskConfig{
+		Dir:           filepath.Join(dir, "cache"),
+		SweepInterval: time.Hour,
+		Logger:        log.NewNopLogger(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, filepath.Join(dir, "cache"), func() {
+		c.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDisk_ReadWrite(t *testing.T) {
+	c, dir, clean := setup(t)
+	defer clean()
+
+	deadline := time.Now().Add(time.Minute)
+	assert.NoError(t, c.SetKey(testKey("registryrepov3|example.com/foo"), deadline, []byte("test bytes")))
+	v, d, err := c.GetKey(testKey("registryrepov3|example.com/foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test bytes", string(v))
+	assert.True(t, deadline.Equal(d))
+
+	_, _, err = c.GetKey(testKey("registryrepov3|example.com/bar"))
+	assert.Equal(t, cache.ErrNotCached, err)
+
+	// Entries survive a restart
+	restarted, err := NewDiskClient(DiskConfig{Dir: dir, SweepInterval: time.Hour, Logger: log.NewNopLogger()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Stop()
+	v, _, err = restarted.GetKey(testKey("registryrepov3|example.com/foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test bytes", string(v))
+}
+
+func TestDisk_Expiry(t *testing.T) {
+	c, dir, clean := setup(t)
+	defer clean()
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.SetKey(testKey("a"), now.Add(time.Minute), []byte("a"))
+	c.SetKey(testKey("b"), now.Add(2*time.Hour), []byte("b"))
+	ioutil.WriteFile(filepath.Join(dir, tmpPrefix+"leftover"), []byte("partial"), 0600)
+
+	// Past its deadline, but within the grace period, an entry is
+	// still returned, so it can be refreshed
+	now = now.Add(2 * time.Minute)
+	_, _, err := c.GetKey(testKey("a"))
+	assert.NoError(t, err)
+
+	now = now.Add(MinExpiry)
+	_, _, err = c.GetKey(testKey("a"))
+	assert.Equal(t, cache.ErrNotCached, err)
+
+	assert.NoError(t, c.sweep())
+	infos, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, infos, 1) {
+		assert.Equal(t, filepath.Base(c.path(testKey("b"))), infos[0].Name())
+	}
+}
@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/ryanuber/go-glob"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+)
+
+// The reasons a tag may be skipped by a TagFilter.
+const (
+	SkippedExcluded  = "excluded"
+	SkippedUnused    = "unused"
+	SkippedRetention = "retention"
+)
+
+// The orders in which tags may be retained.
+const (
+	// RetainByName keeps the tags that sort last by name
+	RetainByName = "name"
+	// RetainBySemver keeps the highest semantic versions, then the
+	// tags that sort last by name
+	RetainBySemver = "semver"
+)
+
+// TagFilter decides which of the tags of an image repository the
+// warmer fetches manifests for. The tags it skips aren't fetched, and
+// are left out of the repository's metadata in the cache.
+type TagFilter struct {
+	// Tags matching any of these are skipped
+	Exclude []ExcludeRule
+	// If not nil, this gives how workloads use the tags of each
+	// image. The tags workloads use now are always kept.
+	InUse func() map[image.CanonicalName]TagsInUse
+	// If true, tags that match none of the patterns in use for an
+	// image are skipped. Images not in use aren't filtered.
+	InUseOnly bool
+	// If more than zero, at most this many tags are kept, the newest
+	// according to RetainOrder, along with any tags in use
+	Retain      int
+	RetainOrder string
+}
+
+// TagsInUse is how the workloads using an image use its tags.
+type TagsInUse struct {
+	// The tag patterns of the workloads; if empty, the tags aren't
+	// filtered by pattern
+	Patterns []policy.Pattern
+	// The tags the workloads use now, which are always kept (unless
+	// excluded), so that there's metadata for the images running
+	Current []string
+}
+
+// ExcludeRule excludes tags matching a glob, in image repositories
+// whose canonical name matches a glob, or in all repositories.
+type ExcludeRule struct {
+	Image string // if empty, all repositories
+	Tag   string
+}
+
+// ParseExcludeRule parses a rule given as `[<image>:]<tag>`, where
+// each of the image and tag may be a glob; e.g., `ci-*`, or
+// `quay.io/weaveworks/*:ci-*`.
+func ParseExcludeRule(s string) (ExcludeRule, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		if s == "" {
+			return ExcludeRule{}, fmt.Errorf("empty tag exclusion")
+		}
+		return ExcludeRule{Tag: s}, nil
+	}
+	name, tag := s[:i], s[i+1:]
+	if name == "" || tag == "" {
+		return ExcludeRule{}, fmt.Errorf("tag exclusion %q: expected [<image>:]<tag>", s)
+	}
+	if name == "*" {
+		return ExcludeRule{Tag: tag}, nil
+	}
+	// Canonicalise the image, so that e.g., `weaveworks/*` matches
+	// images from Docker Hub however they are given
+	ref, err := image.ParseRef(name)
+	if err != nil {
+		return ExcludeRule{}, fmt.Errorf("tag exclusion %q: %s", s, err)
+	}
+	return ExcludeRule{Image: ref.CanonicalName().String(), Tag: tag}, nil
+}
+
+// Excludes says whether the rule excludes the tag given, of the image
+// given.
+func (r ExcludeRule) Excludes(name image.CanonicalName, tag string) bool {
+	return (r.Image == "" || glob.Glob(r.Image, name.String())) && glob.Glob(r.Tag, tag)
+}
+
+// Apply gives the tags to keep, of those given for the image given,
+// and the number skipped for each reason.
+func (f *TagFilter) Apply(name image.CanonicalName, tags []string) ([]string, map[string]int) {
+	skipped := map[string]int{}
+
+	var use TagsInUse
+	if f.InUse != nil {
+		use = f.InUse()[name]
+	}
+	current := map[string]bool{}
+	for _, tag := range use.Current {
+		current[tag] = true
+	}
+
+	var kept []string
+	var inUse int
+tags:
+	for _, tag := range tags {
+		for _, rule := range f.Exclude {
+			if rule.Excludes(name, tag) {
+				skipped[SkippedExcluded]++
+				continue tags
+			}
+		}
+		if current[tag] {
+			inUse++
+		} else if f.InUseOnly && len(use.Patterns) > 0 && !matchesAny(use.Patterns, tag) {
+			skipped[SkippedUnused]++
+			continue
+		}
+		kept = append(kept, tag)
+	}
+
+	if f.Retain > 0 && len(kept) > f.Retain {
+		// The tags in use go first, so they're always retained
+		sortNewestFirst(kept, f.RetainOrder)
+		sort.SliceStable(kept, func(i, j int) bool {
+			return current[kept[i]] && !current[kept[j]]
+		})
+		retain := f.Retain
+		if retain < inUse {
+			retain = inUse
+		}
+		skipped[SkippedRetention] = len(kept) - retain
+		kept = kept[:retain]
+	}
+	return kept, skipped
+}
+
+func matchesAny(patterns []policy.Pattern, tag string) bool {
+	for _, p := range patterns {
+		if p.Matches(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortNewestFirst(tags []string, order string) {
+	if order != RetainBySemver {
+		sort.Sort(sort.Reverse(sort.StringSlice(tags)))
+		return
+	}
+	versions := map[string]*semver.Version{}
+	for _, tag := range tags {
+		if v, err := semver.NewVersion(tag); err == nil {
+			versions[tag] = v
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		vi, vj := versions[tags[i]], versions[tags[j]]
+		switch {
+		case vi != nil && vj != nil:
+			if !vi.Equal(vj) {
+				return vi.GreaterThan(vj)
+			}
+		case vi != nil:
+			return true
+		case vj != nil:
+			return false
+		}
+		return tags[i] > tags[j]
+	})
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+)
+
+func canonical(s string) image.CanonicalName {
+	ref, err := image.ParseRef(s)
+	if err != nil {
+		panic(err)
+	}
+	return ref.CanonicalName()
+}
+
+func TestParseExcludeRule(t *testing.T) {
+	for _, v := range []struct {
+		rule     string
+		expected ExcludeRule
+		error    bool
+	}{
+		{rule: "ci-*", expected: ExcludeRule{Tag: "ci-*"}},
+		{rule: "*:ci-*", expected: ExcludeRule{Tag: "ci-*"}},
+		{rule: "quay.io/weaveworks/*:ci-*", expected: ExcludeRule{Image: "quay.io/weaveworks/*", Tag: "ci-*"}},
+		{rule: "weaveworks/flux:ci-*", expected: ExcludeRule{Image: "index.docker.io/weaveworks/flux", Tag: "ci-*"}},
+		{rule: "localhost:5000/app:ci-*", expected: ExcludeRule{Image: "localhost:5000/app", Tag: "ci-*"}},
+		{rule: "", error: true},
+		{rule: "weaveworks/flux:", error: true},
+		{rule: ":ci-*", error: true},
+	} {
+		rule, err := ParseExcludeRule(v.rule)
+		if v.error {
+			assert.Error(t, err, v.rule)
+			continue
+		}
+		assert.NoError(t, err, v.rule)
+		assert.Equal(t, v.expected, rule, v.rule)
+	}
+}
+
+func TestTagFilter_Exclude(t *testing.T) {
+	var rules []ExcludeRule
+	for _, s := range []string{"ci-*", "weaveworks/*:pr-*"} {
+		rule, err := ParseExcludeRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	f := &TagFilter{Exclude: rules}
+	tags := []string{"1.0", "ci-123", "pr-45"}
+
+	kept, skipped := f.Apply(canonical("weaveworks/flux"), tags)
+	assert.Equal(t, []string{"1.0"}, kept)
+	assert.Equal(t, map[string]int{SkippedExcluded: 2}, skipped)
+
+	kept, skipped = f.Apply(canonical("quay.io/weaveworks/flux"), tags)
+	assert.Equal(t, []string{"1.0", "pr-45"}, kept)
+	assert.Equal(t, map[string]int{SkippedExcluded: 1}, skipped)
+}
+
+func TestTagFilter_InUse(t *testing.T) {
+	f := &TagFilter{
+		InUse: func() map[image.CanonicalName]TagsInUse {
+			return map[image.CanonicalName]TagsInUse{
+				canonical("weaveworks/flux"): {
+					Patterns: []policy.Pattern{policy.NewPattern("semver:~1"), policy.NewPattern("glob:stable-*")},
+					Current:  []string{"1.2.0"},
+				},
+			}
+		},
+		InUseOnly: true,
+	}
+	tags := []string{"1.0.0", "1.2.0", "2.0.0", "stable-3", "master-abc"}
+
+	kept, skipped := f.Apply(canonical("docker.io/weaveworks/flux"), tags)
+	assert.Equal(t, []string{"1.0.0", "1.2.0", "stable-3"}, kept)
+	assert.Equal(t, map[string]int{SkippedUnused: 2}, skipped)
+
+	// Images without patterns aren't filtered
+	kept, _ = f.Apply(canonical("weaveworks/other"), tags)
+	assert.Equal(t, tags, kept)
+}
+
+func TestTagFilter_Current(t *testing.T) {
+	f := &TagFilter{
+		InUse: func() map[image.CanonicalName]TagsInUse {
+			return map[image.CanonicalName]TagsInUse{
+				canonical("weaveworks/flux"): {
+					Patterns: []policy.Pattern{policy.NewPattern("semver:~1")},
+					Current:  []string{"master-abc"},
+				},
+			}
+		},
+		InUseOnly:   true,
+		Retain:      2,
+		RetainOrder: RetainBySemver,
+	}
+	tags := []string{"1.0.0", "1.2.0", "1.3.0", "2.0.0", "master-abc"}
+
+	// The tag in use is kept, though it no longer matches the pattern
+	// and isn't among the newest
+	kept, skipped := f.Apply(canonical("weaveworks/flux"), tags)
+	assert.Equal(t, []string{"master-abc", "1.3.0"}, kept)
+	assert.Equal(t, map[string]int{SkippedUnused: 1, SkippedRetention: 2}, skipped)
+
+	// Tags in use are kept even if there's more of them than the
+	// retention limit, and whether or not tags are filtered by the
+	// patterns in use
+	f.InUseOnly = false
+	f.Retain = 1
+	f.InUse = func() map[image.CanonicalName]TagsInUse {
+		return map[image.CanonicalName]TagsInUse{
+			canonical("weaveworks/flux"): {Current: []string{"1.0.0", "master-abc"}},
+		}
+	}
+	kept, _ = f.Apply(canonical("weaveworks/flux"), tags)
+	assert.ElementsMatch(t, []string{"1.0.0", "master-abc"}, kept)
+}
+
+func TestTagFilter_Retain(t *testing.T) {
+	tags := []string{"v1.9.0", "1.10.0", "master-b", "1.2.0", "master-a", "1.10.0-rc.1"}
+
+	f := &TagFilter{Retain: 3, RetainOrder: RetainBySemver}
+	kept, skipped := f.Apply(canonical("weaveworks/flux"), append([]string(nil), tags...))
+	assert.Equal(t, []string{"1.10.0", "1.10.0-rc.1", "v1.9.0"}, kept)
+	assert.Equal(t, map[string]int{SkippedRetention: 3}, skipped)
+
+	// Non-semver tags come after any versions
+	f.Retain = 5
+	kept, _ = f.Apply(canonical("weaveworks/flux"), append([]string(nil), tags...))
+	assert.Equal(t, []string{"1.10.0", "1.10.0-rc.1", "v1.9.0", "1.2.0", "master-b"}, kept)
+
+	f = &TagFilter{Retain: 2, RetainOrder: RetainByName}
+	kept, _ = f.Apply(canonical("weaveworks/flux"), append([]string(nil), tags...))
+	assert.Equal(t, []string{"v1.9.0", "master-b"}, kept)
+
+	// Fewer tags than the limit are left as they are
+	f.Retain = 10
+	kept, skipped = f.Apply(canonical("weaveworks/flux"), append([]string(nil), tags...))
+	assert.Equal(t, tags, kept)
+	assert.Empty(t, skipped)
+}
@@ -0,0 +1,110 @@
+/*
+This package implements an image DB cache in memory, for when
+running memcached is not worth the trouble.
+
+Entries are given an expiry in the same way as for memcached: based
+on their refresh deadline, with a minimum duration, so they will
+expire well after they would have been refreshed. The cache is
+bounded in size; when it's full, the least recently used entries are
+evicted.
+*/
+package memory
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/flux/registry/cache"
+)
+
+const (
+	// The minimum expiry given to an entry.
+	MinExpiry = time.Hour
+)
+
+type entry struct {
+	key      string
+	value    []byte
+	deadline time.Time
+	expiry   time.Time
+}
+
+// LRUClient is a cache client that keeps entries in memory, up to a
+// maximum total size, evicting the least recently used entries to
+// make room.
+type LRUClient struct {
+	maxBytes int
+	now      func() time.Time
+
+	mu      sync.Mutex
+	bytes   int
+	recency *list.List // of *entry, most recently used first
+	entries map[string]*list.Element
+}
+
+// NewLRUClient constructs an LRUClient that holds at most maxBytes
+// of values.
+func NewLRUClient(maxBytes int) *LRUClient {
+	return &LRUClient{
+		maxBytes: maxBytes,
+		now:      time.Now,
+		recency:  list.New(),
+		entries:  map[string]*list.Element{},
+	}
+}
+
+// GetKey gets the value and its refresh deadline from the cache.
+func (c *LRUClient) GetKey(k cache.Keyer) ([]byte, time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[k.Key()]
+	if !ok {
+		return []byte{}, time.Time{}, cache.ErrNotCached
+	}
+	e := elem.Value.(*entry)
+	if !c.now().Before(e.expiry) {
+		c.remove(elem)
+		return []byte{}, time.Time{}, cache.ErrNotCached
+	}
+	c.recency.MoveToFront(elem)
+	return e.value, e.deadline, nil
+}
+
+// SetKey sets the value and its refresh deadline at a key. NB the
+// entry's expiry is set _longer_ than the deadline, to give us a
+// grace period in which to refresh the value.
+func (c *LRUClient) SetKey(k cache.Keyer, refreshDeadline time.Time, v []byte) error {
+	if len(v) > c.maxBytes {
+		return fmt.Errorf("value of %d bytes is too large for cache of %d bytes", len(v), c.maxBytes)
+	}
+	now := c.now()
+	expiry := refreshDeadline.Sub(now) * 2
+	if expiry < MinExpiry {
+		expiry = MinExpiry
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[k.Key()]; ok {
+		c.remove(elem)
+	}
+	c.entries[k.Key()] = c.recency.PushFront(&entry{
+		key:      k.Key(),
+		value:    v,
+		deadline: refreshDeadline,
+		expiry:   now.Add(expiry),
+	})
+	c.bytes += len(v)
+	for c.bytes > c.maxBytes {
+		c.remove(c.recency.Back())
+	}
+	return nil
+}
+
+func (c *LRUClient) remove(elem *list.Element) {
+	e := c.recency.Remove(elem).(*entry)
+	delete(c.entries, e.key)
+	c.bytes -= len(e.value)
+}
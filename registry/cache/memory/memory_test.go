@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/registry/cache"
+)
+
+type testKey string
+
+func (t testKey) Key() string {
+	return string(t)
+}
+
+func TestLRU_ReadWrite(t *testing.T) {
+	c := NewLRUClient(1024)
+	deadline := time.Now().Add(time.Minute)
+	assert.NoError(t, c.SetKey(testKey("a"), deadline, []byte("test bytes")))
+
+	v, d, err := c.GetKey(testKey("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test bytes", string(v))
+	assert.True(t, deadline.Equal(d))
+
+	_, _, err = c.GetKey(testKey("b"))
+	assert.Equal(t, cache.ErrNotCached, err)
+}
+
+func TestLRU_Evicts(t *testing.T) {
+	c := NewLRUClient(10)
+	deadline := time.Now().Add(time.Minute)
+	c.SetKey(testKey("a"), deadline, []byte("aaaa"))
+	c.SetKey(testKey("b"), deadline, []byte("bbbb"))
+	// Using "a" makes "b" the least recently used
+	c.GetKey(testKey("a"))
+	c.SetKey(testKey("c"), deadline, []byte("cccc"))
+
+	_, _, err := c.GetKey(testKey("b"))
+	assert.Equal(t, cache.ErrNotCached, err)
+	for _, k := range []testKey{"a", "c"} {
+		_, _, err = c.GetKey(k)
+		assert.NoError(t, err, string(k))
+	}
+
+	// Replacing a value doesn't count it twice
+	assert.NoError(t, c.SetKey(testKey("a"), deadline, []byte("AAAAAA")))
+	_, _, err = c.GetKey(testKey("c"))
+	assert.NoError(t, err)
+
+	assert.Error(t, c.SetKey(testKey("d"), deadline, []byte("too many bytes")))
+}
+
+func TestLRU_Expiry(t *testing.T) {
+	now := time.Now()
+	c := NewLRUClient(1024)
+	c.now = func() time.Time { return now }
+
+	// Past its deadline, but within the grace period, an entry is
+	// still returned, so it can be refreshed
+	c.SetKey(testKey("a"), now.Add(time.Minute), []byte("a"))
+	now = now.Add(time.Minute + time.Second)
+	_, d, err := c.GetKey(testKey("a"))
+	assert.NoError(t, err)
+	assert.True(t, d.Before(now))
+
+	now = now.Add(MinExpiry)
+	_, _, err = c.GetKey(testKey("a"))
+	assert.Equal(t, cache.ErrNotCached, err)
+	assert.Equal(t, 0, c.bytes)
+}
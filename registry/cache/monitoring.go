@@ -18,6 +18,13 @@ var (
 		Help:      "Duration of cache requests, in seconds.",
 		Buckets:   stdprometheus.DefBuckets,
 	}, []string{fluxmetrics.LabelMethod, fluxmetrics.LabelSuccess})
+
+	skippedTags = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "cache",
+		Name:      "skipped_tags_total",
+		Help:      "Tags the warmer skipped fetching manifests for, by reason.",
+	}, []string{"reason"})
 )
 
 type instrumentedClient struct {
@@ -54,6 +54,8 @@ type Warmer struct {
 	Trace         bool
 	Priority      chan image.Name
 	Notify        func()
+	// If not nil, decides which tags to fetch manifests for
+	Filter *TagFilter
 }
 
 // NewWarmer creates cache warmer that (when Loop is invoked) will
@@ -96,9 +98,18 @@ func (w *Warmer) Loop(logger log.Logger, stop <-chan struct{}, wg *sync.WaitGrou
 		logger.Log("priority", name.String())
 		if creds, ok := imageCreds[name]; ok {
 			w.warm(ctx, time.Now(), logger, name, creds)
-		} else {
-			logger.Log("priority", name.String(), "err", "no creds available")
+			return
 		}
+		// The name may be given differently to how it's used in the
+		// cluster, e.g., with or without the Docker Hub domain
+		canonical := name.CanonicalName()
+		for running, creds := range imageCreds {
+			if running.CanonicalName() == canonical {
+				w.warm(ctx, time.Now(), logger, running, creds)
+				return
+			}
+		}
+		logger.Log("priority", name.String(), "err", "no creds available")
 	}
 
 	// This loop acts keeps a kind of priority queue, whereby image
@@ -195,13 +206,24 @@ func (w *Warmer) warm(ctx context.Context, now time.Time, logger log.Logger, id
 		return
 	}
 
+	var skippedCount int
+	if w.Filter != nil {
+		var skipped map[string]int
+		tags, skipped = w.Filter.Apply(id.CanonicalName(), tags)
+		for reason, n := range skipped {
+			skippedTags.With("reason", reason).Add(float64(n))
+			skippedCount += n
+		}
+	}
+
 	newImages := map[string]image.Info{}
 
 	// Create a list of images that need updating
 	type update struct {
-		ref             image.Ref
-		previousDigest  string
-		previousRefresh time.Duration
+		ref               image.Ref
+		previousDigest    string
+		previousFirstSeen time.Time
+		previousRefresh   time.Duration
 	}
 	var toUpdate []update
 
@@ -245,7 +267,7 @@ func (w *Warmer) warm(ctx context.Context, now time.Time, logger log.Logger, id
 						if !lastFetched.IsZero() {
 							previousRefresh = deadline.Sub(lastFetched)
 						}
-						toUpdate = append(toUpdate, update{ref: newID, previousRefresh: previousRefresh, previousDigest: entry.Info.Digest})
+						toUpdate = append(toUpdate, update{ref: newID, previousRefresh: previousRefresh, previousDigest: entry.Info.Digest, previousFirstSeen: entry.Info.FirstSeen})
 						refresh++
 					}
 				} else {
@@ -261,11 +283,12 @@ func (w *Warmer) warm(ctx context.Context, now time.Time, logger log.Logger, id
 		}
 	}
 
-	var fetchMx sync.Mutex // also guards access to newImages
+	var fetchMx sync.Mutex // also guards access to newImages and movedCount
 	var successCount int
+	var movedCount int // tags found to point at a different image
 
 	if len(toUpdate) > 0 {
-		logger.Log("info", "refreshing image", "image", id, "tag_count", len(tags), "to_update", len(toUpdate), "of_which_refresh", refresh, "of_which_missing", missing)
+		logger.Log("info", "refreshing image", "image", id, "tag_count", len(tags), "skipped", skippedCount, "to_update", len(toUpdate), "of_which_refresh", refresh, "of_which_missing", missing)
 
 		// The upper bound for concurrent fetches against a single host is
 		// w.Burst, so limit the number of fetching goroutines to that.
@@ -303,6 +326,7 @@ func (w *Warmer) warm(ctx context.Context, now time.Time, logger log.Logger, id
 
 				refresh := update.previousRefresh
 				reason := ""
+				moved := false
 				switch {
 				case entry.ExcludedReason != "":
 					errorLogger.Log("excluded", entry.ExcludedReason, "ref", imageID)
@@ -310,16 +334,23 @@ func (w *Warmer) warm(ctx context.Context, now time.Time, logger log.Logger, id
 					reason = "image is excluded"
 				case update.previousDigest == "":
 					entry.Info.LastFetched = now
+					entry.Info.FirstSeen = now
 					refresh = update.previousRefresh
 					reason = "no prior cache entry for image"
 				case entry.Info.Digest == update.previousDigest:
 					entry.Info.LastFetched = now
+					entry.Info.FirstSeen = update.previousFirstSeen
+					if entry.Info.FirstSeen.IsZero() { // cached before first-seen times were recorded
+						entry.Info.FirstSeen = now
+					}
 					refresh = clipRefresh(refresh * 2)
 					reason = "image digest is same"
 				default: // i.e., not excluded, but the digests differ -> the tag was moved
 					entry.Info.LastFetched = now
+					entry.Info.FirstSeen = now
 					refresh = clipRefresh(refresh / 2)
 					reason = "image digest is different"
+					moved = true
 				}
 
 				if w.Trace {
@@ -340,6 +371,9 @@ func (w *Warmer) warm(ctx context.Context, now time.Time, logger log.Logger, id
 				}
 				fetchMx.Lock()
 				successCount++
+				if moved {
+					movedCount++
+				}
 				if entry.ExcludedReason == "" {
 					newImages[imageID.Tag] = entry.Info
 				}
@@ -364,6 +398,13 @@ func (w *Warmer) warm(ctx context.Context, now time.Time, logger log.Logger, id
 	}
 
 	if w.Notify != nil {
+		// A tag that's been moved is as good as a new image, for
+		// anything pinned to the digest it used to have.
+		if movedCount > 0 {
+			w.Notify()
+			return
+		}
+
 		cacheTags := StringSet{}
 		for t := range oldImages {
 			cacheTags[t] = struct{}{}
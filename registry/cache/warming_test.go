@@ -115,6 +115,70 @@ func TestRefreshDeadline(t *testing.T) {
 	assert.True(t, deadline1.Sub(now1) > deadline2.Sub(now2), "%s > %s", deadline1.Sub(now1), deadline2.Sub(now2))
 }
 
+func TestNotifyOnMovedTag(t *testing.T) {
+	digest := "abc"
+	warmer, cache := setup(t, &digest)
+	var notified int
+	warmer.Notify = func() { notified++ }
+	logger := log.NewNopLogger()
+
+	// The first time around, the tag is new
+	now0 := time.Now()
+	warmer.warm(context.TODO(), now0, logger, repo, registry.NoCredentials())
+	assert.Equal(t, 1, notified)
+
+	k := NewManifestKey(ref.CanonicalRef())
+	_, deadline0, err := cache.GetKey(k)
+	assert.NoError(t, err)
+
+	// Refreshing the same manifest is not news
+	now1 := deadline0.Add(time.Minute)
+	warmer.warm(context.TODO(), now1, logger, repo, registry.NoCredentials())
+	assert.Equal(t, 1, notified)
+
+	_, deadline1, err := cache.GetKey(k)
+	assert.NoError(t, err)
+
+	// But the tag pointing at a different image is
+	digest = "cba"
+	now2 := deadline1.Add(time.Minute)
+	warmer.warm(context.TODO(), now2, logger, repo, registry.NoCredentials())
+	assert.Equal(t, 2, notified)
+}
+
+func TestFirstSeen(t *testing.T) {
+	digest := "abc"
+	warmer, cache := setup(t, &digest)
+	logger := log.NewNopLogger()
+	cached := &Cache{Reader: cache}
+
+	now0 := time.Now().UTC()
+	warmer.warm(context.TODO(), now0, logger, repo, registry.NoCredentials())
+	info, err := cached.GetImage(ref)
+	assert.NoError(t, err)
+	assert.True(t, info.FirstSeen.Equal(now0))
+
+	// Refreshing the same manifest keeps the time it was first seen
+	k := NewManifestKey(ref.CanonicalRef())
+	_, deadline0, err := cache.GetKey(k)
+	assert.NoError(t, err)
+	now1 := deadline0.Add(time.Minute)
+	warmer.warm(context.TODO(), now1, logger, repo, registry.NoCredentials())
+	info, err = cached.GetImage(ref)
+	assert.NoError(t, err)
+	assert.True(t, info.FirstSeen.Equal(now0))
+
+	// If the tag is moved, the new image is seen for the first time
+	_, deadline1, err := cache.GetKey(k)
+	assert.NoError(t, err)
+	digest = "cba"
+	now2 := deadline1.Add(time.Minute)
+	warmer.warm(context.TODO(), now2, logger, repo, registry.NoCredentials())
+	info, err = cached.GetImage(ref)
+	assert.NoError(t, err)
+	assert.True(t, info.FirstSeen.Equal(now2))
+}
+
 func setup(t *testing.T, digest *string) (*Warmer, Client) {
 	client := &mock.Client{
 		TagsFn: func() ([]string, error) {
@@ -140,3 +204,20 @@ func setup(t *testing.T, digest *string) (*Warmer, Client) {
 	warmer := &Warmer{clientFactory: factory, cache: c, burst: 10}
 	return warmer, c
 }
+
+func TestWarmSkipsFilteredTags(t *testing.T) {
+	digest := "abc"
+	warmer, cache := setup(t, &digest)
+	warmer.Filter = &TagFilter{Exclude: []ExcludeRule{{Tag: ref.Tag}}}
+	logger := log.NewNopLogger()
+
+	warmer.warm(context.TODO(), time.Now(), logger, repo, registry.NoCredentials())
+
+	// The tag's manifest isn't fetched, and the tag is left out of
+	// the repository
+	_, _, err := cache.GetKey(NewManifestKey(ref.CanonicalRef()))
+	assert.Equal(t, ErrNotCached, err)
+	repoInfo, err := (&Cache{Reader: cache}).GetRepositoryImages(ref.Name)
+	assert.NoError(t, err)
+	assert.Len(t, repoInfo, 0)
+}
@@ -55,6 +55,12 @@ func (entry *ImageEntry) UnmarshalJSON(bytes []byte) error {
 	return nil
 }
 
+// imageConfig is the part of an image's config (i.e., the
+// container config, rather than the config blob) that we look at.
+type imageConfig struct {
+	Labels map[string]string `json:"Labels"`
+}
+
 // Client is a remote registry client for a particular image
 // repository (e.g., for quay.io/weaveworks/flux). It is an interface
 // so we can wrap it in instrumentation, write fake implementations,
@@ -129,10 +135,11 @@ interpret:
 		var man schema1.Manifest = deserialised.Manifest
 		// for decoding the v1-compatibility entry in schema1 manifests
 		var v1 struct {
-			ID      string    `json:"id"`
-			Created time.Time `json:"created"`
-			OS      string    `json:"os"`
-			Arch    string    `json:"architecture"`
+			ID      string      `json:"id"`
+			Created time.Time   `json:"created"`
+			OS      string      `json:"os"`
+			Arch    string      `json:"architecture"`
+			Config  imageConfig `json:"config"`
 		}
 
 		if err = json.Unmarshal([]byte(man.History[0].V1Compatibility), &v1); err != nil {
@@ -142,6 +149,7 @@ interpret:
 		// identify the image as it's the topmost layer.
 		info.ImageID = v1.ID
 		info.CreatedAt = v1.Created
+		info.Labels = v1.Config.Labels
 	case *schema2.DeserializedManifest:
 		var man schema2.Manifest = deserialised.Manifest
 		configBytes, err := repository.Blobs(ctx).Get(ctx, man.Config.Digest)
@@ -150,9 +158,10 @@ interpret:
 		}
 
 		var config struct {
-			Arch    string    `json:"architecture"`
-			Created time.Time `json:"created"`
-			OS      string    `json:"os"`
+			Arch    string      `json:"architecture"`
+			Created time.Time   `json:"created"`
+			OS      string      `json:"os"`
+			Config  imageConfig `json:"config"`
 		}
 		if err = json.Unmarshal(configBytes, &config); err != nil {
 			return ImageEntry{}, err
@@ -160,6 +169,7 @@ interpret:
 		// This _is_ what Docker uses as its Image ID.
 		info.ImageID = man.Config.Digest.String()
 		info.CreatedAt = config.Created
+		info.Labels = config.Config.Labels
 	case *manifestlist.DeserializedManifestList:
 		var list manifestlist.ManifestList = deserialised.ManifestList
 		// TODO(michael): is it valid to just pick the first one that matches?
@@ -19,6 +19,9 @@ type RemoteClientFactory struct {
 	Limiters      *middleware.RateLimiters
 	Trace         bool
 	InsecureHosts []string
+	// Consulted for credentials for the hosts they match, when there
+	// are none from image pull secrets
+	CredentialProviders *CredentialProviders
 
 	mu               sync.Mutex
 	challengeManager challenge.Manager
@@ -94,6 +97,17 @@ func (f *RemoteClientFactory) ClientFor(repo image.CanonicalName, creds Credenti
 	}
 
 	cred := creds.credsFor(repo.Domain)
+	// Credentials from image pull secrets take precedence; providers
+	// are only consulted for hosts without any
+	if cred.username == "" && f.CredentialProviders != nil {
+		provided, err := f.CredentialProviders.credsFor(repo.Domain)
+		switch {
+		case err != nil:
+			f.Logger.Log("repo", repo.String(), "err", err)
+		case provided.username != "":
+			cred = provided
+		}
+	}
 	if f.Trace {
 		f.Logger.Log("repo", repo.String(), "auth", cred.String(), "api", registryURL.String())
 	}
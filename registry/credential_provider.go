@@ -0,0 +1,148 @@
+package registry
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CredentialProvider gives credentials for registry hosts that are
+// obtained dynamically, e.g., from a cloud provider's token service,
+// rather than from image pull secrets.
+type CredentialProvider interface {
+	// Name identifies the provider, e.g., as the provenance of the
+	// credentials it gives
+	Name() string
+	// Matches says whether the provider gives credentials for the
+	// host given
+	Matches(host string) bool
+	// Credentials obtains credentials for the host given, and says
+	// when they expire
+	Credentials(host string) (username, password string, expiry time.Time, err error)
+}
+
+const (
+	// Credentials are refreshed this long before they expire
+	credentialRefreshMargin = 5 * time.Minute
+	// After failing to obtain credentials for a host, wait this long
+	// before trying again
+	credentialRetryInterval = time.Minute
+)
+
+type cachedCreds struct {
+	creds
+	expiry time.Time
+	// when to try again, after failing to refresh the credentials
+	retryAt time.Time
+	// closed once a refresh in progress is done; nil if there's none
+	refreshing chan struct{}
+}
+
+// CredentialProviders consults a set of credential providers for the
+// hosts they match, caching the credentials each gives until shortly
+// before they expire.
+type CredentialProviders struct {
+	providers []CredentialProvider
+	now       func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedCreds
+	// the providers whose service couldn't be reached last time they
+	// were asked, which have been reported already
+	unreachable map[string]bool
+}
+
+// NewCredentialProviders constructs a CredentialProviders that
+// consults the providers given, in order.
+func NewCredentialProviders(providers ...CredentialProvider) *CredentialProviders {
+	return &CredentialProviders{
+		providers:   providers,
+		now:         time.Now,
+		cache:       map[string]cachedCreds{},
+		unreachable: map[string]bool{},
+	}
+}
+
+// credsFor gives credentials for the host from the first provider
+// that matches it, refreshing them if they are about to expire. If no
+// provider matches, it returns zero creds. If the matching provider
+// fails and there are no unexpired credentials cached, it returns an
+// error, then zero creds until it's time to try the provider again.
+//
+// A provider that can't reach its service (e.g., the metadata service
+// of a cloud the daemon isn't running in) is reported just once,
+// rather than for each host and each retry, until it succeeds again.
+func (ps *CredentialProviders) credsFor(host string) (creds, error) {
+	var provider CredentialProvider
+	for _, p := range ps.providers {
+		if p.Matches(host) {
+			provider = p
+			break
+		}
+	}
+	if provider == nil {
+		return creds{}, nil
+	}
+
+	ps.mu.Lock()
+	// Wait for anyone else refreshing the credentials, rather than
+	// asking the provider again
+	for ps.cache[host].refreshing != nil {
+		refreshing := ps.cache[host].refreshing
+		ps.mu.Unlock()
+		<-refreshing
+		ps.mu.Lock()
+	}
+	now := ps.now()
+	cached := ps.cache[host]
+	if now.Add(credentialRefreshMargin).Before(cached.expiry) || now.Before(cached.retryAt) {
+		ps.mu.Unlock()
+		if now.Before(cached.expiry) {
+			return cached.creds, nil
+		}
+		return creds{}, nil
+	}
+	refreshing := make(chan struct{})
+	cached.refreshing = refreshing
+	ps.cache[host] = cached
+	ps.mu.Unlock()
+
+	// Don't hold the lock while asking the provider, since that can
+	// take a while
+	username, password, expiry, err := provider.Credentials(host)
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	defer close(refreshing)
+	cached.refreshing = nil
+	if err != nil {
+		cached.retryAt = now.Add(credentialRetryInterval)
+		ps.cache[host] = cached
+		if now.Before(cached.expiry) {
+			return cached.creds, nil
+		}
+		if _, ok := errors.Cause(err).(*url.Error); ok {
+			if ps.unreachable[provider.Name()] {
+				return creds{}, nil
+			}
+			ps.unreachable[provider.Name()] = true
+			return creds{}, fmt.Errorf("obtaining credentials from %s for %s: %s (not reported again until it can be reached)", provider.Name(), host, err)
+		}
+		return creds{}, fmt.Errorf("obtaining credentials from %s for %s: %s", provider.Name(), host, err)
+	}
+	delete(ps.unreachable, provider.Name())
+	cached = cachedCreds{
+		creds: creds{
+			registry:   host,
+			provenance: provider.Name(),
+			username:   username,
+			password:   password,
+		},
+		expiry: expiry,
+	}
+	ps.cache[host] = cached
+	return cached.creds, nil
+}
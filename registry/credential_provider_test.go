@@ -0,0 +1,416 @@
+package registry
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	calls  int
+	expiry time.Time
+	err    error
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) Matches(host string) bool {
+	return host == "fake.example.com"
+}
+
+func (p *fakeProvider) Credentials(host string) (string, string, time.Time, error) {
+	p.calls++
+	if p.err != nil {
+		return "", "", time.Time{}, p.err
+	}
+	return "user", fmt.Sprintf("token%d", p.calls), p.expiry, nil
+}
+
+func TestCredentialProviders_Caching(t *testing.T) {
+	now := time.Now()
+	provider := &fakeProvider{expiry: now.Add(time.Hour)}
+	ps := NewCredentialProviders(provider)
+	ps.now = func() time.Time { return now }
+
+	// Hosts no provider matches get no credentials
+	c, err := ps.credsFor("docker.io")
+	assert.NoError(t, err)
+	assert.Equal(t, creds{}, c)
+	assert.Equal(t, 0, provider.calls)
+
+	c, err = ps.credsFor("fake.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "token1", c.password)
+	assert.Equal(t, "fake", c.provenance)
+
+	// Until they're about to expire, the credentials are cached
+	now = now.Add(50 * time.Minute)
+	c, _ = ps.credsFor("fake.example.com")
+	assert.Equal(t, "token1", c.password)
+	assert.Equal(t, 1, provider.calls)
+
+	// ... then they're refreshed
+	now = now.Add(6 * time.Minute)
+	provider.expiry = now.Add(time.Hour)
+	c, _ = ps.credsFor("fake.example.com")
+	assert.Equal(t, "token2", c.password)
+	assert.Equal(t, 2, provider.calls)
+
+	// If refreshing fails, the cached credentials are used while
+	// they're unexpired, and refreshing isn't tried again right away
+	now = now.Add(56 * time.Minute)
+	provider.err = errors.New("token service unavailable")
+	c, err = ps.credsFor("fake.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "token2", c.password)
+	c, err = ps.credsFor("fake.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, provider.calls)
+
+	// Once they have expired, it's an error; then there are no
+	// credentials until it's time to try again
+	now = now.Add(5 * time.Minute)
+	_, err = ps.credsFor("fake.example.com")
+	assert.Error(t, err)
+	assert.Equal(t, 4, provider.calls)
+	c, err = ps.credsFor("fake.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, creds{}, c)
+	assert.Equal(t, 4, provider.calls)
+
+	// ... until refreshing succeeds again
+	now = now.Add(credentialRetryInterval)
+	provider.err = nil
+	provider.expiry = now.Add(time.Hour)
+	c, err = ps.credsFor("fake.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "token5", c.password)
+}
+
+func TestCredentialProviders_Matches(t *testing.T) {
+	for _, v := range []struct {
+		provider CredentialProvider
+		host     string
+		matches  bool
+	}{
+		{&GCRProvider{}, "gcr.io", true},
+		{&GCRProvider{}, "eu.gcr.io", true},
+		{&GCRProvider{}, "notgcr.io", false},
+		{&ECRProvider{}, "123456789012.dkr.ecr.eu-west-1.amazonaws.com", true},
+		{&ECRProvider{}, "123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn", true},
+		{&ECRProvider{}, "123456789012.dkr.ecr-fips.us-east-1.amazonaws.com", true},
+		{&ECRProvider{}, "dkr.ecr.eu-west-1.amazonaws.com", false},
+		{&ECRProvider{}, "docker.io", false},
+		{&ACRProvider{}, "myregistry.azurecr.io", true},
+		{&ACRProvider{}, "myregistry.azurecr.cn", true},
+		{&ACRProvider{}, "azurecr.io", false},
+		{&ACRProvider{}, "quay.io", false},
+	} {
+		assert.Equal(t, v.matches, v.provider.Matches(v.host), "%s matching %s", v.provider.Name(), v.host)
+	}
+}
+
+func TestGCRProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"gcrtoken","expires_in":3600,"token_type":"Bearer"}`)
+	}))
+	defer server.Close()
+
+	p := &GCRProvider{TokenURL: server.URL}
+	username, password, expiry, err := p.Credentials("gcr.io")
+	assert.NoError(t, err)
+	assert.Equal(t, "oauth2accesstoken", username)
+	assert.Equal(t, "gcrtoken", password)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiry, time.Minute)
+}
+
+func TestECRProvider(t *testing.T) {
+	expiresAt := time.Now().Add(12 * time.Hour).Truncate(time.Second)
+	var target, authorization, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Metadata requests must use the session token (IMDSv2)
+		if strings.HasPrefix(r.URL.Path, "/meta-data/") && r.Header.Get("X-aws-ec2-metadata-token") != "imdstoken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/token":
+			if r.Method != "PUT" || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, "imdstoken")
+		case "/meta-data/":
+			fmt.Fprint(w, "node-role\n")
+		case "/meta-data/node-role":
+			fmt.Fprint(w, `{"AccessKeyId":"AKIDEXAMPLE","SecretAccessKey":"secret","Token":"session"}`)
+		case "/ecr/":
+			target = r.Header.Get("X-Amz-Target")
+			authorization = r.Header.Get("Authorization")
+			bs, _ := ioutil.ReadAll(r.Body)
+			body = string(bs)
+			token := base64.StdEncoding.EncodeToString([]byte("AWS:ecrpassword"))
+			fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d,"proxyEndpoint":"https://123456789012.dkr.ecr.eu-west-1.amazonaws.com"}]}`, token, expiresAt.Unix())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	p := &ECRProvider{Endpoint: server.URL + "/ecr/", MetadataURL: server.URL + "/meta-data/", MetadataTokenURL: server.URL + "/api/token"}
+	username, password, expiry, err := p.Credentials("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "AWS", username)
+	assert.Equal(t, "ecrpassword", password)
+	assert.True(t, expiresAt.Equal(expiry))
+
+	assert.Equal(t, ecrTarget, target)
+	assert.Equal(t, `{"registryIds":["123456789012"]}`, body)
+	assert.True(t, strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"), authorization)
+	assert.Contains(t, authorization, "/eu-west-1/ecr/aws4_request")
+	assert.Contains(t, authorization, "x-amz-security-token")
+}
+
+func TestECRProvider_WebIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-ecr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("webidentitytoken\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/flux")
+	os.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	defer os.Unsetenv("AWS_ROLE_ARN")
+	defer os.Unsetenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+
+	var form url.Values
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sts/":
+			r.ParseForm()
+			form = r.PostForm
+			fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>session</SessionToken>
+      <Expiration>2038-01-19T03:14:07Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`)
+		case "/ecr/":
+			authorization = r.Header.Get("Authorization")
+			token := base64.StdEncoding.EncodeToString([]byte("AWS:ecrpassword"))
+			fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d}]}`, token, time.Now().Add(time.Hour).Unix())
+		default:
+			// the metadata service shouldn't be consulted
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	p := &ECRProvider{Endpoint: server.URL + "/ecr/", STSEndpoint: server.URL + "/sts/", MetadataURL: server.URL + "/meta-data/", MetadataTokenURL: server.URL + "/api/token"}
+	_, password, _, err := p.Credentials("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "ecrpassword", password)
+
+	assert.Equal(t, "AssumeRoleWithWebIdentity", form.Get("Action"))
+	assert.Equal(t, "arn:aws:iam::123456789012:role/flux", form.Get("RoleArn"))
+	assert.Equal(t, "webidentitytoken", form.Get("WebIdentityToken"))
+	assert.Equal(t, awsDefaultSessionName, form.Get("RoleSessionName"))
+	assert.True(t, strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=ASIAEXAMPLE/"), authorization)
+}
+
+// This is the "get-vanilla" case from the AWS Signature Version 4
+// test suite.
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	signV4(req, nil, "service", "us-east-1", awsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+}
+
+func TestACRProvider(t *testing.T) {
+	expiresOn := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata":
+			if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("resource") != azureResource {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"access_token":"aadtoken","expires_on":"%d"}`, expiresOn.Unix())
+		case "/oauth2/exchange":
+			r.ParseForm()
+			if r.PostForm.Get("access_token") != "aadtoken" || r.PostForm.Get("service") != "myregistry.azurecr.io" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"refresh_token":"acrtoken"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	p := &ACRProvider{MetadataURL: server.URL + "/metadata", ExchangeURL: server.URL + "/oauth2/exchange"}
+	username, password, expiry, err := p.Credentials("myregistry.azurecr.io")
+	assert.NoError(t, err)
+	assert.Equal(t, acrTokenUsername, username)
+	assert.Equal(t, "acrtoken", password)
+	assert.True(t, expiresOn.Equal(expiry))
+}
+
+func TestACRProvider_WorkloadIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-acr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("federatedtoken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("AZURE_FEDERATED_TOKEN_FILE", tokenFile)
+	os.Setenv("AZURE_CLIENT_ID", "client")
+	os.Setenv("AZURE_TENANT_ID", "tenant")
+	defer os.Unsetenv("AZURE_FEDERATED_TOKEN_FILE")
+	defer os.Unsetenv("AZURE_CLIENT_ID")
+	defer os.Unsetenv("AZURE_TENANT_ID")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/tenant/oauth2/v2.0/token":
+			if r.PostForm.Get("client_id") != "client" ||
+				r.PostForm.Get("client_assertion") != "federatedtoken" ||
+				r.PostForm.Get("client_assertion_type") != azureAssertionType ||
+				r.PostForm.Get("scope") != azureScope {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token_type":"Bearer","access_token":"aadtoken","expires_in":3600}`)
+		case "/oauth2/exchange":
+			if r.PostForm.Get("access_token") != "aadtoken" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"refresh_token":"acrtoken"}`)
+		default:
+			// the metadata service shouldn't be consulted
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	p := &ACRProvider{MetadataURL: server.URL + "/metadata", AuthorityURL: server.URL + "/", ExchangeURL: server.URL + "/oauth2/exchange"}
+	username, password, expiry, err := p.Credentials("myregistry.azurecr.io")
+	assert.NoError(t, err)
+	assert.Equal(t, acrTokenUsername, username)
+	assert.Equal(t, "acrtoken", password)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiry, time.Minute)
+}
+
+func TestCredentialProviders_Unreachable(t *testing.T) {
+	now := time.Now()
+	provider := &fakeProvider{err: &url.Error{Op: "Get", URL: "http://169.254.169.254/", Err: errors.New("connection refused")}}
+	ps := NewCredentialProviders(provider)
+	ps.now = func() time.Time { return now }
+
+	// An unreachable service is reported the first time ...
+	_, err := ps.credsFor("fake.example.com")
+	assert.Error(t, err)
+
+	// ... but not after that, though it's still tried
+	now = now.Add(credentialRetryInterval)
+	c, err := ps.credsFor("fake.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, creds{}, c)
+	assert.Equal(t, 2, provider.calls)
+
+	// Once it's reachable again, it's reported again if it goes away
+	now = now.Add(credentialRetryInterval)
+	provider.err = nil
+	provider.expiry = now.Add(time.Minute)
+	_, err = ps.credsFor("fake.example.com")
+	assert.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+	provider.err = &url.Error{Op: "Get", URL: "http://169.254.169.254/", Err: errors.New("connection refused")}
+	_, err = ps.credsFor("fake.example.com")
+	assert.Error(t, err)
+}
+
+type blockingProvider struct {
+	fakeProvider
+	started, release chan struct{}
+}
+
+func (p *blockingProvider) Matches(host string) bool {
+	return host == "slow.example.com" || p.fakeProvider.Matches(host)
+}
+
+func (p *blockingProvider) Credentials(host string) (string, string, time.Time, error) {
+	if host == "slow.example.com" {
+		close(p.started)
+		<-p.release
+	}
+	return p.fakeProvider.Credentials(host)
+}
+
+func TestCredentialProviders_Concurrent(t *testing.T) {
+	provider := &blockingProvider{
+		fakeProvider: fakeProvider{expiry: time.Now().Add(time.Hour)},
+		started:      make(chan struct{}),
+		release:      make(chan struct{}),
+	}
+	ps := NewCredentialProviders(provider)
+
+	slow := make(chan creds, 2)
+	go func() {
+		c, _ := ps.credsFor("slow.example.com")
+		slow <- c
+	}()
+	<-provider.started
+
+	// Other hosts aren't held up while the provider is being asked
+	// for credentials
+	c, err := ps.credsFor("fake.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "user", c.username)
+
+	// ... and asking for the same host waits for the same answer,
+	// rather than asking again
+	go func() {
+		c, _ := ps.credsFor("slow.example.com")
+		slow <- c
+	}()
+	close(provider.release)
+	first, second := <-slow, <-slow
+	assert.Equal(t, "user", first.username)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 2, provider.calls)
+}
@@ -131,11 +131,6 @@ func (cs Credentials) credsFor(host string) creds {
 	if cred, found := cs.m[host]; found {
 		return cred
 	}
-	if host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") {
-		if cred, err := GetGCPOauthToken(host); err == nil {
-			return cred
-		}
-	}
 	return creds{}
 }
 
@@ -0,0 +1,330 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	awsDefaultMetadataURL      = "http://169.254.169.254/latest/meta-data/iam/security-credentials/"
+	awsDefaultMetadataTokenURL = "http://169.254.169.254/latest/api/token"
+	ecrTarget                  = "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+	// The session name used when assuming a role with a web identity
+	// token, unless AWS_ROLE_SESSION_NAME is set
+	awsDefaultSessionName = "flux"
+)
+
+// ECR hosts look like <account>.dkr.ecr.<region>.amazonaws.com
+var ecrHostPattern = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// ECRProvider gives credentials for AWS Elastic Container Registry,
+// by asking ECR for an authorization token. The request is signed
+// with, in order of preference:
+//
+//   - the AWS credentials in the environment (AWS_ACCESS_KEY_ID,
+//     AWS_SECRET_ACCESS_KEY and, optionally, AWS_SESSION_TOKEN);
+//   - the credentials for the role given as AWS_ROLE_ARN, obtained
+//     from STS with the web identity token in the file given as
+//     AWS_WEB_IDENTITY_TOKEN_FILE (as set up by IAM roles for service
+//     accounts, in EKS);
+//   - the credentials for the IAM role of the instance, from the EC2
+//     metadata service.
+type ECRProvider struct {
+	// The URL of the ECR API; if empty, the endpoint for the region
+	// of the registry is used
+	Endpoint string
+	// The URL of the STS API; if empty, the endpoint for the region
+	// of the registry is used
+	STSEndpoint string
+	// The URL of the EC2 metadata service's security credentials,
+	// and of its session token (for IMDSv2); if empty, the usual
+	// addresses are used
+	MetadataURL      string
+	MetadataTokenURL string
+	Client           *http.Client
+}
+
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+}
+
+func (p *ECRProvider) Name() string {
+	return "AWS ECR"
+}
+
+func (p *ECRProvider) Matches(host string) bool {
+	return ecrHostPattern.MatchString(host)
+}
+
+func (p *ECRProvider) Credentials(host string) (string, string, time.Time, error) {
+	m := ecrHostPattern.FindStringSubmatch(host)
+	if m == nil {
+		return "", "", time.Time{}, fmt.Errorf("%s is not an ECR host", host)
+	}
+	account, region := m[1], m[3]
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://api.ecr.%s.amazonaws.com%s/", region, m[4])
+	}
+
+	awsCreds, err := p.awsCredentials(region, m[4])
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	body, err := json.Marshal(map[string][]string{"registryIds": {account}})
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	request, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	request.Header.Set("X-Amz-Target", ecrTarget)
+	signV4(request, body, "ecr", region, awsCreds, time.Now())
+
+	response, err := httpClient(p.Client).Do(request)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(response.Body)
+		return "", "", time.Time{}, fmt.Errorf("unexpected status from ECR: %s: %s", response.Status, bytes.TrimSpace(msg))
+	}
+
+	var result struct {
+		AuthorizationData []struct {
+			AuthorizationToken string
+			ExpiresAt          float64
+		} `json:"authorizationData"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return "", "", time.Time{}, err
+	}
+	if len(result.AuthorizationData) == 0 {
+		return "", "", time.Time{}, fmt.Errorf("no authorization data from ECR for %s", host)
+	}
+	data := result.AuthorizationData[0]
+	token, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	parts := strings.SplitN(string(token), ":", 2)
+	if len(parts) != 2 {
+		return "", "", time.Time{}, fmt.Errorf("authorization token from ECR for %s has wrong number of fields (expected 2, got %d)", host, len(parts))
+	}
+	return parts[0], parts[1], time.Unix(int64(data.ExpiresAt), 0), nil
+}
+
+// awsCredentials finds the AWS credentials to sign requests with;
+// from the environment, by assuming a role with a web identity, or
+// failing those, from the EC2 metadata service. The region and domain
+// suffix are used to find the regional STS endpoint.
+func (p *ECRProvider) awsCredentials(region, suffix string) (awsCredentials, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return awsCredentials{AccessKeyID: id, SecretAccessKey: secret, Token: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	if role, tokenFile := os.Getenv("AWS_ROLE_ARN"), os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"); role != "" && tokenFile != "" {
+		return p.webIdentityCredentials(role, tokenFile, region, suffix)
+	}
+	return p.instanceCredentials()
+}
+
+// webIdentityCredentials assumes the role given, using the web
+// identity token in the file given, and returns the temporary
+// credentials STS gives for it.
+func (p *ECRProvider) webIdentityCredentials(role, tokenFile, region, suffix string) (awsCredentials, error) {
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, errors.Wrap(err, "reading web identity token")
+	}
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = awsDefaultSessionName
+	}
+	endpoint := p.STSEndpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://sts.%s.amazonaws.com%s/", region, suffix)
+	}
+
+	// AssumeRoleWithWebIdentity is authorised by the token, so the
+	// request isn't signed
+	response, err := httpClient(p.Client).PostForm(endpoint, url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	})
+	if err != nil {
+		return awsCredentials{}, errors.Wrap(err, "assuming role with web identity")
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(response.Body)
+		return awsCredentials{}, fmt.Errorf("unexpected status from STS: %s: %s", response.Status, bytes.TrimSpace(msg))
+	}
+
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string
+			SessionToken    string
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(response.Body).Decode(&result); err != nil {
+		return awsCredentials{}, errors.Wrap(err, "parsing response from STS")
+	}
+	c := result.Credentials
+	return awsCredentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, Token: c.SessionToken}, nil
+}
+
+// instanceCredentials gets the credentials for the IAM role of the
+// instance from the EC2 metadata service. A session token is asked
+// for first, as required by IMDSv2; if that fails, the requests are
+// made without one, as IMDSv1 allows.
+func (p *ECRProvider) instanceCredentials() (awsCredentials, error) {
+	metadataURL, tokenURL := p.MetadataURL, p.MetadataTokenURL
+	if metadataURL == "" {
+		metadataURL = awsDefaultMetadataURL
+	}
+	if tokenURL == "" {
+		tokenURL = awsDefaultMetadataTokenURL
+	}
+	client := httpClient(p.Client)
+
+	var token string
+	request, err := http.NewRequest("PUT", tokenURL, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	request.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	if response, err := client.Do(request); err == nil {
+		if response.StatusCode == http.StatusOK {
+			bs, _ := ioutil.ReadAll(response.Body)
+			token = strings.TrimSpace(string(bs))
+		}
+		response.Body.Close()
+	}
+
+	get := func(url string) ([]byte, error) {
+		request, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			request.Header.Set("X-aws-ec2-metadata-token", token)
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status from EC2 metadata service: %s", response.Status)
+		}
+		return ioutil.ReadAll(response.Body)
+	}
+
+	roles, err := get(metadataURL)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return awsCredentials{}, fmt.Errorf("no IAM role for instance")
+	}
+	bs, err := get(strings.TrimSuffix(metadataURL, "/") + "/" + role)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	var c awsCredentials
+	if err := json.Unmarshal(bs, &c); err != nil {
+		return awsCredentials{}, err
+	}
+	return c, nil
+}
+
+// signV4 signs a request with AWS Signature Version 4, as described
+// in https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html.
+// All the headers of the request are signed.
+func signV4(req *http.Request, body []byte, service, region string, c awsCredentials, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", c.Token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, strings.TrimSpace(headers[k]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + c.SecretAccessKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 )
 
 const (
@@ -16,37 +18,70 @@ type gceToken struct {
 	TokenType   string `json:"token_type"`
 }
 
-func GetGCPOauthToken(host string) (creds, error) {
-	request, err := http.NewRequest("GET", gcpDefaultTokenURL, nil)
+// GCRProvider gives credentials for Google Container Registry, using
+// the access token of the service account the daemon runs as,
+// obtained from the GCE metadata service.
+type GCRProvider struct {
+	// The URL of the token endpoint; if empty, that of the GCE
+	// metadata service is used
+	TokenURL string
+	Client   *http.Client
+}
+
+func (p *GCRProvider) Name() string {
+	return "GCP metadata"
+}
+
+func (p *GCRProvider) Matches(host string) bool {
+	return host == "gcr.io" || strings.HasSuffix(host, ".gcr.io")
+}
+
+func (p *GCRProvider) Credentials(host string) (string, string, time.Time, error) {
+	tokenURL := p.TokenURL
+	if tokenURL == "" {
+		tokenURL = gcpDefaultTokenURL
+	}
+	request, err := http.NewRequest("GET", tokenURL, nil)
 	if err != nil {
-		return creds{}, err
+		return "", "", time.Time{}, err
 	}
-
 	request.Header.Add("Metadata-Flavor", "Google")
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+	response, err := httpClient(p.Client).Do(request)
 	if err != nil {
-		return creds{}, err
+		return "", "", time.Time{}, err
 	}
-
+	defer response.Body.Close()
 	if response.StatusCode != http.StatusOK {
-		return creds{}, fmt.Errorf("unexpected status from metadata service: %s", response.Status)
+		return "", "", time.Time{}, fmt.Errorf("unexpected status from metadata service: %s", response.Status)
 	}
 
 	var token gceToken
-	decoder := json.NewDecoder(response.Body)
-	if err := decoder.Decode(&token); err != nil {
-		return creds{}, err
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", "", time.Time{}, err
 	}
+	return "oauth2accesstoken", token.AccessToken, time.Now().Add(time.Duration(token.ExpiresIn) * time.Second), nil
+}
 
-	if err := response.Body.Close(); err != nil {
+// GetGCPOauthToken obtains credentials for the host given from the
+// GCE metadata service.
+func GetGCPOauthToken(host string) (creds, error) {
+	username, password, _, err := (&GCRProvider{}).Credentials(host)
+	if err != nil {
 		return creds{}, err
 	}
-
 	return creds{
 		registry:   host,
 		provenance: "",
-		username:   "oauth2accesstoken",
-		password:   token.AccessToken}, nil
+		username:   username,
+		password:   password}, nil
+}
+
+// httpClient gives the client given, or the default client if it's
+// nil.
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
 }
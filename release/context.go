@@ -19,6 +19,8 @@ type ReleaseContext struct {
 	manifests cluster.Manifests
 	repo      *git.Checkout
 	registry  registry.Registry
+	// applied to all controllers, after consulting the cluster
+	filters []update.ControllerFilter
 }
 
 func NewReleaseContext(c cluster.Cluster, m cluster.Manifests, reg registry.Registry, repo *git.Checkout) *ReleaseContext {
@@ -30,6 +32,14 @@ func NewReleaseContext(c cluster.Cluster, m cluster.Manifests, reg registry.Regi
 	}
 }
 
+// WithFilters adds filters that are applied to every controller
+// selected for a release, whatever the release asks for; e.g., to
+// skip controllers in namespaces that are frozen.
+func (rc *ReleaseContext) WithFilters(filters ...update.ControllerFilter) *ReleaseContext {
+	rc.filters = append(rc.filters, filters...)
+	return rc
+}
+
 func (rc *ReleaseContext) Registry() registry.Registry {
 	return rc.registry
 }
@@ -41,6 +51,15 @@ func (rc *ReleaseContext) LoadManifests() (map[string]resource.Resource, error)
 func (rc *ReleaseContext) WriteUpdates(updates []*update.ControllerUpdate) error {
 	err := func() error {
 		for _, update := range updates {
+			if gen, ok := rc.manifests.(cluster.ManifestGenerator); ok && gen.Generated(update.Resource) {
+				for _, container := range update.Updates {
+					if err := gen.SetGeneratedContainerImage(rc.repo.Dir(), update.Resource, container.Container, container.Target); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
 			manifestBytes, err := ioutil.ReadFile(update.ManifestPath)
 			if err != nil {
 				return err
@@ -112,6 +131,7 @@ func (rc *ReleaseContext) SelectServices(results update.Result, prefilters, post
 		forPostFiltering = append(forPostFiltering, update)
 	}
 
+	postfilters = append(append([]update.ControllerFilter{}, postfilters...), rc.filters...)
 	var filteredUpdates []*update.ControllerUpdate
 	for _, s := range forPostFiltering {
 		fr := s.Filter(postfilters...)
@@ -16,6 +16,7 @@ import (
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/git/gittest"
 	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
 	registryMock "github.com/weaveworks/flux/registry/mock"
 	"github.com/weaveworks/flux/resource"
 	"github.com/weaveworks/flux/update"
@@ -261,6 +262,171 @@ func Test_InitContainer(t *testing.T) {
 
 }
 
+func Test_InjectedContainer(t *testing.T) {
+	// A container that's in the cluster but not in the manifest, as
+	// when a sidecar is injected by an admission controller, can't be
+	// updated; it shouldn't stop the others being updated though.
+	injectedSvc := cluster.Controller{
+		ID: hwSvcID,
+		Containers: cluster.ContainersOrExcuse{
+			Containers: append(hwSvc.Containers.Containers, resource.Container{
+				Name:  "injected",
+				Image: sidecarRef,
+			}),
+		},
+	}
+
+	cluster := mockCluster(injectedSvc, lockedSvc)
+
+	expect := expected{
+		Specific: update.Result{
+			hwSvcID: update.ControllerResult{
+				Status: update.ReleaseStatusSuccess,
+				PerContainer: []update.ContainerUpdate{
+					update.ContainerUpdate{
+						Container: helloContainer,
+						Current:   oldRef,
+						Target:    newHwRef,
+					},
+					update.ContainerUpdate{
+						Container: sidecarContainer,
+						Current:   sidecarRef,
+						Target:    newSidecarRef,
+					},
+				},
+			},
+		},
+		Else: ignoredNotIncluded,
+	}
+
+	spec := update.ReleaseImageSpec{
+		ServiceSpecs: []update.ResourceSpec{hwSvcSpec},
+		ImageSpec:    update.ImageSpecLatest,
+		Kind:         update.ReleaseKindExecute,
+	}
+
+	checkout, clean := setup(t)
+	defer clean()
+
+	testRelease(t, &ReleaseContext{
+		cluster:   cluster,
+		manifests: mockManifests,
+		registry:  mockRegistry,
+		repo:      checkout,
+	}, spec, expect.Result())
+}
+
+func Test_PinDigest(t *testing.T) {
+	const (
+		hwDigest      = "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"
+		movedDigest   = "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"
+		sidecarDigest = "sha256:e4f8c41cf2c14a9ac1eebf3e25db5f6a1f3f8c16f6b4d0c28ef2d5e1e4bbd0a1"
+	)
+	pinnedRegistry := func(hwDigest string) *registryMock.Registry {
+		return &registryMock.Registry{
+			Images: []image.Info{
+				{ID: newHwRef, Digest: hwDigest, CreatedAt: timeNow},
+				{ID: newSidecarRef, Digest: sidecarDigest, CreatedAt: timeNow},
+			},
+		}
+	}
+
+	checkout, clean := setup(t)
+	defer clean()
+	if _, err := cluster.UpdatePolicies(mockManifests, checkout.Dir(), checkout.ManifestDirs(), hwSvcID, policy.Update{
+		Add: policy.Set{policy.Pin: policy.PinDigest},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := update.ReleaseImageSpec{
+		ServiceSpecs: []update.ResourceSpec{hwSvcSpec},
+		ImageSpec:    update.ImageSpecLatest,
+		Kind:         update.ReleaseKindExecute,
+	}
+
+	// Releasing a new tag writes its digest too
+	testRelease(t, &ReleaseContext{
+		cluster:   mockCluster(hwSvc, lockedSvc),
+		manifests: mockManifests,
+		registry:  pinnedRegistry(hwDigest),
+		repo:      checkout,
+	}, spec, expected{
+		Specific: update.Result{
+			hwSvcID: update.ControllerResult{
+				Status: update.ReleaseStatusSuccess,
+				PerContainer: []update.ContainerUpdate{
+					{
+						Container: helloContainer,
+						Current:   oldRef,
+						Target:    newHwRef.WithDigest(hwDigest),
+					},
+					{
+						Container: sidecarContainer,
+						Current:   sidecarRef,
+						Target:    newSidecarRef.WithDigest(sidecarDigest),
+					},
+				},
+			},
+		},
+		Else: ignoredNotIncluded,
+	}.Result())
+
+	// Once the pinned images are running, moving one of the tags
+	// means just that one is updated
+	pinnedSvc := cluster.Controller{
+		ID: hwSvcID,
+		Containers: cluster.ContainersOrExcuse{
+			Containers: []resource.Container{
+				{Name: helloContainer, Image: newHwRef.WithDigest(hwDigest)},
+				{Name: sidecarContainer, Image: newSidecarRef.WithDigest(sidecarDigest)},
+			},
+		},
+	}
+	testRelease(t, &ReleaseContext{
+		cluster:   mockCluster(pinnedSvc, lockedSvc),
+		manifests: mockManifests,
+		registry:  pinnedRegistry(movedDigest),
+		repo:      checkout,
+	}, spec, expected{
+		Specific: update.Result{
+			hwSvcID: update.ControllerResult{
+				Status: update.ReleaseStatusSuccess,
+				PerContainer: []update.ContainerUpdate{
+					{
+						Container: helloContainer,
+						Current:   newHwRef.WithDigest(hwDigest),
+						Target:    newHwRef.WithDigest(movedDigest),
+					},
+				},
+			},
+		},
+		Else: ignoredNotIncluded,
+	}.Result())
+
+	// Without the digests of the latest images, there's nothing to
+	// pin to, and that's given as the reason for skipping
+	testRelease(t, &ReleaseContext{
+		cluster:   mockCluster(pinnedSvc, lockedSvc),
+		manifests: mockManifests,
+		registry: &registryMock.Registry{
+			Images: []image.Info{
+				{ID: newHwRef, CreatedAt: timeNow},
+				{ID: newSidecarRef, CreatedAt: timeNow},
+			},
+		},
+		repo: checkout,
+	}, spec, expected{
+		Specific: update.Result{
+			hwSvcID: update.ControllerResult{
+				Status: update.ReleaseStatusSkipped,
+				Error:  update.DigestNotKnown,
+			},
+		},
+		Else: ignoredNotIncluded,
+	}.Result())
+}
+
 func Test_FilterLogic(t *testing.T) {
 	cluster := mockCluster(hwSvc, lockedSvc) // no testsvc in cluster, but it _is_ in repo
 
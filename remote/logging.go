@@ -8,8 +8,10 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v12"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/freeze"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/update"
 )
@@ -108,6 +110,60 @@ func (p *ErrorLoggingServer) GitRepoConfig(ctx context.Context, regenerate bool)
 	return p.server.GitRepoConfig(ctx, regenerate)
 }
 
+func (p *ErrorLoggingServer) SyncPlan(ctx context.Context) (_ v12.SyncPlan, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "SyncPlan", "error", err)
+		}
+	}()
+	return p.server.SyncPlan(ctx)
+}
+
+func (p *ErrorLoggingServer) DriftReport(ctx context.Context) (_ v12.DriftReport, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "DriftReport", "error", err)
+		}
+	}()
+	return p.server.DriftReport(ctx)
+}
+
+func (p *ErrorLoggingServer) ListPendingReleases(ctx context.Context) (_ []v12.PendingRelease, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "ListPendingReleases", "error", err)
+		}
+	}()
+	return p.server.ListPendingReleases(ctx)
+}
+
+func (p *ErrorLoggingServer) ApproveRelease(ctx context.Context, id job.ID, cause update.Cause) (_ job.ID, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "ApproveRelease", "error", err)
+		}
+	}()
+	return p.server.ApproveRelease(ctx, id, cause)
+}
+
+func (p *ErrorLoggingServer) ListFreezes(ctx context.Context) (_ []freeze.Freeze, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "ListFreezes", "error", err)
+		}
+	}()
+	return p.server.ListFreezes(ctx)
+}
+
+func (p *ErrorLoggingServer) SetFreeze(ctx context.Context, f freeze.Freeze) (err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "SetFreeze", "error", err)
+		}
+	}()
+	return p.server.SetFreeze(ctx, f)
+}
+
 type ErrorLoggingUpstreamServer struct {
 	*ErrorLoggingServer
 	server api.UpstreamServer
@@ -11,8 +11,10 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v12"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/freeze"
 	"github.com/weaveworks/flux/job"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
 	"github.com/weaveworks/flux/update"
@@ -128,6 +130,66 @@ func (i *instrumentedServer) GitRepoConfig(ctx context.Context, regenerate bool)
 	return i.s.GitRepoConfig(ctx, regenerate)
 }
 
+func (i *instrumentedServer) SyncPlan(ctx context.Context) (_ v12.SyncPlan, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "SyncPlan",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.SyncPlan(ctx)
+}
+
+func (i *instrumentedServer) DriftReport(ctx context.Context) (_ v12.DriftReport, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "DriftReport",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.DriftReport(ctx)
+}
+
+func (i *instrumentedServer) ListPendingReleases(ctx context.Context) (_ []v12.PendingRelease, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "ListPendingReleases",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.ListPendingReleases(ctx)
+}
+
+func (i *instrumentedServer) ApproveRelease(ctx context.Context, id job.ID, cause update.Cause) (_ job.ID, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "ApproveRelease",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.ApproveRelease(ctx, id, cause)
+}
+
+func (i *instrumentedServer) ListFreezes(ctx context.Context) (_ []freeze.Freeze, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "ListFreezes",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.ListFreezes(ctx)
+}
+
+func (i *instrumentedServer) SetFreeze(ctx context.Context, f freeze.Freeze) (err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "SetFreeze",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.SetFreeze(ctx, f)
+}
+
 var _ api.UpstreamServer = &instrumentedUpstreamServer{}
 
 type instrumentedUpstreamServer struct {
@@ -12,11 +12,16 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v12"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/drift"
+	"github.com/weaveworks/flux/freeze"
 	"github.com/weaveworks/flux/guid"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/resource"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -49,6 +54,25 @@ type MockServer struct {
 
 	GitRepoConfigAnswer v6.GitConfig
 	GitRepoConfigError  error
+
+	SyncPlanAnswer v12.SyncPlan
+	SyncPlanError  error
+
+	DriftReportAnswer v12.DriftReport
+	DriftReportError  error
+
+	ListPendingReleasesAnswer []v12.PendingRelease
+	ListPendingReleasesError  error
+
+	ApproveReleaseArgTest func(job.ID, update.Cause) error
+	ApproveReleaseAnswer  job.ID
+	ApproveReleaseError   error
+
+	ListFreezesAnswer []freeze.Freeze
+	ListFreezesError  error
+
+	SetFreezeArgTest func(freeze.Freeze) error
+	SetFreezeError   error
 }
 
 func (p *MockServer) Ping(ctx context.Context) error {
@@ -104,6 +128,40 @@ func (p *MockServer) GitRepoConfig(ctx context.Context, regenerate bool) (v6.Git
 	return p.GitRepoConfigAnswer, p.GitRepoConfigError
 }
 
+func (p *MockServer) SyncPlan(ctx context.Context) (v12.SyncPlan, error) {
+	return p.SyncPlanAnswer, p.SyncPlanError
+}
+
+func (p *MockServer) DriftReport(ctx context.Context) (v12.DriftReport, error) {
+	return p.DriftReportAnswer, p.DriftReportError
+}
+
+func (p *MockServer) ListPendingReleases(ctx context.Context) ([]v12.PendingRelease, error) {
+	return p.ListPendingReleasesAnswer, p.ListPendingReleasesError
+}
+
+func (p *MockServer) ApproveRelease(ctx context.Context, id job.ID, cause update.Cause) (job.ID, error) {
+	if p.ApproveReleaseArgTest != nil {
+		if err := p.ApproveReleaseArgTest(id, cause); err != nil {
+			return job.ID(""), err
+		}
+	}
+	return p.ApproveReleaseAnswer, p.ApproveReleaseError
+}
+
+func (p *MockServer) ListFreezes(ctx context.Context) ([]freeze.Freeze, error) {
+	return p.ListFreezesAnswer, p.ListFreezesError
+}
+
+func (p *MockServer) SetFreeze(ctx context.Context, f freeze.Freeze) error {
+	if p.SetFreezeArgTest != nil {
+		if err := p.SetFreezeArgTest(f); err != nil {
+			return err
+		}
+	}
+	return p.SetFreezeError
+}
+
 var _ api.UpstreamServer = &MockServer{}
 
 // -- Battery of tests for an api.Server implementation. Since these
@@ -174,12 +232,75 @@ func ServerTestBattery(t *testing.T, wrap func(mock api.UpstreamServer) api.Upst
 		return nil
 	}
 
+	syncPlanAnswer := v12.SyncPlan{
+		Revision: "commit 3",
+		Resources: cluster.SyncPlan{
+			{ID: serviceID, Source: "service.yaml", Action: cluster.PlanUpdate},
+			{ID: flux.MustParseResourceID("foobar/hello"), Source: "hello.yaml", Error: "invalid definition"},
+		},
+	}
+
+	driftReportAnswer := v12.DriftReport{
+		Revision: "commit 2",
+		Resources: drift.Report{
+			{ID: serviceID, Source: "service.yaml", Differences: []drift.Difference{
+				{Path: "spec.template.spec.containers[0].image", Git: "quay.io/example/app:v1", Cluster: "quay.io/example/app:v2"},
+			}},
+			{ID: flux.MustParseResourceID("foobar/hello"), Source: "hello.yaml", Missing: true},
+		},
+	}
+
+	pendingID := job.ID(guid.New())
+	pendingAnswer := []v12.PendingRelease{
+		{
+			ID: pendingID,
+			Spec: update.Spec{
+				Type: update.Auto,
+				Spec: update.Automated{Changes: []update.Change{
+					{ServiceID: serviceID, Container: resource.Container{Name: "frobnicator", Image: imageID}, ImageID: imageID},
+				}},
+			},
+			Result: update.Result{
+				serviceID: update.ControllerResult{Status: update.ReleaseStatusSuccess},
+			},
+			Approval: "branch",
+			Branch:   "flux-release/the-space-of-names",
+			Created:  now,
+		},
+	}
+	approveCause := update.Cause{User: "someone", Message: "looks good"}
+	checkApprove := func(id job.ID, cause update.Cause) error {
+		if id != pendingID || !reflect.DeepEqual(approveCause, cause) {
+			return errors.New("expected != actual")
+		}
+		return nil
+	}
+
+	freezesAnswer := []freeze.Freeze{
+		{Window: "0 18 * * mon-fri for 15h0m0s", Until: now},
+		{Namespace: "the-space-of-names", Until: now, User: "someone", Reason: "holidays"},
+	}
+	setFreeze := freeze.Freeze{Namespace: "the-space-of-names", Until: now, User: "someone", Reason: "holidays"}
+	checkFreeze := func(f freeze.Freeze) error {
+		if !reflect.DeepEqual(setFreeze, f) {
+			return errors.New("expected != actual")
+		}
+		return nil
+	}
+
 	mock := &MockServer{
-		ListServicesAnswer:     serviceAnswer,
-		ListImagesAnswer:       imagesAnswer,
-		UpdateManifestsArgTest: checkUpdateSpec,
-		UpdateManifestsAnswer:  job.ID(guid.New()),
-		SyncStatusAnswer:       syncStatusAnswer,
+		ListServicesAnswer:        serviceAnswer,
+		ListImagesAnswer:          imagesAnswer,
+		UpdateManifestsArgTest:    checkUpdateSpec,
+		UpdateManifestsAnswer:     job.ID(guid.New()),
+		SyncStatusAnswer:          syncStatusAnswer,
+		SyncPlanAnswer:            syncPlanAnswer,
+		DriftReportAnswer:         driftReportAnswer,
+		ListPendingReleasesAnswer: pendingAnswer,
+		ApproveReleaseArgTest:     checkApprove,
+		ApproveReleaseAnswer:      pendingID,
+		ListFreezesAnswer:         freezesAnswer,
+		SetFreezeArgTest:          checkFreeze,
 	}
 
 	ctx := context.Background()
@@ -244,4 +365,72 @@ func ServerTestBattery(t *testing.T, wrap func(mock api.UpstreamServer) api.Upst
 	if !reflect.DeepEqual(mock.SyncStatusAnswer, syncSt) {
 		t.Errorf("expected: %#v\ngot: %#v", mock.SyncStatusAnswer, syncSt)
 	}
+
+	plan, err := client.SyncPlan(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(mock.SyncPlanAnswer, plan) {
+		t.Errorf("expected: %#v\ngot: %#v", mock.SyncPlanAnswer, plan)
+	}
+	mock.SyncPlanError = fmt.Errorf("sync plan error")
+	if _, err = client.SyncPlan(ctx); err == nil {
+		t.Error("expected error from SyncPlan, got nil")
+	}
+
+	report, err := client.DriftReport(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(mock.DriftReportAnswer, report) {
+		t.Errorf("expected: %#v\ngot: %#v", mock.DriftReportAnswer, report)
+	}
+	mock.DriftReportError = fmt.Errorf("drift report error")
+	if _, err = client.DriftReport(ctx); err == nil {
+		t.Error("expected error from DriftReport, got nil")
+	}
+
+	pending, err := client.ListPendingReleases(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(mock.ListPendingReleasesAnswer, pending) {
+		t.Errorf("expected: %#v\ngot: %#v", mock.ListPendingReleasesAnswer, pending)
+	}
+	mock.ListPendingReleasesError = fmt.Errorf("list pending releases error")
+	if _, err = client.ListPendingReleases(ctx); err == nil {
+		t.Error("expected error from ListPendingReleases, got nil")
+	}
+
+	approvedID, err := client.ApproveRelease(ctx, pendingID, approveCause)
+	if err != nil {
+		t.Error(err)
+	}
+	if approvedID != mock.ApproveReleaseAnswer {
+		t.Errorf("expected %q, got %q", mock.ApproveReleaseAnswer, approvedID)
+	}
+	mock.ApproveReleaseError = fmt.Errorf("approve release error")
+	if _, err = client.ApproveRelease(ctx, pendingID, approveCause); err == nil {
+		t.Error("expected error from ApproveRelease, got nil")
+	}
+
+	freezes, err := client.ListFreezes(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(mock.ListFreezesAnswer, freezes) {
+		t.Errorf("expected: %#v\ngot: %#v", mock.ListFreezesAnswer, freezes)
+	}
+	mock.ListFreezesError = fmt.Errorf("list freezes error")
+	if _, err = client.ListFreezes(ctx); err == nil {
+		t.Error("expected error from ListFreezes, got nil")
+	}
+
+	if err := client.SetFreeze(ctx, setFreeze); err != nil {
+		t.Error(err)
+	}
+	mock.SetFreezeError = fmt.Errorf("set freeze error")
+	if err := client.SetFreeze(ctx, setFreeze); err == nil {
+		t.Error("expected error from SetFreeze, got nil")
+	}
 }
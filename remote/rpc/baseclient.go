@@ -8,8 +8,10 @@ import (
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v12"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/freeze"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/remote"
 	"github.com/weaveworks/flux/update"
@@ -67,3 +69,27 @@ func (bc baseClient) SyncStatus(context.Context, string) ([]string, error) {
 func (bc baseClient) GitRepoConfig(context.Context, bool) (v6.GitConfig, error) {
 	return v6.GitConfig{}, remote.UpgradeNeededError(errors.New("GitRepoConfig method not implemented"))
 }
+
+func (bc baseClient) SyncPlan(context.Context) (v12.SyncPlan, error) {
+	return v12.SyncPlan{}, remote.UpgradeNeededError(errors.New("SyncPlan method not implemented"))
+}
+
+func (bc baseClient) DriftReport(context.Context) (v12.DriftReport, error) {
+	return v12.DriftReport{}, remote.UpgradeNeededError(errors.New("DriftReport method not implemented"))
+}
+
+func (bc baseClient) ListPendingReleases(context.Context) ([]v12.PendingRelease, error) {
+	return nil, remote.UpgradeNeededError(errors.New("ListPendingReleases method not implemented"))
+}
+
+func (bc baseClient) ApproveRelease(context.Context, job.ID, update.Cause) (job.ID, error) {
+	return "", remote.UpgradeNeededError(errors.New("ApproveRelease method not implemented"))
+}
+
+func (bc baseClient) ListFreezes(context.Context) ([]freeze.Freeze, error) {
+	return nil, remote.UpgradeNeededError(errors.New("ListFreezes method not implemented"))
+}
+
+func (bc baseClient) SetFreeze(context.Context, freeze.Freeze) error {
+	return remote.UpgradeNeededError(errors.New("SetFreeze method not implemented"))
+}
@@ -0,0 +1,111 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net/rpc"
+
+	"github.com/weaveworks/flux/api/v12"
+	"github.com/weaveworks/flux/freeze"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/remote"
+	"github.com/weaveworks/flux/update"
+)
+
+// RPCClientV12 is the rpc-backed implementation of a server, for
+// talking to remote daemons. This version introduces SyncPlan,
+// DriftReport, ListPendingReleases, ApproveRelease, ListFreezes and
+// SetFreeze.
+type RPCClientV12 struct {
+	*RPCClientV11
+}
+
+type clientV12 interface {
+	v12.Server
+	v12.Upstream
+}
+
+var _ clientV12 = &RPCClientV12{}
+
+// NewClientV12 creates a new rpc-backed implementation of the server.
+func NewClientV12(conn io.ReadWriteCloser) *RPCClientV12 {
+	return &RPCClientV12{NewClientV11(conn)}
+}
+
+func (p *RPCClientV12) SyncPlan(ctx context.Context) (v12.SyncPlan, error) {
+	var resp SyncPlanResponse
+	err := p.client.Call("RPCServer.SyncPlan", struct{}{}, &resp)
+	if err != nil {
+		if _, ok := err.(rpc.ServerError); !ok && err != nil {
+			err = remote.FatalError{err}
+		}
+	} else if resp.ApplicationError != nil {
+		err = resp.ApplicationError
+	}
+	return resp.Result, err
+}
+
+func (p *RPCClientV12) DriftReport(ctx context.Context) (v12.DriftReport, error) {
+	var resp DriftReportResponse
+	err := p.client.Call("RPCServer.DriftReport", struct{}{}, &resp)
+	if err != nil {
+		if _, ok := err.(rpc.ServerError); !ok && err != nil {
+			err = remote.FatalError{err}
+		}
+	} else if resp.ApplicationError != nil {
+		err = resp.ApplicationError
+	}
+	return resp.Result, err
+}
+
+func (p *RPCClientV12) ListPendingReleases(ctx context.Context) ([]v12.PendingRelease, error) {
+	var resp ListPendingReleasesResponse
+	err := p.client.Call("RPCServer.ListPendingReleases", struct{}{}, &resp)
+	if err != nil {
+		if _, ok := err.(rpc.ServerError); !ok && err != nil {
+			err = remote.FatalError{err}
+		}
+	} else if resp.ApplicationError != nil {
+		err = resp.ApplicationError
+	}
+	return resp.Result, err
+}
+
+func (p *RPCClientV12) ApproveRelease(ctx context.Context, id job.ID, cause update.Cause) (job.ID, error) {
+	var resp ApproveReleaseResponse
+	err := p.client.Call("RPCServer.ApproveRelease", ApproveReleaseRequest{ID: id, Cause: cause}, &resp)
+	if err != nil {
+		if _, ok := err.(rpc.ServerError); !ok && err != nil {
+			err = remote.FatalError{err}
+		}
+	} else if resp.ApplicationError != nil {
+		err = resp.ApplicationError
+	}
+	return resp.Result, err
+}
+
+func (p *RPCClientV12) ListFreezes(ctx context.Context) ([]freeze.Freeze, error) {
+	var resp ListFreezesResponse
+	err := p.client.Call("RPCServer.ListFreezes", struct{}{}, &resp)
+	if err != nil {
+		if _, ok := err.(rpc.ServerError); !ok && err != nil {
+			err = remote.FatalError{err}
+		}
+	} else if resp.ApplicationError != nil {
+		err = resp.ApplicationError
+	}
+	return resp.Result, err
+}
+
+func (p *RPCClientV12) SetFreeze(ctx context.Context, f freeze.Freeze) error {
+	var resp SetFreezeResponse
+	err := p.client.Call("RPCServer.SetFreeze", f, &resp)
+	if err != nil {
+		if _, ok := err.(rpc.ServerError); !ok && err != nil {
+			err = remote.FatalError{err}
+		}
+	} else if resp.ApplicationError != nil {
+		err = resp.ApplicationError
+	}
+	return err
+}
@@ -181,6 +181,7 @@ func listImagesWithOptions(ctx context.Context, client listImagesWithoutOptionsC
 			if err != nil {
 				return statuses, err
 			}
+			newContainer.Init = container.Init
 			statuses[i].Containers[j] = newContainer
 		}
 	}
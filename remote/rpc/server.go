@@ -7,6 +7,7 @@ import (
 	"net/rpc/jsonrpc"
 
 	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v12"
 
 	"github.com/pkg/errors"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
 	fluxerr "github.com/weaveworks/flux/errors"
+	"github.com/weaveworks/flux/freeze"
 	"github.com/weaveworks/flux/job"
 	"github.com/weaveworks/flux/update"
 )
@@ -196,3 +198,108 @@ func (p *RPCServer) GitRepoConfig(regenerate bool, resp *GitRepoConfigResponse)
 	}
 	return err
 }
+
+type SyncPlanResponse struct {
+	Result           v12.SyncPlan
+	ApplicationError *fluxerr.Error
+}
+
+func (p *RPCServer) SyncPlan(_ struct{}, resp *SyncPlanResponse) error {
+	v, err := p.s.SyncPlan(context.Background())
+	resp.Result = v
+	if err != nil {
+		if err, ok := errors.Cause(err).(*fluxerr.Error); ok {
+			resp.ApplicationError = err
+			return nil
+		}
+	}
+	return err
+}
+
+type DriftReportResponse struct {
+	Result           v12.DriftReport
+	ApplicationError *fluxerr.Error
+}
+
+func (p *RPCServer) DriftReport(_ struct{}, resp *DriftReportResponse) error {
+	v, err := p.s.DriftReport(context.Background())
+	resp.Result = v
+	if err != nil {
+		if err, ok := errors.Cause(err).(*fluxerr.Error); ok {
+			resp.ApplicationError = err
+			return nil
+		}
+	}
+	return err
+}
+
+type ListPendingReleasesResponse struct {
+	Result           []v12.PendingRelease
+	ApplicationError *fluxerr.Error
+}
+
+func (p *RPCServer) ListPendingReleases(_ struct{}, resp *ListPendingReleasesResponse) error {
+	v, err := p.s.ListPendingReleases(context.Background())
+	resp.Result = v
+	if err != nil {
+		if err, ok := errors.Cause(err).(*fluxerr.Error); ok {
+			resp.ApplicationError = err
+			return nil
+		}
+	}
+	return err
+}
+
+type ApproveReleaseRequest struct {
+	ID    job.ID
+	Cause update.Cause
+}
+
+type ApproveReleaseResponse struct {
+	Result           job.ID
+	ApplicationError *fluxerr.Error
+}
+
+func (p *RPCServer) ApproveRelease(req ApproveReleaseRequest, resp *ApproveReleaseResponse) error {
+	v, err := p.s.ApproveRelease(context.Background(), req.ID, req.Cause)
+	resp.Result = v
+	if err != nil {
+		if err, ok := errors.Cause(err).(*fluxerr.Error); ok {
+			resp.ApplicationError = err
+			return nil
+		}
+	}
+	return err
+}
+
+type ListFreezesResponse struct {
+	Result           []freeze.Freeze
+	ApplicationError *fluxerr.Error
+}
+
+func (p *RPCServer) ListFreezes(_ struct{}, resp *ListFreezesResponse) error {
+	v, err := p.s.ListFreezes(context.Background())
+	resp.Result = v
+	if err != nil {
+		if err, ok := errors.Cause(err).(*fluxerr.Error); ok {
+			resp.ApplicationError = err
+			return nil
+		}
+	}
+	return err
+}
+
+type SetFreezeResponse struct {
+	ApplicationError *fluxerr.Error
+}
+
+func (p *RPCServer) SetFreeze(f freeze.Freeze, resp *SetFreezeResponse) error {
+	err := p.s.SetFreeze(context.Background(), f)
+	if err != nil {
+		if err, ok := errors.Cause(err).(*fluxerr.Error); ok {
+			resp.ApplicationError = err
+			return nil
+		}
+	}
+	return err
+}
@@ -17,6 +17,9 @@ type Resource interface {
 type Container struct {
 	Name  string
 	Image image.Ref
+	// Init is true for containers that are run to completion before
+	// the others are started (e.g., Kubernetes' init containers).
+	Init bool
 }
 
 type Workload interface {
@@ -27,3 +30,17 @@ type Workload interface {
 	// effect on any underlying file or cluster resource.
 	SetContainerImage(container string, ref image.Ref) error
 }
+
+// Immutable is implemented by workloads whose images can't be changed
+// once they're created (e.g., Kubernetes Jobs). Their images are
+// listed, but they aren't automated or released to.
+type Immutable interface {
+	Immutable() bool
+}
+
+// IsImmutable says whether the resource given is a workload whose
+// images can't be changed.
+func IsImmutable(res Resource) bool {
+	im, ok := res.(Immutable)
+	return ok && im.Immutable()
+}
@@ -9,32 +9,66 @@ import (
 	"github.com/weaveworks/flux/resource"
 )
 
-// Sync synchronises the cluster to the files in a directory
-func Sync(logger log.Logger, m cluster.Manifests, repoResources map[string]resource.Resource, clus cluster.Cluster,
-	deletes bool) error {
+// Sync synchronises the cluster to the files in a directory. The
+// resources applied are marked as belonging to `source`; if `gc` is
+// true, resources that were previously synced from that source, but
+// are no longer present in the files, are deleted. The outcome for
+// each resource synced (including those deleted) is returned, even if
+// there are errors applying others.
+func Sync(logger log.Logger, m cluster.Manifests, source string, repoResources map[string]resource.Resource, clus cluster.Cluster,
+	gc bool) (cluster.SyncResult, error) {
+	sync, err := prepareSync(logger, m, source, repoResources, clus, gc)
+	if err != nil {
+		return nil, err
+	}
+	return clus.Sync(sync)
+}
+
+// Plan works out what Sync would do, given the same arguments,
+// without changing anything in the cluster.
+func Plan(logger log.Logger, m cluster.Manifests, source string, repoResources map[string]resource.Resource, clus cluster.Cluster,
+	gc bool) (cluster.SyncPlan, error) {
+	sync, err := prepareSync(logger, m, source, repoResources, clus, gc)
+	if err != nil {
+		return nil, err
+	}
+	return clus.PlanSync(sync)
+}
+
+func prepareSync(logger log.Logger, m cluster.Manifests, source string, repoResources map[string]resource.Resource, clus cluster.Cluster,
+	gc bool) (cluster.SyncDef, error) {
+	sync := cluster.SyncDef{Source: source}
+
 	// Get a map of resources defined in the cluster
 	clusterBytes, err := clus.Export()
 
 	if err != nil {
-		return errors.Wrap(err, "exporting resource defs from cluster")
+		return sync, errors.Wrap(err, "exporting resource defs from cluster")
 	}
 	clusterResources, err := m.ParseManifests(clusterBytes)
 	if err != nil {
-		return errors.Wrap(err, "parsing exported resources")
+		return sync, errors.Wrap(err, "parsing exported resources")
 	}
 
-	// Everything that's in the cluster but not in the repo, delete;
-	// everything that's in the repo, apply. This is an approximation
+	// Everything that's in the repo, apply. This is an approximation
 	// to figuring out what's changed, and applying that. We're
 	// relying on Kubernetes to decide for each application if it is a
 	// no-op.
-	sync := cluster.SyncDef{}
 
-	// DANGER ZONE (tamara) This works and is dangerous. At the moment will delete Flux and
-	// other pods unless the relevant manifests are part of the user repo. Needs a lot of thought
-	// before this cleanup cluster feature can be unleashed on the world.
-	if deletes {
-		for id, res := range clusterResources {
+	// Only resources that we have marked as coming from this source
+	// are candidates for deletion; anything else in the cluster
+	// (including fluxd itself, unless it was synced from the repo) is
+	// left alone.
+	if gc {
+		syncedBytes, err := clus.ExportSynced(source)
+		if err != nil {
+			return sync, errors.Wrap(err, "exporting synced resource defs from cluster")
+		}
+		syncedResources, err := m.ParseManifests(syncedBytes)
+		if err != nil {
+			return sync, errors.Wrap(err, "parsing exported synced resources")
+		}
+		for id, res := range syncedResources {
 			prepareSyncDelete(logger, repoResources, id, res, &sync)
 		}
 	}
@@ -42,8 +76,7 @@ func Sync(logger log.Logger, m cluster.Manifests, repoResources map[string]resou
 	for id, res := range repoResources {
 		prepareSyncApply(logger, clusterResources, id, res, &sync)
 	}
-
-	return clus.Sync(sync)
+	return sync, nil
 }
 
 func prepareSyncDelete(logger log.Logger, repoResources map[string]resource.Resource, id string, res resource.Resource, sync *cluster.SyncDef) {
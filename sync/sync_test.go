@@ -32,7 +32,7 @@ func TestSync(t *testing.T) {
 	// Start with nothing running. We should be told to apply all the things.
 	mockCluster := &cluster.Mock{}
 	manifests := &kubernetes.Manifests{}
-	var clus cluster.Cluster = &syncCluster{mockCluster, map[string][]byte{}}
+	var clus cluster.Cluster = &syncCluster{mockCluster, map[string][]byte{}, map[string]string{}}
 
 	dirs := checkout.ManifestDirs()
 	resources, err := manifests.LoadManifests(checkout.Dir(), dirs)
@@ -40,7 +40,7 @@ func TestSync(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := Sync(log.NewNopLogger(), manifests, resources, clus, true); err != nil {
+	if _, err := Sync(log.NewNopLogger(), manifests, testSource, resources, clus, true); err != nil {
 		t.Fatal(err)
 	}
 	checkClusterMatchesFiles(t, manifests, clus, checkout.Dir(), dirs)
@@ -60,12 +60,67 @@ func TestSync(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := Sync(log.NewNopLogger(), manifests, resources, clus, true); err != nil {
+	result, err := Sync(log.NewNopLogger(), manifests, testSource, resources, clus, true)
+	if err != nil {
 		t.Fatal(err)
 	}
+	if len(result.Deleted()) == 0 {
+		t.Error("expected deleted resources to be reported")
+	}
+	for id, outcome := range result {
+		if outcome != cluster.SyncDeleted && outcome != cluster.SyncUnchanged {
+			t.Errorf("expected %s to be unchanged, got %q", id, outcome)
+		}
+	}
 	checkClusterMatchesFiles(t, manifests, clus, checkout.Dir(), dirs)
 }
 
+func TestSyncLeavesUnmarkedResources(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+
+	manifests := &kubernetes.Manifests{}
+	clus := &syncCluster{&cluster.Mock{}, map[string][]byte{}, map[string]string{}}
+
+	dirs := checkout.ManifestDirs()
+	resources, err := manifests.LoadManifests(checkout.Dir(), dirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sync(log.NewNopLogger(), manifests, testSource, resources, clus, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Something that was applied by other means, and something that
+	// was applied from another source; neither should be deleted.
+	clus.resources["default:deployment/unmarked"] = []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: unmarked
+  namespace: default
+`)
+	clus.resources["default:deployment/other"] = []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: other
+  namespace: default
+`)
+	clus.sources["default:deployment/other"] = "other-source"
+
+	result, err := Sync(log.NewNopLogger(), manifests, testSource, resources, clus, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted := result.Deleted(); len(deleted) != 0 {
+		t.Errorf("expected nothing to be deleted, got %v", deleted)
+	}
+	for _, id := range []string{"default:deployment/unmarked", "default:deployment/other"} {
+		if _, ok := clus.resources[id]; !ok {
+			t.Errorf("expected %s to be left in the cluster", id)
+		}
+	}
+}
+
 func TestPrepareSyncDelete(t *testing.T) {
 	var tests = []struct {
 		msg      string
@@ -172,6 +227,8 @@ func TestPrepareSyncApply(t *testing.T) {
 
 // ---
 
+const testSource = "git@example.com:test/repo#master"
+
 var gitconf = git.Config{
 	SyncTag:   "test-sync",
 	NotesRef:  "test-notes",
@@ -198,22 +255,36 @@ func execCommand(cmd string, args ...string) error {
 type syncCluster struct {
 	*cluster.Mock
 	resources map[string][]byte
+	sources   map[string]string
 }
 
-func (p *syncCluster) Sync(def cluster.SyncDef) error {
+func (p *syncCluster) Sync(def cluster.SyncDef) (cluster.SyncResult, error) {
 	println("=== Syncing ===")
+	result := cluster.SyncResult{}
 	for _, action := range def.Actions {
 		if action.Delete != nil {
 			println("Deleting " + action.Delete.ResourceID().String())
 			delete(p.resources, action.Delete.ResourceID().String())
+			delete(p.sources, action.Delete.ResourceID().String())
+			result[action.Delete.ResourceID()] = cluster.SyncDeleted
 		}
 		if action.Apply != nil {
 			println("Applying " + action.Apply.ResourceID().String())
-			p.resources[action.Apply.ResourceID().String()] = action.Apply.Bytes()
+			id := action.Apply.ResourceID().String()
+			switch existing, ok := p.resources[id]; {
+			case !ok:
+				result[action.Apply.ResourceID()] = cluster.SyncCreated
+			case bytes.Equal(existing, action.Apply.Bytes()):
+				result[action.Apply.ResourceID()] = cluster.SyncUnchanged
+			default:
+				result[action.Apply.ResourceID()] = cluster.SyncConfigured
+			}
+			p.resources[id] = action.Apply.Bytes()
+			p.sources[id] = def.Source
 		}
 	}
 	println("=== Done syncing ===")
-	return nil
+	return result, nil
 }
 
 func (p *syncCluster) Export() ([]byte, error) {
@@ -226,6 +297,16 @@ func (p *syncCluster) Export() ([]byte, error) {
 	return bytes.Join(configs, []byte("\n---\n")), nil
 }
 
+func (p *syncCluster) ExportSynced(source string) ([]byte, error) {
+	var configs [][]byte
+	for id, config := range p.resources {
+		if p.sources[id] == source {
+			configs = append(configs, config)
+		}
+	}
+	return bytes.Join(configs, []byte("\n---\n")), nil
+}
+
 func resourcesToStrings(resources map[string]resource.Resource) map[string]string {
 	res := map[string]string{}
 	for k, r := range resources {
@@ -103,10 +103,11 @@ func (a *Automated) calculateImageUpdates(rc ReleaseContext, candidates []*Contr
 					continue
 				}
 
-				// We transplant the tag here, to make sure we keep
-				// the format of the image name as it is in the
-				// resource (e.g., to avoid canonicalising it)
-				newImageID := currentImageID.WithNewTag(change.ImageID.Tag)
+				// We transplant the tag (and digest, if pinned) here,
+				// to make sure we keep the format of the image name as
+				// it is in the resource (e.g., to avoid canonicalising
+				// it)
+				newImageID := currentImageID.WithNewTag(change.ImageID.Tag).WithDigest(change.ImageID.Digest)
 				containerUpdates = append(containerUpdates, ContainerUpdate{
 					Container: container.Name,
 					Current:   currentImageID,
@@ -4,10 +4,12 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
 )
 
 const (
 	Locked               = "locked"
+	Frozen               = "frozen"
 	NotIncluded          = "not included"
 	Excluded             = "excluded"
 	DifferentImage       = "a different image"
@@ -15,6 +17,8 @@ const (
 	NotInRepo            = "not found in repository"
 	ImageNotFound        = "cannot find one or more images"
 	ImageUpToDate        = "image(s) up to date"
+	DigestNotKnown       = "image(s) pinned, but digest of latest image not known"
+	Immutable            = "image(s) cannot be changed once created"
 	DoesNotUseImage      = "does not use image(s)"
 	ContainerNotFound    = "container(s) not found: %s"
 	ContainerTagMismatch = "container(s) tag mismatch: %s"
@@ -89,3 +93,34 @@ func (f *LockedFilter) Filter(u ControllerUpdate) ControllerResult {
 	}
 	return ControllerResult{}
 }
+
+// FrozenFilter skips controllers in namespaces in which releases are
+// frozen, according to the func given.
+type FrozenFilter struct {
+	Frozen func(namespace string) bool
+}
+
+func (f *FrozenFilter) Filter(u ControllerUpdate) ControllerResult {
+	if ns, _, _ := u.ResourceID.Components(); f.Frozen(ns) {
+		return ControllerResult{
+			Status: ReleaseStatusSkipped,
+			Error:  Frozen,
+		}
+	}
+	return ControllerResult{}
+}
+
+// ImmutableFilter skips workloads whose images can't be changed once
+// they have been created, e.g., Kubernetes Jobs.
+type ImmutableFilter struct {
+}
+
+func (f *ImmutableFilter) Filter(u ControllerUpdate) ControllerResult {
+	if resource.IsImmutable(u.Resource) {
+		return ControllerResult{
+			Status: ReleaseStatusSkipped,
+			Error:  Immutable,
+		}
+	}
+	return ControllerResult{}
+}
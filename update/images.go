@@ -61,10 +61,11 @@ func (ii ImageInfos) FilterAndSort(pattern policy.Pattern) SortedImageInfos {
 }
 
 // FindWithRef returns image.Info given an image ref. If the image cannot be
-// found, it returns the image.Info with the ID provided.
+// found, it returns the image.Info with the ID provided. A ref pinned to a
+// digest is only found if the tag still has that digest.
 func (ii ImageInfos) FindWithRef(ref image.Ref) image.Info {
 	for _, img := range ii {
-		if img.ID == ref {
+		if img.ID == ref.WithDigest("") && (ref.Digest == "" || ref.Digest == img.Digest) {
 			return img
 		}
 	}
@@ -106,7 +107,7 @@ func filterImages(images []image.Info, pattern policy.Pattern) ImageInfos {
 	for _, i := range images {
 		tag := i.ID.Tag
 		// Ignore latest if and only if it's not what the user wants.
-		if pattern != policy.PatternLatest && strings.EqualFold(tag, "latest") {
+		if pattern.String() != policy.PatternLatest.String() && strings.EqualFold(tag, "latest") {
 			continue
 		}
 		if pattern.Matches(tag) {
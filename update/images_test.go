@@ -78,6 +78,28 @@ func TestImageInfos_Filter_semver(t *testing.T) {
 	assert.Equal(t, SortedImageInfos{semver1}, ii.FilterAndSort(policy.NewPattern("semver:~1")))
 }
 
+func TestImageInfos_FindWithRef_digest(t *testing.T) {
+	const digest = "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"
+	v1 := image.Info{ID: name.ToRef("v1"), Digest: digest, CreatedAt: time.Now()}
+	ii := ImageInfos{v1}
+
+	assert.Equal(t, v1, ii.FindWithRef(name.ToRef("v1")))
+	assert.Equal(t, v1, ii.FindWithRef(name.ToRef("v1").WithDigest(digest)))
+	// If the tag has moved, the pinned image is not the one in the list
+	moved := name.ToRef("v1").WithDigest("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4")
+	assert.Equal(t, image.Info{ID: moved}, ii.FindWithRef(moved))
+}
+
+func TestImageInfos_Filter_prerelease(t *testing.T) {
+	release := image.Info{ID: name.ToRef("1.2.3")}
+	rc := image.Info{ID: name.ToRef("1.2.4-rc.1")}
+	beta := image.Info{ID: name.ToRef("1.2.4-beta.1")}
+
+	ii := ImageInfos{release, rc, beta}
+	assert.Equal(t, SortedImageInfos{release}, ii.FilterAndSort(policy.NewPattern("semver:~1.2")))
+	assert.Equal(t, SortedImageInfos{rc, release}, ii.FilterAndSort(policy.NewPattern("semver:~1.2 prerelease=rc")))
+}
+
 func TestAvail(t *testing.T) {
 	m := ImageRepos{imageReposMap{name: infos}}
 	avail := m.GetRepoImages(mustParseName("weaveworks/goodbyeworld"))
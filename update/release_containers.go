@@ -72,7 +72,7 @@ func (s ReleaseContainersSpec) filters() ([]ControllerFilter, []ControllerFilter
 func (s ReleaseContainersSpec) controllerUpdates(results Result, all []*ControllerUpdate) []*ControllerUpdate {
 	var updates []*ControllerUpdate
 	for _, u := range all {
-		cs, err := u.Controller.ContainersOrError()
+		cs, err := u.Containers()
 		if err != nil {
 			results[u.ResourceID] = ControllerResult{
 				Status: ReleaseStatusFailed,
@@ -207,7 +207,7 @@ func (s ReleaseImageSpec) calculateImageUpdates(rc ReleaseContext, candidates []
 	// image that could be updated.
 	var updates []*ControllerUpdate
 	for _, u := range candidates {
-		containers, err := u.Controller.ContainersOrError()
+		containers, err := u.Containers()
 		if err != nil {
 			results[u.ResourceID] = ControllerResult{
 				Status: ReleaseStatusFailed,
@@ -221,6 +221,12 @@ func (s ReleaseImageSpec) calculateImageUpdates(rc ReleaseContext, candidates []
 		// for the purpose of filtering the output.
 		ignoredOrSkipped := ReleaseStatusIgnored
 		var containerUpdates []ContainerUpdate
+		// If the images are pinned, a tag that has been moved to a
+		// different image counts as a new image.
+		pinned := policy.PinsDigest(u.Resource.Policy())
+		// Set if a container is skipped because the digest to pin its
+		// image to isn't known
+		var digestNotKnown bool
 
 		for _, container := range containers {
 			currentImageID := container.Image
@@ -233,6 +239,7 @@ func (s ReleaseImageSpec) calculateImageUpdates(rc ReleaseContext, candidates []
 					tagPattern = policy.NewPattern(pattern)
 				}
 			}
+			tagPattern = policy.WithSortOrder(tagPattern, u.Resource.Policy())
 
 			filteredImages := imageRepos.GetRepoImages(currentImageID.Name).FilterAndSort(tagPattern)
 			latestImage, ok := filteredImages.Latest()
@@ -245,15 +252,22 @@ func (s ReleaseImageSpec) calculateImageUpdates(rc ReleaseContext, candidates []
 				continue
 			}
 
-			if currentImageID == latestImage.ID {
-				ignoredOrSkipped = ReleaseStatusSkipped
-				continue
-			}
-
 			// We want to update the image with respect to the form it
 			// appears in the manifest, whereas what we have is the
 			// canonical form.
 			newImageID := currentImageID.WithNewTag(latestImage.ID.Tag)
+			if pinned {
+				if latestImage.Digest == "" {
+					digestNotKnown = true
+					continue
+				}
+				newImageID = newImageID.WithDigest(latestImage.Digest)
+			}
+
+			if currentImageID.Tag == newImageID.Tag && (!pinned || currentImageID.Digest == newImageID.Digest) {
+				ignoredOrSkipped = ReleaseStatusSkipped
+				continue
+			}
 			containerUpdates = append(containerUpdates, ContainerUpdate{
 				Container: container.Name,
 				Current:   currentImageID,
@@ -269,6 +283,11 @@ func (s ReleaseImageSpec) calculateImageUpdates(rc ReleaseContext, candidates []
 				Status:       ReleaseStatusSuccess,
 				PerContainer: containerUpdates,
 			}
+		case digestNotKnown:
+			results[u.ResourceID] = ControllerResult{
+				Status: ReleaseStatusSkipped,
+				Error:  DigestNotKnown,
+			}
 		case ignoredOrSkipped == ReleaseStatusSkipped:
 			results[u.ResourceID] = ControllerResult{
 				Status: ReleaseStatusSkipped,
@@ -14,6 +14,29 @@ type ControllerUpdate struct {
 	Updates      []ContainerUpdate
 }
 
+// Containers gives the containers running in the cluster that can
+// be updated; that is, those that are also in the manifest.
+// Containers that appear only in the cluster (e.g., sidecars injected
+// by an admission controller) are left out, since there's nothing
+// to update for them.
+func (s *ControllerUpdate) Containers() ([]resource.Container, error) {
+	containers, err := s.Controller.ContainersOrError()
+	if err != nil || s.Resource == nil {
+		return containers, err
+	}
+	inManifest := map[string]bool{}
+	for _, c := range s.Resource.Containers() {
+		inManifest[c.Name] = true
+	}
+	var result []resource.Container
+	for _, c := range containers {
+		if inManifest[c.Name] {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
 type ControllerFilter interface {
 	Filter(ControllerUpdate) ControllerResult
 }